@@ -4,19 +4,34 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
 	_ "rcodegen/pkg/executor" // Register dispatcher factory via init()
 	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/server"
 	"rcodegen/pkg/settings"
+	"rcodegen/pkg/workspace"
 )
 
 func main() {
+	s, _ := settings.LoadWithFallback()
+	if s != nil {
+		bundle.DisableBuiltins(s.DisableBuiltins)
+	}
+
 	if len(os.Args) < 2 {
-		printUsage()
-		os.Exit(1)
+		// Scripts and CI can run the configured default bundle with no arguments
+		if s == nil || s.DefaultBundle == "" || stdinIsTerminal() {
+			printUsage()
+			os.Exit(1)
+		}
+		os.Args = append(os.Args, "bundle")
 	}
 
 	switch os.Args[1] {
@@ -24,6 +39,10 @@ func main() {
 		runBundle()
 	case "list":
 		listBundles()
+	case "init":
+		initBundles()
+	case "compare":
+		compareRuns()
 	case "help", "-h", "--help":
 		printUsage()
 	default:
@@ -36,8 +55,8 @@ func main() {
 func runBundle() {
 	// Pre-process args to separate flags from positional args
 	// This allows flags like --opus-only to appear anywhere
-	// Flags that take values: -c
-	flagsWithValues := map[string]bool{"-c": true}
+	// Flags that take values: -c, --timeout, --monitor, --model, --socket, --resume
+	flagsWithValues := map[string]bool{"-c": true, "--timeout": true, "-timeout": true, "--monitor": true, "-monitor": true, "--model": true, "-model": true, "--socket": true, "-socket": true, "--resume": true, "-resume": true}
 
 	var flagArgs, positionalArgs []string
 	args := os.Args[2:]
@@ -58,18 +77,35 @@ func runBundle() {
 	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
 	codebase := fs.String("c", "", "Codebase path")
 	jsonOutput := fs.Bool("j", false, "Output JSON")
+	events := fs.Bool("events", false, "Stream run events to stdout as JSON lines instead of the display")
 	liveMode := fs.Bool("live", true, "Enable animated live display (default: true)")
 	staticMode := fs.Bool("static", false, "Use static display instead of animated")
+	noAnimation := fs.Bool("no-animation", false, "Print a plain line per step instead of animating, even on a terminal")
 	opusOnly := fs.Bool("opus-only", false, "Force all Claude steps to use Opus model")
 	flashOnly := fs.Bool("flash", false, "Force all Gemini steps to use flash preview model")
+	timeout := fs.Duration("timeout", 0, "Stop the whole run after this long (e.g. 30m), with a partial summary")
+	monitorAddr := fs.String("monitor", "", "Serve run status as JSON over HTTP on this address (e.g. :8080)")
+	socketPath := fs.String("socket", "", "Publish the final envelope to the Unix socket at this path (e.g. for an editor plugin)")
+	socketEvents := fs.Bool("socket-events", false, "Also publish every run event to --socket")
+	sandbox := fs.Bool("sandbox", false, "Run tools in a copy of the codebase and report what they changed")
+	useLock := fs.Bool("l", false, "Wait for other runs of the same bundle on the same codebase")
+	yes := fs.Bool("yes", false, "Skip the confirmation before expensive runs")
+	dryRun := fs.Bool("dry-run", false, "Print what each step would do without running anything")
+	resume := fs.String("resume", "", "Reuse the completed steps of a previous job (job ID or resume token)")
+	fs.BoolVar(dryRun, "n", false, "Print what each step would do without running anything")
+	toolModels := toolModelFlag{}
+	fs.Var(toolModels, "model", "Default model for a tool as tool=model (repeatable); steps with a model keep it")
 
 	fs.Parse(flagArgs)
 
-	if len(positionalArgs) == 0 {
-		fmt.Fprintln(os.Stderr, "Error: bundle name required")
+	// Load settings
+	s, _ := settings.LoadWithFallback()
+
+	bundleName, inputArgs, err := selectBundle(positionalArgs, s, stdinIsTerminal())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	bundleName := positionalArgs[0]
 
 	// Parse remaining args as inputs (key=value or positional task)
 	inputs := make(map[string]string)
@@ -77,7 +113,7 @@ func runBundle() {
 		inputs["codebase"] = expandPath(*codebase)
 	}
 
-	for _, arg := range positionalArgs[1:] {
+	for _, arg := range inputArgs {
 		if idx := strings.Index(arg, "="); idx != -1 {
 			inputs[arg[:idx]] = arg[idx+1:]
 		} else {
@@ -86,36 +122,105 @@ func runBundle() {
 		}
 	}
 
-	// Load settings
-	s, _ := settings.LoadWithFallback()
-
 	// Load bundle
-	b, err := bundle.Load(bundleName)
+	b, err := loadBundle(bundleName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Prompt for missing inputs when running interactively
+	if !*jsonOutput && !*events && stdinIsTerminal() {
+		inputs, err = orchestrator.CollectInputs(b, inputs, os.Stdin, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Run
 	orch := orchestrator.New(s)
 	// Live mode is default unless --static is set or -j (JSON) output is requested
 	if *liveMode && !*staticMode && !*jsonOutput {
 		orch.SetLiveMode(true)
 	}
+	if *noAnimation {
+		orch.SetNoAnimation(true)
+	}
 	if *opusOnly {
 		orch.SetOpusOnly(true)
 	}
 	if *flashOnly {
 		orch.SetFlashOnly(true)
 	}
+	if *timeout > 0 {
+		orch.SetTimeout(*timeout)
+	}
+	if *useLock {
+		orch.SetLock(true)
+	}
+	if len(toolModels) > 0 {
+		orch.SetToolModels(toolModels)
+	}
+	if *sandbox {
+		orch.SetSandbox(true)
+	}
+	if *resume != "" {
+		orch.SetResume(resumeJob(*resume))
+	}
+	if !*yes && !*jsonOutput && !*events && stdinIsTerminal() {
+		orch.SetConfirm(os.Stdin, os.Stdout)
+	}
+	if *dryRun {
+		if *jsonOutput {
+			orch.SetDryRun(io.Discard) // The plan is in the JSON envelope
+		} else {
+			orch.SetDryRun(os.Stdout)
+		}
+	}
+	if *events {
+		orch.SetEventStream(os.Stdout)
+	}
+	if *monitorAddr != "" {
+		monitor := server.NewMonitor()
+		srv, err := server.Serve(*monitorAddr, monitor)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: starting monitor: %v\n", err)
+			os.Exit(1)
+		}
+		defer srv.Close()
+		orch.AddObserver(monitor)
+		monitor.SetController(orch.Controller())
+	}
+	var publisher *server.SocketPublisher
+	if *socketPath != "" {
+		publisher, err = server.DialSocket(*socketPath, *socketEvents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: connecting to socket: %v\n", err)
+			os.Exit(1)
+		}
+		orch.AddObserver(publisher)
+	}
 	env, err := orch.Run(b, inputs)
+	if publisher != nil {
+		publisher.PublishEnvelope(env)
+		publisher.Close()
+	}
 
 	if *jsonOutput {
 		json.NewEncoder(os.Stdout).Encode(env)
+	} else if changes, ok := env.Result["sandbox_changes"].(orchestrator.SandboxChanges); ok && !*events {
+		fmt.Printf("Sandbox %s: %d added, %d modified, %d deleted\n",
+			env.Result["sandbox_dir"], len(changes.Added), len(changes.Modified), len(changes.Deleted))
 	}
 
-	if err != nil || env.Status != "success" {
-		os.Exit(1)
+	// Exit code reflects the outcome for CI: 0 success, 1 failure,
+	// 2 partial, 3 budget exceeded, 4 timeout
+	if code := env.ExitCode(); code != envelope.ExitSuccess {
+		os.Exit(code)
+	}
+	if err != nil {
+		os.Exit(envelope.ExitFailure)
 	}
 }
 
@@ -132,28 +237,114 @@ func listBundles() {
 	}
 }
 
+func initBundles() {
+	dir, copied, err := bundle.InitUserBundles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(copied) == 0 {
+		fmt.Printf("%s already has every builtin bundle\n", dir)
+		return
+	}
+	fmt.Printf("Copied %d bundles to %s:\n", len(copied), dir)
+	for _, name := range copied {
+		fmt.Printf("  %s\n", name)
+	}
+}
+
+func compareRuns() {
+	if len(os.Args) != 4 {
+		fmt.Fprintln(os.Stderr, "Usage: rcodegen compare <job-a> <job-b>")
+		os.Exit(1)
+	}
+	diff, err := workspace.CompareRuns(os.Args[2], os.Args[3])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cost := orchestrator.DefaultCostFormatter
+	if s, _ := settings.LoadWithFallback(); s != nil {
+		cost = orchestrator.NewCostFormatter(s.Currency, s.Locale, s.CurrencyRate)
+	}
+	signed := func(usd float64) string {
+		if usd >= 0 {
+			return "+" + cost.Format(usd)
+		}
+		return cost.Format(usd)
+	}
+	signedDuration := func(d time.Duration) string {
+		if d >= 0 {
+			return "+" + d.Round(time.Second).String()
+		}
+		return d.Round(time.Second).String()
+	}
+	status := func(a, b string) string {
+		if a == "" {
+			a = "-"
+		}
+		if b == "" {
+			b = "-"
+		}
+		if a == b {
+			return a
+		}
+		return a + " -> " + b
+	}
+
+	fmt.Printf("Comparing %s runs: %s -> %s\n", diff.Bundle, diff.JobA, diff.JobB)
+	fmt.Printf("  Status:   %s\n", status(diff.StatusA, diff.StatusB))
+	fmt.Printf("  Cost:     %s -> %s (%s)\n", cost.Format(diff.CostA), cost.Format(diff.CostB), signed(diff.CostDelta))
+	fmt.Printf("  Duration: %s\n", signedDuration(diff.DurationDelta))
+	fmt.Println("\nSteps:")
+	for _, step := range diff.Steps {
+		fmt.Printf("  %-20s %-22s %10s %8s\n", step.Name, status(step.StatusA, step.StatusB),
+			signed(step.CostDelta), signedDuration(step.DurationDelta))
+	}
+}
+
 func printUsage() {
 	fmt.Println(`rcodegen - Multi-tool orchestrator
 
 Usage:
   rcodegen <bundle> [options] [inputs...]
+  rcodegen <file> [options] [inputs...]   Run the bundle in a .json or .yaml file (e.g. ./workflows/ci.yaml)
+  rcodegen [options] [inputs...]   Run default_bundle from settings (non-interactive)
   rcodegen list
+  rcodegen init   Copy the builtin bundles to ~/.rcodegen/bundles/ to edit
+  rcodegen compare <job-a> <job-b>
 
 Options:
   -c <path>      Codebase path (or run from within project directory)
   --opus-only    Force all Claude steps to use Opus model
   --flash        Force all Gemini steps to use flash preview model
+  --model <t=m>  Use model m for tool t's steps that set no model (repeatable)
   --static       Use static display instead of animated
+  --no-animation  Print a plain line per step (no spinner or cursor codes); automatic when output is not a terminal
+  --timeout <d>  Stop the run after duration d (e.g. 30m), printing a partial summary
+  --monitor <a>  Serve run status JSON at http://<a>/status (e.g. :8080)
+  --socket <p>   Send the final envelope as length-prefixed JSON to Unix socket p
+  --socket-events  Also send every run event to --socket
+  --events       Print every run event to stdout as a line of JSON, with no display or summary
+  --sandbox      Run tools in a copy of the codebase; the real one is left untouched
+  -l             Queue behind other runs of the same bundle on the same codebase
+  -n, --dry-run  Print each step's tool, model and resolved task without running anything
+  --resume <j>   Skip the steps job j (an ID or a failed run's resume_token) completed
+  --yes          Don't ask before runs estimated to cost confirm_above_usd or more
   -j             Output JSON
 
 Inputs:
   key=value      Named input (e.g., project_name=myapp)
   "text"         Positional argument becomes 'task' input
 
+Exit status:
+  0 success, 1 failure, 2 partial, 3 budget exceeded, 4 timeout
+
 Examples:
   rcodegen build-review-audit -c ~/projects/myapp "Add user authentication"
   rcodegen build-review-audit project_name=myapp "Build a CLI tool" --opus-only
-  rcodegen security-review -c ./myproject
+  rcodegen security-review -c ./myproject --model claude=haiku
   rcodegen list`)
 
 	// Show available bundles
@@ -171,6 +362,64 @@ Examples:
 	}
 }
 
+// loadBundle loads a bundle by name, or from a file when given a path to one
+func loadBundle(arg string) (*bundle.Bundle, error) {
+	if strings.HasSuffix(arg, ".json") || strings.HasSuffix(arg, ".yaml") || strings.HasSuffix(arg, ".yml") || strings.ContainsRune(arg, os.PathSeparator) {
+		return bundle.LoadFromPath(expandPath(arg))
+	}
+	return bundle.Load(arg)
+}
+
+// selectBundle splits the positional args into the bundle name and inputs.
+// When no bundle is named (no args, or the first is a key=value input) and
+// the session is non-interactive, the default bundle from settings is used.
+func selectBundle(positional []string, s *settings.Settings, interactive bool) (string, []string, error) {
+	if len(positional) > 0 && !strings.Contains(positional[0], "=") {
+		return positional[0], positional[1:], nil
+	}
+	if !interactive && s != nil && s.DefaultBundle != "" {
+		return s.DefaultBundle, positional, nil
+	}
+	return "", nil, fmt.Errorf("bundle name required")
+}
+
+// resumeJob returns the job a --resume value names: the job of a resume
+// token, or the value itself as a job ID or directory
+func resumeJob(value string) string {
+	if tok, err := orchestrator.ParseResumeToken(value); err == nil {
+		return tok.JobID
+	}
+	return value
+}
+
+// toolModelFlag collects repeated --model tool=model flags
+type toolModelFlag map[string]string
+
+func (f toolModelFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for tool, model := range f {
+		pairs = append(pairs, tool+"="+model)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f toolModelFlag) Set(value string) error {
+	tool, model, ok := strings.Cut(value, "=")
+	tool, model = strings.TrimSpace(tool), strings.TrimSpace(model)
+	if !ok || tool == "" || model == "" {
+		return fmt.Errorf("expected tool=model, got %q", value)
+	}
+	f[tool] = model
+	return nil
+}
+
+// stdinIsTerminal reports whether standard input is an interactive terminal
+func stdinIsTerminal() bool {
+	stat, err := os.Stdin.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
 func expandPath(path string) string {
 	if strings.HasPrefix(path, "~/") {
 		return os.Getenv("HOME") + path[1:]
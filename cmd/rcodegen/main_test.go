@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/settings"
+)
+
+func TestSelectBundle(t *testing.T) {
+	withDefault := &settings.Settings{DefaultBundle: "nightly-review"}
+
+	tests := []struct {
+		name        string
+		args        []string
+		s           *settings.Settings
+		interactive bool
+		wantBundle  string
+		wantInputs  []string
+		wantErr     bool
+	}{
+		{"named bundle", []string{"security-review", "task text"}, withDefault, false, "security-review", []string{"task text"}, false},
+		{"default when none given", nil, withDefault, false, "nightly-review", nil, false},
+		{"default keeps key=value inputs", []string{"project_name=app"}, withDefault, false, "nightly-review", []string{"project_name=app"}, false},
+		{"no default in interactive sessions", nil, withDefault, true, "", nil, true},
+		{"no default configured", nil, &settings.Settings{}, false, "", nil, true},
+		{"no settings", nil, nil, false, "", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name, inputs, err := selectBundle(tc.args, tc.s, tc.interactive)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("selectBundle error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if name != tc.wantBundle {
+				t.Errorf("bundle = %q, want %q", name, tc.wantBundle)
+			}
+			if len(inputs) != 0 || len(tc.wantInputs) != 0 {
+				if !reflect.DeepEqual(inputs, tc.wantInputs) {
+					t.Errorf("inputs = %q, want %q", inputs, tc.wantInputs)
+				}
+			}
+		})
+	}
+}
+
+func TestToolModelFlag(t *testing.T) {
+	f := toolModelFlag{}
+	for _, v := range []string{"claude=haiku", "gemini = gemini-flash", "claude=sonnet"} {
+		if err := f.Set(v); err != nil {
+			t.Fatalf("Set(%q): %v", v, err)
+		}
+	}
+	want := toolModelFlag{"claude": "sonnet", "gemini": "gemini-flash"}
+	if !reflect.DeepEqual(f, want) {
+		t.Errorf("flag = %v, want %v", f, want)
+	}
+	if got := f.String(); got != "claude=sonnet,gemini=gemini-flash" {
+		t.Errorf("String() = %q", got)
+	}
+
+	for _, bad := range []string{"claude", "=haiku", "claude=", ""} {
+		if err := f.Set(bad); err == nil {
+			t.Errorf("Set(%q) should fail", bad)
+		}
+	}
+}
+
+func TestResumeJob(t *testing.T) {
+	tok := orchestrator.ResumeToken{JobID: "20261016-101500-abcd1234", Bundle: "build", ResumeFrom: "implement"}
+	if got := resumeJob(tok.Encode()); got != tok.JobID {
+		t.Errorf("resumeJob(token) = %q, want %q", got, tok.JobID)
+	}
+	for _, job := range []string{"20261016-101500-abcd1234", "/tmp/jobs/20261016-101500-abcd1234"} {
+		if got := resumeJob(job); got != job {
+			t.Errorf("resumeJob(%q) = %q", job, got)
+		}
+	}
+}
@@ -1,3 +1,8 @@
 module rcodegen
 
 go 1.25.5
+
+require (
+	github.com/creack/pty v1.1.24
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -1,52 +1,175 @@
 package bundle
 
 type Bundle struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Inputs      []Input `json:"inputs,omitempty"`
-	Steps       []Step  `json:"steps"`
-	SourcePath  string  `json:"-"` // Path to bundle file (not serialized)
+	Name        string  `json:"name" yaml:"name"`
+	Description string  `json:"description" yaml:"description"`
+	Inputs      []Input `json:"inputs,omitempty" yaml:"inputs,omitempty"`
+	Steps       []Step  `json:"steps" yaml:"steps"`
+	SourcePath  string  `json:"-" yaml:"-"` // Path to bundle file (not serialized)
+
+	// Constants are bundle-wide values reusable as ${const.key}; they may
+	// reference inputs and other constants
+	Constants map[string]string `json:"constants,omitempty" yaml:"constants,omitempty"`
+
+	// TemplateEngine renders step tasks: "simple" ${...} substitution (default)
+	// or "go" for text/template with conditionals and ranges
+	TemplateEngine string `json:"template_engine,omitempty" yaml:"template_engine,omitempty"`
+
+	// StrictConditions fails the run when a step condition references
+	// something that cannot be resolved, instead of treating it as false
+	StrictConditions bool `json:"strict_conditions,omitempty" yaml:"strict_conditions,omitempty"`
+
+	// OnFailure runs once when a step fails, before the run returns its
+	// failure, e.g. to post a notification. It sees the failing step's name
+	// and error as ${failure.step} and ${failure.message}.
+	OnFailure *Step `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
 }
 
 type Input struct {
-	Name        string `json:"name"`
-	Required    bool   `json:"required"`
-	Description string `json:"description,omitempty"`
-	Default     string `json:"default,omitempty"`
+	Name        string `json:"name" yaml:"name"`
+	Required    bool   `json:"required" yaml:"required"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// ShowIf is a condition over earlier inputs (e.g. "${inputs.deploy} == 'yes'");
+	// the input is only prompted for, and only required, when it holds
+	ShowIf string `json:"show_if,omitempty" yaml:"show_if,omitempty"`
 }
 
 type Step struct {
-	Name string `json:"name"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"` // Shown under the step name in the displays
 
 	// Tool execution
-	Tool  string `json:"tool,omitempty"`  // claude, gemini, codex
-	Model string `json:"model,omitempty"`
-	Task  string `json:"task,omitempty"`
+	Tool  string `json:"tool,omitempty" yaml:"tool,omitempty"` // claude, gemini, codex
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+	Task  string `json:"task,omitempty" yaml:"task,omitempty"`
+
+	// ToolIf switches the tool or model when a condition holds, e.g. to a
+	// stronger model when an earlier step flagged the work as complex. The
+	// first rule whose condition holds wins; with none, Tool and Model apply.
+	ToolIf []ToolRule `json:"tool_if,omitempty" yaml:"tool_if,omitempty"`
+
+	// PromptFile is a .md file, relative to the bundle, whose body becomes
+	// the task; its YAML front matter (tool, model, description) overrides
+	// the step's own settings
+	PromptFile string `json:"prompt_file,omitempty" yaml:"prompt_file,omitempty"`
+
+	// OutputStream selects the primary output: "stdout" (default), "stderr", or "both"
+	OutputStream string `json:"output_stream,omitempty" yaml:"output_stream,omitempty"`
+	FailOnStderr bool   `json:"fail_on_stderr,omitempty" yaml:"fail_on_stderr,omitempty"` // Any stderr output fails the step, even on exit 0
+
+	// Output line filters (regexes): only lines matching OutputFilter and not
+	// matching OutputExclude are shown in the live display and stored
+	OutputFilter  string `json:"output_filter,omitempty" yaml:"output_filter,omitempty"`
+	OutputExclude string `json:"output_exclude,omitempty" yaml:"output_exclude,omitempty"`
+
+	// OnAbort decides what happens when the step is aborted while running:
+	// "fail" (default) stops the run, "continue" moves on to the next step
+	OnAbort string `json:"on_abort,omitempty" yaml:"on_abort,omitempty"`
+
+	// Timeout (a Go duration like "5m") kills the tool process of an attempt
+	// that runs longer and fails the step with TIMEOUT (empty = no limit)
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Cache reuses the result of an earlier successful run with the same
+	// tool, model, task and codebase git commit instead of running again
+	Cache bool `json:"cache,omitempty" yaml:"cache,omitempty"`
+
+	// Noop does nothing and records a success result: a labeled checkpoint or
+	// a join point after a parallel block that conditions can refer to
+	Noop bool `json:"noop,omitempty" yaml:"noop,omitempty"`
 
 	// Parallel execution
-	Parallel []Step `json:"parallel,omitempty"`
+	Parallel []Step `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+
+	// MaxConcurrency limits how many parallel substeps run at once, e.g. to
+	// stay under a provider's rate limit (0 = all at once)
+	MaxConcurrency int `json:"max_concurrency,omitempty" yaml:"max_concurrency,omitempty"`
+
+	// Loop: Do runs once per item of the list Foreach resolves to (a JSON
+	// array or one item per line), with the item available as ${item}
+	Foreach string `json:"foreach,omitempty" yaml:"foreach,omitempty"`
+	Do      *Step  `json:"do,omitempty" yaml:"do,omitempty"`
+	// Collect gathers every iteration's output, in item order, into the
+	// foreach step's "collected" result; merge steps read them as inputs
+	Collect bool `json:"collect,omitempty" yaml:"collect,omitempty"`
 
 	// Merge outputs
-	Merge *MergeDef `json:"merge,omitempty"`
+	Merge *MergeDef `json:"merge,omitempty" yaml:"merge,omitempty"`
 
 	// Vote/ensemble
-	Vote *VoteDef `json:"vote,omitempty"`
+	Vote *VoteDef `json:"vote,omitempty" yaml:"vote,omitempty"`
 
 	// Conditional
-	If   string `json:"if,omitempty"`
-	Then *Step  `json:"then,omitempty"`
-	Else *Step  `json:"else,omitempty"`
+	If   string `json:"if,omitempty" yaml:"if,omitempty"`
+	Then *Step  `json:"then,omitempty" yaml:"then,omitempty"`
+	Else *Step  `json:"else,omitempty" yaml:"else,omitempty"`
+
+	// PTY runs the tool on a pseudo-terminal, for CLIs that behave
+	// differently when their output is not a TTY (stderr is merged into stdout)
+	PTY bool `json:"pty,omitempty" yaml:"pty,omitempty"`
 
 	// Output
-	Save string `json:"save,omitempty"`
+	Save string `json:"save,omitempty" yaml:"save,omitempty"`
+
+	// Outputs writes fields of the step's result to their own files,
+	// keyed by field name (e.g. {"report": "report.md", "patch": "fix.patch"})
+	Outputs map[string]string `json:"outputs,omitempty" yaml:"outputs,omitempty"`
+
+	// Retry
+	Retry *RetryDef `json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	// RetryPromptSuffix is appended to the task of every retry, followed by
+	// why the previous attempt failed (e.g. "Your previous output was not
+	// valid JSON; try again.")
+	RetryPromptSuffix string `json:"retry_prompt_suffix,omitempty" yaml:"retry_prompt_suffix,omitempty"`
+
+	// SuccessWhen is a condition a tool step's own result must meet, e.g.
+	// "${steps.review.output} contains 'VERDICT:'"; a run that exits cleanly
+	// without meeting it fails with SUCCESS_CHECK_FAILED
+	SuccessWhen string `json:"success_when,omitempty" yaml:"success_when,omitempty"`
+
+	// EscalateTo lists stronger models to re-run the step on, in order,
+	// while its result fails SuccessWhen (e.g. ["sonnet", "opus"] after haiku)
+	EscalateTo []string `json:"escalate_to,omitempty" yaml:"escalate_to,omitempty"`
 }
 
+// ToolRule picks a step's tool or model when its condition holds, see
+// Step.ToolIf
+type ToolRule struct {
+	If    string `json:"if" yaml:"if"`
+	Tool  string `json:"tool,omitempty" yaml:"tool,omitempty"`   // Empty keeps the step's tool
+	Model string `json:"model,omitempty" yaml:"model,omitempty"` // With a tool, empty means that tool's default
+}
+
+// Step abort policies (Step.OnAbort)
+const (
+	OnAbortFail     = "fail"
+	OnAbortContinue = "continue"
+)
+
+// The strategies merge and vote steps accept
+var (
+	MergeStrategies = []string{"concat", "union", "dedupe"}
+	VoteStrategies  = []string{"majority", "unanimous", "ranked"}
+)
+
 type MergeDef struct {
-	Inputs   []string `json:"inputs"`
-	Strategy string   `json:"strategy"` // concat, union, dedupe
+	Inputs   []string `json:"inputs" yaml:"inputs"`
+	Strategy string   `json:"strategy" yaml:"strategy"` // concat, union, dedupe
 }
 
 type VoteDef struct {
-	Inputs   []string `json:"inputs"`
-	Strategy string   `json:"strategy"` // majority, unanimous, ranked
+	Inputs   []string `json:"inputs" yaml:"inputs"`
+	Strategy string   `json:"strategy" yaml:"strategy"` // majority, unanimous, ranked
+
+	// ReturnScores adds a per-candidate "scores" map to the vote result
+	ReturnScores bool `json:"return_scores,omitempty" yaml:"return_scores,omitempty"`
+}
+
+type RetryDef struct {
+	Max              int   `json:"max" yaml:"max"`                                                     // Re-runs allowed after the first attempt
+	RetryOnExitCodes []int `json:"retry_on_exit_codes,omitempty" yaml:"retry_on_exit_codes,omitempty"` // Only retry these exit codes (empty = any exit code)
+	BackoffMs        int   `json:"backoff_ms,omitempty" yaml:"backoff_ms,omitempty"`                   // Wait before the first re-run, doubling each time (0 = none)
 }
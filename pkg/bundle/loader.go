@@ -5,10 +5,15 @@ package bundle
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strings"
 )
 
 //go:embed builtin/*.json
@@ -31,6 +36,24 @@ func validateBundleName(name string) error {
 	return nil
 }
 
+// builtinsDisabled hides the embedded bundles from Load and List
+var builtinsDisabled bool
+
+// DisableBuiltins makes Load and List ignore the embedded builtin bundles, so
+// only bundles in ~/.rcodegen/bundles/ can be used
+func DisableBuiltins(disabled bool) {
+	builtinsDisabled = disabled
+}
+
+// bundleExtensions are the user bundle file extensions, in lookup order
+var bundleExtensions = []string{".json", ".yaml", ".yml"}
+
+// isYAMLFile reports whether path names a YAML bundle
+func isYAMLFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
 func Load(name string) (*Bundle, error) {
 	// Validate bundle name to prevent path traversal
 	if err := validateBundleName(name); err != nil {
@@ -42,17 +65,21 @@ func Load(name string) (*Bundle, error) {
 	if err != nil {
 		homeDir = os.Getenv("HOME") // Fallback for compatibility
 	}
-	userPath := filepath.Join(homeDir, ".rcodegen", "bundles", name+".json")
-	if data, err := os.ReadFile(userPath); err == nil {
-		var b Bundle
-		if err := json.Unmarshal(data, &b); err != nil {
-			return nil, fmt.Errorf("invalid bundle %s: %w", name, err)
+	for _, ext := range bundleExtensions {
+		userPath := filepath.Join(homeDir, ".rcodegen", "bundles", name+ext)
+		if data, err := os.ReadFile(userPath); err == nil {
+			b, err := parseBundleFile(data, userPath)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bundle %s: %w", name, err)
+			}
+			return b, nil
 		}
-		b.SourcePath = userPath
-		return &b, nil
 	}
 
 	// Try builtin bundles
+	if builtinsDisabled {
+		return nil, fmt.Errorf("bundle not found: %s (builtin bundles are disabled)", name)
+	}
 	data, err := builtinBundles.ReadFile("builtin/" + name + ".json")
 	if err != nil {
 		return nil, fmt.Errorf("bundle not found: %s", name)
@@ -62,11 +89,117 @@ func Load(name string) (*Bundle, error) {
 	if err := json.Unmarshal(data, &b); err != nil {
 		return nil, fmt.Errorf("invalid builtin bundle %s: %w", name, err)
 	}
+	if err := b.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid builtin bundle %s: %w", name, err)
+	}
 	// For builtin bundles, find the source path relative to the executable
 	b.SourcePath = findBuiltinBundlePath(name)
 	return &b, nil
 }
 
+// LoadFromPath loads the bundle in the file at path, such as one checked
+// into a repository, with the same validation as Load. Files ending in
+// .yaml or .yml are parsed as YAML, anything else as JSON. Prompt files
+// resolve relative to the bundle file.
+func LoadFromPath(path string) (*Bundle, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle path %s: %w", path, err)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle: %w", err)
+	}
+	b, err := parseBundleFile(data, abs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle %s: %w", path, err)
+	}
+	if err := validateBundleName(b.Name); err != nil {
+		return nil, fmt.Errorf("invalid bundle %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// parseBundleFile decodes and validates the bundle read from path, loading
+// its prompt files from path's directory
+func parseBundleFile(data []byte, path string) (*Bundle, error) {
+	var b Bundle
+	unmarshal := json.Unmarshal
+	if isYAMLFile(path) {
+		unmarshal = unmarshalYAML
+	}
+	if err := unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+	b.SourcePath = path
+	if err := loadPromptFiles(b.Steps, dirReader(filepath.Dir(path))); err != nil {
+		return nil, err
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// InitUserBundles creates ~/.rcodegen/bundles/, readable only by the user,
+// and copies the builtin bundles into it as editable starting points. A
+// bundle the user already has, in any format, is left alone. It returns the
+// directory and the names of the bundles copied.
+func InitUserBundles() (string, []string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		homeDir = os.Getenv("HOME") // Fallback for compatibility
+	}
+	userDir := filepath.Join(homeDir, ".rcodegen", "bundles")
+	if err := os.MkdirAll(userDir, 0700); err != nil {
+		return "", nil, fmt.Errorf("creating %s: %w", userDir, err)
+	}
+
+	entries, err := builtinBundles.ReadDir("builtin")
+	if err != nil {
+		return "", nil, err
+	}
+	var copied []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || userBundleExists(userDir, name) {
+			continue
+		}
+		data, err := builtinBundles.ReadFile("builtin/" + e.Name())
+		if err != nil {
+			return userDir, copied, err
+		}
+		// O_EXCL: never clobber a file that appeared since the check
+		f, err := os.OpenFile(filepath.Join(userDir, e.Name()), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return userDir, copied, err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return userDir, copied, fmt.Errorf("copying bundle %s: %w", name, err)
+		}
+		copied = append(copied, name)
+	}
+	return userDir, copied, nil
+}
+
+// userBundleExists reports whether dir has a bundle called name in any of
+// the bundle formats
+func userBundleExists(dir, name string) bool {
+	for _, ext := range bundleExtensions {
+		if _, err := os.Stat(filepath.Join(dir, name+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // findBuiltinBundlePath attempts to locate the source file for a builtin bundle
 // This is useful for copying the bundle to output directories
 func findBuiltinBundlePath(name string) string {
@@ -104,14 +237,17 @@ func findBuiltinBundlePath(name string) string {
 	return "builtin/" + name + ".json"
 }
 
+// List returns the names of the builtin and user bundles, sorted, each once
 func List() ([]string, error) {
 	var names []string
 
 	// List builtin
-	entries, _ := builtinBundles.ReadDir("builtin")
-	for _, e := range entries {
-		if filepath.Ext(e.Name()) == ".json" {
-			names = append(names, e.Name()[:len(e.Name())-5])
+	if !builtinsDisabled {
+		entries, _ := builtinBundles.ReadDir("builtin")
+		for _, e := range entries {
+			if filepath.Ext(e.Name()) == ".json" {
+				names = append(names, e.Name()[:len(e.Name())-5])
+			}
 		}
 	}
 
@@ -123,11 +259,15 @@ func List() ([]string, error) {
 	userDir := filepath.Join(homeDir, ".rcodegen", "bundles")
 	if entries, err := os.ReadDir(userDir); err == nil {
 		for _, e := range entries {
-			if filepath.Ext(e.Name()) == ".json" {
-				names = append(names, e.Name()[:len(e.Name())-5])
+			ext := filepath.Ext(e.Name())
+			if ext == ".json" || isYAMLFile(e.Name()) {
+				names = append(names, strings.TrimSuffix(e.Name(), ext))
 			}
 		}
 	}
 
-	return names, nil
+	// A user bundle overriding a builtin (or saved as both JSON and YAML) is
+	// listed once
+	sort.Strings(names)
+	return slices.Compact(names), nil
 }
@@ -1,6 +1,9 @@
 package bundle
 
 import (
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -79,3 +82,192 @@ func TestValidateBundleName(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadFromPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "workflows")
+	if err := os.MkdirAll(filepath.Join(dir, "prompts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"ci.json":           `{"name": "ci", "description": "Checks", "steps": [{"name": "review", "prompt_file": "prompts/review.md"}]}`,
+		"prompts/review.md": "---\ntool: claude\n---\nReview ${inputs.codebase}\n",
+		"broken.json":       `{"name": "broken", "steps": [{"name": "a"}]}`,
+		"badname.json":      `{"name": "../escape", "steps": [{"name": "a", "tool": "claude"}]}`,
+		"notjson.json":      `{"name": `,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := LoadFromPath(filepath.Join(dir, "ci.json"))
+	if err != nil {
+		t.Fatalf("LoadFromPath: %v", err)
+	}
+	if b.Name != "ci" || b.SourcePath != filepath.Join(dir, "ci.json") {
+		t.Errorf("got name %q source %q", b.Name, b.SourcePath)
+	}
+	if b.Steps[0].Tool != "claude" || !strings.Contains(b.Steps[0].Task, "Review ${inputs.codebase}") {
+		t.Errorf("prompt file should resolve relative to the bundle, got %+v", b.Steps[0])
+	}
+
+	for name, want := range map[string]string{
+		"broken.json":  "has nothing to run",
+		"badname.json": "invalid bundle name",
+		"notjson.json": "invalid bundle",
+		"missing.json": "reading bundle",
+	} {
+		if _, err := LoadFromPath(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadFromPath(%s) = %v, want an error containing %q", name, err, want)
+		}
+	}
+}
+
+func TestLoadFromPath_Relative(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "local.json"), []byte(`{"name": "local", "steps": [{"name": "a", "tool": "claude"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	b, err := LoadFromPath("local.json")
+	if err != nil {
+		t.Fatalf("LoadFromPath: %v", err)
+	}
+	if !filepath.IsAbs(b.SourcePath) {
+		t.Errorf("SourcePath should be absolute, got %q", b.SourcePath)
+	}
+}
+
+func TestDisableBuiltins(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "team.json"), []byte(`{"name": "team", "steps": [{"name": "a", "tool": "claude"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	builtin := "security-review"
+	if _, err := Load(builtin); err != nil {
+		t.Fatalf("builtin %s should load by default: %v", builtin, err)
+	}
+
+	DisableBuiltins(true)
+	t.Cleanup(func() { DisableBuiltins(false) })
+
+	if _, err := Load(builtin); err == nil || !strings.Contains(err.Error(), "builtin bundles are disabled") {
+		t.Errorf("Load(%q) with builtins disabled = %v, want a not found error", builtin, err)
+	}
+	if _, err := Load("team"); err != nil {
+		t.Errorf("user bundles should still load: %v", err)
+	}
+	names, _ := List()
+	if len(names) != 1 || names[0] != "team" {
+		t.Errorf("List() = %v, want only the user bundle", names)
+	}
+}
+
+func TestInitUserBundles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+
+	got, copied, err := InitUserBundles()
+	if err != nil {
+		t.Fatalf("InitUserBundles: %v", err)
+	}
+	if got != dir {
+		t.Errorf("dir = %q, want %q", got, dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("bundle dir mode = %v, want 0700", perm)
+	}
+	entries, _ := builtinBundles.ReadDir("builtin")
+	if len(copied) != len(entries) {
+		t.Fatalf("copied %v, want all %d builtins", copied, len(entries))
+	}
+	want, _ := builtinBundles.ReadFile("builtin/tdd.json")
+	if data, err := os.ReadFile(filepath.Join(dir, "tdd.json")); err != nil || string(data) != string(want) {
+		t.Errorf("tdd.json copy = %q, %v", data, err)
+	}
+	// The copies load like any user bundle
+	if _, err := Load("tdd"); err != nil {
+		t.Errorf("Load(tdd) after init: %v", err)
+	}
+
+	// Running it again copies nothing and keeps the user's edits
+	edited := `{"name": "tdd", "steps": [{"name": "mine", "tool": "claude"}]}`
+	if err := os.WriteFile(filepath.Join(dir, "tdd.json"), []byte(edited), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "summary.json"))
+	if err := os.WriteFile(filepath.Join(dir, "summary.yaml"), []byte("name: summary\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "compete.json"))
+
+	_, copied, err = InitUserBundles()
+	if err != nil {
+		t.Fatalf("second InitUserBundles: %v", err)
+	}
+	if len(copied) != 1 || copied[0] != "compete" {
+		t.Errorf("second run copied %v, want only the removed compete bundle", copied)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "tdd.json")); string(data) != edited {
+		t.Errorf("tdd.json was overwritten: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "summary.json")); !os.IsNotExist(err) {
+		t.Error("a bundle kept as YAML should not get a JSON copy")
+	}
+}
+
+func TestList_SortedAndDeduplicated(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := builtinBundles.ReadDir("builtin")
+	builtin := strings.TrimSuffix(entries[0].Name(), ".json")
+	// An override of a builtin, a bundle in both formats, and names that
+	// sort before and after the builtins
+	for _, file := range []string{builtin + ".json", "zz-team.json", "zz-team.yaml", "aa-first.yml", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("List() = %v, want sorted", names)
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("List() has %q more than once: %v", name, names)
+		}
+		seen[name] = true
+	}
+	for _, want := range []string{builtin, "zz-team", "aa-first"} {
+		if !seen[want] {
+			t.Errorf("List() = %v, missing %q", names, want)
+		}
+	}
+	if seen["notes"] {
+		t.Error("files that are not bundles should not be listed")
+	}
+	if len(names) != len(entries)+2 {
+		t.Errorf("List() has %d names, want the %d builtins and 2 user bundles", len(names), len(entries))
+	}
+}
@@ -0,0 +1,125 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PromptFront is the front matter of a prompt file: the step settings it
+// overrides
+type PromptFront struct {
+	Tool        string
+	Model       string
+	Description string
+}
+
+// ParsePromptFile splits a prompt file into its front matter and body. Front
+// matter is optional; when present it is a block of YAML "key: value" lines
+// between "---" lines at the top of the file, with keys tool, model and
+// description.
+func ParsePromptFile(data []byte) (PromptFront, string, error) {
+	var front PromptFront
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	rest, ok := strings.CutPrefix(text, "---\n")
+	if !ok {
+		return front, strings.TrimSpace(text), nil
+	}
+
+	header, body, ok := strings.Cut(rest, "\n---")
+	if !ok {
+		return front, "", fmt.Errorf("front matter is not closed with ---")
+	}
+	body = strings.TrimPrefix(body, "-") // Tolerate "----" as the closing line
+	for n, line := range strings.Split(header, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return front, "", fmt.Errorf("front matter line %d: expected key: value", n+2)
+		}
+		value = unquote(strings.TrimSpace(value))
+		switch strings.TrimSpace(key) {
+		case "tool":
+			front.Tool = value
+		case "model":
+			front.Model = value
+		case "description":
+			front.Description = value
+		default:
+			return front, "", fmt.Errorf("front matter line %d: unknown key %q (want tool, model or description)", n+2, strings.TrimSpace(key))
+		}
+	}
+	return front, strings.TrimSpace(body), nil
+}
+
+// unquote strips matching single or double quotes around a YAML scalar
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// loadPromptFiles sets the task of every step with a prompt file to the
+// file's body, applying its front matter over the step's own settings. read
+// loads a prompt file path relative to the bundle.
+func loadPromptFiles(steps []Step, read func(name string) ([]byte, error)) error {
+	for i := range steps {
+		if err := loadPromptFile(&steps[i], read); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPromptFile loads the prompt file of step and of its substeps
+func loadPromptFile(step *Step, read func(name string) ([]byte, error)) error {
+	if step.PromptFile != "" {
+		if step.Task != "" {
+			return fmt.Errorf("step %s sets both task and prompt_file", step.Name)
+		}
+		data, err := read(step.PromptFile)
+		if err != nil {
+			return fmt.Errorf("step %s: reading prompt file: %w", step.Name, err)
+		}
+		front, body, err := ParsePromptFile(data)
+		if err != nil {
+			return fmt.Errorf("step %s: prompt file %s: %w", step.Name, step.PromptFile, err)
+		}
+		step.Task = body
+		if front.Tool != "" {
+			step.Tool = front.Tool
+		}
+		if front.Model != "" {
+			step.Model = front.Model
+		}
+		if front.Description != "" {
+			step.Description = front.Description
+		}
+	}
+	if err := loadPromptFiles(step.Parallel, read); err != nil {
+		return err
+	}
+	for _, branch := range []*Step{step.Then, step.Else, step.Do} {
+		if branch != nil {
+			if err := loadPromptFile(branch, read); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dirReader reads prompt files relative to dir; absolute paths are read as is
+func dirReader(dir string) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return os.ReadFile(name)
+	}
+}
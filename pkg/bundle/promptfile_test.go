@@ -0,0 +1,107 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePromptFile(t *testing.T) {
+	data := "---\r\ntool: codex\r\nmodel: \"gpt-5\"\r\n# reviewed weekly\r\ndescription: Find flaky tests\r\n---\r\n\r\nFind the flaky tests in ${inputs.codebase}.\r\n"
+	front, body, err := ParsePromptFile([]byte(data))
+	if err != nil {
+		t.Fatalf("ParsePromptFile: %v", err)
+	}
+	if front.Tool != "codex" || front.Model != "gpt-5" || front.Description != "Find flaky tests" {
+		t.Errorf("front matter = %+v", front)
+	}
+	if body != "Find the flaky tests in ${inputs.codebase}." {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestParsePromptFile_NoFrontMatter(t *testing.T) {
+	front, body, err := ParsePromptFile([]byte("\nJust a prompt.\n"))
+	if err != nil {
+		t.Fatalf("ParsePromptFile: %v", err)
+	}
+	if front != (PromptFront{}) || body != "Just a prompt." {
+		t.Errorf("got %+v %q, want only a body", front, body)
+	}
+}
+
+func TestParsePromptFile_Errors(t *testing.T) {
+	for _, data := range []string{
+		"---\ntool: claude\nNo closing line",
+		"---\ntool claude\n---\nbody",
+		"---\ntemperature: 0.2\n---\nbody",
+	} {
+		if _, _, err := ParsePromptFile([]byte(data)); err == nil {
+			t.Errorf("ParsePromptFile(%q) should fail", data)
+		}
+	}
+}
+
+func TestLoad_PromptFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+	if err := os.MkdirAll(filepath.Join(dir, "prompts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"prompts/review.md": "---\ntool: gemini\nmodel: gemini-3-pro\n---\nReview ${inputs.codebase} for bugs.\n",
+		"prompts/fix.md":    "Fix what the review found.\n",
+		"prompt-bundle.json": `{"name": "prompt-bundle", "steps": [
+			{"name": "review", "tool": "claude", "model": "sonnet", "prompt_file": "prompts/review.md"},
+			{"name": "gate", "if": "true", "then": {"name": "fix", "tool": "codex", "prompt_file": "prompts/fix.md"}}
+		]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := Load("prompt-bundle")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	review := b.Steps[0]
+	if review.Tool != "gemini" || review.Model != "gemini-3-pro" {
+		t.Errorf("front matter should override the step, got tool=%s model=%s", review.Tool, review.Model)
+	}
+	if review.Task != "Review ${inputs.codebase} for bugs." {
+		t.Errorf("task = %q, want the prompt body", review.Task)
+	}
+	fix := b.Steps[1].Then
+	if fix.Tool != "codex" || fix.Task != "Fix what the review found." {
+		t.Errorf("branch prompt file not loaded: %+v", fix)
+	}
+}
+
+func TestLoad_PromptFileErrors(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	bundles := map[string]string{
+		"missing-prompt": `{"name": "missing-prompt", "steps": [{"name": "a", "tool": "claude", "prompt_file": "nope.md"}]}`,
+		"double-task":    `{"name": "double-task", "steps": [{"name": "a", "tool": "claude", "task": "hi", "prompt_file": "nope.md"}]}`,
+	}
+	for name, content := range bundles {
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Load("missing-prompt"); err == nil || !strings.Contains(err.Error(), "reading prompt file") {
+		t.Errorf("missing prompt file: got %v", err)
+	}
+	if _, err := Load("double-task"); err == nil || !strings.Contains(err.Error(), "both task and prompt_file") {
+		t.Errorf("task and prompt_file: got %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package bundle
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// stepRefPattern matches step references like ${steps.analyze.stdout}
+var stepRefPattern = regexp.MustCompile(`\$\{steps\.([^.}]+)`)
+
+// foreachIterationPattern matches the names foreach iterations run under
+var foreachIterationPattern = regexp.MustCompile(`^(.+)-[0-9]+$`)
+
+// Validate checks the bundle for problems that would make it impossible to
+// run: inputs without names, steps that don't set exactly one kind (tool,
+// parallel, foreach, merge, vote, then or noop), merge and vote inputs that
+// don't name earlier steps, and circular step references. Every problem
+// found is listed in the error.
+func (b *Bundle) Validate() error {
+	var problems []string
+	for i, in := range b.Inputs {
+		if strings.TrimSpace(in.Name) == "" {
+			problems = append(problems, fmt.Sprintf("input %d has no name", i+1))
+		}
+	}
+
+	v := &stepValidator{earlier: make(map[string]bool), foreachBases: make(map[string]bool)}
+	for i := range b.Steps {
+		v.check(&b.Steps[i], stepLabel(&b.Steps[i], i))
+	}
+	if b.OnFailure != nil {
+		v.check(b.OnFailure, "on_failure step")
+	}
+	problems = append(problems, v.problems...)
+
+	if err := checkStepCycles(b.Steps); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("%s", problems[0])
+	}
+	return fmt.Errorf("%d problems:\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+}
+
+// stepValidator checks steps in run order, tracking the names earlier steps
+// record results under
+type stepValidator struct {
+	earlier      map[string]bool
+	foreachBases map[string]bool // Iterations run as "<base>-<n>"
+	problems     []string
+}
+
+func (v *stepValidator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// check validates step, labeled for messages, and its nested steps
+func (v *stepValidator) check(step *Step, label string) {
+	var kinds []string
+	for _, kind := range []struct {
+		name string
+		set  bool
+	}{
+		{"tool", step.Tool != ""},
+		{"parallel", len(step.Parallel) > 0},
+		{"foreach", step.Foreach != ""},
+		{"merge", step.Merge != nil},
+		{"vote", step.Vote != nil},
+		{"then", step.Then != nil},
+		{"noop", step.Noop},
+	} {
+		if kind.set {
+			kinds = append(kinds, kind.name)
+		}
+	}
+	switch len(kinds) {
+	case 0:
+		v.addf("%s has nothing to run: set one of tool, parallel, foreach, merge, vote, then or noop", label)
+	case 1:
+	default:
+		v.addf("%s sets %s; a step must set exactly one of them", label, joinKinds(kinds))
+	}
+
+	if step.MaxConcurrency < 0 {
+		v.addf("%s has a negative max_concurrency", label)
+	}
+	if len(step.ToolIf) > 0 && step.Tool == "" {
+		v.addf("%s has tool_if but no default tool", label)
+	}
+	for i, rule := range step.ToolIf {
+		if strings.TrimSpace(rule.If) == "" {
+			v.addf("%s: tool_if rule %d has no if condition", label, i+1)
+		}
+		if rule.Tool == "" && rule.Model == "" {
+			v.addf("%s: tool_if rule %d sets neither tool nor model", label, i+1)
+		}
+	}
+	if step.SuccessWhen != "" && step.Tool == "" {
+		v.addf("%s has success_when but no tool", label)
+	}
+	if len(step.EscalateTo) > 0 && step.SuccessWhen == "" {
+		v.addf("%s has escalate_to but no success_when to decide when to escalate", label)
+	}
+	if step.Else != nil && step.Then == nil {
+		v.addf("%s has else but no then", label)
+	}
+	if step.Foreach != "" && step.Do == nil {
+		v.addf("%s has foreach but no do step", label)
+	}
+	if step.Do != nil && step.Foreach == "" {
+		v.addf("%s has a do step but no foreach", label)
+	}
+	if step.Merge != nil {
+		v.checkInputs(label, "merge", step.Merge.Inputs)
+		v.checkStrategy(label, "merge", step.Merge.Strategy, MergeStrategies)
+	}
+	if step.Vote != nil {
+		v.checkInputs(label, "vote", step.Vote.Inputs)
+		v.checkStrategy(label, "vote", step.Vote.Strategy, VoteStrategies)
+	}
+
+	for i := range step.Parallel {
+		v.check(&step.Parallel[i], stepLabel(&step.Parallel[i], i))
+	}
+	if step.Then != nil {
+		v.check(step.Then, label+" then")
+	}
+	if step.Else != nil {
+		v.check(step.Else, label+" else")
+	}
+	if step.Do != nil {
+		v.check(step.Do, label+" do")
+		base := step.Do.Name
+		if base == "" {
+			base = step.Name
+		}
+		v.foreachBases[base] = true
+	}
+
+	if step.Name != "" {
+		v.earlier[step.Name] = true
+	}
+}
+
+// checkInputs reports merge or vote inputs that don't name an earlier step
+func (v *stepValidator) checkInputs(label, kind string, inputs []string) {
+	if len(inputs) == 0 {
+		v.addf("%s has no %s inputs", label, kind)
+	}
+	for _, in := range inputs {
+		if strings.TrimSpace(in) == "" {
+			v.addf("%s has an empty %s input", label, kind)
+			continue
+		}
+		for _, name := range inputStepRefs([]string{in}) {
+			if !v.isEarlier(name) {
+				v.addf("%s: %s input %q does not name an earlier step", label, kind, in)
+				break
+			}
+		}
+	}
+}
+
+// checkStrategy reports a merge or vote strategy that is not one of valid
+func (v *stepValidator) checkStrategy(label, kind, strategy string, valid []string) {
+	if strategy != "" && !slices.Contains(valid, strategy) {
+		v.addf("%s has unknown %s strategy %q (valid: %s)", label, kind, strategy, strings.Join(valid, ", "))
+	}
+}
+
+// isEarlier reports whether name is the result of a step checked before
+func (v *stepValidator) isEarlier(name string) bool {
+	if v.earlier[name] {
+		return true
+	}
+	m := foreachIterationPattern.FindStringSubmatch(name)
+	return m != nil && v.foreachBases[m[1]]
+}
+
+// stepLabel names a step in validation messages
+func stepLabel(step *Step, index int) string {
+	if step.Name == "" {
+		return fmt.Sprintf("step %d", index+1)
+	}
+	return "step " + step.Name
+}
+
+// joinKinds lists step kinds as "tool and parallel" or "tool, merge and vote"
+func joinKinds(kinds []string) string {
+	if len(kinds) == 1 {
+		return kinds[0]
+	}
+	return strings.Join(kinds[:len(kinds)-1], ", ") + " and " + kinds[len(kinds)-1]
+}
+
+// checkStepCycles builds the graph of which steps reference which other
+// steps' results and reports the first cycle found, e.g. "a -> b -> a".
+func checkStepCycles(steps []Step) error {
+	graph := make(map[string][]string)
+	var order []string
+	for i := range steps {
+		addStepRefs(graph, &order, &steps[i])
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range graph[name] {
+			switch state[dep] {
+			case visiting:
+				// Cycle: slice the path from the first occurrence of dep
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	for _, name := range order {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return fmt.Errorf("circular step reference: %s", strings.Join(cycle, " -> "))
+			}
+		}
+	}
+	return nil
+}
+
+// addStepRefs records the steps that step depends on. Then/Else branches and
+// foreach bodies report their result under the parent step's name, so their
+// references count as the parent's; parallel children are separate steps the
+// parent waits on.
+func addStepRefs(graph map[string][]string, order *[]string, step *Step) {
+	name := step.Name
+	if _, seen := graph[name]; !seen {
+		graph[name] = nil
+		*order = append(*order, name)
+	}
+
+	var refs []string
+	collect := func(s *Step) {
+		refs = append(refs, textStepRefs(s.Task)...)
+		refs = append(refs, textStepRefs(s.If)...)
+		refs = append(refs, textStepRefs(s.Foreach)...)
+		if s.Merge != nil {
+			refs = append(refs, inputStepRefs(s.Merge.Inputs)...)
+		}
+		if s.Vote != nil {
+			refs = append(refs, inputStepRefs(s.Vote.Inputs)...)
+		}
+	}
+	collect(step)
+	for _, branch := range []*Step{step.Then, step.Else, step.Do} {
+		if branch != nil {
+			collect(branch)
+		}
+	}
+
+	for i := range step.Parallel {
+		child := &step.Parallel[i]
+		refs = append(refs, child.Name)
+		addStepRefs(graph, order, child)
+	}
+
+	graph[name] = append(graph[name], refs...)
+}
+
+// textStepRefs returns the step names referenced as ${steps.NAME...} in s
+func textStepRefs(s string) []string {
+	var names []string
+	for _, m := range stepRefPattern.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// inputStepRefs returns the step names referenced by merge/vote inputs,
+// which are either ${steps.NAME...} references or bare step names
+func inputStepRefs(inputs []string) []string {
+	var names []string
+	for _, in := range inputs {
+		if strings.Contains(in, "${") {
+			names = append(names, textStepRefs(in)...)
+		} else if in != "" {
+			names = append(names, in)
+		}
+	}
+	return names
+}
@@ -0,0 +1,308 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate_SelfReference(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "analyze", Tool: "claude", Task: "Improve on ${steps.analyze.stdout}"},
+	}}
+
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected a cycle error for a self-referencing step")
+	}
+	if !strings.Contains(err.Error(), "circular step reference: analyze -> analyze") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_TwoStepCycle(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "draft", Tool: "claude", Task: "Revise ${steps.review.stdout}"},
+		{Name: "review", Tool: "gemini", Task: "Review ${steps.draft.stdout}"},
+	}}
+
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected a cycle error for a two-step cycle")
+	}
+	if !strings.Contains(err.Error(), "circular step reference: draft -> review -> draft") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestValidate_CycleThroughMergeInputs(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "write", Tool: "claude", Task: "Polish ${steps.combine.output_ref}"},
+		{Name: "combine", Merge: &MergeDef{
+			Inputs:   []string{"${steps.write.output_ref}"},
+			Strategy: "concat",
+		}},
+	}}
+
+	err := b.Validate()
+	if err == nil || !strings.Contains(err.Error(), "write -> combine -> write") {
+		t.Errorf("expected cycle through merge inputs, got %v", err)
+	}
+}
+
+func TestValidate_ParallelChildReferencingParent(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "fanout", Parallel: []Step{
+			{Name: "a", Tool: "claude", Task: "Use ${steps.fanout.status}"},
+			{Name: "b", Tool: "codex", Task: "Independent"},
+		}},
+	}}
+
+	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "fanout -> a -> fanout") {
+		t.Errorf("expected cycle between parallel parent and child, got %v", err)
+	}
+}
+
+func TestValidate_CycleThroughForeach(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "list", Tool: "claude", Task: "List files not covered by ${steps.review.output}"},
+		{Name: "review", Foreach: "${steps.list.output}", Do: &Step{Tool: "claude", Task: "Review ${item}"}},
+	}}
+
+	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "list -> review -> list") {
+		t.Errorf("expected cycle through the foreach list, got %v", err)
+	}
+}
+
+func TestValidate_AcyclicBundles(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "proposals", Parallel: []Step{
+			{Name: "claude-proposal", Tool: "claude", Task: "${inputs.task}"},
+			{Name: "gemini-proposal", Tool: "gemini", Task: "${inputs.task}"},
+		}},
+		{Name: "pick", Vote: &VoteDef{Inputs: []string{"claude-proposal", "gemini-proposal"}, Strategy: "majority"}},
+		{Name: "report", Tool: "claude", Task: "Summarize ${steps.pick.result}", If: "${steps.pick.status} == 'success'"},
+	}}
+	if err := b.Validate(); err != nil {
+		t.Errorf("unexpected error for acyclic bundle: %v", err)
+	}
+
+	entries, err := builtinBundles.ReadDir("builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".json")
+		loaded, err := Load(name)
+		if err != nil {
+			t.Fatalf("Load(%q): %v", name, err)
+		}
+		if err := loaded.Validate(); err != nil {
+			t.Errorf("builtin bundle %s failed validation: %v", name, err)
+		}
+	}
+}
+
+func TestValidate_StepKinds(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "both", Tool: "claude", Parallel: []Step{{Name: "child", Tool: "codex"}}},
+		{Name: "empty"},
+		{Name: "three", Tool: "claude", Merge: &MergeDef{Inputs: []string{"child"}}, Vote: &VoteDef{Inputs: []string{"child"}}},
+		{Name: "branch", If: "true", Then: &Step{}, Else: &Step{Tool: "claude"}},
+		{Name: "orphan-else", Tool: "claude", Else: &Step{Tool: "claude"}},
+		{Name: "loop", Foreach: "${inputs.files}"},
+	}}
+
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected structural problems")
+	}
+	for _, want := range []string{
+		"step both sets tool and parallel",
+		"step empty has nothing to run",
+		"step three sets tool, merge and vote",
+		"step branch then has nothing to run",
+		"step orphan-else has else but no then",
+		"step loop has foreach but no do step",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should report %q, got:\n%v", want, err)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "6 problems:") {
+		t.Errorf("error should count the problems, got:\n%v", err)
+	}
+}
+
+func TestValidate_MergeAndVoteInputs(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "early-merge", Merge: &MergeDef{Inputs: []string{"draft"}}},
+		{Name: "draft", Tool: "claude"},
+		{Name: "drafts", Foreach: "${inputs.topics}", Do: &Step{Name: "section", Tool: "claude"}},
+		{Name: "combine", Merge: &MergeDef{Inputs: []string{"draft", "section-2", "${steps.drafts.output_ref}", "${inputs.extra}"}}},
+		{Name: "pick", Vote: &VoteDef{Inputs: []string{"draft", "typo", ""}}},
+		{Name: "none", Merge: &MergeDef{}},
+	}}
+
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected input problems")
+	}
+	for _, want := range []string{
+		`step early-merge: merge input "draft" does not name an earlier step`,
+		`step pick: vote input "typo" does not name an earlier step`,
+		"step pick has an empty vote input",
+		"step none has no merge inputs",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should report %q, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "step combine") {
+		t.Errorf("earlier steps, foreach iterations and non-step references are valid inputs, got:\n%v", err)
+	}
+}
+
+func TestValidate_InputNames(t *testing.T) {
+	b := &Bundle{
+		Inputs: []Input{{Name: "task", Required: true}, {Name: " ", Required: true}},
+		Steps:  []Step{{Name: "a", Tool: "claude"}},
+	}
+	if err := b.Validate(); err == nil || err.Error() != "input 2 has no name" {
+		t.Errorf("expected the unnamed input reported alone, got %v", err)
+	}
+}
+
+func TestLoad_ValidatesBundle(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `{"name": "broken", "steps": [
+		{"name": "a", "tool": "claude", "parallel": [{"name": "b", "tool": "codex"}]},
+		{"name": "c", "merge": {"inputs": ["missing"]}}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load("broken")
+	if err == nil {
+		t.Fatal("expected Load to reject an invalid bundle")
+	}
+	for _, want := range []string{"invalid bundle broken: 2 problems", "step a sets tool and parallel", `merge input "missing"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should contain %q, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidate_ToolIfRules(t *testing.T) {
+	valid := &Bundle{Steps: []Step{
+		{Name: "fix", Tool: "gemini", ToolIf: []ToolRule{{If: "${inputs.hard} == 'yes'", Tool: "claude", Model: "opus"}}},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	b := &Bundle{Steps: []Step{
+		{Name: "a", Parallel: []Step{{Name: "x", Tool: "claude"}}, ToolIf: []ToolRule{{If: "1 == 1", Tool: "codex"}}},
+		{Name: "b", Tool: "claude", ToolIf: []ToolRule{{Tool: "codex"}, {If: "1 == 1"}}},
+	}}
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected tool_if problems")
+	}
+	for _, want := range []string{
+		"step a has tool_if but no default tool",
+		"step b: tool_if rule 1 has no if condition",
+		"step b: tool_if rule 2 sets neither tool nor model",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidate_SuccessWhenAndEscalateTo(t *testing.T) {
+	valid := &Bundle{Steps: []Step{
+		{Name: "review", Tool: "claude", Model: "haiku", SuccessWhen: "${steps.review.output} contains 'OK'", EscalateTo: []string{"opus"}},
+	}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	b := &Bundle{Steps: []Step{
+		{Name: "a", SuccessWhen: "1 == 1", Parallel: []Step{{Name: "x", Tool: "claude"}}},
+		{Name: "b", Tool: "claude", EscalateTo: []string{"opus"}},
+	}}
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected success_when problems")
+	}
+	for _, want := range []string{
+		"step a has success_when but no tool",
+		"step b has escalate_to but no success_when",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidate_NegativeMaxConcurrency(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "fanout", MaxConcurrency: -1, Parallel: []Step{{Name: "a", Tool: "claude"}}},
+	}}
+	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "step fanout has a negative max_concurrency") {
+		t.Errorf("expected a max_concurrency problem, got %v", err)
+	}
+}
+
+func TestValidate_UnknownStrategies(t *testing.T) {
+	b := &Bundle{Steps: []Step{
+		{Name: "draft", Tool: "claude"},
+		{Name: "combine", Merge: &MergeDef{Inputs: []string{"draft"}, Strategy: "concatt"}},
+		{Name: "pick", Vote: &VoteDef{Inputs: []string{"draft"}, Strategy: "plurality"}},
+		{Name: "default", Merge: &MergeDef{Inputs: []string{"draft"}}},
+		{Name: "ranked", Vote: &VoteDef{Inputs: []string{"draft"}, Strategy: "ranked"}},
+	}}
+
+	err := b.Validate()
+	if err == nil {
+		t.Fatal("expected unknown strategies to be rejected")
+	}
+	for _, want := range []string{
+		`step combine has unknown merge strategy "concatt" (valid: concat, union, dedupe)`,
+		`step pick has unknown vote strategy "plurality" (valid: majority, unanimous, ranked)`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should report %q, got:\n%v", want, err)
+		}
+	}
+	if !strings.HasPrefix(err.Error(), "2 problems:") {
+		t.Errorf("only the unknown strategies are problems, got:\n%v", err)
+	}
+}
+
+func TestValidate_OnFailure(t *testing.T) {
+	valid := &Bundle{
+		Steps:     []Step{{Name: "build", Tool: "claude"}},
+		OnFailure: &Step{Name: "notify", Tool: "claude", Task: "${steps.build.output}"},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	b := &Bundle{
+		Steps:     []Step{{Name: "build", Tool: "claude"}},
+		OnFailure: &Step{Name: "notify"},
+	}
+	err := b.Validate()
+	if err == nil || !strings.Contains(err.Error(), "on_failure step has nothing to run") {
+		t.Errorf("expected an on_failure problem, got %v", err)
+	}
+}
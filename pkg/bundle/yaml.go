@@ -0,0 +1,25 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unmarshalYAML decodes a YAML bundle document into v, a pointer to a
+// struct. Keys map to fields by their yaml struct tags; unlike JSON bundles,
+// a key with no matching field is an error, so a misspelled setting is
+// reported rather than ignored.
+func unmarshalYAML(data []byte, v interface{}) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("yaml: empty document")
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package bundle
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const roundTripYAML = `
+# Review pipeline
+name: review
+description: "Review: then fix"
+template_engine: simple
+strict_conditions: true
+constants:
+  style: 'Google''s guide'
+inputs:
+  - name: codebase
+    required: true
+  - {name: depth, required: false, default: 3}
+steps:
+  - name: reviews
+    parallel:
+      - name: claude-review
+        tool: claude
+        model: opus
+        task: |
+          Review ${inputs.codebase}.
+
+          Follow ${const.style}.
+      - name: codex-review
+        tool: codex
+        task: >-
+          Review the code
+          for bugs # not a comment inside a block scalar
+        retry:
+          max: 2
+          retry_on_exit_codes: [1, 2]
+          backoff_ms: 500
+  - name: combine
+    merge:
+      inputs:
+      - claude-review
+      - codex-review
+      strategy: union
+  - name: pick
+    vote: {inputs: [claude-review, codex-review], strategy: ranked, return_scores: true}
+  - name: fix
+    if: ${steps.pick.status} == 'success'   # trailing comment
+    then:
+      name: apply
+      tool: claude
+      task: "Fix \"${steps.pick.result.decision}\"\n"
+    else: {name: skip, noop: true}
+  - name: each
+    foreach: ${steps.combine.output}
+    collect: true
+    do:
+      tool: gemini
+      task: Check ${item}
+    outputs:
+      report: report.md
+`
+
+const roundTripJSON = `{
+  "name": "review",
+  "description": "Review: then fix",
+  "template_engine": "simple",
+  "strict_conditions": true,
+  "constants": {"style": "Google's guide"},
+  "inputs": [
+    {"name": "codebase", "required": true},
+    {"name": "depth", "required": false, "default": "3"}
+  ],
+  "steps": [
+    {"name": "reviews", "parallel": [
+      {"name": "claude-review", "tool": "claude", "model": "opus",
+       "task": "Review ${inputs.codebase}.\n\nFollow ${const.style}.\n"},
+      {"name": "codex-review", "tool": "codex",
+       "task": "Review the code for bugs # not a comment inside a block scalar",
+       "retry": {"max": 2, "retry_on_exit_codes": [1, 2], "backoff_ms": 500}}
+    ]},
+    {"name": "combine", "merge": {"inputs": ["claude-review", "codex-review"], "strategy": "union"}},
+    {"name": "pick", "vote": {"inputs": ["claude-review", "codex-review"], "strategy": "ranked", "return_scores": true}},
+    {"name": "fix", "if": "${steps.pick.status} == 'success'",
+     "then": {"name": "apply", "tool": "claude", "task": "Fix \"${steps.pick.result.decision}\"\n"},
+     "else": {"name": "skip", "noop": true}},
+    {"name": "each", "foreach": "${steps.combine.output}", "collect": true,
+     "do": {"tool": "gemini", "task": "Check ${item}"},
+     "outputs": {"report": "report.md"}}
+  ]
+}`
+
+func TestUnmarshalYAML_MatchesJSON(t *testing.T) {
+	var fromYAML, fromJSON Bundle
+	if err := unmarshalYAML([]byte(roundTripYAML), &fromYAML); err != nil {
+		t.Fatalf("unmarshalYAML: %v", err)
+	}
+	if err := json.Unmarshal([]byte(roundTripJSON), &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		y, _ := json.MarshalIndent(fromYAML, "", "  ")
+		j, _ := json.MarshalIndent(fromJSON, "", "  ")
+		t.Errorf("YAML and JSON bundles differ\nYAML: %s\nJSON: %s", y, j)
+	}
+	if err := fromYAML.Validate(); err != nil {
+		t.Errorf("YAML bundle should validate: %v", err)
+	}
+}
+
+func TestUnmarshalYAML_RoundTripsJSONBundles(t *testing.T) {
+	// Every builtin bundle written out as YAML decodes to the same bundle
+	entries, err := builtinBundles.ReadDir("builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, _ := builtinBundles.ReadFile("builtin/" + e.Name())
+		var want Bundle
+		if err := json.Unmarshal(data, &want); err != nil {
+			t.Fatal(err)
+		}
+		var got Bundle
+		if err := unmarshalYAML(toYAML(t, want), &got); err != nil {
+			t.Fatalf("%s: unmarshalYAML: %v", e.Name(), err)
+		}
+		// Compared as JSON: omitted empty lists don't come back as empty
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: bundle changed in a YAML round trip\ngot:  %s\nwant: %s", e.Name(), gotJSON, wantJSON)
+		}
+	}
+}
+
+// toYAML writes b as block YAML with every string double-quoted
+func toYAML(t *testing.T, b Bundle) []byte {
+	t.Helper()
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var node interface{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	writeYAMLNode(&sb, node, 0)
+	return []byte(sb.String())
+}
+
+func writeYAMLNode(sb *strings.Builder, node interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for key, value := range n {
+			sb.WriteString(pad + key + ":")
+			writeYAMLChild(sb, value, indent)
+		}
+	case []interface{}:
+		for _, value := range n {
+			sb.WriteString(pad + "-")
+			writeYAMLChild(sb, value, indent)
+		}
+	}
+}
+
+func writeYAMLChild(sb *strings.Builder, value interface{}, indent int) {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			sb.WriteString(" []\n")
+			return
+		}
+		sb.WriteString("\n")
+		writeYAMLNode(sb, v, indent+2)
+	case map[string]interface{}:
+		sb.WriteString("\n")
+		writeYAMLNode(sb, v, indent+2)
+	default:
+		data, _ := json.Marshal(v) // JSON scalars are valid YAML flow scalars
+		sb.WriteString(" " + string(data) + "\n")
+	}
+}
+
+func TestUnmarshalYAML_BlockScalars(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"literal", "task: |\n  one\n    two\n\n  three\n", "one\n  two\n\nthree\n"},
+		{"literal strip", "task: |-\n  one\n  two\n\n", "one\ntwo"},
+		{"literal keep", "task: |+\n  one\n\n\nname: x\n", "one\n\n\n"},
+		{"folded", "task: >\n  one\n  two\n\n  three\n", "one two\nthree\n"},
+		{"folded more indented", "task: >\n  one\n    code\n  two\n", "one\n  code\ntwo\n"},
+		{"empty", "task: |\nname: x\n", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var s Step
+			if err := unmarshalYAML([]byte(tc.yaml), &s); err != nil {
+				t.Fatalf("unmarshalYAML: %v", err)
+			}
+			if s.Task != tc.want {
+				t.Errorf("task = %q, want %q", s.Task, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalYAML_Scalars(t *testing.T) {
+	var s Step
+	doc := `name: "quoted # not a comment"
+tool: 'it''s "quoted" # still' # comment
+model: gpt-5 # comment
+task: "Review: this, carefully"
+description: ~
+on_abort: "tab\there"
+cache: True
+outputs: {a: "x, y", b: z}
+`
+	if err := unmarshalYAML([]byte(doc), &s); err != nil {
+		t.Fatalf("unmarshalYAML: %v", err)
+	}
+	want := Step{
+		Name:    "quoted # not a comment",
+		Tool:    `it's "quoted" # still`,
+		Model:   "gpt-5",
+		Task:    "Review: this, carefully",
+		OnAbort: "tab\there",
+		Cache:   true,
+		Outputs: map[string]string{"a": "x, y", "b": "z"},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+}
+
+func TestUnmarshalYAML_AnchorsAndFlow(t *testing.T) {
+	doc := `name: shared
+steps:
+  - &review
+    name: claude-review
+    tool: claude
+    task: !!str Review the diff
+  - <<: *review
+    name: codex-review
+    tool: codex
+  - name: pick
+    vote: {
+      inputs: [
+        claude-review,
+        codex-review,
+      ],
+      strategy: majority,
+    }
+`
+	var b Bundle
+	if err := unmarshalYAML([]byte(doc), &b); err != nil {
+		t.Fatalf("unmarshalYAML: %v", err)
+	}
+	codex := b.Steps[1]
+	if codex.Name != "codex-review" || codex.Tool != "codex" || codex.Task != "Review the diff" {
+		t.Errorf("merged step = %+v, want the anchored task with its own name and tool", codex)
+	}
+	if vote := b.Steps[2].Vote; vote == nil || !reflect.DeepEqual(vote.Inputs, []string{"claude-review", "codex-review"}) {
+		t.Errorf("vote = %+v, want both inputs from the multi-line flow sequence", vote)
+	}
+}
+
+func TestUnmarshalYAML_Errors(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want string
+	}{
+		{"name: a\n  tool: claude\n", "line 2"},
+		{"name: a\nname: b\n", `mapping key "name" already defined`},
+		{"steps:\n  - name: a\n    retry:\n      max: lots\n", "cannot unmarshal !!str `lots` into int"},
+		{"steps: a\n", "into []bundle.Step"},
+		{"steps:\n  - name: a\n    cache: maybe\n", "cannot unmarshal !!str `maybe` into bool"},
+		{"steps:\n  - name: a\n    tol: claude\n", "field tol not found"},
+		{"inputs: [a, b\n", "did not find expected ',' or ']'"},
+		{"name: \"open\n", "found unexpected end of stream"},
+		{"just text\n", "into bundle.Bundle"},
+		{"", "empty document"},
+	}
+	for _, tc := range tests {
+		var b Bundle
+		err := unmarshalYAML([]byte(tc.yaml), &b)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("unmarshalYAML(%q) = %v, want an error containing %q", tc.yaml, err, tc.want)
+		}
+	}
+}
+
+func TestLoad_YAMLBundles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".rcodegen", "bundles")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"nightly.yaml": "name: nightly\nsteps:\n  - name: audit\n    tool: claude\n    task: Audit ${inputs.codebase}\n",
+		"quick.yml":    "name: quick\nsteps:\n  - {name: lint, tool: codex}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"nightly", "quick"} {
+		b, err := Load(name)
+		if err != nil {
+			t.Fatalf("Load(%q): %v", name, err)
+		}
+		if b.Name != name || len(b.Steps) != 1 {
+			t.Errorf("Load(%q) = %+v", name, b)
+		}
+	}
+	b, err := LoadFromPath(filepath.Join(dir, "nightly.yaml"))
+	if err != nil || b.Steps[0].Task != "Audit ${inputs.codebase}" {
+		t.Errorf("LoadFromPath(nightly.yaml) = %+v, %v", b, err)
+	}
+
+	names, _ := List()
+	listed := strings.Join(names, ",")
+	if !strings.Contains(listed, "nightly") || !strings.Contains(listed, "quick") {
+		t.Errorf("List() = %v, want the YAML bundles", names)
+	}
+}
@@ -1,6 +1,12 @@
 package envelope
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"time"
+)
 
 type Status string
 
@@ -12,11 +18,13 @@ const (
 )
 
 type Envelope struct {
-	Status    Status                 `json:"status"`
-	Result    map[string]interface{} `json:"result,omitempty"`
-	OutputRef string                 `json:"output_ref,omitempty"`
-	Error     *ErrorInfo             `json:"error,omitempty"`
-	Metrics   *Metrics               `json:"metrics,omitempty"`
+	Status     Status                 `json:"status"`
+	Result     map[string]interface{} `json:"result,omitempty"`
+	OutputRef  string                 `json:"output_ref,omitempty"`
+	OutputHash string                 `json:"output_hash,omitempty"` // sha256 of the normalized output, see HashOutput
+	Error      *ErrorInfo             `json:"error,omitempty"`
+	Metrics    *Metrics               `json:"metrics,omitempty"`
+	Warnings   []string               `json:"warnings,omitempty"` // Problems noticed that did not stop the run
 }
 
 type ErrorInfo struct {
@@ -64,11 +72,31 @@ func (b *Builder) WithResult(key string, value interface{}) *Builder {
 	return b
 }
 
+// WithWarning records a problem that did not change the status
+func (b *Builder) WithWarning(message string) *Builder {
+	b.env.Warnings = append(b.env.Warnings, message)
+	return b
+}
+
 func (b *Builder) WithOutputRef(path string) *Builder {
 	b.env.OutputRef = path
 	return b
 }
 
+// WithOutputHash records HashOutput(output), so steps with the same output
+// can be grouped without reading their output files
+func (b *Builder) WithOutputHash(output string) *Builder {
+	b.env.OutputHash = HashOutput(output)
+	return b
+}
+
+// WithOutputSum records an output hash already computed, such as an
+// OutputHasher's Sum for output too large to pass to WithOutputHash
+func (b *Builder) WithOutputSum(sum string) *Builder {
+	b.env.OutputHash = sum
+	return b
+}
+
 func (b *Builder) WithDuration(ms int64) *Builder {
 	if b.env.Metrics == nil {
 		b.env.Metrics = &Metrics{}
@@ -80,3 +108,80 @@ func (b *Builder) WithDuration(ms int64) *Builder {
 func (b *Builder) Build() *Envelope {
 	return b.env
 }
+
+// HashOutput returns the hex sha256 of output after normalizing line endings
+// to LF, trimming trailing whitespace from each line and dropping leading
+// and trailing blank lines, so cosmetic differences do not split duplicates
+func HashOutput(output string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	output = strings.ReplaceAll(output, "\r", "\n")
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	normalized := strings.Trim(strings.Join(lines, "\n"), "\n")
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// OutputHasher computes HashOutput over output written to it in pieces, for
+// output too large to hold in memory. Its Sum equals HashOutput of everything
+// written.
+type OutputHasher struct {
+	h        hash.Hash
+	started  bool   // Content has been hashed; later newlines may count
+	newlines int    // Newlines held until content shows they are not trailing
+	blanks   []byte // Spaces and tabs held until content shows they are not trailing
+	afterCR  bool   // The last byte was a CR, so an LF next is part of it
+	buf      []byte
+}
+
+// NewOutputHasher returns an empty OutputHasher
+func NewOutputHasher() *OutputHasher {
+	return &OutputHasher{h: sha256.New()}
+}
+
+func (o *OutputHasher) Write(p []byte) (int, error) {
+	o.buf = o.buf[:0]
+	for _, c := range p {
+		afterCR := o.afterCR
+		o.afterCR = c == '\r'
+		switch c {
+		case '\n':
+			if afterCR {
+				continue
+			}
+			fallthrough
+		case '\r':
+			o.blanks = o.blanks[:0]
+			if o.started {
+				o.newlines++
+			}
+		case ' ', '\t':
+			o.blanks = append(o.blanks, c)
+		default:
+			for ; o.newlines > 0; o.newlines-- {
+				o.buf = append(o.buf, '\n')
+			}
+			o.buf = append(o.buf, o.blanks...)
+			o.buf = append(o.buf, c)
+			o.blanks = o.blanks[:0]
+			o.started = true
+		}
+	}
+	o.h.Write(o.buf)
+	return len(p), nil
+}
+
+// Sum returns the hex sha256 of the normalized output written so far
+func (o *OutputHasher) Sum() string {
+	return hex.EncodeToString(o.h.Sum(nil))
+}
+
+// Reset discards everything written
+func (o *OutputHasher) Reset() {
+	o.h.Reset()
+	o.started, o.newlines, o.afterCR = false, 0, false
+	o.blanks = o.blanks[:0]
+}
@@ -72,6 +72,77 @@ func TestBuilder_WithOutputRef(t *testing.T) {
 	}
 }
 
+func TestBuilder_WithOutputHash(t *testing.T) {
+	env := New().Success().WithOutputHash("result").Build()
+	if env.OutputHash != HashOutput("result") {
+		t.Errorf("expected OutputHash=HashOutput(\"result\"), got %s", env.OutputHash)
+	}
+	if len(env.OutputHash) != 64 {
+		t.Errorf("expected a hex sha256, got %q", env.OutputHash)
+	}
+}
+
+func TestHashOutput(t *testing.T) {
+	base := HashOutput("func main() {}\nreturn 1\n")
+
+	same := []string{
+		"func main() {}\nreturn 1\n",
+		"func main() {}\r\nreturn 1\r\n",
+		"func main() {}  \nreturn 1\t\n",
+		"\nfunc main() {}\nreturn 1\n\n\n",
+	}
+	for _, s := range same {
+		if got := HashOutput(s); got != base {
+			t.Errorf("HashOutput(%q) = %s, want %s (identical after normalization)", s, got, base)
+		}
+	}
+
+	different := []string{
+		"func main() {}\nreturn 2\n",
+		"func main()  {}\nreturn 1\n",
+		"  func main() {}\nreturn 1\n",
+		"",
+	}
+	for _, s := range different {
+		if got := HashOutput(s); got == base {
+			t.Errorf("HashOutput(%q) should differ from %q", s, "func main() {}\nreturn 1\n")
+		}
+	}
+}
+
+func TestOutputHasher_MatchesHashOutput(t *testing.T) {
+	inputs := []string{
+		"",
+		"\n\n",
+		"func main() {}\nreturn 1\n",
+		"func main() {}\r\nreturn 1\r\n",
+		"func main() {}  \nreturn 1\t\n",
+		"\nfunc main() {}\nreturn 1\n\n\n",
+		"  \t\n  lead\r\rmid \t \r\n\n\ttail  \t",
+		"a\r\n\r\n\rb \r",
+	}
+	for _, in := range inputs {
+		want := HashOutput(in)
+		// Every split point, so CRLF pairs and held blanks straddle writes
+		for split := 0; split <= len(in); split++ {
+			h := NewOutputHasher()
+			h.Write([]byte(in[:split]))
+			h.Write([]byte(in[split:]))
+			if got := h.Sum(); got != want {
+				t.Errorf("split %q at %d: Sum = %s, want HashOutput %s", in, split, got, want)
+			}
+		}
+	}
+
+	h := NewOutputHasher()
+	h.Write([]byte("discarded\n"))
+	h.Reset()
+	h.Write([]byte("result"))
+	if got := h.Sum(); got != HashOutput("result") {
+		t.Errorf("after Reset: Sum = %s, want HashOutput(\"result\")", got)
+	}
+}
+
 func TestBuilder_WithTool(t *testing.T) {
 	env := New().WithTool("claude").Build()
 
@@ -153,3 +224,13 @@ func TestStatusConstants(t *testing.T) {
 		t.Errorf("StatusSkipped = %q, want 'skipped'", StatusSkipped)
 	}
 }
+
+func TestBuilder_WithWarning(t *testing.T) {
+	env := New().Success().WithWarning("first").WithWarning("second").Build()
+	if env.Status != StatusSuccess {
+		t.Errorf("warnings should not change the status, got %s", env.Status)
+	}
+	if len(env.Warnings) != 2 || env.Warnings[0] != "first" || env.Warnings[1] != "second" {
+		t.Errorf("expected warnings in order, got %q", env.Warnings)
+	}
+}
@@ -0,0 +1,40 @@
+package envelope
+
+// Error codes with a dedicated process exit code
+const (
+	CodeRunTimeout     = "RUN_TIMEOUT"
+	CodeBudgetExceeded = "BUDGET_EXCEEDED"
+)
+
+// Process exit codes reported for a run outcome, for CI gating
+const (
+	ExitSuccess        = 0
+	ExitFailure        = 1
+	ExitPartial        = 2
+	ExitBudgetExceeded = 3
+	ExitTimeout        = 4
+)
+
+// ExitCode maps the envelope's outcome to a process exit code: 0 for
+// success (or skipped), 2 for partial, 3 when a budget was exceeded, 4 on
+// timeout, and 1 for any other failure or a missing envelope
+func (e *Envelope) ExitCode() int {
+	if e == nil {
+		return ExitFailure
+	}
+	switch e.Status {
+	case StatusSuccess, StatusSkipped:
+		return ExitSuccess
+	case StatusPartial:
+		return ExitPartial
+	}
+	if e.Error != nil {
+		switch e.Error.Code {
+		case CodeBudgetExceeded:
+			return ExitBudgetExceeded
+		case CodeRunTimeout:
+			return ExitTimeout
+		}
+	}
+	return ExitFailure
+}
@@ -0,0 +1,29 @@
+package envelope
+
+import "testing"
+
+func TestEnvelope_ExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		env  *Envelope
+		want int
+	}{
+		{"success", New().Success().Build(), 0},
+		{"skipped", &Envelope{Status: StatusSkipped}, 0},
+		{"partial", &Envelope{Status: StatusPartial}, 2},
+		{"failure", New().Failure("EXEC_FAILED", "exit status 1").Build(), 1},
+		{"failure without error info", &Envelope{Status: StatusFailure}, 1},
+		{"budget exceeded", New().Failure(CodeBudgetExceeded, "over budget").Build(), 3},
+		{"timeout", New().Failure(CodeRunTimeout, "run exceeded timeout of 1m").Build(), 4},
+		{"unknown status", &Envelope{Status: "weird"}, 1},
+		{"nil envelope", nil, 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.env.ExitCode(); got != tc.want {
+				t.Errorf("ExitCode() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/workspace"
+)
+
+// cacheEntry is the stored outcome of a successful cached step
+type cacheEntry struct {
+	Output    string    `json:"output"`
+	Stdout    string    `json:"stdout"`
+	Stderr    string    `json:"stderr"`
+	Model     string    `json:"model,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultCacheDir is where step results are cached (~/.rcodegen/cache/steps)
+func DefaultCacheDir() string {
+	return filepath.Join(filepath.Dir(workspace.DefaultBaseDir()), "cache", "steps")
+}
+
+// gitHead returns the HEAD commit of the repository containing dir,
+// or "" when dir is not inside a git repository
+func gitHead(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// stepCacheKey hashes everything that determines a step's output: the tool,
+// model, rendered task, output shaping, and the codebase's git commit. A new
+// commit therefore busts the cache even when the prompt is unchanged.
+func stepCacheKey(step *bundle.Step, model, task, commit string) string {
+	h := sha256.New()
+	for _, part := range []string{step.Tool, model, task, step.OutputStream, step.OutputFilter, step.OutputExclude, commit} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *ToolExecutor) cacheDir() string {
+	if e.CacheDir != "" {
+		return e.CacheDir
+	}
+	return DefaultCacheDir()
+}
+
+// loadCache returns the entry stored under key, if any
+func (e *ToolExecutor) loadCache(key string) (cacheEntry, bool) {
+	var entry cacheEntry
+	data, err := os.ReadFile(filepath.Join(e.cacheDir(), key+".json"))
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+// storeCache saves entry under key. Failures are ignored: the cache is
+// an optimisation and never fails a step.
+func (e *ToolExecutor) storeCache(key string, entry cacheEntry) {
+	dir := e.cacheDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := filepath.Join(dir, key+".json.tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, filepath.Join(dir, key+".json"))
+}
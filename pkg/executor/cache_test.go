@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+)
+
+// gitCommit commits a change to file in repo, initialising the repo on first use
+func gitCommit(t *testing.T, repo, file, content string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(repo, ".git")); os.IsNotExist(err) {
+		runGit(t, repo, "init", "-q")
+	}
+	if err := os.WriteFile(filepath.Join(repo, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "add", file)
+	runGit(t, repo, "commit", "-q", "-m", "update "+file)
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.email=test@example.com", "-c", "user.name=test", "-c", "commit.gpgsign=false"}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestToolExecutor_CacheKeyedByGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	e, _, ws := newShellExecutor(t)
+	e.CacheDir = t.TempDir()
+	repo := t.TempDir()
+	ctx := orchestrator.NewContext(map[string]string{"codebase": repo})
+	counter := filepath.Join(t.TempDir(), "runs")
+
+	step := &bundle.Step{
+		Name:  "build",
+		Tool:  "sh",
+		Task:  fmt.Sprintf("echo run >> %s; cat main.txt", counter),
+		Cache: true,
+	}
+	run := func() *envelope.Envelope {
+		t.Helper()
+		env, err := e.Execute(step, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if env.Status != envelope.StatusSuccess {
+			t.Fatalf("expected success, got %s: %+v", env.Status, env.Error)
+		}
+		return env
+	}
+
+	gitCommit(t, repo, "main.txt", "v1\n")
+	if env := run(); env.Result["cached"] == true {
+		t.Error("first run should not be a cache hit")
+	}
+
+	// Same commit: served from the cache without running
+	env := run()
+	if env.Result["cached"] != true {
+		t.Error("second run at the same commit should be a cache hit")
+	}
+	if runs := countRuns(t, counter); runs != 1 {
+		t.Errorf("expected 1 run at the same commit, got %d", runs)
+	}
+	if out, _ := os.ReadFile(env.OutputRef); !strings.Contains(string(out), `"output": "v1\n"`) {
+		t.Errorf("cached output should be restored, got:\n%s", out)
+	}
+
+	// New commit: the cache misses and the step runs again
+	gitCommit(t, repo, "main.txt", "v2\n")
+	env = run()
+	if env.Result["cached"] == true {
+		t.Error("run after a new commit should miss the cache")
+	}
+	if runs := countRuns(t, counter); runs != 2 {
+		t.Errorf("expected 2 runs after a new commit, got %d", runs)
+	}
+	if out, _ := os.ReadFile(env.OutputRef); !strings.Contains(string(out), `"output": "v2\n"`) {
+		t.Errorf("output after a new commit should be fresh, got:\n%s", out)
+	}
+}
+
+func TestToolExecutor_CacheDisabledByDefault(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	e.CacheDir = t.TempDir()
+	counter := filepath.Join(t.TempDir(), "runs")
+
+	step := &bundle.Step{Name: "plain", Tool: "sh", Task: fmt.Sprintf("echo run >> %s", counter)}
+	for i := 0; i < 2; i++ {
+		if _, err := e.Execute(step, ctx, ws); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if runs := countRuns(t, counter); runs != 2 {
+		t.Errorf("steps without cache should always run, got %d runs", runs)
+	}
+}
+
+func TestToolExecutor_FailedStepNotCached(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	e.CacheDir = t.TempDir()
+	counter := filepath.Join(t.TempDir(), "runs")
+
+	step := &bundle.Step{Name: "broken", Tool: "sh", Task: fmt.Sprintf("echo run >> %s; exit 1", counter), Cache: true}
+	for i := 0; i < 2; i++ {
+		env, err := e.Execute(step, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if env.Status != envelope.StatusFailure {
+			t.Fatalf("expected failure, got %s", env.Status)
+		}
+	}
+	if runs := countRuns(t, counter); runs != 2 {
+		t.Errorf("failed steps should not be cached, got %d runs", runs)
+	}
+}
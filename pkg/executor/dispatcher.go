@@ -1,6 +1,9 @@
 package executor
 
 import (
+	"fmt"
+	"time"
+
 	"rcodegen/pkg/bundle"
 	"rcodegen/pkg/envelope"
 	"rcodegen/pkg/orchestrator"
@@ -15,36 +18,124 @@ func init() {
 	}
 }
 
+// DefaultMaxParallelDepth is how deeply parallel blocks may nest by default
+const DefaultMaxParallelDepth = 3
+
 type Dispatcher struct {
 	tool     *ToolExecutor
 	parallel *ParallelExecutor
+	foreach  *ForeachExecutor
 	merge    *MergeExecutor
 	vote     *VoteExecutor
+
+	maxParallelDepth int // Nested parallel blocks deeper than this are rejected
 }
 
 func NewDispatcher(tools map[string]runner.Tool) *Dispatcher {
 	d := &Dispatcher{
-		tool:  &ToolExecutor{Tools: tools},
-		merge: &MergeExecutor{},
-		vote:  &VoteExecutor{},
+		tool:             &ToolExecutor{Tools: tools},
+		merge:            &MergeExecutor{},
+		vote:             &VoteExecutor{},
+		maxParallelDepth: DefaultMaxParallelDepth,
 	}
 	d.parallel = &ParallelExecutor{Dispatcher: d}
+	d.foreach = &ForeachExecutor{Dispatcher: d}
 	d.merge.ToolExecutor = d.tool
 	return d
 }
 
+// SetMaxParallelDepth limits how deeply parallel blocks may nest, guarding
+// against a bundle forking an unbounded number of subprocesses (0 or less
+// restores the default)
+func (d *Dispatcher) SetMaxParallelDepth(depth int) {
+	if depth <= 0 {
+		depth = DefaultMaxParallelDepth
+	}
+	d.maxParallelDepth = depth
+}
+
+// SetPromptWarnTokens sets the estimated token count above which a resolved
+// task is logged with a warning (0 restores the default, negative disables)
+func (d *Dispatcher) SetPromptWarnTokens(tokens int) {
+	d.tool.PromptWarnTokens = tokens
+}
+
+// SetSystemPromptFiles sets the system prompt file passed to each tool
+// (tool name -> file)
+func (d *Dispatcher) SetSystemPromptFiles(files map[string]string) {
+	d.tool.SystemPromptFiles = files
+}
+
 func (d *Dispatcher) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
-	// Determine step type and dispatch
+	start := time.Now()
+	env, err := d.dispatch(step, ctx, ws)
+	if env != nil {
+		stampTimes(env, start, time.Now())
+	}
+	if err == nil && env != nil && env.Status == envelope.StatusSuccess && len(step.Outputs) > 0 {
+		env = writeOutputs(step, env, ctx, ws)
+	}
+	if err == nil && env != nil && env.Status == envelope.StatusSuccess && step.Save != "" {
+		env = saveOutput(step, env, ctx, ws)
+	}
+	return env, err
+}
+
+// stampTimes records when a step started and ended in its result, as UTC
+// RFC 3339 timestamps ("started_at", "ended_at") for correlating with
+// provider logs
+func stampTimes(env *envelope.Envelope, start, end time.Time) {
+	if env.Result == nil {
+		env.Result = make(map[string]interface{})
+	}
+	env.Result["started_at"] = start.UTC().Format(time.RFC3339Nano)
+	env.Result["ended_at"] = end.UTC().Format(time.RFC3339Nano)
+	if env.Metrics != nil {
+		env.Metrics.StartTime = start
+		env.Metrics.EndTime = end
+	}
+}
+
+// dispatch runs step with the executor for its type
+func (d *Dispatcher) dispatch(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	step = orchestrator.SelectTool(step, ctx)
 	switch {
+	case step.Noop:
+		return envelope.New().Success().WithOutputHash("").WithResult("noop", true).Build(), nil
 	case len(step.Parallel) > 0:
+		if depth := parallelDepth(step); depth > d.maxParallelDepth {
+			err := fmt.Errorf("step %s nests parallel blocks %d deep, exceeding the limit of %d", step.Name, depth, d.maxParallelDepth)
+			return envelope.New().Failure("PARALLEL_DEPTH_EXCEEDED", err.Error()).Build(), err
+		}
 		return d.parallel.Execute(step, ctx, ws)
+	case step.Foreach != "":
+		return d.foreach.Execute(step, ctx, ws)
 	case step.Merge != nil:
 		return d.merge.Execute(step, ctx, ws)
 	case step.Vote != nil:
 		return d.vote.Execute(step, ctx, ws)
 	case step.Tool != "":
-		return d.tool.Execute(step, ctx, ws)
+		return d.executeTool(step, ctx, ws)
 	default:
 		return envelope.New().Failure("UNKNOWN_STEP", "Cannot determine step type").Build(), nil
 	}
 }
+
+// parallelDepth returns how deeply parallel blocks nest within step: 0 for
+// no parallel block, 1 for a parallel block of plain steps, and so on
+func parallelDepth(step *bundle.Step) int {
+	depth := 0
+	for _, branch := range []*bundle.Step{step.Then, step.Else, step.Do} {
+		if branch != nil {
+			depth = max(depth, parallelDepth(branch))
+		}
+	}
+	if len(step.Parallel) == 0 {
+		return depth
+	}
+	deepest := 0
+	for i := range step.Parallel {
+		deepest = max(deepest, parallelDepth(&step.Parallel[i]))
+	}
+	return max(depth, deepest+1)
+}
@@ -0,0 +1,208 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/workspace"
+)
+
+// nestedParallel builds a step whose parallel blocks nest depth levels deep
+func nestedParallel(depth int) bundle.Step {
+	step := bundle.Step{Name: "leaf", Tool: "sh", Task: "echo leaf"}
+	for i := depth; i >= 1; i-- {
+		step = bundle.Step{
+			Name:     fmt.Sprintf("level%d", i),
+			Parallel: []bundle.Step{step, {Name: fmt.Sprintf("sibling%d", i), Tool: "sh", Task: "echo sibling"}},
+		}
+	}
+	return step
+}
+
+func newShellDispatcher(t *testing.T) (*Dispatcher, *orchestrator.Context, *workspace.Workspace) {
+	t.Helper()
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	ctx := orchestrator.NewContext(map[string]string{"codebase": t.TempDir()})
+	return NewDispatcher(map[string]runner.Tool{"sh": shellTool{}}), ctx, ws
+}
+
+func TestParallelDepth(t *testing.T) {
+	for depth := 0; depth <= 5; depth++ {
+		step := nestedParallel(depth)
+		if got := parallelDepth(&step); got != depth {
+			t.Errorf("parallelDepth of %d nested blocks = %d", depth, got)
+		}
+	}
+
+	deep := nestedParallel(2)
+	branch := bundle.Step{Name: "cond", If: "true", Then: &deep}
+	if got := parallelDepth(&branch); got != 2 {
+		t.Errorf("parallelDepth through a then branch = %d, want 2", got)
+	}
+}
+
+func TestDispatcher_RejectsDeepParallelNesting(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := nestedParallel(DefaultMaxParallelDepth + 1)
+	env, err := d.Execute(&step, ctx, ws)
+	if err == nil {
+		t.Fatal("expected a depth-limit error")
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "PARALLEL_DEPTH_EXCEEDED" {
+		t.Fatalf("expected PARALLEL_DEPTH_EXCEEDED, got %+v", env)
+	}
+	if !strings.Contains(err.Error(), "4 deep, exceeding the limit of 3") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ran := ctx.GetResult("leaf"); ran {
+		t.Error("no substep should run when the depth limit is exceeded")
+	}
+}
+
+func TestDispatcher_AllowsParallelNestingWithinLimit(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := nestedParallel(DefaultMaxParallelDepth)
+	env, err := d.Execute(&step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Fatalf("status = %s, want success (%+v)", env.Status, env.Error)
+	}
+	if leaf, ok := ctx.GetResult("leaf"); !ok || leaf.Status != envelope.StatusSuccess {
+		t.Error("the innermost step should have run")
+	}
+}
+
+func TestDispatcher_ConfigurableParallelDepth(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	d.SetMaxParallelDepth(1)
+
+	step := nestedParallel(2)
+	if _, err := d.Execute(&step, ctx, ws); err == nil || !strings.Contains(err.Error(), "limit of 1") {
+		t.Errorf("expected the configured limit to apply, got %v", err)
+	}
+
+	d.SetMaxParallelDepth(0)
+	if d.maxParallelDepth != DefaultMaxParallelDepth {
+		t.Errorf("SetMaxParallelDepth(0) = %d, want the default", d.maxParallelDepth)
+	}
+}
+
+func TestDispatcher_NoopStep(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	// A noop step needs no tool and ignores any task
+	join := bundle.Step{Name: "join", Noop: true, Task: "exit 1"}
+	env, err := d.Execute(&join, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess || env.Result["noop"] != true {
+		t.Fatalf("expected a noop success envelope, got %+v", env)
+	}
+	ctx.SetResult(join.Name, env)
+
+	if got := ctx.Resolve("${steps.join.status}"); got != "success" {
+		t.Errorf("${steps.join.status} = %q, want success", got)
+	}
+	if !orchestrator.EvaluateCondition("${steps.join.status} == 'success'", ctx) {
+		t.Error("a condition on the noop step should hold")
+	}
+
+	report := bundle.Step{Name: "report", Tool: "sh", Task: "echo joined=${steps.join.status}"}
+	env, err = d.Execute(&report, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("report step failed: %v %+v", err, env)
+	}
+	data, err := os.ReadFile(env.OutputRef)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	if !strings.Contains(string(data), "joined=success") {
+		t.Errorf("later step should see the noop's status, got %s", data)
+	}
+}
+
+func TestDispatcher_StepTimestamps(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	before := time.Now()
+	step := bundle.Step{Name: "slow", Tool: "sh", Task: "sleep 0.2"}
+	env, err := d.Execute(&step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("step failed: %v %+v", err, env)
+	}
+
+	parse := func(key string) time.Time {
+		t.Helper()
+		s, _ := env.Result[key].(string)
+		ts, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("%s = %q is not an RFC 3339 timestamp: %v", key, s, err)
+		}
+		return ts
+	}
+	started, ended := parse("started_at"), parse("ended_at")
+	if started.Before(before.Truncate(time.Millisecond)) || !ended.After(started) {
+		t.Errorf("timestamps out of order: before %v, started %v, ended %v", before, started, ended)
+	}
+	elapsed := ended.Sub(started)
+	recorded := time.Duration(env.Metrics.DurationMs) * time.Millisecond
+	if diff := elapsed - recorded; diff < -5*time.Millisecond || diff > 50*time.Millisecond {
+		t.Errorf("ended_at - started_at = %v, recorded duration %v", elapsed, recorded)
+	}
+	if !env.Metrics.StartTime.Equal(started) || !env.Metrics.EndTime.Equal(ended) {
+		t.Errorf("metrics times %v-%v should match the result's", env.Metrics.StartTime, env.Metrics.EndTime)
+	}
+	ctx.SetResult("slow", env)
+	if got := ctx.Resolve("${steps.slow.result.started_at}"); got != env.Result["started_at"] {
+		t.Errorf("started_at should resolve for later steps, got %q", got)
+	}
+
+	// Steps of every kind are stamped, including their substeps
+	group := bundle.Step{Name: "group", Parallel: []bundle.Step{{Name: "a", Tool: "sh", Task: "true"}}}
+	env, _ = d.Execute(&group, ctx, ws)
+	child, _ := ctx.GetResult("a")
+	if env.Result["started_at"] == nil || child == nil || child.Result["ended_at"] == nil {
+		t.Errorf("parallel step and its substeps should carry timestamps, got %v / %+v", env.Result, child)
+	}
+}
+
+func TestDispatcher_ToolIfSelectsTool(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.SetResult("triage", envelope.New().Success().WithResult("complex", "yes").Build())
+
+	// Parallel substeps pick their tool when the block runs; "cheap" is not
+	// a registered tool, so only a selected "sh" succeeds
+	step := bundle.Step{Name: "review", Parallel: []bundle.Step{
+		{Name: "hard", Tool: "cheap", Task: "echo hard", ToolIf: []bundle.ToolRule{
+			{If: "${steps.triage.result.complex} == 'no'", Tool: "other"},
+			{If: "${steps.triage.result.complex} == 'yes'", Tool: "sh"},
+		}},
+		{Name: "easy", Tool: "cheap", Task: "echo easy", ToolIf: []bundle.ToolRule{
+			{If: "${steps.triage.result.complex} == 'no'", Tool: "sh"},
+		}},
+	}}
+	if _, err := d.Execute(&step, ctx, ws); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if hard, _ := ctx.GetResult("hard"); hard == nil || hard.Status != envelope.StatusSuccess || hard.Metrics.Tool != "sh" {
+		t.Errorf("hard should run with the selected sh tool, got %+v", hard)
+	}
+	if easy, _ := ctx.GetResult("easy"); easy == nil || easy.Status != envelope.StatusFailure {
+		t.Errorf("easy should fall back to its default tool, got %+v", easy)
+	}
+}
@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"fmt"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/workspace"
+)
+
+// executeTool runs a tool step and checks its result against the step's
+// success_when condition. While the check fails, the step is re-run on each
+// escalate_to model in turn; the result records the models escalated from,
+// and its cost and tokens include every run.
+func (d *Dispatcher) executeTool(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	env, err := d.tool.Execute(step, ctx, ws)
+	if step.SuccessWhen == "" {
+		return env, err
+	}
+
+	var escalatedFrom []string
+	var spent usageTotals
+	for _, model := range step.EscalateTo {
+		if err != nil || env.Status != envelope.StatusSuccess || meetsSuccessWhen(step, env, ctx) {
+			break
+		}
+		from, _ := env.Result["model"].(string)
+		escalatedFrom = append(escalatedFrom, from)
+		spent.add(env)
+
+		next := *step
+		next.Model = model
+		env, err = d.tool.Execute(&next, ctx, ws)
+	}
+	if err != nil || env == nil {
+		return env, err
+	}
+
+	if env.Status == envelope.StatusSuccess && !meetsSuccessWhen(step, env, ctx) {
+		env.Status = envelope.StatusFailure
+		env.Error = &envelope.ErrorInfo{
+			Code:    "SUCCESS_CHECK_FAILED",
+			Message: fmt.Sprintf("step %s: result does not meet success_when %q", step.Name, step.SuccessWhen),
+		}
+	}
+	if len(escalatedFrom) > 0 {
+		spent.addTo(env)
+		env.Result["escalated"] = true
+		env.Result["escalated_from"] = escalatedFrom
+	}
+	return env, nil
+}
+
+// meetsSuccessWhen evaluates the step's success_when with its result
+// available as ${steps.<name>...}
+func meetsSuccessWhen(step *bundle.Step, env *envelope.Envelope, ctx *orchestrator.Context) bool {
+	ctx.SetResult(step.Name, env)
+	return orchestrator.EvaluateCondition(step.SuccessWhen, ctx)
+}
+
+// usageTotals adds up the cost and tokens of runs an escalation replaced
+type usageTotals struct {
+	costUSD          float64
+	inputTokens      int
+	outputTokens     int
+	cacheReadTokens  int
+	cacheWriteTokens int
+}
+
+func (u *usageTotals) add(env *envelope.Envelope) {
+	cost, _ := env.Result["cost_usd"].(float64)
+	in, _ := env.Result["input_tokens"].(int)
+	out, _ := env.Result["output_tokens"].(int)
+	u.costUSD += cost
+	u.inputTokens += in
+	u.outputTokens += out
+	read, _ := env.Result["cache_read_tokens"].(int)
+	write, _ := env.Result["cache_write_tokens"].(int)
+	u.cacheReadTokens += read
+	u.cacheWriteTokens += write
+}
+
+// addTo adds the totals to env's own
+func (u usageTotals) addTo(env *envelope.Envelope) {
+	if env.Result == nil {
+		env.Result = make(map[string]interface{})
+	}
+	cost, _ := env.Result["cost_usd"].(float64)
+	in, _ := env.Result["input_tokens"].(int)
+	out, _ := env.Result["output_tokens"].(int)
+	env.Result["cost_usd"] = cost + u.costUSD
+	env.Result["input_tokens"] = in + u.inputTokens
+	env.Result["output_tokens"] = out + u.outputTokens
+	read, _ := env.Result["cache_read_tokens"].(int)
+	write, _ := env.Result["cache_write_tokens"].(int)
+	env.Result["cache_read_tokens"] = read + u.cacheReadTokens
+	env.Result["cache_write_tokens"] = write + u.cacheWriteTokens
+}
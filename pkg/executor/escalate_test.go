@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/workspace"
+)
+
+// modelShellTool runs the task like shellTool, with the step's model in
+// $MODEL so a script can answer differently per model
+type modelShellTool struct{ shellTool }
+
+func (modelShellTool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	cmd := shellTool{}.BuildCommand(cfg, workDir, task)
+	cmd.Env = append(os.Environ(), "MODEL="+cfg.Model)
+	return cmd
+}
+
+func newModelDispatcher(t *testing.T) (*Dispatcher, *orchestrator.Context, *workspace.Workspace) {
+	t.Helper()
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	ctx := orchestrator.NewContext(map[string]string{"codebase": t.TempDir()})
+	return NewDispatcher(map[string]runner.Tool{"sh": modelShellTool{}}), ctx, ws
+}
+
+// Only opus writes a verdict
+const verdictTask = `echo "review by $MODEL"; if [ "$MODEL" = opus ]; then echo 'VERDICT: ship'; fi`
+
+func TestDispatcher_EscalatesUntilSuccessWhen(t *testing.T) {
+	d, ctx, ws := newModelDispatcher(t)
+
+	step := &bundle.Step{
+		Name:        "review",
+		Tool:        "sh",
+		Model:       "haiku",
+		Task:        verdictTask,
+		SuccessWhen: "${steps.review.output} contains 'VERDICT:'",
+		EscalateTo:  []string{"sonnet", "opus", "unused"},
+	}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Execute = %+v, %v", env, err)
+	}
+	if env.Result["model"] != "opus" {
+		t.Errorf("model = %v, want the first model whose output passed", env.Result["model"])
+	}
+	if env.Result["escalated"] != true {
+		t.Error("result should record the escalation")
+	}
+	if from, _ := env.Result["escalated_from"].([]string); !slices.Equal(from, []string{"haiku", "sonnet"}) {
+		t.Errorf("escalated_from = %v", env.Result["escalated_from"])
+	}
+	if got := ctx.Resolve("${steps.review.output}"); got != "review by opus\nVERDICT: ship\n" {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestDispatcher_SuccessWhenWithoutEscalation(t *testing.T) {
+	d, ctx, ws := newModelDispatcher(t)
+
+	// Passing on the first model runs once
+	step := &bundle.Step{Name: "review", Tool: "sh", Model: "opus", Task: verdictTask,
+		SuccessWhen: "${steps.review.output} contains 'VERDICT:'", EscalateTo: []string{"other"}}
+	env, _ := d.Execute(step, ctx, ws)
+	if env.Status != envelope.StatusSuccess || env.Result["escalated"] != nil {
+		t.Errorf("a passing result should not escalate: %+v", env)
+	}
+
+	// Failing every model fails the step
+	step = &bundle.Step{Name: "review", Tool: "sh", Model: "haiku", Task: verdictTask,
+		SuccessWhen: "${steps.review.output} contains 'VERDICT:'", EscalateTo: []string{"sonnet"}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "SUCCESS_CHECK_FAILED" {
+		t.Fatalf("expected SUCCESS_CHECK_FAILED, got %+v", env)
+	}
+	if from, _ := env.Result["escalated_from"].([]string); !slices.Equal(from, []string{"haiku"}) {
+		t.Errorf("escalated_from = %v", env.Result["escalated_from"])
+	}
+}
+
+func TestUsageTotals(t *testing.T) {
+	var spent usageTotals
+	spent.add(envelope.New().Success().WithResult("cost_usd", 0.01).WithResult("input_tokens", 100).Build())
+	spent.add(envelope.New().Success().WithResult("cost_usd", 0.02).WithResult("output_tokens", 5).WithResult("cache_read_tokens", 300).WithResult("cache_write_tokens", 40).Build())
+
+	env := envelope.New().Success().WithResult("cost_usd", 0.5).WithResult("input_tokens", 1000).WithResult("output_tokens", 50).Build()
+	spent.addTo(env)
+	if cost := env.Result["cost_usd"].(float64); cost < 0.5299 || cost > 0.5301 {
+		t.Errorf("cost_usd = %v, want 0.53", cost)
+	}
+	if env.Result["input_tokens"] != 1100 || env.Result["output_tokens"] != 55 {
+		t.Errorf("tokens = %v in, %v out", env.Result["input_tokens"], env.Result["output_tokens"])
+	}
+	if env.Result["cache_read_tokens"] != 300 || env.Result["cache_write_tokens"] != 40 {
+		t.Errorf("cache tokens = %v read, %v write", env.Result["cache_read_tokens"], env.Result["cache_write_tokens"])
+	}
+}
@@ -0,0 +1,215 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/workspace"
+)
+
+type ForeachExecutor struct {
+	Dispatcher *Dispatcher
+}
+
+// ForeachIteration is the outcome of one iteration in a foreach step's
+// "children" result, listed in item order
+type ForeachIteration struct {
+	Item       string          `json:"item"`
+	Name       string          `json:"name"`
+	Status     envelope.Status `json:"status"`
+	OutputRef  string          `json:"output_ref,omitempty"`
+	OutputHash string          `json:"output_hash,omitempty"`
+	CostUSD    float64         `json:"cost_usd,omitempty"`
+}
+
+// Execute runs step.Do once per item, one at a time, with ${item} bound to
+// the item. Each iteration runs as "<do name>-<n>" (the do step's name
+// defaults to the foreach step's), so its result can be referenced by later
+// steps; an iteration whose do condition is false is skipped. An empty list
+// succeeds with zero iterations. With step.Collect the iterations' outputs
+// are also gathered, in item order, into the "collected" result and the
+// step's own output.
+func (e *ForeachExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	if step.Do == nil {
+		return envelope.New().Failure("INVALID_FOREACH", "foreach step "+step.Name+" has no do step").Build(), nil
+	}
+	list := ctx.Resolve(step.Foreach)
+	if list == step.Foreach && strings.Contains(list, "${") {
+		return envelope.New().Failure("FOREACH_UNRESOLVED",
+			fmt.Sprintf("foreach step %s: %s did not resolve", step.Name, step.Foreach)).Build(), nil
+	}
+	items := foreachItems(list)
+
+	base := step.Do.Name
+	if base == "" {
+		base = step.Name
+	}
+
+	allSuccess := true
+	var totalCost float64
+	var totalInput, totalOutput, totalCacheRead, totalCacheWrite int
+	var firstErr error
+	iterations := make([]ForeachIteration, 0, len(items))
+	var collected []string
+	var hashes []string
+
+loop:
+	for i, item := range items {
+		select {
+		case <-ctx.Done():
+			// Aborted: report the iterations that ran
+			allSuccess = false
+			break loop
+		default:
+		}
+
+		iter := *step.Do
+		iter.Name = fmt.Sprintf("%s-%d", base, i+1)
+		restore := ctx.BindItem(item)
+		var env *envelope.Envelope
+		var err error
+		holds, condErr := ctx.EvaluateIf(iter.If)
+		switch {
+		case condErr != nil:
+			// Like a parallel substep's, a condition that can't be
+			// evaluated (strict_conditions) fails the whole loop
+			restore()
+			return envelope.New().Failure("CONDITION_ERROR", condErr.Error()).
+				WithResult("iterations", len(iterations)).
+				WithResult("children", iterations).
+				Build(), nil
+		case iter.If != "" && !holds:
+			env = &envelope.Envelope{Status: envelope.StatusSkipped}
+		default:
+			env, err = e.Dispatcher.Execute(&iter, ctx, ws)
+		}
+		restore()
+		if env == nil {
+			env = envelope.New().Failure("EXEC_FAILED", "iteration "+iter.Name+" returned no result").Build()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		ctx.SetResult(iter.Name, env) // Make available to later steps
+
+		if env.Status != envelope.StatusSuccess && env.Status != envelope.StatusSkipped {
+			allSuccess = false
+		}
+		cost, _ := env.Result["cost_usd"].(float64)
+		totalCost += cost
+		if t, ok := env.Result["input_tokens"].(int); ok {
+			totalInput += t
+		}
+		if t, ok := env.Result["output_tokens"].(int); ok {
+			totalOutput += t
+		}
+		if t, ok := env.Result["cache_read_tokens"].(int); ok {
+			totalCacheRead += t
+		}
+		if t, ok := env.Result["cache_write_tokens"].(int); ok {
+			totalCacheWrite += t
+		}
+		iterations = append(iterations, ForeachIteration{
+			Item:       item,
+			Name:       iter.Name,
+			Status:     env.Status,
+			OutputRef:  env.OutputRef,
+			OutputHash: env.OutputHash,
+			CostUSD:    cost,
+		})
+		hashes = append(hashes, env.OutputHash)
+		if step.Collect {
+			output, _ := ctx.EnvelopeOutput(env)
+			collected = append(collected, output)
+		}
+	}
+
+	status := envelope.StatusSuccess
+	if !allSuccess {
+		status = envelope.StatusPartial
+	}
+
+	// Without collect the loop has no output of its own, so its hash
+	// covers its iterations' hashes
+	env := &envelope.Envelope{
+		Status:     status,
+		OutputHash: envelope.HashOutput(strings.Join(hashes, "\n")),
+		Result: map[string]interface{}{
+			"iterations":         len(iterations),
+			"children":           iterations,
+			"cost_usd":           totalCost,
+			"input_tokens":       totalInput,
+			"output_tokens":      totalOutput,
+			"cache_read_tokens":  totalCacheRead,
+			"cache_write_tokens": totalCacheWrite,
+		},
+	}
+	if step.Collect {
+		if collected == nil {
+			collected = []string{}
+		}
+		env.Result["collected"] = collected
+		// "output" lets later steps use ${steps.<name>.output}
+		outputPath, err := ws.WriteOutput(step.Name, map[string]interface{}{
+			"output":    joinOutputs(collected),
+			"collected": collected,
+		})
+		if err != nil {
+			return envelope.New().Failure("WRITE_ERROR", err.Error()).Build(), err
+		}
+		env.OutputRef = outputPath
+		env.OutputHash = envelope.HashOutput(joinOutputs(collected))
+	}
+	return env, firstErr
+}
+
+// collectedOutputs returns the outputs a collecting foreach step gathered,
+// whether held in memory or decoded from JSON
+func collectedOutputs(env *envelope.Envelope) ([]string, bool) {
+	if env == nil {
+		return nil, false
+	}
+	switch collected := env.Result["collected"].(type) {
+	case []string:
+		return collected, true
+	case []interface{}:
+		outputs := make([]string, 0, len(collected))
+		for _, v := range collected {
+			s, _ := v.(string)
+			outputs = append(outputs, s)
+		}
+		return outputs, true
+	}
+	return nil, false
+}
+
+// foreachItems splits a resolved foreach list into items: the elements of a
+// JSON array (non-string elements as JSON), or else its non-blank lines
+func foreachItems(list string) []string {
+	trimmed := strings.TrimSpace(list)
+	var elems []interface{}
+	if strings.HasPrefix(trimmed, "[") && json.Unmarshal([]byte(trimmed), &elems) == nil {
+		items := make([]string, 0, len(elems))
+		for _, elem := range elems {
+			if s, ok := elem.(string); ok {
+				items = append(items, s)
+				continue
+			}
+			b, _ := json.Marshal(elem)
+			items = append(items, string(b))
+		}
+		return items
+	}
+
+	var items []string
+	for _, line := range strings.Split(trimmed, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items
+}
@@ -0,0 +1,221 @@
+package executor
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/runner"
+)
+
+func TestForeachExecutor_JSONList(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.Inputs["files"] = `["main.go", "util.go"]`
+
+	step := &bundle.Step{Name: "lint", Foreach: "${inputs.files}", Do: &bundle.Step{Tool: "sh", Task: "echo checking ${item}"}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess || env.Result["iterations"] != 2 {
+		t.Fatalf("expected 2 successful iterations, got %s %v", env.Status, env.Result)
+	}
+
+	children := env.Result["children"].([]ForeachIteration)
+	for i, want := range []string{"main.go", "util.go"} {
+		child := children[i]
+		if child.Item != want || child.Name != "lint-"+string(rune('1'+i)) || child.Status != envelope.StatusSuccess {
+			t.Errorf("children[%d] = %+v, want item %s", i, child, want)
+		}
+		data, err := os.ReadFile(child.OutputRef)
+		if err != nil || !strings.Contains(string(data), "checking "+want) {
+			t.Errorf("iteration %d output = %q (%v), want the item bound in the task", i, data, err)
+		}
+	}
+	if got := ctx.Resolve("${steps.lint-2.status}"); got != "success" {
+		t.Errorf("iteration results should be available to later steps, got %q", got)
+	}
+	if got := ctx.Resolve("${item}"); got != "${item}" {
+		t.Errorf("${item} should be unbound after the loop, got %q", got)
+	}
+}
+
+func TestForeachExecutor_SumsCacheTokens(t *testing.T) {
+	_, ctx, ws := newShellDispatcher(t)
+	d := NewDispatcher(map[string]runner.Tool{"claude": streamShellTool{}})
+	ctx.Inputs["files"] = "main.go\nutil.go"
+
+	step := &bundle.Step{Name: "review", Foreach: "${inputs.files}", Do: &bundle.Step{Tool: "claude", Task: usageTask(10, 5, 300, 40)}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Execute = %+v, %v", env, err)
+	}
+	if env.Result["cache_read_tokens"] != 600 || env.Result["cache_write_tokens"] != 80 {
+		t.Errorf("cache tokens = %v read, %v write; want 600 and 80", env.Result["cache_read_tokens"], env.Result["cache_write_tokens"])
+	}
+}
+
+func TestForeachExecutor_LineListWithFailure(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.Inputs["targets"] = "alpha\n\n  beta  \ngamma\n"
+
+	step := &bundle.Step{Name: "check", Foreach: "${inputs.targets}", Do: &bundle.Step{
+		Name: "probe", Tool: "sh", Task: `test "${item}" != beta`,
+	}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusPartial {
+		t.Errorf("a failed iteration should make the loop partial, got %s", env.Status)
+	}
+	var statuses []envelope.Status
+	var names []string
+	for _, child := range env.Result["children"].([]ForeachIteration) {
+		statuses = append(statuses, child.Status)
+		names = append(names, child.Name)
+	}
+	wantStatuses := []envelope.Status{envelope.StatusSuccess, envelope.StatusFailure, envelope.StatusSuccess}
+	if !reflect.DeepEqual(statuses, wantStatuses) {
+		t.Errorf("statuses = %v, want %v", statuses, wantStatuses)
+	}
+	if !reflect.DeepEqual(names, []string{"probe-1", "probe-2", "probe-3"}) {
+		t.Errorf("iterations should be named after the do step, got %v", names)
+	}
+}
+
+func TestForeachExecutor_DoCondition(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.Inputs["targets"] = "alpha\nbeta"
+
+	step := &bundle.Step{Name: "check", Foreach: "${inputs.targets}", Do: &bundle.Step{
+		Name: "probe", Tool: "sh", Task: "exit 1", If: "'${item}' == 'alpha'",
+	}}
+	env, _ := d.Execute(step, ctx, ws)
+	children := env.Result["children"].([]ForeachIteration)
+	if children[0].Status != envelope.StatusFailure || children[1].Status != envelope.StatusSkipped {
+		t.Errorf("statuses = %s, %s; want the beta iteration skipped", children[0].Status, children[1].Status)
+	}
+}
+
+func TestForeachExecutor_StrictConditions(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.SetStrictConditions(true)
+	ctx.Inputs["targets"] = "alpha\nbeta"
+
+	step := &bundle.Step{Name: "check", Foreach: "${inputs.targets}", Do: &bundle.Step{
+		Name: "probe", Tool: "sh", Task: "true", If: "${steps.setpu.status} == 'success'",
+	}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "CONDITION_ERROR" {
+		t.Fatalf("got %s %+v, want a CONDITION_ERROR failure", env.Status, env.Error)
+	}
+	if _, ran := ctx.GetResult("probe-1"); ran {
+		t.Error("no iteration should run once its condition fails to evaluate")
+	}
+}
+
+func TestForeachExecutor_EmptyList(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.Inputs["files"] = "[]"
+
+	step := &bundle.Step{Name: "lint", Foreach: "${inputs.files}", Do: &bundle.Step{Tool: "sh", Task: "exit 1"}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess || env.Result["iterations"] != 0 {
+		t.Errorf("an empty list should succeed with zero iterations, got %s %v", env.Status, env.Result)
+	}
+}
+
+func TestForeachExecutor_CollectOutputs(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.Inputs["sections"] = "intro\nbody\nconclusion"
+
+	step := &bundle.Step{Name: "draft", Foreach: "${inputs.sections}", Collect: true, Do: &bundle.Step{
+		Tool: "sh", Task: "echo draft of ${item}",
+	}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx.SetResult(step.Name, env)
+
+	want := []string{"draft of intro\n", "draft of body\n", "draft of conclusion\n"}
+	if got, _ := env.Result["collected"].([]string); !reflect.DeepEqual(got, want) {
+		t.Errorf("collected = %q, want the three outputs in item order", got)
+	}
+	if got, _ := ctx.StepOutput("draft"); got != "draft of intro\n\n---\n\ndraft of body\n\n---\n\ndraft of conclusion" {
+		t.Errorf("step output = %q, want the collected outputs joined", got)
+	}
+
+	merge := &bundle.Step{Name: "combined", Merge: &bundle.MergeDef{Inputs: []string{"draft"}, Strategy: "union"}}
+	env, err = d.Execute(merge, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("merge failed: %v %+v", err, env)
+	}
+	if env.Result["input_count"] != 3 {
+		t.Errorf("merge should read each collected output as an input, got %v", env.Result["input_count"])
+	}
+	if got := readMerged(t, env); got != "draft of intro\ndraft of body\ndraft of conclusion" {
+		t.Errorf("merged = %q", got)
+	}
+}
+
+func TestForeachExecutor_CollectEmptyList(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	ctx.Inputs["files"] = "[]"
+
+	step := &bundle.Step{Name: "lint", Foreach: "${inputs.files}", Collect: true, Do: &bundle.Step{Tool: "sh", Task: "true"}}
+	env, _ := d.Execute(step, ctx, ws)
+	if got, ok := env.Result["collected"].([]string); !ok || len(got) != 0 {
+		t.Errorf("collected = %#v, want an empty list", env.Result["collected"])
+	}
+}
+
+func TestForeachExecutor_Invalid(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	tests := []struct {
+		step *bundle.Step
+		code string
+	}{
+		{&bundle.Step{Name: "nodo", Foreach: "a\nb"}, "INVALID_FOREACH"},
+		{&bundle.Step{Name: "unbound", Foreach: "${steps.missing.output}", Do: &bundle.Step{Tool: "sh", Task: "true"}}, "FOREACH_UNRESOLVED"},
+	}
+	for _, tc := range tests {
+		env, err := d.Execute(tc.step, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if env.Error == nil || env.Error.Code != tc.code {
+			t.Errorf("step %s: expected %s, got %+v", tc.step.Name, tc.code, env.Error)
+		}
+	}
+}
+
+func TestForeachItems(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{`["a", "b c"]`, []string{"a", "b c"}},
+		{`[1, {"path": "x.go"}, "y"]`, []string{"1", `{"path":"x.go"}`, "y"}},
+		{"one\r\n two \n\nthree", []string{"one", "two", "three"}},
+		{"[not json", []string{"[not json"}},
+		{"  ", nil},
+		{"[]", []string{}},
+	}
+	for _, tc := range tests {
+		if got := foreachItems(tc.list); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("foreachItems(%q) = %#v, want %#v", tc.list, got, tc.want)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package executor
 
 import (
 	"fmt"
-	"os"
+	"slices"
 	"strings"
 
 	"rcodegen/pkg/bundle"
@@ -11,17 +11,49 @@ import (
 	"rcodegen/pkg/workspace"
 )
 
+// Merge strategies
+const (
+	MergeConcat = "concat" // Inputs joined in order (default)
+	MergeUnion  = "union"  // Distinct lines across all inputs, first occurrence first
+	MergeDedupe = "dedupe" // Like union, but lines differing only in case or spacing count as duplicates
+)
+
 type MergeExecutor struct {
 	ToolExecutor *ToolExecutor
 }
 
 func (e *MergeExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
-	// Collect inputs
+	strategy := step.Merge.Strategy
+	if strategy == "" {
+		strategy = MergeConcat
+	}
+	if !slices.Contains(bundle.MergeStrategies, strategy) {
+		return envelope.New().Failure("INVALID_MERGE_STRATEGY",
+			fmt.Sprintf("unknown merge strategy %q (valid: %s)", strategy, strings.Join(bundle.MergeStrategies, ", "))).Build(), nil
+	}
+
+	// Collect inputs: a bare step name reads that step's output (each output
+	// of a collecting foreach), a reference like ${steps.x.output_ref} names
+	// the file to read
 	var contents []string
 	var failedInputs []string
 	for _, inputRef := range step.Merge.Inputs {
+		if !strings.Contains(inputRef, "${") {
+			env, _ := ctx.GetResult(inputRef)
+			if collected, ok := collectedOutputs(env); ok {
+				contents = append(contents, collected...)
+				continue
+			}
+			content, ok := ctx.StepOutput(inputRef)
+			if !ok {
+				failedInputs = append(failedInputs, inputRef+": no output")
+				continue
+			}
+			contents = append(contents, content)
+			continue
+		}
 		path := ctx.Resolve(inputRef)
-		data, err := os.ReadFile(path)
+		data, err := ws.ReadOutput(path)
 		if err != nil {
 			failedInputs = append(failedInputs, fmt.Sprintf("%s: %v", inputRef, err))
 			continue
@@ -30,18 +62,20 @@ func (e *MergeExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws
 	}
 
 	var merged string
-	switch step.Merge.Strategy {
-	case "concat":
-		merged = strings.Join(contents, "\n\n---\n\n")
-	case "union", "dedupe":
-		// For now, just concat - could add deduplication later
-		merged = strings.Join(contents, "\n\n")
-	default:
-		merged = strings.Join(contents, "\n\n")
+	switch strategy {
+	case MergeConcat:
+		merged = joinOutputs(contents)
+	case MergeUnion:
+		merged = mergeLines(contents, func(line string) string { return line })
+	case MergeDedupe:
+		merged = mergeLines(contents, func(line string) string {
+			return strings.ToLower(strings.Join(strings.Fields(line), " "))
+		})
 	}
 
-	// Write merged output
+	// Write merged output; "output" lets later steps use ${steps.<name>.output}
 	outputPath, err := ws.WriteOutput(step.Name, map[string]interface{}{
+		"output":      merged,
 		"merged":      merged,
 		"input_count": len(contents),
 	})
@@ -52,7 +86,37 @@ func (e *MergeExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws
 	return envelope.New().
 		Success().
 		WithOutputRef(outputPath).
+		WithOutputHash(merged).
+		WithResult("strategy", strategy).
 		WithResult("input_count", len(contents)).
 		WithResult("failed_inputs", failedInputs).
 		Build(), nil
 }
+
+// mergeLines returns the lines of all inputs in order, keeping only the first
+// line with each key. Blank lines are dropped.
+func mergeLines(contents []string, key func(string) string) string {
+	seen := make(map[string]bool)
+	var lines []string
+	for _, content := range contents {
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimRight(line, " \t\r")
+			k := key(line)
+			if strings.TrimSpace(line) == "" || seen[k] {
+				continue
+			}
+			seen[k] = true
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// joinOutputs concatenates outputs in order, separated by horizontal rules
+func joinOutputs(outputs []string) string {
+	parts := make([]string, len(outputs))
+	for i, output := range outputs {
+		parts[i] = strings.TrimRight(output, "\r\n")
+	}
+	return strings.Join(parts, "\n\n---\n\n")
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/workspace"
+)
+
+// recordStep stores output as the result of a completed step
+func recordStep(t *testing.T, ctx *orchestrator.Context, ws *workspace.Workspace, name, output string) {
+	t.Helper()
+	ref, err := ws.WriteStepResult(name, output, output, "")
+	if err != nil {
+		t.Fatalf("WriteStepResult: %v", err)
+	}
+	ctx.SetResult(name, &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: ref})
+}
+
+// readMerged returns the merged text stored at the envelope's output ref
+func readMerged(t *testing.T, env *envelope.Envelope) string {
+	t.Helper()
+	data, err := os.ReadFile(env.OutputRef)
+	if err != nil {
+		t.Fatalf("reading merge output: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("merge output is not JSON: %v", err)
+	}
+	merged, _ := out["merged"].(string)
+	return merged
+}
+
+func TestMergeExecutor_Strategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"concat", "- fix parser\n- add tests\n\n---\n\n- add tests\n-  Fix   Parser\n\n- update docs"},
+		{"", "- fix parser\n- add tests\n\n---\n\n- add tests\n-  Fix   Parser\n\n- update docs"},
+		{"union", "- fix parser\n- add tests\n-  Fix   Parser\n- update docs"},
+		{"dedupe", "- fix parser\n- add tests\n- update docs"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.strategy, func(t *testing.T) {
+			e := &MergeExecutor{}
+			_, ctx, ws := newShellExecutor(t)
+			recordStep(t, ctx, ws, "claude-review", "- fix parser\n- add tests\n")
+			recordStep(t, ctx, ws, "gemini-review", "- add tests\n-  Fix   Parser\n\n- update docs\n")
+
+			step := &bundle.Step{Name: "combined", Merge: &bundle.MergeDef{
+				Inputs:   []string{"claude-review", "gemini-review"},
+				Strategy: tc.strategy,
+			}}
+			env, err := e.Execute(step, ctx, ws)
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			if env.Status != envelope.StatusSuccess || env.OutputRef == "" {
+				t.Fatalf("expected a success with an output_ref, got %+v", env)
+			}
+			if env.Result["input_count"] != 2 {
+				t.Errorf("input_count = %v, want 2", env.Result["input_count"])
+			}
+			if got := readMerged(t, env); got != tc.want {
+				t.Errorf("merged = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeExecutor_ReferencesAndChaining(t *testing.T) {
+	e := &MergeExecutor{}
+	_, ctx, ws := newShellExecutor(t)
+	ws.PersistFormat = workspace.PersistRaw
+	recordStep(t, ctx, ws, "a", "one\ntwo")
+	recordStep(t, ctx, ws, "b", "two\nthree")
+
+	// ${steps.x.output_ref} inputs name the file to read
+	first := &bundle.Step{Name: "first", Merge: &bundle.MergeDef{
+		Inputs:   []string{"${steps.a.output_ref}", "${steps.b.output_ref}"},
+		Strategy: "union",
+	}}
+	env, err := e.Execute(first, ctx, ws)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	ctx.SetResult("first", env)
+
+	// A merge's output can feed another merge by name
+	recordStep(t, ctx, ws, "c", "three\nfour")
+	second := &bundle.Step{Name: "second", Merge: &bundle.MergeDef{Inputs: []string{"first", "c", "missing"}, Strategy: "union"}}
+	env, err = e.Execute(second, ctx, ws)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if got, want := readMerged(t, env), "one\ntwo\nthree\nfour"; got != want {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+	if failed, _ := env.Result["failed_inputs"].([]string); len(failed) != 1 {
+		t.Errorf("failed_inputs = %v, want the missing step", env.Result["failed_inputs"])
+	}
+}
+
+func TestMergeExecutor_UnknownStrategy(t *testing.T) {
+	e := &MergeExecutor{}
+	_, ctx, ws := newShellExecutor(t)
+
+	step := &bundle.Step{Name: "combined", Merge: &bundle.MergeDef{Inputs: []string{"a"}, Strategy: "zip"}}
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if env.Error == nil || env.Error.Code != "INVALID_MERGE_STRATEGY" {
+		t.Errorf("expected INVALID_MERGE_STRATEGY, got %+v", env.Error)
+	}
+}
@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/workspace"
+)
+
+// writeOutputs writes each of step's named outputs to its own file and
+// records the paths in env's "outputs" result. A field is taken from the
+// step's result, or else from its output parsed as a JSON object; fields
+// the step did not produce are listed under "missing_outputs".
+func writeOutputs(step *bundle.Step, env *envelope.Envelope, ctx *orchestrator.Context, ws *workspace.Workspace) *envelope.Envelope {
+	names := make([]string, 0, len(step.Outputs))
+	for name, file := range step.Outputs {
+		if err := checkOutputFile(file); err != nil {
+			return envelope.New().
+				WithOutputRef(env.OutputRef).
+				Failure("INVALID_OUTPUT", fmt.Sprintf("step %s output %s: %v", step.Name, name, err)).
+				Build()
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parsed map[string]interface{}
+	if text, ok := ctx.EnvelopeOutput(env); ok {
+		parsed = parseJSONObject(text)
+	}
+
+	written := make(map[string]string, len(names))
+	var missing []string
+	for _, name := range names {
+		value, ok := env.Result[name]
+		if !ok {
+			value, ok = parsed[name]
+		}
+		if !ok || value == nil {
+			missing = append(missing, name)
+			continue
+		}
+		path, err := ws.WriteNamedOutput(step.Name, step.Outputs[name], outputBytes(value))
+		if err != nil {
+			return envelope.New().
+				WithOutputRef(env.OutputRef).
+				Failure("OUTPUT_WRITE_FAILED", fmt.Sprintf("step %s output %s: %v", step.Name, name, err)).
+				Build()
+		}
+		written[name] = path
+	}
+
+	if env.Result == nil {
+		env.Result = make(map[string]interface{})
+	}
+	env.Result["outputs"] = written
+	if len(missing) > 0 {
+		env.Result["missing_outputs"] = missing
+	}
+	return env
+}
+
+// checkOutputFile rejects output file names that would escape the step's
+// outputs directory
+func checkOutputFile(file string) error {
+	if file == "" {
+		return fmt.Errorf("empty file name")
+	}
+	if filepath.IsAbs(file) {
+		return fmt.Errorf("file %q must be relative", file)
+	}
+	clean := filepath.Clean(file)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("file %q is outside the outputs directory", file)
+	}
+	return nil
+}
+
+// parseJSONObject parses text as a JSON object, also accepting one
+// surrounded by prose or a Markdown code fence; nil if there is none
+func parseJSONObject(text string) map[string]interface{} {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start == -1 || end < start {
+		return nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(text[start:end+1]), &obj); err != nil {
+		return nil
+	}
+	return obj
+}
+
+// outputBytes renders a result value as file content: strings as-is,
+// anything else as indented JSON
+func outputBytes(value interface{}) []byte {
+	if s, ok := value.(string); ok {
+		return []byte(s)
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return []byte(fmt.Sprint(value))
+	}
+	return append(data, '\n')
+}
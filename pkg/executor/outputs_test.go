@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func TestDispatcher_WritesNamedOutputs(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{
+		Name:    "audit",
+		Tool:    "sh",
+		Task:    `printf '%s\n' 'Done: {"report": "# Audit\nAll good", "patch": "--- a/x\n+++ b/x", "score": 9}'`,
+		Outputs: map[string]string{"report": "report.md", "patch": "fix.patch", "notes": "notes.txt"},
+	}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success, got %s (%+v)", env.Status, env.Error)
+	}
+
+	outputs, ok := env.Result["outputs"].(map[string]string)
+	if !ok || len(outputs) != 2 {
+		t.Fatalf("outputs = %#v, want report and patch", env.Result["outputs"])
+	}
+	for name, want := range map[string]string{"report": "# Audit\nAll good", "patch": "--- a/x\n+++ b/x"} {
+		path := outputs[name]
+		if path != filepath.Join(ws.JobDir, "outputs", "audit", step.Outputs[name]) {
+			t.Errorf("%s written to %s", name, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+	if missing, _ := env.Result["missing_outputs"].([]string); len(missing) != 1 || missing[0] != "notes" {
+		t.Errorf("missing_outputs = %v, want [notes]", env.Result["missing_outputs"])
+	}
+}
+
+func TestDispatcher_NamedOutputsFromResult(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{
+		Name:    "cheap",
+		Tool:    "sh",
+		Task:    "echo plain text",
+		Outputs: map[string]string{"output_length": "length.json"},
+	}
+	env, _ := d.Execute(step, ctx, ws)
+	path := env.Result["outputs"].(map[string]string)["output_length"]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	if string(data) != "11\n" {
+		t.Errorf("output_length file = %q, want the JSON-encoded result", data)
+	}
+}
+
+func TestDispatcher_RejectsEscapingOutputFile(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	for _, file := range []string{"../escape.md", "/tmp/escape.md", ""} {
+		step := &bundle.Step{
+			Name:    "audit",
+			Tool:    "sh",
+			Task:    `echo '{"report": "x"}'`,
+			Outputs: map[string]string{"report": file},
+		}
+		env, _ := d.Execute(step, ctx, ws)
+		if env.Status != envelope.StatusFailure || env.Error.Code != "INVALID_OUTPUT" {
+			t.Errorf("file %q: expected INVALID_OUTPUT, got %s %+v", file, env.Status, env.Error)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package executor
 
 import (
+	"strings"
 	"sync"
 
 	"rcodegen/pkg/bundle"
@@ -13,48 +14,106 @@ type ParallelExecutor struct {
 	Dispatcher *Dispatcher
 }
 
+// ParallelChild is the outcome of one substep in a parallel step's
+// "children" result, listed in declaration order
+type ParallelChild struct {
+	Name       string          `json:"name"`
+	Status     envelope.Status `json:"status"`
+	OutputRef  string          `json:"output_ref,omitempty"`
+	OutputHash string          `json:"output_hash,omitempty"`
+	CostUSD    float64         `json:"cost_usd,omitempty"`
+}
+
 func (e *ParallelExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
 	var wg sync.WaitGroup
-	results := make(map[string]*envelope.Envelope)
+	// Indexed by declaration order, so aggregation does not depend on
+	// which substep finishes first
+	results := make([]*envelope.Envelope, len(step.Parallel))
 	var mu sync.Mutex
 	var firstErr error
 
-	for _, substep := range step.Parallel {
+	// With max_concurrency, a substep starts only once it holds a slot
+	var slots chan struct{}
+	if step.MaxConcurrency > 0 && step.MaxConcurrency < len(step.Parallel) {
+		slots = make(chan struct{}, step.MaxConcurrency)
+	}
+
+	for i, substep := range step.Parallel {
+		if slots != nil {
+			slots <- struct{}{}
+		}
 		wg.Add(1)
-		go func(s bundle.Step) {
+		go func(i int, s bundle.Step) {
 			defer wg.Done()
-			env, err := e.Dispatcher.Execute(&s, ctx, ws)
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			var env *envelope.Envelope
+			var err error
+			holds, condErr := ctx.EvaluateIf(s.If)
+			switch {
+			case condErr != nil:
+				env = envelope.New().Failure("CONDITION_ERROR", condErr.Error()).Build()
+			case s.If != "" && !holds:
+				env = &envelope.Envelope{Status: envelope.StatusSkipped}
+			default:
+				env, err = e.Dispatcher.Execute(&s, ctx, ws)
+			}
+			if env == nil {
+				env = envelope.New().Failure("EXEC_FAILED", "substep "+s.Name+" returned no result").Build()
+			}
 			mu.Lock()
 			defer mu.Unlock()
 			if err != nil && firstErr == nil {
 				firstErr = err
 			}
-			results[s.Name] = env
+			results[i] = env
 			ctx.SetResult(s.Name, env) // Make available to later steps
-		}(substep)
+		}(i, substep)
 	}
 
 	wg.Wait()
 
 	// Build aggregate result with summed costs
 	allSuccess := true
+	skipped := 0
 	var totalCost float64
-	var totalInput, totalOutput int
+	var totalInput, totalOutput, totalCacheRead, totalCacheWrite int
+	children := make([]ParallelChild, 0, len(results))
+	hashes := make([]string, 0, len(results))
 
-	for _, env := range results {
-		if env.Status != envelope.StatusSuccess {
+	for i, env := range results {
+		// A skipped child did not fail, so it does not downgrade the group
+		switch env.Status {
+		case envelope.StatusSuccess:
+		case envelope.StatusSkipped:
+			skipped++
+		default:
 			allSuccess = false
 		}
 		// Aggregate costs from substeps
-		if c, ok := env.Result["cost_usd"].(float64); ok {
-			totalCost += c
-		}
+		cost, _ := env.Result["cost_usd"].(float64)
+		totalCost += cost
 		if t, ok := env.Result["input_tokens"].(int); ok {
 			totalInput += t
 		}
 		if t, ok := env.Result["output_tokens"].(int); ok {
 			totalOutput += t
 		}
+		if t, ok := env.Result["cache_read_tokens"].(int); ok {
+			totalCacheRead += t
+		}
+		if t, ok := env.Result["cache_write_tokens"].(int); ok {
+			totalCacheWrite += t
+		}
+		children = append(children, ParallelChild{
+			Name:       step.Parallel[i].Name,
+			Status:     env.Status,
+			OutputRef:  env.OutputRef,
+			OutputHash: env.OutputHash,
+			CostUSD:    cost,
+		})
+		hashes = append(hashes, env.OutputHash)
 	}
 
 	status := envelope.StatusSuccess
@@ -62,14 +121,31 @@ func (e *ParallelExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context,
 		status = envelope.StatusPartial
 	}
 
-	return &envelope.Envelope{
-		Status: status,
+	// A parallel block has no output of its own; its hash covers its
+	// children's, so blocks whose candidates agree share a hash
+	env := &envelope.Envelope{
+		Status:     status,
+		OutputHash: envelope.HashOutput(strings.Join(hashes, "\n")),
 		Result: map[string]interface{}{
-			"steps":        len(results),
-			"completed":    len(results),
-			"cost_usd":     totalCost,
-			"input_tokens": totalInput,
-			"output_tokens": totalOutput,
+			"steps":              len(results),
+			"completed":          len(results) - skipped,
+			"skipped":            skipped,
+			"cost_usd":           totalCost,
+			"input_tokens":       totalInput,
+			"output_tokens":      totalOutput,
+			"cache_read_tokens":  totalCacheRead,
+			"cache_write_tokens": totalCacheWrite,
+			"children":           children,
 		},
-	}, firstErr
+	}
+	// A substep condition that can't be evaluated (strict_conditions) is a
+	// bundle error, so it fails the whole block rather than one branch
+	for _, child := range results {
+		if child.Error != nil && child.Error.Code == "CONDITION_ERROR" {
+			env.Status = envelope.StatusFailure
+			env.Error = child.Error
+			break
+		}
+	}
+	return env, firstErr
 }
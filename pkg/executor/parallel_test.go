@@ -0,0 +1,317 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/runner"
+)
+
+func TestParallelExecutor_ChildrenInDeclarationOrder(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	// Earlier substeps sleep longer, so they finish in reverse order
+	names := []string{"first", "second", "third", "fourth"}
+	var substeps []bundle.Step
+	for i, name := range names {
+		substeps = append(substeps, bundle.Step{
+			Name: name,
+			Tool: "sh",
+			Task: fmt.Sprintf("sleep 0.%d; echo %s", len(names)-i, name),
+		})
+	}
+	step := &bundle.Step{Name: "fanout", Parallel: substeps}
+
+	for run := 0; run < 3; run++ {
+		env, err := d.Execute(step, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if env.Status != envelope.StatusSuccess {
+			t.Fatalf("expected success, got %s", env.Status)
+		}
+
+		children, ok := env.Result["children"].([]ParallelChild)
+		if !ok {
+			t.Fatalf("expected children to be []ParallelChild, got %T", env.Result["children"])
+		}
+		if len(children) != len(names) {
+			t.Fatalf("expected %d children, got %d", len(names), len(children))
+		}
+		for i, child := range children {
+			if child.Name != names[i] {
+				t.Errorf("run %d: children[%d] = %s, want %s", run, i, child.Name, names[i])
+			}
+			if child.Status != envelope.StatusSuccess || child.OutputRef == "" {
+				t.Errorf("run %d: child %s = %+v, want success with an output ref", run, child.Name, child)
+			}
+		}
+	}
+}
+
+func TestDispatcher_GroupOutputHashes(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	block := func(name, answer string) *envelope.Envelope {
+		t.Helper()
+		env, err := d.Execute(&bundle.Step{Name: name, Parallel: []bundle.Step{
+			{Name: name + "-a", Tool: "sh", Task: "echo " + answer},
+			{Name: name + "-b", Tool: "sh", Task: "echo done"},
+		}}, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return env
+	}
+	first, same, other := block("first", "yes"), block("same", "yes"), block("other", "no")
+	if first.OutputHash == "" || first.OutputHash != same.OutputHash || first.OutputHash == other.OutputHash {
+		t.Errorf("parallel hashes %q %q %q, want equal only for agreeing children", first.OutputHash, same.OutputHash, other.OutputHash)
+	}
+	children := first.Result["children"].([]ParallelChild)
+	if children[0].OutputHash != envelope.HashOutput("yes") {
+		t.Errorf("child output_hash = %q, want the child's own hash", children[0].OutputHash)
+	}
+
+	loop := &bundle.Step{Name: "loop", Foreach: "a\nb", Collect: true, Do: &bundle.Step{Tool: "sh", Task: "echo ${item}"}}
+	env, err := d.Execute(loop, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.OutputHash != envelope.HashOutput(joinOutputs([]string{"a\n", "b\n"})) {
+		t.Errorf("collecting foreach output_hash = %q, want the hash of its collected output", env.OutputHash)
+	}
+
+	noop, _ := d.Execute(&bundle.Step{Name: "marker", Noop: true}, ctx, ws)
+	if noop.OutputHash != envelope.HashOutput("") {
+		t.Errorf("noop output_hash = %q, want the hash of an empty output", noop.OutputHash)
+	}
+}
+
+func TestParallelExecutor_ChildStatuses(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{Name: "mixed", Parallel: []bundle.Step{
+		{Name: "ok", Tool: "sh", Task: "sleep 0.2; true"},
+		{Name: "broken", Tool: "sh", Task: "exit 1"},
+	}}
+
+	env, _ := d.Execute(step, ctx, ws)
+	if env.Status != envelope.StatusPartial {
+		t.Errorf("expected partial status, got %s", env.Status)
+	}
+	children := env.Result["children"].([]ParallelChild)
+	if children[0].Name != "ok" || children[0].Status != envelope.StatusSuccess {
+		t.Errorf("children[0] = %+v, want ok/success", children[0])
+	}
+	if children[1].Name != "broken" || children[1].Status != envelope.StatusFailure {
+		t.Errorf("children[1] = %+v, want broken/failure", children[1])
+	}
+}
+
+func TestParallelExecutor_ChildStatusConditions(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{Name: "reviews", Parallel: []bundle.Step{
+		{Name: "review-a", Tool: "sh", Task: "true"},
+		{Name: "review-b", Tool: "sh", Task: "exit 1"},
+	}}
+	env, _ := d.Execute(step, ctx, ws)
+	ctx.SetResult(step.Name, env)
+
+	if !orchestrator.EvaluateCondition("any_failed(reviews)", ctx) {
+		t.Error("expected any_failed(reviews) to be true for a partial group")
+	}
+	if orchestrator.EvaluateCondition("all_succeeded(reviews)", ctx) {
+		t.Error("expected all_succeeded(reviews) to be false for a partial group")
+	}
+}
+
+func TestParallelExecutor_SkippedChildKeepsSuccess(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{Name: "checks", Parallel: []bundle.Step{
+		{Name: "lint", Tool: "sh", Task: "true"},
+		{Name: "deploy", Tool: "sh", Task: "exit 1", If: "false"},
+	}}
+
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Errorf("expected success with a skipped child, got %s", env.Status)
+	}
+	if env.Result["completed"] != 1 || env.Result["skipped"] != 1 {
+		t.Errorf("completed/skipped = %v/%v, want 1/1", env.Result["completed"], env.Result["skipped"])
+	}
+	children := env.Result["children"].([]ParallelChild)
+	if children[1].Name != "deploy" || children[1].Status != envelope.StatusSkipped {
+		t.Errorf("children[1] = %+v, want deploy/skipped", children[1])
+	}
+	if got, ok := ctx.GetResult("deploy"); !ok || got.Status != envelope.StatusSkipped {
+		t.Errorf("expected deploy to be recorded as skipped, got %+v", got)
+	}
+}
+
+func TestParallelExecutor_SkippedChildWithFailure(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{Name: "checks", Parallel: []bundle.Step{
+		{Name: "lint", Tool: "sh", Task: "exit 1"},
+		{Name: "deploy", Tool: "sh", Task: "true", If: "false"},
+	}}
+
+	env, _ := d.Execute(step, ctx, ws)
+	if env.Status != envelope.StatusPartial {
+		t.Errorf("expected partial when a child fails alongside a skipped one, got %s", env.Status)
+	}
+}
+
+func TestParallelExecutor_StrictConditions(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			d, ctx, ws := newShellDispatcher(t)
+			ctx.SetStrictConditions(strict)
+
+			step := &bundle.Step{Name: "checks", Parallel: []bundle.Step{
+				{Name: "lint", Tool: "sh", Task: "true"},
+				{Name: "deploy", Tool: "sh", Task: "true", If: "${steps.lnit.status} == 'success'"},
+			}}
+			env, err := d.Execute(step, ctx, ws)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strict {
+				// The typo'd reference just makes the condition false
+				if env.Status != envelope.StatusSuccess || env.Result["skipped"] != 1 {
+					t.Errorf("lenient: got %s with %v skipped, want success with deploy skipped", env.Status, env.Result["skipped"])
+				}
+				return
+			}
+			if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "CONDITION_ERROR" {
+				t.Fatalf("strict: got %s %+v, want a CONDITION_ERROR failure", env.Status, env.Error)
+			}
+			if !strings.Contains(env.Error.Message, "${steps.lnit.status}") {
+				t.Errorf("error should name the unresolved reference, got %q", env.Error.Message)
+			}
+		})
+	}
+}
+
+// usageTask is a task for a stream-json tool that reports the given usage
+func usageTask(input, output, cacheRead, cacheWrite int) string {
+	return fmt.Sprintf(`echo '{"type":"result","result":"done","total_cost_usd":0.01,"usage":{"input_tokens":%d,"output_tokens":%d,"cache_read_input_tokens":%d,"cache_creation_input_tokens":%d}}'`,
+		input, output, cacheRead, cacheWrite)
+}
+
+func TestParallelExecutor_SumsCacheTokens(t *testing.T) {
+	_, ctx, ws := newShellDispatcher(t)
+	d := NewDispatcher(map[string]runner.Tool{"claude": streamShellTool{}})
+
+	step := &bundle.Step{Name: "fanout", Parallel: []bundle.Step{
+		{Name: "a", Tool: "claude", Task: usageTask(10, 5, 300, 40)},
+		{Name: "b", Tool: "claude", Task: usageTask(20, 7, 100, 2)},
+	}}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Execute = %+v, %v", env, err)
+	}
+	if env.Result["input_tokens"] != 30 || env.Result["output_tokens"] != 12 {
+		t.Errorf("tokens = %v in, %v out; want 30 and 12", env.Result["input_tokens"], env.Result["output_tokens"])
+	}
+	if env.Result["cache_read_tokens"] != 400 || env.Result["cache_write_tokens"] != 42 {
+		t.Errorf("cache tokens = %v read, %v write; want 400 and 42", env.Result["cache_read_tokens"], env.Result["cache_write_tokens"])
+	}
+}
+
+func TestParallelExecutor_MaxConcurrency(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	// Each substep marks itself running, records how many are running, and
+	// clears its mark before exiting
+	running := t.TempDir()
+	counts := filepath.Join(t.TempDir(), "counts")
+	var substeps []bundle.Step
+	for i := 0; i < 6; i++ {
+		substeps = append(substeps, bundle.Step{
+			Name: fmt.Sprintf("call-%d", i),
+			Tool: "sh",
+			Task: fmt.Sprintf("touch %[1]s/%[2]d; ls %[1]s | wc -l >> %[3]s; sleep 0.15; rm %[1]s/%[2]d", running, i, counts),
+		})
+	}
+	step := &bundle.Step{Name: "fanout", Parallel: substeps, MaxConcurrency: 2}
+
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success, got %v %+v", err, env)
+	}
+	data, err := os.ReadFile(counts)
+	if err != nil {
+		t.Fatalf("reading counts: %v", err)
+	}
+	peak := 0
+	for _, field := range strings.Fields(string(data)) {
+		n, _ := strconv.Atoi(field)
+		peak = max(peak, n)
+	}
+	if peak != 2 {
+		t.Errorf("at most 2 substeps should run at once, and 2 should overlap; peak was %d", peak)
+	}
+	if children := env.Result["children"].([]ParallelChild); len(children) != 6 {
+		t.Errorf("expected all 6 substeps to run, got %d", len(children))
+	}
+}
+
+func TestParallelExecutor_UnlimitedByDefault(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	running := t.TempDir()
+	counts := filepath.Join(t.TempDir(), "counts")
+	var substeps []bundle.Step
+	for i := 0; i < 4; i++ {
+		substeps = append(substeps, bundle.Step{
+			Name: fmt.Sprintf("call-%d", i),
+			Tool: "sh",
+			Task: fmt.Sprintf("touch %[1]s/%[2]d; sleep 0.3; ls %[1]s | wc -l >> %[3]s", running, i, counts),
+		})
+	}
+	if _, err := d.Execute(&bundle.Step{Name: "fanout", Parallel: substeps}, ctx, ws); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(counts)
+	if !strings.Contains(string(data), "4") {
+		t.Errorf("without max_concurrency all 4 substeps should run together, counts:\n%s", data)
+	}
+}
+
+// Run with -race: substeps record their results and resolve each other's
+// while running side by side
+func TestParallelExecutor_ConcurrentContextAccess(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	var substeps []bundle.Step
+	for i := 0; i < 12; i++ {
+		substeps = append(substeps, bundle.Step{
+			Name: fmt.Sprintf("sub-%d", i),
+			Tool: "sh",
+			If:   "count_status(sub-, failure) == 0",
+			Task: fmt.Sprintf("echo '%d ${steps.sub-%d.status}'", i, (i+1)%12),
+		}, bundle.Step{Name: fmt.Sprintf("mark-%d", i), Noop: true})
+	}
+	env, err := d.Execute(&bundle.Step{Name: "fanout", Parallel: substeps}, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success, got %v %+v", err, env)
+	}
+	for _, s := range substeps {
+		if r, ok := ctx.GetResult(s.Name); !ok || r.Status != envelope.StatusSuccess {
+			t.Errorf("%s result = %+v", s.Name, r)
+		}
+	}
+}
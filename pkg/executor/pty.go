@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// errPTYUnsupported is returned by startPTY on platforms without
+// pseudo-terminals
+var errPTYUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+// ptyCapture runs a command on a pseudo-terminal, for tools that only
+// stream (or colorize, or print at all) when they see a TTY. The terminal
+// merges the command's stdout and stderr into one stream.
+type ptyCapture struct {
+	master *os.File
+	tty    *os.File
+	out    *detachableWriter
+	done   chan struct{}
+}
+
+// startPTY opens a pseudo-terminal, connects cmd's stdin, stdout and stderr
+// to it and starts copying what the command writes to out. Call finish once
+// the command has exited.
+func startPTY(cmd *exec.Cmd, out io.Writer) (*ptyCapture, error) {
+	master, tty, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	setControllingTTY(cmd)
+
+	p := &ptyCapture{master: master, tty: tty, out: &detachableWriter{w: out}, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		// Terminals end lines with \r\n; store them as \n like piped output
+		w := &crlfWriter{w: p.out}
+		io.Copy(w, master) // Ends with an EIO error once the terminal is closed
+		w.Flush()
+	}()
+	return p, nil
+}
+
+// finish closes the terminal and waits for the command's remaining output
+// to be copied. A child of the command that still holds the terminal open
+// is not waited for beyond abortWait: the copy is detached from out, so
+// nothing the child prints later lands in the step's (or a retry's)
+// output, and stopped by closing the master.
+func (p *ptyCapture) finish() {
+	p.tty.Close()
+	select {
+	case <-p.done:
+		p.master.Close()
+		return
+	case <-time.After(abortWait):
+	}
+	p.out.detach()
+	p.master.Close() // Non-blocking, so this ends the pending read
+	select {
+	case <-p.done:
+	case <-time.After(abortWait):
+	}
+}
+
+// detachableWriter passes writes to w until detach is called, then drops
+// them
+type detachableWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (d *detachableWriter) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.w == nil {
+		return len(p), nil
+	}
+	return d.w.Write(p)
+}
+
+// detach stops passing writes on; it returns once a write in progress ends
+func (d *detachableWriter) detach() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w = nil
+}
+
+// crlfWriter converts \r\n line endings to \n, holding back a trailing \r
+// until the next write shows whether a \n follows it
+type crlfWriter struct {
+	w       io.Writer
+	pending bool // The last write ended in \r
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	data := p
+	if c.pending {
+		data = append([]byte{'\r'}, p...)
+		c.pending = false
+	}
+	if len(data) > 0 && data[len(data)-1] == '\r' {
+		data = data[:len(data)-1]
+		c.pending = true
+	}
+	if _, err := c.w.Write(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes a held-back trailing \r
+func (c *crlfWriter) Flush() {
+	if c.pending {
+		c.w.Write([]byte{'\r'})
+		c.pending = false
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+)
+
+func openPTY() (master, tty *os.File, err error) {
+	return nil, nil, errPTYUnsupported
+}
+
+func setControllingTTY(cmd *exec.Cmd) {}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// skipWithoutPTY skips the test where pseudo-terminals are unavailable
+func skipWithoutPTY(t *testing.T) {
+	t.Helper()
+	master, tty, err := openPTY()
+	if err != nil {
+		t.Skipf("pseudo-terminals unavailable: %v", err)
+	}
+	master.Close()
+	tty.Close()
+}
+
+func TestToolExecutor_PTYCapturesTTYOutput(t *testing.T) {
+	skipWithoutPTY(t)
+	e, ctx, ws := newShellExecutor(t)
+
+	task := `if [ -t 1 ]; then echo "stdout is a tty"; else echo "stdout is a pipe"; fi; echo "to stderr" >&2`
+	env, err := e.Execute(&bundle.Step{Name: "term", Tool: "sh", Task: task, PTY: true}, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success, got %s (%+v)", env.Status, env.Error)
+	}
+	ctx.SetResult("term", env)
+	output, _ := ctx.StepOutput("term")
+	if output != "stdout is a tty\nto stderr\n" {
+		t.Errorf("output = %q, want the TTY branch and stderr with \\n line endings", output)
+	}
+
+	// Without a PTY the same command sees a pipe
+	env, _ = e.Execute(&bundle.Step{Name: "piped", Tool: "sh", Task: task}, ctx, ws)
+	ctx.SetResult("piped", env)
+	if output, _ := ctx.StepOutput("piped"); output != "stdout is a pipe\n" {
+		t.Errorf("piped output = %q, want the pipe branch", output)
+	}
+}
+
+func TestToolExecutor_PTYFailureExitCode(t *testing.T) {
+	skipWithoutPTY(t)
+	e, ctx, ws := newShellExecutor(t)
+
+	env, _ := e.Execute(&bundle.Step{Name: "term", Tool: "sh", Task: "echo broken; exit 3", PTY: true}, ctx, ws)
+	if env.Status != envelope.StatusFailure {
+		t.Errorf("expected the command's failure to fail the step, got %s", env.Status)
+	}
+}
+
+func TestStartPTY_OrphanOutputDetached(t *testing.T) {
+	skipWithoutPTY(t)
+
+	// The background child keeps the terminal open after sh exits and
+	// prints again once finish has given up waiting for it
+	var out lockedBuffer
+	cmd := exec.Command("sh", "-c", "(sleep 1; echo late) & echo early")
+	term, err := startPTY(cmd, &out)
+	if err != nil {
+		t.Fatalf("startPTY: %v", err)
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	started := time.Now()
+	term.finish()
+	if elapsed := time.Since(started); elapsed > 3*abortWait {
+		t.Errorf("finish took %s waiting on the orphan", elapsed)
+	}
+	select {
+	case <-term.done:
+	default:
+		t.Error("the copy should have stopped once finish returned")
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if got := out.String(); got != "early\n" {
+		t.Errorf("output = %q, want only what was printed before finish", got)
+	}
+}
+
+func TestCRLFWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &crlfWriter{w: &buf}
+	for _, chunk := range []string{"one\r\ntwo\r", "\nthree\r", "x\r"} {
+		if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	w.Flush()
+	if got := buf.String(); got != "one\ntwo\nthree\rx\r" {
+		t.Errorf("got %q, want \\r\\n converted across writes and lone \\r kept", got)
+	}
+}
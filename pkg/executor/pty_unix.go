@@ -0,0 +1,60 @@
+//go:build linux || darwin
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// openPTY opens a new pseudo-terminal, returning its master side and the
+// terminal the command runs on. pty.Open leaves the master in blocking
+// mode, where closing it does not interrupt a pending read, so the master
+// is reopened non-blocking: finish can then stop a copy that a child still
+// holding the terminal would otherwise keep alive.
+func openPTY() (master, tty *os.File, err error) {
+	master, tty, err = pty.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	if master, err = reopenNonblocking(master); err != nil {
+		tty.Close()
+		return nil, nil, err
+	}
+	return master, tty, nil
+}
+
+// reopenNonblocking replaces f with a non-blocking duplicate that the
+// runtime poller manages, closing f
+func reopenNonblocking(f *os.File) (*os.File, error) {
+	syscall.ForkLock.RLock()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err == nil {
+		syscall.CloseOnExec(fd)
+	}
+	syscall.ForkLock.RUnlock()
+	name := f.Name()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
+
+// setControllingTTY starts cmd in a new session with its stdin, the
+// terminal, as the controlling terminal
+func setControllingTTY(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+}
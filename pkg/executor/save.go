@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/workspace"
+)
+
+// saveOutput copies step's output to the file named by its save field and
+// records the written path in env's "saved_to" result. The name is resolved
+// as a template and taken relative to the run's output_dir (the step's
+// outputs directory in the job when there is none); an absolute or ~/ name
+// is used as-is, but only when the bundle spells it that way, so a
+// substituted value can't point the write elsewhere. A save that fails
+// fails the step, keeping what it already recorded (output, cost, tokens,
+// model and duration).
+func saveOutput(step *bundle.Step, env *envelope.Envelope, ctx *orchestrator.Context, ws *workspace.Workspace) *envelope.Envelope {
+	path, err := savePath(step, ctx, ws)
+	if err != nil {
+		return saveFailed(env, "INVALID_SAVE", fmt.Sprintf("step %s save: %v", step.Name, err))
+	}
+
+	output, _ := ctx.EnvelopeOutput(env)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = os.WriteFile(path, []byte(output), 0644)
+	}
+	if err != nil {
+		return saveFailed(env, "SAVE_FAILED", fmt.Sprintf("step %s save: %v", step.Name, err))
+	}
+
+	if env.Result == nil {
+		env.Result = make(map[string]interface{})
+	}
+	env.Result["saved_to"] = path
+	return env
+}
+
+// saveFailed marks env failed with the given error, keeping the rest of it
+func saveFailed(env *envelope.Envelope, code, message string) *envelope.Envelope {
+	env.Status = envelope.StatusFailure
+	env.Error = &envelope.ErrorInfo{Code: code, Message: message}
+	return env
+}
+
+// savePath resolves step's save field to the file to write
+func savePath(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (string, error) {
+	name := strings.TrimSpace(ctx.Resolve(step.Save))
+	if name == "" {
+		return "", fmt.Errorf("empty file name")
+	}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return "", fmt.Errorf("file %q must not contain ..", name)
+		}
+	}
+
+	raw := strings.TrimSpace(step.Save)
+	switch {
+	case raw == "~" || strings.HasPrefix(raw, "~/"):
+		if name != "~" && !strings.HasPrefix(name, "~/") {
+			return "", fmt.Errorf("file %q must be under the home directory", name)
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, strings.TrimPrefix(name[1:], "/")), nil
+	case filepath.IsAbs(raw):
+		return filepath.Clean(name), nil
+	case filepath.IsAbs(name) || strings.HasPrefix(name, "~"):
+		return "", fmt.Errorf("file %q must be relative", name)
+	}
+
+	dir := ctx.Resolve("${inputs.output_dir:-}")
+	if dir == "" {
+		dir = filepath.Join(ws.JobDir, "outputs", step.Name)
+	}
+	return filepath.Join(dir, name), nil
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/runner"
+)
+
+func TestDispatcher_SavesOutputToTemplatedFile(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	outDir := t.TempDir()
+	ctx.Inputs["output_dir"] = outDir
+	ctx.Inputs["project"] = "widget"
+
+	step := &bundle.Step{Name: "report", Tool: "sh", Task: "echo '# Report'", Save: "${inputs.project}/report.md"}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Execute = %+v, %v", env, err)
+	}
+
+	want := filepath.Join(outDir, "widget", "report.md")
+	if env.Result["saved_to"] != want {
+		t.Errorf("saved_to = %v, want %s", env.Result["saved_to"], want)
+	}
+	data, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "# Report\n" {
+		t.Errorf("saved file = %q", data)
+	}
+}
+
+func TestDispatcher_SaveWithoutOutputDirUsesJob(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+
+	step := &bundle.Step{Name: "notes", Tool: "sh", Task: "echo hi", Save: "notes.txt"}
+	env, _ := d.Execute(step, ctx, ws)
+	want := filepath.Join(ws.JobDir, "outputs", "notes", "notes.txt")
+	if env.Status != envelope.StatusSuccess || env.Result["saved_to"] != want {
+		t.Fatalf("saved_to = %v (%+v), want %s", env.Result["saved_to"], env.Error, want)
+	}
+}
+
+func TestDispatcher_SaveExpandsTilde(t *testing.T) {
+	d, ctx, ws := newShellDispatcher(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	step := &bundle.Step{Name: "home", Tool: "sh", Task: "echo hi", Save: "~/reports/out.md"}
+	env, _ := d.Execute(step, ctx, ws)
+	want := filepath.Join(home, "reports", "out.md")
+	if env.Status != envelope.StatusSuccess || env.Result["saved_to"] != want {
+		t.Fatalf("saved_to = %v (%+v), want %s", env.Result["saved_to"], env.Error, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDispatcher_SaveRejectsTraversal(t *testing.T) {
+	for _, tc := range []struct {
+		name, save, value string
+	}{
+		{"parent", "../escape.md", ""},
+		{"nested", "reports/../../escape.md", ""},
+		{"templated parent", "${inputs.name}.md", "../../escape"},
+		{"templated absolute", "${inputs.name}", "/tmp/escape.md"},
+		{"templated home", "${inputs.name}", "~/escape.md"},
+		{"absolute with parent", "/tmp/reports/../escape.md", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, ctx, ws := newShellDispatcher(t)
+			outDir := filepath.Join(t.TempDir(), "out")
+			ctx.Inputs["output_dir"] = outDir
+			ctx.Inputs["name"] = tc.value
+
+			step := &bundle.Step{Name: "bad", Tool: "sh", Task: "echo hi", Save: tc.save}
+			env, err := d.Execute(step, ctx, ws)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "INVALID_SAVE" {
+				t.Fatalf("expected INVALID_SAVE, got %s (%+v)", env.Status, env.Error)
+			}
+			if env.OutputRef == "" || env.Result["output_length"] == nil {
+				t.Errorf("the step's output and result should be kept, got %+v", env)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(outDir), "escape.md")); !os.IsNotExist(err) {
+				t.Error("nothing should be written outside the output directory")
+			}
+		})
+	}
+}
+
+func TestDispatcher_SaveFailureKeepsResult(t *testing.T) {
+	_, ctx, ws := newShellDispatcher(t)
+	d := NewDispatcher(map[string]runner.Tool{"claude": streamShellTool{}})
+	// output_dir is a file, so the save can't create its directory
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Inputs["output_dir"] = blocker
+
+	step := &bundle.Step{Name: "review", Tool: "claude", Task: usageTask(10, 5, 300, 40), Save: "review.md"}
+	env, err := d.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "SAVE_FAILED" {
+		t.Fatalf("expected SAVE_FAILED, got %s (%+v)", env.Status, env.Error)
+	}
+	if env.Result["cost_usd"] != 0.01 || env.Result["input_tokens"] != 10 || env.Result["cache_read_tokens"] != 300 {
+		t.Errorf("the step's cost and tokens should be kept, got %v", env.Result)
+	}
+	if _, ok := env.Result["model"]; !ok || env.OutputRef == "" || env.Metrics == nil || env.Metrics.Tool != "claude" {
+		t.Errorf("the step's model, output and metrics should be kept, got %+v", env)
+	}
+}
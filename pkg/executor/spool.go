@@ -0,0 +1,234 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+// maxBufferedOutput is how much of a step's stdout is held in memory. Past
+// it the output streams to a file in the job and only its start and end are
+// kept, so a tool printing gigabytes doesn't hold them all.
+var maxBufferedOutput = 8 << 20
+
+// outputSpool captures a command's output with bounded memory. Up to limit
+// bytes are kept whole; past that the output is written to path as it
+// arrives (or dropped, when path is empty) and memory keeps the first and
+// last limit/2 bytes. It is safe for concurrent use, so the partial output
+// of a killed command can be read while orphaned children may still write.
+type outputSpool struct {
+	mu      sync.Mutex
+	limit   int
+	path    string
+	file    *os.File // Open while spilling to path
+	onDisk  bool     // The whole output is in path
+	head    []byte   // All output until spilled, then its first limit/2 bytes
+	tail    []byte   // The last limit/2 bytes once spilled
+	size    int64    // Bytes written in total
+	spilled bool
+	err     error // First error writing the spill file
+}
+
+func newOutputSpool(path string, limit int) *outputSpool {
+	return &outputSpool{path: path, limit: limit}
+}
+
+func (s *outputSpool) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.size += int64(len(p))
+	if !s.spilled && len(s.head)+len(p) <= s.limit {
+		s.head = append(s.head, p...)
+		return len(p), nil
+	}
+	if !s.spilled {
+		s.spill()
+	}
+	if room := s.limit/2 - len(s.head); room > 0 {
+		s.head = append(s.head, p[:min(room, len(p))]...)
+	}
+	if s.file != nil && s.err == nil {
+		_, s.err = s.file.Write(p)
+		s.onDisk = s.err == nil
+	}
+	half := s.limit / 2
+	if len(p) >= half {
+		s.tail = append(s.tail[:0], p[len(p)-half:]...)
+	} else {
+		s.tail = append(s.tail, p...)
+		if over := len(s.tail) - half; over > 0 {
+			s.tail = append(s.tail[:0], s.tail[over:]...)
+		}
+	}
+	return len(p), nil
+}
+
+// spill moves the output so far to the spill file and trims memory to the
+// head; the caller adds what it is writing to the head's remaining room and
+// the tail. Callers must hold s.mu.
+func (s *outputSpool) spill() {
+	s.spilled = true
+	if s.path != "" {
+		if s.err = os.MkdirAll(filepath.Dir(s.path), 0755); s.err == nil {
+			s.file, s.err = os.Create(s.path)
+		}
+		if s.err == nil {
+			_, s.err = s.file.Write(s.head)
+		}
+	}
+	if half := s.limit / 2; len(s.head) > half {
+		s.tail = append([]byte(nil), s.head[half:]...)
+		s.head = append([]byte(nil), s.head[:half]...)
+	}
+}
+
+// String returns the output whole, or once spilled its start and end around
+// a note of what was left out and where to find it
+func (s *outputSpool) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.spilled {
+		return string(s.head)
+	}
+	omitted := s.size - int64(len(s.head)) - int64(len(s.tail))
+	where := ""
+	if s.onDisk {
+		where = "; full output in " + s.path
+	}
+	return fmt.Sprintf("%s\n... [%d bytes omitted%s] ...\n%s", s.head, omitted, where, s.tail)
+}
+
+// Spilled reports whether the output outgrew memory
+func (s *outputSpool) Spilled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spilled
+}
+
+// File returns the path holding the whole output, or "" if it is not on disk
+func (s *outputSpool) File() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.onDisk {
+		return ""
+	}
+	return s.path
+}
+
+// Size returns how many bytes have been written
+func (s *outputSpool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// retained returns how many bytes are held in memory
+func (s *outputSpool) retained() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.head) + len(s.tail)
+}
+
+// Close closes the spill file, keeping it
+func (s *outputSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		s.onDisk = false
+	}
+	return err
+}
+
+// Reset discards the output, removing any spill file, for another attempt
+func (s *outputSpool) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if s.spilled && s.path != "" {
+		os.Remove(s.path)
+	}
+	s.head, s.tail = nil, nil
+	s.size, s.spilled, s.onDisk, s.err = 0, false, false, nil
+}
+
+// writeSpilledOutput records the output of a step whose stdout spilled to
+// spillPath, returning its output_ref, output_hash and length. The spill file
+// already holds the whole stdout, so it is the output_ref of a stdout step;
+// a "both" step's output is copied from it, followed by stderr, into
+// outputs/<step>.out. Either way the hash is taken as the file is read, and
+// stderr is written beside the output in errors/, where
+// ${steps.<name>.stderr} looks. A store other than local disk gets a copy.
+func writeSpilledOutput(ws *workspace.Workspace, stepName, stream, spillPath, stderr string) (string, string, int64, error) {
+	src, err := os.Open(spillPath)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer src.Close()
+
+	path := spillPath
+	hasher := envelope.NewOutputHasher()
+	var dst io.Writer = hasher
+	var out *os.File
+	if stream == "both" {
+		path = filepath.Join(ws.JobDir, "outputs", stepName+".out")
+		if out, err = os.Create(path); err != nil {
+			return "", "", 0, err
+		}
+		defer out.Close()
+		dst = io.MultiWriter(out, hasher)
+	}
+	size, err := io.Copy(dst, src)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if out != nil && stderr != "" {
+		// Joined as selectOutput joins them
+		sep := "\n"
+		last := make([]byte, 1)
+		if _, err := src.ReadAt(last, size-1); err == nil && last[0] == '\n' {
+			sep = ""
+		}
+		n, err := io.WriteString(dst, sep+stderr)
+		if err != nil {
+			return "", "", 0, err
+		}
+		size += int64(n)
+	}
+	if out != nil {
+		if err := out.Close(); err != nil {
+			return "", "", 0, err
+		}
+	}
+
+	store := ws.OutputStore()
+	if _, local := store.(workspace.LocalStore); !local {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", 0, err
+		}
+		if err := store.Write(path, data); err != nil {
+			return "", "", 0, err
+		}
+	}
+	if stderr != "" {
+		errPath := filepath.Join(ws.JobDir, "errors", filepath.Base(path))
+		if err := store.Write(errPath, []byte(stderr)); err != nil {
+			return "", "", 0, err
+		}
+	}
+	return path, hasher.Sum(), size, nil
+}
@@ -0,0 +1,182 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func TestOutputSpool_SmallOutputStaysInMemory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	s := newOutputSpool(path, 64)
+	s.Write([]byte("hello\n"))
+	s.Write([]byte("world\n"))
+
+	if got := s.String(); got != "hello\nworld\n" {
+		t.Errorf("String = %q", got)
+	}
+	if s.Spilled() || s.File() != "" {
+		t.Error("small output should not spill")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("no spill file expected, stat err = %v", err)
+	}
+}
+
+func TestOutputSpool_LargeOutputIsBounded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outputs", "big.stdout")
+	const limit = 1024
+	s := newOutputSpool(path, limit)
+
+	var want bytes.Buffer
+	for i := 0; i < 100000; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		want.WriteString(line)
+		s.Write([]byte(line))
+		if n := s.retained(); n > limit {
+			t.Fatalf("after %d lines %d bytes are held in memory, limit %d", i+1, n, limit)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if !s.Spilled() || s.File() != path {
+		t.Fatalf("Spilled = %v, File = %q", s.Spilled(), s.File())
+	}
+	if s.Size() != int64(want.Len()) {
+		t.Errorf("Size = %d, want %d", s.Size(), want.Len())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want.Bytes()) {
+		t.Errorf("spill file holds %d bytes, want the whole %d byte output", len(data), want.Len())
+	}
+
+	got := s.String()
+	if !strings.HasPrefix(got, "line 0\nline 1\n") || !strings.HasSuffix(got, "line 99999\n") {
+		t.Errorf("String should keep the start and end, got %q...", got[:40])
+	}
+	if !strings.Contains(got, "bytes omitted; full output in "+path) {
+		t.Errorf("String should say where the full output is: %q", got)
+	}
+
+	// Another attempt starts over
+	s.Reset()
+	if s.String() != "" || s.Spilled() {
+		t.Error("Reset should discard the output")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Reset should remove the spill file, stat err = %v", err)
+	}
+}
+
+func TestOutputSpool_WithoutPathKeepsStartAndEnd(t *testing.T) {
+	s := newOutputSpool("", 16)
+	s.Write([]byte("first line\n" + strings.Repeat("x", 1000) + "\nlast\n"))
+
+	got := s.String()
+	if !strings.HasPrefix(got, "first li") || !strings.HasSuffix(got, "\nlast\n") {
+		t.Errorf("String = %q", got)
+	}
+	if s.File() != "" || strings.Contains(got, "full output in") {
+		t.Error("a spool without a path should not point to a file")
+	}
+}
+
+func TestToolExecutor_LargeOutputStreamsToFile(t *testing.T) {
+	defer func(limit int) { maxBufferedOutput = limit }(maxBufferedOutput)
+	maxBufferedOutput = 64 << 10
+
+	e, ctx, ws := newShellExecutor(t)
+	step := &bundle.Step{Name: "flood", Tool: "sh", Task: "seq 1 500000"}
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Execute = %+v, %v", env, err)
+	}
+
+	var want strings.Builder
+	for i := 1; i <= 500000; i++ {
+		fmt.Fprintf(&want, "%d\n", i)
+	}
+	file, _ := env.Result["stdout_file"].(string)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("reading stdout_file %q: %v", file, err)
+	}
+	if string(data) != want.String() {
+		t.Errorf("stdout_file holds %d bytes, want the whole %d byte output", len(data), want.Len())
+	}
+	if env.Result["stdout_bytes"] != int64(want.Len()) {
+		t.Errorf("stdout_bytes = %v, want %d", env.Result["stdout_bytes"], want.Len())
+	}
+
+	// The spill file is the step's output, whole
+	if env.OutputRef != file {
+		t.Errorf("OutputRef = %q, want the spill file %q", env.OutputRef, file)
+	}
+	if env.OutputHash != envelope.HashOutput(want.String()) {
+		t.Error("OutputHash should cover the whole output")
+	}
+	if env.Result["output_length"] != want.Len() {
+		t.Errorf("output_length = %v, want %d", env.Result["output_length"], want.Len())
+	}
+}
+
+func TestToolExecutor_LargeOutputReadDownstream(t *testing.T) {
+	defer func(limit int) { maxBufferedOutput = limit }(maxBufferedOutput)
+	maxBufferedOutput = 1 << 10
+
+	var stdout strings.Builder
+	for i := 1; i <= 5000; i++ {
+		fmt.Fprintf(&stdout, "%d\n", i)
+	}
+	tests := []struct {
+		stream string
+		want   string
+	}{
+		{"", stdout.String()},
+		{"both", stdout.String() + "oops\n"},
+	}
+	for _, tc := range tests {
+		t.Run("stream="+tc.stream, func(t *testing.T) {
+			e, ctx, ws := newShellExecutor(t)
+			step := &bundle.Step{Name: "flood", Tool: "sh", Task: "seq 1 5000; echo oops >&2", OutputStream: tc.stream}
+			env, err := e.Execute(step, ctx, ws)
+			if err != nil || env.Status != envelope.StatusSuccess {
+				t.Fatalf("Execute = %+v, %v", env, err)
+			}
+			ctx.SetResult(step.Name, env)
+
+			if got := ctx.Resolve("${steps.flood.output}"); got != tc.want {
+				t.Errorf("${steps.flood.output} is %d bytes, want the whole %d", len(got), len(tc.want))
+			}
+			if got := ctx.Resolve("${steps.flood.stderr}"); got != "oops\n" {
+				t.Errorf("${steps.flood.stderr} = %q, want %q", got, "oops\n")
+			}
+			if env.OutputHash != envelope.HashOutput(tc.want) {
+				t.Error("OutputHash should cover the whole output")
+			}
+
+			// A later step is handed all of it
+			count := &bundle.Step{Name: "count", Tool: "sh", Task: `printf '%s' "${steps.flood.output}" | wc -l`}
+			env, err = e.Execute(count, ctx, ws)
+			if err != nil || env.Status != envelope.StatusSuccess {
+				t.Fatalf("Execute count = %+v, %v", env, err)
+			}
+			ctx.SetResult(count.Name, env)
+			lines := strings.Count(tc.want, "\n")
+			if got := strings.TrimSpace(ctx.Resolve("${steps.count.output}")); got != fmt.Sprint(lines) {
+				t.Errorf("downstream step counted %s lines, want %d", got, lines)
+			}
+		})
+	}
+}
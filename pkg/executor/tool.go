@@ -4,14 +4,19 @@ package executor
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"rcodegen/pkg/bundle"
 	"rcodegen/pkg/envelope"
@@ -22,6 +27,44 @@ import (
 
 type ToolExecutor struct {
 	Tools map[string]runner.Tool
+
+	// CacheDir holds results of steps with cache enabled (default DefaultCacheDir())
+	CacheDir string
+
+	// PromptWarnTokens is the estimated token count above which a resolved
+	// task is logged with a warning (0 means DefaultPromptWarnTokens,
+	// negative disables the warning)
+	PromptWarnTokens int
+
+	// SystemPromptFiles maps a tool name to the system prompt file passed
+	// to it, for tools whose own defaults don't already set one
+	SystemPromptFiles map[string]string
+}
+
+// DefaultPromptWarnTokens flags resolved tasks that are likely runaway
+// templates, e.g. a huge step output inlined into a prompt
+const DefaultPromptWarnTokens = 100000
+
+// estimateTokens approximates a prompt's token count at 4 characters per token
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// promptWarning returns a warning when task exceeds the prompt size threshold
+func (e *ToolExecutor) promptWarning(step *bundle.Step, task string) string {
+	limit := e.PromptWarnTokens
+	if limit == 0 {
+		limit = DefaultPromptWarnTokens
+	}
+	if limit < 0 {
+		return ""
+	}
+	tokens := estimateTokens(task)
+	if tokens <= limit {
+		return ""
+	}
+	return fmt.Sprintf("warning: resolved task for step %s is ~%d tokens (%d chars), over the %d-token warning threshold",
+		step.Name, tokens, len(task), limit)
 }
 
 func (e *ToolExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
@@ -30,8 +73,21 @@ func (e *ToolExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws
 		return envelope.New().Failure("TOOL_NOT_FOUND", "Unknown tool: "+step.Tool).Build(), nil
 	}
 
+	filter, err := newLineFilter(step.OutputFilter, step.OutputExclude)
+	if err != nil {
+		return envelope.New().WithTool(step.Tool).Failure("INVALID_OUTPUT_FILTER", err.Error()).Build(), nil
+	}
+
+	timeout, err := stepTimeout(step)
+	if err != nil {
+		return envelope.New().WithTool(step.Tool).Failure("INVALID_TIMEOUT", err.Error()).Build(), nil
+	}
+
 	// Resolve task template
-	task := ctx.Resolve(step.Task)
+	task, err := ctx.RenderTask(step.Task)
+	if err != nil {
+		return envelope.New().WithTool(step.Tool).Failure("TEMPLATE_ERROR", err.Error()).Build(), nil
+	}
 
 	// Build config
 	cfg := &runner.Config{
@@ -42,6 +98,10 @@ func (e *ToolExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws
 	// Apply tool-specific defaults (sets MaxBudget, etc.)
 	tool.ApplyToolDefaults(cfg)
 
+	if cfg.SystemPromptFile == "" {
+		cfg.SystemPromptFile = e.SystemPromptFiles[step.Tool]
+	}
+
 	// Override model if specified in step
 	if step.Model != "" {
 		cfg.Model = step.Model
@@ -60,57 +120,226 @@ func (e *ToolExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws
 		workDir, _ = os.Getwd()
 	}
 
-	// Build and run command
-	start := time.Now()
-	cmd := tool.BuildCommand(cfg, workDir, task)
+	// Serve cached steps from a previous run at the same commit
+	var cacheKey, commit string
+	if step.Cache {
+		commit = gitHead(workDir)
+		cacheKey = stepCacheKey(step, cfg.Model, task, commit)
+		if entry, ok := e.loadCache(cacheKey); ok {
+			outputPath, _ := ws.WriteStepResult(step.Name, entry.Output, entry.Stdout, entry.Stderr)
+			return envelope.New().
+				WithTool(step.Tool).
+				WithOutputRef(outputPath).
+				WithOutputHash(entry.Output).
+				WithDuration(0).
+				Success().
+				WithResult("output_length", len(entry.Output)).
+				WithResult("cost_usd", 0.0).
+				WithResult("input_tokens", 0).
+				WithResult("output_tokens", 0).
+				WithResult("model", cfg.Model).
+				WithResult("cached", true).
+				Build(), nil
+		}
+	}
 
 	// Create log file for real-time output
 	logDir := filepath.Join(ws.JobDir, "logs")
 	os.MkdirAll(logDir, 0755)
 	logPath := filepath.Join(logDir, step.Name+".log")
 	logFile, logErr := os.Create(logPath)
-
-	var stdout, stderr bytes.Buffer
+	// Lines reach the log (and so the live display) filtered and masked
+	clean := func(s string) string { return ctx.MaskSecrets(filter.apply(s)) }
+	var logOut *lineWriter
 	if logErr == nil {
-		// Write to both buffer and log file simultaneously
-		cmd.Stdout = io.MultiWriter(&stdout, logFile)
-		cmd.Stderr = io.MultiWriter(&stderr, logFile)
 		defer logFile.Close()
-	} else {
-		// Fallback to buffer only
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
+		logOut = &lineWriter{w: logFile, transform: clean}
 	}
 
-	err := cmd.Run()
+	// Stream the step's running cost to the display as result events arrive
+	costParser := runner.NewStreamParser(io.Discard)
+	costParser.OnCost = func(cost float64) { ctx.ReportCost(step.Name, cost) }
+	costOut := &lineWriter{w: io.Discard, transform: func(s string) string {
+		costParser.ProcessLine(s)
+		return ""
+	}}
+
+	// Stream the step's lines to the live display as they arrive, with
+	// stream-json events formatted the way a terminal run shows them
+	displayParser := runner.NewStreamParser(&lineWriter{w: io.Discard, transform: func(s string) string {
+		for _, line := range strings.Split(strings.TrimRight(s, "\n"), "\n") {
+			ctx.ReportOutput(step.Name, line)
+		}
+		return ""
+	}})
+	displayOut := &lineWriter{w: io.Discard, transform: func(s string) string {
+		displayParser.ProcessLine(clean(s))
+		return ""
+	}}
+
+	// Flag oversized prompts before spending on the call
+	warning := e.promptWarning(step, task)
+	if warning != "" && logErr == nil {
+		fmt.Fprintln(logFile, warning)
+	}
+
+	// Build and run command, re-running it while the step's retry policy allows.
+	// Stdout is held with bounded memory: filtered and masked as it arrives
+	// into a spool that moves to a file in the job once it grows large, and
+	// raw (only its start and end once large) for the session and usage
+	// the tool reports; stream-json turns are counted as they go by.
+	start := time.Now()
+	stdout := newOutputSpool(filepath.Join(ws.JobDir, "outputs", step.Name+".stdout"), maxBufferedOutput)
+	defer stdout.Close()
+	rawStdout := newOutputSpool("", maxBufferedOutput)
+	cleanOut := &lineWriter{w: stdout, transform: clean}
+	var stderr lockedBuffer
+	var counts *runner.StreamParser
+	attempts := 0
+	attemptTask := task
+	for {
+		attempts++
+		stdout.Reset()
+		rawStdout.Reset()
+		stderr.Reset()
+		counts = runner.NewStreamParser(io.Discard)
+		countOut := &lineWriter{w: io.Discard, transform: func(s string) string {
+			counts.ProcessLine(s)
+			return ""
+		}}
+
+		cmd := tool.BuildCommand(cfg, workDir, attemptTask)
+		setJobEnv(cmd, ws)
+		if logErr == nil {
+			// Write to both buffer and log file simultaneously
+			cmd.Stdout = io.MultiWriter(cleanOut, rawStdout, logOut, costOut, displayOut, countOut)
+			cmd.Stderr = io.MultiWriter(&stderr, logOut)
+		} else {
+			// Fallback to buffer only
+			cmd.Stdout = io.MultiWriter(cleanOut, rawStdout, costOut, displayOut, countOut)
+			cmd.Stderr = &stderr
+		}
+		var term *ptyCapture
+		if step.PTY {
+			// The terminal merges stderr into stdout
+			if term, err = startPTY(cmd, cmd.Stdout); err != nil {
+				return envelope.New().
+					WithTool(step.Tool).
+					Failure("PTY_UNAVAILABLE", fmt.Sprintf("step %s: allocating a pseudo-terminal: %v", step.Name, err)).
+					Build(), nil
+			}
+		}
+
+		err = runCmd(cmd, ctx.Done(), timeout)
+		if term != nil {
+			term.finish()
+		}
+		if errors.Is(err, errCmdAborted) || errors.Is(err, errCmdTimedOut) {
+			// Keep what the step printed before it was stopped
+			if logOut != nil {
+				logOut.Flush()
+			}
+			displayOut.Flush()
+			cleanOut.Flush()
+			outputPath, outputHash, _ := writeToolOutput(ws, step, stdout, clean(stderr.String()))
+			elapsed := time.Since(start)
+			builder := envelope.New().
+				WithTool(step.Tool).
+				WithOutputRef(outputPath).
+				WithOutputSum(outputHash).
+				WithDuration(elapsed.Milliseconds())
+			if errors.Is(err, errCmdTimedOut) {
+				builder.Failure("TIMEOUT", fmt.Sprintf("step %s timed out after %s (limit %s)", step.Name, elapsed.Round(time.Millisecond), timeout)).
+					WithResult("timeout", timeout.String())
+			} else {
+				builder.Failure(orchestrator.StepAbortedCode, "step "+step.Name+" was stopped before it finished")
+			}
+			return builder.WithResult("partial_output", true).Build(), nil
+		}
+		if logOut != nil {
+			logOut.Flush()
+		}
+		displayOut.Flush()
+		cleanOut.Flush()
+		countOut.Flush()
+		if err == nil || !shouldRetry(step.Retry, attempts, err) {
+			break
+		}
+		if step.RetryPromptSuffix != "" {
+			attemptTask = retryTask(task, ctx.Resolve(step.RetryPromptSuffix), err, clean(stderr.String()))
+		}
+		if !waitBackoff(retryBackoff(step.Retry, attempts), ctx.Done()) {
+			break // Aborted while waiting: report the last failure
+		}
+	}
 	duration := time.Since(start)
 
 	// Extract and store session ID for future reuse
-	if sessionID := extractSessionID(step.Tool, stdout.String(), stderr.String()); sessionID != "" {
+	if sessionID := extractSessionID(step.Tool, rawStdout.String(), stderr.String()); sessionID != "" {
 		ctx.SetToolSession(step.Tool, sessionID)
 	}
 
-	// Write output
-	outputPath, _ := ws.WriteOutput(step.Name, map[string]interface{}{
-		"stdout": stdout.String(),
-		"stderr": stderr.String(),
-	})
+	// Write output, filtered and with any ${secret.*} values masked
+	stderrText := clean(stderr.String())
+	outputPath, outputHash, outputLength := writeToolOutput(ws, step, stdout, stderrText)
 
 	// Build envelope
 	builder := envelope.New().
 		WithTool(step.Tool).
 		WithOutputRef(outputPath).
+		WithOutputSum(outputHash).
 		WithDuration(duration.Milliseconds())
+	if step.Retry != nil {
+		builder.WithResult("attempts", attempts)
+	}
+	if warning != "" {
+		builder.WithResult("prompt_warning", warning)
+	}
+	if stdout.Spilled() {
+		builder.WithResult("stdout_bytes", stdout.Size())
+		if file := stdout.File(); file != "" {
+			builder.WithResult("stdout_file", file)
+		}
+	}
 
 	if err != nil {
-		return builder.Failure("EXEC_FAILED", err.Error()).Build(), nil
+		// An exit error only says "exit status N"; what went wrong is on stderr
+		message := ctx.MaskSecrets(err.Error())
+		if tail := stderrTail(stderrText); tail != "" {
+			message += ": " + lastLine(tail)
+			builder.WithResult("stderr", tail)
+		}
+		return builder.Failure("EXEC_FAILED", message).Build(), nil
+	}
+	if step.FailOnStderr && stderr.Len() > 0 {
+		firstLine, _, _ := strings.Cut(strings.TrimSpace(ctx.MaskSecrets(stderr.String())), "\n")
+		return builder.Failure("STDERR_OUTPUT", "step wrote to stderr: "+firstLine).Build(), nil
 	}
 
-	// Extract cost/token info
-	usage := extractCostInfo(step.Tool, stdout.String(), stderr.String())
+	// Extract cost/token info, as counted over the whole stream
+	usage := extractCostInfo(counts)
+
+	// Only whole outputs are cached
+	if cacheKey != "" && !stdout.Spilled() {
+		stdoutText := stdout.String()
+		output := selectOutput(step.OutputStream, stdoutText, stderrText)
+		e.storeCache(cacheKey, cacheEntry{
+			Output:    output,
+			Stdout:    stdoutText,
+			Stderr:    stderrText,
+			Model:     cfg.Model,
+			Commit:    commit,
+			CreatedAt: time.Now(),
+		})
+	}
+
+	if tool.UsesStreamOutput() {
+		builder.WithResult("assistant_turns", counts.AssistantTurns).
+			WithResult("tool_calls", counts.ToolCalls)
+	}
 
 	return builder.Success().
-		WithResult("output_length", stdout.Len()).
+		WithResult("output_length", outputLength).
 		WithResult("cost_usd", usage.CostUSD).
 		WithResult("input_tokens", usage.InputTokens).
 		WithResult("output_tokens", usage.OutputTokens).
@@ -120,6 +349,325 @@ func (e *ToolExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws
 		Build(), nil
 }
 
+// Errors returned by runCmd when it killed the command
+var (
+	errCmdAborted  = errors.New("command aborted")
+	errCmdTimedOut = errors.New("command timed out")
+)
+
+// stepTimeout parses the step's timeout; zero means no limit
+func stepTimeout(step *bundle.Step) (time.Duration, error) {
+	if step.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(step.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("step %s: invalid timeout %q: %v", step.Name, step.Timeout, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("step %s: timeout %q is negative", step.Name, step.Timeout)
+	}
+	return d, nil
+}
+
+// setJobEnv exports the run's job ID and directory to cmd as RCODEGEN_JOB_ID
+// and RCODEGEN_JOB_DIR, so tools can write into the job dir. An environment
+// already set by the tool is kept; otherwise the process environment is used.
+func setJobEnv(cmd *exec.Cmd, ws *workspace.Workspace) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		"RCODEGEN_JOB_ID="+ws.JobID,
+		"RCODEGEN_JOB_DIR="+ws.JobDir,
+	)
+}
+
+// abortWait is how long runCmd waits for a killed command's output to drain
+const abortWait = 500 * time.Millisecond
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use, so the partial
+// output of a killed command can be read while orphaned children of the
+// command may still be writing to it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+// runCmd runs cmd until it exits, or kills it when abort closes or, with a
+// non-zero timeout, when the timeout expires
+func runCmd(cmd *exec.Cmd, abort <-chan struct{}, timeout time.Duration) error {
+	deadline := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		deadline, cancel = context.WithTimeout(deadline, timeout)
+		defer cancel()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var stopped error
+	select {
+	case err := <-done:
+		return err
+	case <-abort:
+		stopped = errCmdAborted
+	case <-deadline.Done():
+		stopped = errCmdTimedOut
+	}
+	cmd.Process.Kill()
+	select {
+	case <-done:
+	case <-time.After(abortWait):
+		// A child of the command still holds its output open
+	}
+	return stopped
+}
+
+// lineWriter transforms output a line at a time before writing to w, so
+// secrets split across writes are still masked and filters see whole lines.
+// Flush writes any unterminated last line.
+type lineWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	transform func(string) string
+	buf       []byte
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = append(l.buf, p...)
+	if i := bytes.LastIndexByte(l.buf, '\n'); i >= 0 {
+		if _, err := io.WriteString(l.w, l.transform(string(l.buf[:i+1]))); err != nil {
+			return 0, err
+		}
+		l.buf = append(l.buf[:0], l.buf[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line
+func (l *lineWriter) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(l.w, l.transform(string(l.buf)))
+	l.buf = l.buf[:0]
+	return err
+}
+
+// lineFilter keeps the lines matching include (when set) and not matching
+// exclude (when set)
+type lineFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newLineFilter(include, exclude string) (lineFilter, error) {
+	var f lineFilter
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile(include); err != nil {
+			return f, fmt.Errorf("invalid output_filter: %w", err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile(exclude); err != nil {
+			return f, fmt.Errorf("invalid output_exclude: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// apply drops the filtered-out lines of s, keeping line endings intact
+func (f lineFilter) apply(s string) string {
+	if f.include == nil && f.exclude == nil {
+		return s
+	}
+	var b strings.Builder
+	for len(s) > 0 {
+		line := s
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			line = s[:i+1]
+		}
+		s = s[len(line):]
+
+		text := strings.TrimRight(line, "\r\n")
+		if f.include != nil && !f.include.MatchString(text) {
+			continue
+		}
+		if f.exclude != nil && f.exclude.MatchString(text) {
+			continue
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// selectOutput returns the stream chosen as a step's primary output.
+// "both" joins stdout and stderr; anything else but "stderr" means stdout.
+func selectOutput(stream, stdout, stderr string) string {
+	switch stream {
+	case "stderr":
+		return stderr
+	case "both":
+		if stdout == "" || stderr == "" {
+			return stdout + stderr
+		}
+		return strings.TrimSuffix(stdout, "\n") + "\n" + stderr
+	default:
+		return stdout
+	}
+}
+
+// writeToolOutput records a tool step's output, returning its output_ref,
+// output_hash and length. Stdout that spilled to disk is recorded whole from
+// its spill file; otherwise the output is written with WriteStepResult.
+func writeToolOutput(ws *workspace.Workspace, step *bundle.Step, stdout *outputSpool, stderr string) (string, string, int) {
+	// Closing the spill file keeps orphaned children from growing it
+	stdout.Close()
+	if file := stdout.File(); file != "" && step.OutputStream != "stderr" {
+		if path, hash, size, err := writeSpilledOutput(ws, step.Name, step.OutputStream, file, stderr); err == nil {
+			return path, hash, int(size)
+		}
+	}
+	stdoutText := stdout.String()
+	output := selectOutput(step.OutputStream, stdoutText, stderr)
+	path, _ := ws.WriteStepResult(step.Name, output, stdoutText, stderr)
+	return path, envelope.HashOutput(output), len(output)
+}
+
+// shouldRetry reports whether a failed attempt may be re-run under the step's retry policy
+func shouldRetry(retry *bundle.RetryDef, attempts int, err error) bool {
+	if retry == nil || attempts > retry.Max {
+		return false
+	}
+	return isRetryableError(err, retry.RetryOnExitCodes)
+}
+
+// maxStderrTailBytes caps how much of a failed command's stderr is kept in
+// its failure envelope or quoted in a retry's task
+const maxStderrTailBytes = 4096
+
+// stderrTail returns the end of a command's stderr, trimmed and cut at a
+// line boundary to at most maxStderrTailBytes, with "..." marking a cut
+func stderrTail(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) <= maxStderrTailBytes {
+		return stderr
+	}
+	tail := stderr[len(stderr)-maxStderrTailBytes:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+	return "...\n" + tail
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
+
+// retryTask is the task of a retry: the original task, the step's retry
+// suffix, and why the previous attempt failed, with the end of its stderr
+func retryTask(task, suffix string, err error, stderr string) string {
+	reason := err.Error()
+	if tail := stderrTail(stderr); tail != "" {
+		reason += "\n" + tail
+	}
+	return task + "\n\n" + suffix + "\n\nThe previous attempt failed: " + reason
+}
+
+// maxRetryBackoff caps the exponential wait between attempts
+const maxRetryBackoff = 5 * time.Minute
+
+// retryBackoff is the wait after the given failed attempt: BackoffMs after
+// the first, doubling for each later attempt, at most maxRetryBackoff
+func retryBackoff(retry *bundle.RetryDef, attempts int) time.Duration {
+	if retry == nil || retry.BackoffMs <= 0 {
+		return 0
+	}
+	d := time.Duration(retry.BackoffMs) * time.Millisecond
+	for i := 1; i < attempts && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
+
+// waitBackoff sleeps for d, returning false if abort closes first
+func waitBackoff(d time.Duration, abort <-chan struct{}) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-abort:
+		return false
+	}
+}
+
+// isRetryableError classifies a command error. Only non-zero exits are retryable;
+// failing to start the process (missing binary, bad workdir) won't fix itself.
+// When exitCodes is non-empty, only those exit codes are retried.
+func isRetryableError(err error, exitCodes []int) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	if len(exitCodes) == 0 {
+		return true
+	}
+	code := exitErr.ExitCode()
+	for _, c := range exitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
 // UsageInfo holds token and cost information
 type UsageInfo struct {
 	CostUSD          float64
@@ -129,85 +677,16 @@ type UsageInfo struct {
 	CacheWriteTokens int
 }
 
-// extractCostInfo extracts cost and token information from tool output
-func extractCostInfo(toolName, stdout, stderr string) UsageInfo {
-	usage := UsageInfo{}
-
-	switch toolName {
-	case "claude":
-		// Claude outputs streaming JSON with detailed usage in the result object
-		lines := strings.Split(stdout, "\n")
-		for i := len(lines) - 1; i >= 0; i-- {
-			line := strings.TrimSpace(lines[i])
-			if line == "" {
-				continue
-			}
-			var obj map[string]interface{}
-			if err := json.Unmarshal([]byte(line), &obj); err != nil {
-				continue
-			}
-			if objType, _ := obj["type"].(string); objType == "result" {
-				usage.CostUSD, _ = obj["total_cost_usd"].(float64)
-				if u, ok := obj["usage"].(map[string]interface{}); ok {
-					if v, ok := u["input_tokens"].(float64); ok {
-						usage.InputTokens = int(v)
-					}
-					if v, ok := u["output_tokens"].(float64); ok {
-						usage.OutputTokens = int(v)
-					}
-					if v, ok := u["cache_read_input_tokens"].(float64); ok {
-						usage.CacheReadTokens = int(v)
-					}
-					if v, ok := u["cache_creation_input_tokens"].(float64); ok {
-						usage.CacheWriteTokens = int(v)
-					}
-				}
-				return usage
-			}
-		}
-	case "codex":
-		// Codex outputs "tokens used\n7,476\n" in stderr
-		re := regexp.MustCompile(`tokens used\s*\n\s*([\d,]+)`)
-		if matches := re.FindStringSubmatch(stderr); len(matches) > 1 {
-			tokenStr := strings.ReplaceAll(matches[1], ",", "")
-			tokens, _ := strconv.Atoi(tokenStr)
-			// Codex doesn't break down input/output, estimate 70% input, 30% output
-			usage.InputTokens = tokens * 7 / 10
-			usage.OutputTokens = tokens * 3 / 10
-			// Estimate cost: GPT-5.2 Codex pricing
-			// Input: $0.01/1K, Output: $0.03/1K (rough estimates)
-			usage.CostUSD = float64(usage.InputTokens)*0.00001 + float64(usage.OutputTokens)*0.00003
-		}
-	case "gemini":
-		// Gemini outputs JSON with token breakdown in stats
-		lines := strings.Split(stdout, "\n")
-		for i := len(lines) - 1; i >= 0; i-- {
-			line := strings.TrimSpace(lines[i])
-			if line == "" {
-				continue
-			}
-			var obj map[string]interface{}
-			if err := json.Unmarshal([]byte(line), &obj); err != nil {
-				continue
-			}
-			if objType, _ := obj["type"].(string); objType == "result" {
-				if stats, ok := obj["stats"].(map[string]interface{}); ok {
-					if v, ok := stats["input_tokens"].(float64); ok {
-						usage.InputTokens = int(v)
-					}
-					if v, ok := stats["output_tokens"].(float64); ok {
-						usage.OutputTokens = int(v)
-					}
-					if v, ok := stats["cached"].(float64); ok {
-						usage.CacheReadTokens = int(v)
-					}
-					// Gemini 3 pricing (estimates)
-					// Input: $0.0005/1K, Output: $0.0015/1K
-					usage.CostUSD = float64(usage.InputTokens)*0.0000005 + float64(usage.OutputTokens)*0.0000015
-				}
-				return usage
-			}
-		}
+// extractCostInfo reads the cost and token usage a tool reported from the
+// parser its stdout went through. Claude, Codex (--json) and Gemini
+// (stream-json) usage all land in parser.Usage; only Claude reports a cost.
+func extractCostInfo(parser *runner.StreamParser) UsageInfo {
+	usage := UsageInfo{CostUSD: parser.TotalCostUSD}
+	if u := parser.Usage; u != nil {
+		usage.InputTokens = u.InputTokens
+		usage.OutputTokens = u.OutputTokens
+		usage.CacheReadTokens = u.CacheReadInputTokens
+		usage.CacheWriteTokens = u.CacheCreationInputTokens
 	}
 	return usage
 }
@@ -234,7 +713,17 @@ func extractSessionID(toolName, stdout, stderr string) string {
 			}
 		}
 	case "codex":
-		// Codex outputs "session id: <uuid>" in stderr
+		// Codex --json starts with a thread.started event naming the session;
+		// its terminal output says "session id: <uuid>" on stderr
+		for _, line := range strings.Split(stdout, "\n") {
+			var obj struct {
+				Type     string `json:"type"`
+				ThreadID string `json:"thread_id"`
+			}
+			if json.Unmarshal([]byte(strings.TrimSpace(line)), &obj) == nil && obj.Type == "thread.started" && obj.ThreadID != "" {
+				return obj.ThreadID
+			}
+		}
 		re := regexp.MustCompile(`session id: ([0-9a-f-]+)`)
 		if matches := re.FindStringSubmatch(stderr); len(matches) > 1 {
 			return matches[1]
@@ -0,0 +1,1023 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+	"rcodegen/pkg/workspace"
+)
+
+// shellTool is a runner.Tool that runs the step task as a shell script.
+// It lets executor tests drive real subprocesses without any AI CLI installed.
+type shellTool struct{}
+
+func (shellTool) Name() string                                      { return "sh" }
+func (shellTool) BinaryName() string                                { return "sh" }
+func (shellTool) ReportDir() string                                 { return "_rcodegen" }
+func (shellTool) ReportPrefix() string                              { return "sh-" }
+func (shellTool) ValidModels() []string                             { return nil }
+func (shellTool) DefaultModel() string                              { return "" }
+func (shellTool) DefaultModelSetting() string                       { return "" }
+func (shellTool) ShowStatus()                                       {}
+func (shellTool) SupportsStatusTracking() bool                      { return false }
+func (shellTool) CaptureStatusBefore() interface{}                  { return nil }
+func (shellTool) CaptureStatusAfter() interface{}                   { return nil }
+func (shellTool) PrintStatusSummary(before, after interface{})      {}
+func (shellTool) ToolSpecificFlags() []runner.FlagDef               { return nil }
+func (shellTool) ApplyToolDefaults(cfg *runner.Config)              {}
+func (shellTool) PrepareForExecution(cfg *runner.Config)            {}
+func (shellTool) ValidateConfig(cfg *runner.Config) error           { return nil }
+func (shellTool) BannerTitle() string                               { return "sh" }
+func (shellTool) BannerSubtitle() string                            { return "" }
+func (shellTool) PrintToolSpecificBannerFields(cfg *runner.Config)  {}
+func (shellTool) PrintToolSpecificSummaryFields(cfg *runner.Config) {}
+func (shellTool) SecurityWarning() []string                         { return nil }
+func (shellTool) ToolSpecificHelpSections() []runner.HelpSection    { return nil }
+func (shellTool) StatsJSONFields(cfg *runner.Config) map[string]interface{} {
+	return nil
+}
+func (shellTool) UsesStreamOutput() bool                   { return false }
+func (shellTool) RunLogFields(cfg *runner.Config) []string { return nil }
+
+func (shellTool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", task)
+	cmd.Dir = workDir
+	return cmd
+}
+
+// newShellExecutor returns a ToolExecutor with the shell tool registered as "sh",
+// plus a context rooted in a temp codebase and a fresh workspace.
+func newShellExecutor(t *testing.T) (*ToolExecutor, *orchestrator.Context, *workspace.Workspace) {
+	t.Helper()
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	ctx := orchestrator.NewContext(map[string]string{"codebase": t.TempDir()})
+	return &ToolExecutor{Tools: map[string]runner.Tool{"sh": shellTool{}}}, ctx, ws
+}
+
+// countRuns returns how many lines the counter file has, i.e. how many times the script ran
+func countRuns(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading counter: %v", err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestToolExecutor_RetryOnListedExitCode(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	counter := filepath.Join(t.TempDir(), "runs")
+
+	step := &bundle.Step{
+		Name:  "flaky",
+		Tool:  "sh",
+		Task:  fmt.Sprintf("echo run >> %s; exit 3", counter),
+		Retry: &bundle.RetryDef{Max: 2, RetryOnExitCodes: []int{3}},
+	}
+
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusFailure {
+		t.Errorf("expected failure after exhausting retries, got %s", env.Status)
+	}
+	if runs := countRuns(t, counter); runs != 3 {
+		t.Errorf("expected 3 runs (1 + 2 retries), got %d", runs)
+	}
+	if env.Result["attempts"] != 3 {
+		t.Errorf("expected attempts=3, got %v", env.Result["attempts"])
+	}
+}
+
+// taskRecordingTool runs like shellTool but records the task of every
+// attempt, failing while the task has not been retried
+type taskRecordingTool struct {
+	shellTool
+	tasks *[]string
+}
+
+func (r taskRecordingTool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	*r.tasks = append(*r.tasks, task)
+	script := "echo 'unexpected token at line 1' >&2; exit 1"
+	if len(*r.tasks) > 1 {
+		script = "echo '{}'"
+	}
+	return shellTool{}.BuildCommand(cfg, workDir, script)
+}
+
+func TestToolExecutor_RetryPromptSuffix(t *testing.T) {
+	var tasks []string
+	e, ctx, ws := newShellExecutor(t)
+	e.Tools["sh"] = taskRecordingTool{tasks: &tasks}
+	ctx.SetResult("schema", envelope.New().Success().WithResult("format", "JSON").Build())
+
+	step := &bundle.Step{
+		Name:              "extract",
+		Tool:              "sh",
+		Task:              "Summarize the report",
+		Retry:             &bundle.RetryDef{Max: 2},
+		RetryPromptSuffix: "Your previous output was not valid ${steps.schema.result.format}; try again.",
+	}
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected the retry to succeed, got %v %+v", err, env)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(tasks))
+	}
+	if tasks[0] != "Summarize the report" {
+		t.Errorf("first attempt should get the task unchanged, got %q", tasks[0])
+	}
+	for _, want := range []string{
+		"Summarize the report\n\n",
+		"Your previous output was not valid JSON; try again.",
+		"The previous attempt failed: exit status 1",
+		"unexpected token at line 1",
+	} {
+		if !strings.Contains(tasks[1], want) {
+			t.Errorf("retry task should contain %q, got:\n%s", want, tasks[1])
+		}
+	}
+}
+
+func TestRetryTask_TruncatesStderr(t *testing.T) {
+	got := retryTask("task", "again", errors.New("exit status 2"), strings.Repeat("x", 3*maxStderrTailBytes)+"the end")
+	if !strings.HasSuffix(got, "the end") || len(got) > 100+maxStderrTailBytes {
+		t.Errorf("retry task should keep only the end of stderr, got %d bytes", len(got))
+	}
+}
+
+func TestToolExecutor_RetryBackoff(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	step := &bundle.Step{
+		Name:  "rate-limited",
+		Tool:  "sh",
+		Task:  "exit 1",
+		Retry: &bundle.RetryDef{Max: 2, BackoffMs: 60},
+	}
+
+	started := time.Now()
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusFailure || env.Result["attempts"] != 3 {
+		t.Fatalf("expected a failure after 3 attempts, got %s attempts=%v", env.Status, env.Result["attempts"])
+	}
+	// 60ms before the second attempt, 120ms before the third
+	if elapsed := time.Since(started); elapsed < 180*time.Millisecond {
+		t.Errorf("retries should back off for at least 180ms, took %s", elapsed)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		retry    *bundle.RetryDef
+		attempts int
+		want     time.Duration
+	}{
+		{nil, 1, 0},
+		{&bundle.RetryDef{Max: 3}, 1, 0},
+		{&bundle.RetryDef{Max: 3, BackoffMs: 2000}, 1, 2 * time.Second},
+		{&bundle.RetryDef{Max: 3, BackoffMs: 2000}, 2, 4 * time.Second},
+		{&bundle.RetryDef{Max: 3, BackoffMs: 2000}, 3, 8 * time.Second},
+		{&bundle.RetryDef{Max: 50, BackoffMs: 2000}, 40, maxRetryBackoff},
+	}
+	for _, tc := range tests {
+		if got := retryBackoff(tc.retry, tc.attempts); got != tc.want {
+			t.Errorf("retryBackoff(%+v, %d) = %s, want %s", tc.retry, tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestWaitBackoff_Abort(t *testing.T) {
+	abort := make(chan struct{})
+	close(abort)
+	started := time.Now()
+	if waitBackoff(time.Minute, abort) {
+		t.Error("waitBackoff should report the abort")
+	}
+	if time.Since(started) > time.Second {
+		t.Error("waitBackoff should return as soon as it is aborted")
+	}
+}
+
+func TestToolExecutor_NoRetryOnUnlistedExitCode(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	counter := filepath.Join(t.TempDir(), "runs")
+
+	step := &bundle.Step{
+		Name:  "broken",
+		Tool:  "sh",
+		Task:  fmt.Sprintf("echo run >> %s; exit 1", counter),
+		Retry: &bundle.RetryDef{Max: 2, RetryOnExitCodes: []int{3}},
+	}
+
+	env, _ := e.Execute(step, ctx, ws)
+	if env.Status != envelope.StatusFailure {
+		t.Errorf("expected failure, got %s", env.Status)
+	}
+	if runs := countRuns(t, counter); runs != 1 {
+		t.Errorf("expected exit code 1 not to be retried, got %d runs", runs)
+	}
+}
+
+func TestToolExecutor_RetrySucceedsOnLaterAttempt(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	marker := filepath.Join(t.TempDir(), "marker")
+
+	step := &bundle.Step{
+		Name:  "eventually",
+		Tool:  "sh",
+		Task:  fmt.Sprintf("if [ -f %[1]s ]; then echo ok; exit 0; fi; touch %[1]s; exit 75", marker),
+		Retry: &bundle.RetryDef{Max: 3, RetryOnExitCodes: []int{75}},
+	}
+
+	env, _ := e.Execute(step, ctx, ws)
+	if env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success on second attempt, got %s", env.Status)
+	}
+	if env.Result["attempts"] != 2 {
+		t.Errorf("expected attempts=2, got %v", env.Result["attempts"])
+	}
+}
+
+func TestToolExecutor_NoRetryBlock(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	counter := filepath.Join(t.TempDir(), "runs")
+
+	step := &bundle.Step{
+		Name: "once",
+		Tool: "sh",
+		Task: fmt.Sprintf("echo run >> %s; exit 3", counter),
+	}
+
+	env, _ := e.Execute(step, ctx, ws)
+	if runs := countRuns(t, counter); runs != 1 {
+		t.Errorf("expected a single run without a retry block, got %d", runs)
+	}
+	if _, ok := env.Result["attempts"]; ok {
+		t.Error("attempts should not be recorded without a retry block")
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	startErr := exec.Command("/nonexistent/binary").Run()
+
+	tests := []struct {
+		name  string
+		err   error
+		codes []int
+		want  bool
+	}{
+		{"any exit code when unlisted", exitErr, nil, true},
+		{"listed exit code", exitErr, []int{1, 3}, true},
+		{"unlisted exit code", exitErr, []int{1, 2}, false},
+		{"start failure never retried", startErr, nil, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryableError(tc.err, tc.codes); got != tc.want {
+				t.Errorf("isRetryableError(%v, %v) = %v, want %v", tc.err, tc.codes, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestToolExecutor_OutputStream(t *testing.T) {
+	tests := []struct {
+		stream string
+		want   string
+	}{
+		{"", "diagnostics\n"},
+		{"stdout", "diagnostics\n"},
+		{"stderr", "the answer\n"},
+		{"both", "diagnostics\nthe answer\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run("stream="+tc.stream, func(t *testing.T) {
+			e, ctx, ws := newShellExecutor(t)
+			step := &bundle.Step{
+				Name:         "mixed",
+				Tool:         "sh",
+				Task:         "echo diagnostics; echo 'the answer' >&2",
+				OutputStream: tc.stream,
+			}
+
+			env, err := e.Execute(step, ctx, ws)
+			if err != nil || env.Status != envelope.StatusSuccess {
+				t.Fatalf("Execute() = %v, %v", env, err)
+			}
+			if env.Result["output_length"] != len(tc.want) {
+				t.Errorf("output_length = %v, want %d", env.Result["output_length"], len(tc.want))
+			}
+
+			ctx.SetResult(step.Name, env)
+			if got := ctx.Resolve("${steps.mixed.output}"); got != tc.want {
+				t.Errorf("${steps.mixed.output} = %q, want %q", got, tc.want)
+			}
+			// The raw streams stay available regardless of the selection
+			if got := ctx.Resolve("${steps.mixed.stderr}"); got != "the answer\n" {
+				t.Errorf("${steps.mixed.stderr} = %q", got)
+			}
+		})
+	}
+}
+
+func TestToolExecutor_OutputStreamRaw(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	ws.PersistFormat = workspace.PersistRaw
+
+	step := &bundle.Step{
+		Name:         "answer",
+		Tool:         "sh",
+		Task:         "echo noise; echo '# Report' >&2",
+		OutputStream: "stderr",
+	}
+	env, _ := e.Execute(step, ctx, ws)
+
+	data, err := os.ReadFile(env.OutputRef)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	if string(data) != "# Report\n" {
+		t.Errorf("raw output file = %q, want the stderr stream", data)
+	}
+}
+
+func TestToolExecutor_FailOnStderr(t *testing.T) {
+	tests := []struct {
+		name         string
+		task         string
+		failOnStderr bool
+		want         envelope.Status
+	}{
+		{"stderr with flag fails", "echo ok; echo 'warning: deprecated' >&2", true, envelope.StatusFailure},
+		{"stderr without flag succeeds", "echo ok; echo 'warning: deprecated' >&2", false, envelope.StatusSuccess},
+		{"clean run with flag succeeds", "echo ok", true, envelope.StatusSuccess},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, ctx, ws := newShellExecutor(t)
+			step := &bundle.Step{Name: "strict", Tool: "sh", Task: tc.task, FailOnStderr: tc.failOnStderr}
+
+			env, err := e.Execute(step, ctx, ws)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if env.Status != tc.want {
+				t.Fatalf("status = %s, want %s", env.Status, tc.want)
+			}
+			if tc.want == envelope.StatusFailure {
+				if env.Error == nil || env.Error.Code != "STDERR_OUTPUT" {
+					t.Fatalf("expected STDERR_OUTPUT error, got %+v", env.Error)
+				}
+				if !strings.Contains(env.Error.Message, "warning: deprecated") {
+					t.Errorf("error message should quote stderr, got %q", env.Error.Message)
+				}
+				if env.OutputRef == "" {
+					t.Error("output should still be persisted for a stderr failure")
+				}
+			}
+		})
+	}
+}
+
+func TestToolExecutor_SecretsMaskedInLogsAndOutputs(t *testing.T) {
+	t.Setenv("RCODEGEN_TEST_API_KEY", "sk-live-123456")
+	e, ctx, ws := newShellExecutor(t)
+	received := filepath.Join(t.TempDir(), "received")
+
+	step := &bundle.Step{
+		Name: "deploy",
+		Tool: "sh",
+		Task: fmt.Sprintf("printf %%s '${secret.RCODEGEN_TEST_API_KEY}' > %s; echo \"using ${secret.RCODEGEN_TEST_API_KEY}\"; echo 'key=${secret.RCODEGEN_TEST_API_KEY}' >&2; exit 2", received),
+	}
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The tool received the real value
+	if data, _ := os.ReadFile(received); string(data) != "sk-live-123456" {
+		t.Fatalf("tool received %q, want the secret value", data)
+	}
+
+	// Nothing written out contains it
+	logData, err := os.ReadFile(filepath.Join(ws.JobDir, "logs", "deploy.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outData, err := os.ReadFile(env.OutputRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"log": string(logData), "output": string(outData), "error": env.Error.Message} {
+		if strings.Contains(data, "sk-live-123456") {
+			t.Errorf("secret leaked into %s: %q", name, data)
+		}
+	}
+	if !strings.Contains(string(logData), "using "+orchestrator.SecretMask) || !strings.Contains(string(logData), "key="+orchestrator.SecretMask) {
+		t.Errorf("log should show the masked secret:\n%s", logData)
+	}
+	ctx.SetResult("deploy", env)
+	if got := ctx.Resolve("${steps.deploy.stdout}"); got != "using "+orchestrator.SecretMask+"\n" {
+		t.Errorf("persisted stdout = %q, want masked", got)
+	}
+}
+
+func TestToolExecutor_OutputFilter(t *testing.T) {
+	task := "echo 'INFO starting'; echo 'DEBUG cache warm'; echo 'RESULT 42'; echo 'DEBUG done'; echo 'WARN slow disk' >&2"
+
+	tests := []struct {
+		name       string
+		filter     string
+		exclude    string
+		wantStdout string
+		wantLog    []string
+		droppedLog []string
+	}{
+		{"include only", "^(RESULT|WARN)", "", "RESULT 42\n",
+			[]string{"RESULT 42", "WARN slow disk"}, []string{"INFO starting", "DEBUG"}},
+		{"exclude only", "", "^DEBUG", "INFO starting\nRESULT 42\n",
+			[]string{"INFO starting", "RESULT 42", "WARN slow disk"}, []string{"DEBUG"}},
+		{"include and exclude", "^(INFO|DEBUG)", "done$", "INFO starting\nDEBUG cache warm\n",
+			[]string{"INFO starting", "DEBUG cache warm"}, []string{"DEBUG done", "RESULT", "WARN"}},
+		{"no filters", "", "", "INFO starting\nDEBUG cache warm\nRESULT 42\nDEBUG done\n",
+			[]string{"INFO starting", "DEBUG done", "WARN slow disk"}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, ctx, ws := newShellExecutor(t)
+			step := &bundle.Step{Name: "noisy", Tool: "sh", Task: task, OutputFilter: tc.filter, OutputExclude: tc.exclude}
+
+			env, err := e.Execute(step, ctx, ws)
+			if err != nil || env.Status != envelope.StatusSuccess {
+				t.Fatalf("unexpected result: %+v %v", env, err)
+			}
+			ctx.SetResult("noisy", env)
+			if got := ctx.Resolve("${steps.noisy.stdout}"); got != tc.wantStdout {
+				t.Errorf("stored stdout = %q, want %q", got, tc.wantStdout)
+			}
+
+			logData, err := os.ReadFile(filepath.Join(ws.JobDir, "logs", "noisy.log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.wantLog {
+				if !strings.Contains(string(logData), want) {
+					t.Errorf("log should contain %q:\n%s", want, logData)
+				}
+			}
+			for _, dropped := range tc.droppedLog {
+				if strings.Contains(string(logData), dropped) {
+					t.Errorf("log should not contain %q:\n%s", dropped, logData)
+				}
+			}
+		})
+	}
+}
+
+func TestToolExecutor_InvalidOutputFilter(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	step := &bundle.Step{Name: "bad", Tool: "sh", Task: "echo hi", OutputFilter: "(unclosed"}
+
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Error == nil || env.Error.Code != "INVALID_OUTPUT_FILTER" {
+		t.Errorf("expected INVALID_OUTPUT_FILTER, got %+v", env)
+	}
+}
+
+func TestToolExecutor_OutputHash(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	run := func(name, task string) *envelope.Envelope {
+		t.Helper()
+		env, err := e.Execute(&bundle.Step{Name: name, Tool: "sh", Task: task}, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return env
+	}
+	a := run("candidate-a", "echo same answer")
+	b := run("candidate-b", "printf 'same answer\\r\\n'")
+	c := run("candidate-c", "echo other answer")
+
+	if a.OutputHash == "" {
+		t.Fatal("expected an output_hash on the envelope")
+	}
+	if a.OutputHash != b.OutputHash {
+		t.Errorf("identical outputs should hash equally: %s vs %s", a.OutputHash, b.OutputHash)
+	}
+	if a.OutputHash == c.OutputHash {
+		t.Error("different outputs should hash differently")
+	}
+}
+
+func TestToolExecutor_PromptLengthWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		taskLen  int
+		wantWarn bool
+	}{
+		{"below threshold", 100, 390, false},
+		{"at threshold", 100, 400, false},
+		{"above threshold", 100, 800, true},
+		{"default threshold", 0, 800, false},
+		{"disabled", -1, 1 << 20, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, ctx, ws := newShellExecutor(t)
+			e.PromptWarnTokens = tc.limit
+
+			// A shell comment pads the task without changing what runs
+			task := "true #" + strings.Repeat("x", tc.taskLen-6)
+			env, err := e.Execute(&bundle.Step{Name: "big", Tool: "sh", Task: task}, ctx, ws)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, warned := env.Result["prompt_warning"]
+			if warned != tc.wantWarn {
+				t.Errorf("prompt_warning present = %v, want %v (result %v)", warned, tc.wantWarn, env.Result["prompt_warning"])
+			}
+			logData, err := os.ReadFile(filepath.Join(ws.JobDir, "logs", "big.log"))
+			if err != nil {
+				t.Fatalf("reading log: %v", err)
+			}
+			if got := strings.Contains(string(logData), "warning: resolved task"); got != tc.wantWarn {
+				t.Errorf("warning in step log = %v, want %v:\n%.200s", got, tc.wantWarn, logData)
+			}
+		})
+	}
+}
+
+func TestSetJobEnv(t *testing.T) {
+	t.Setenv("RCODEGEN_TEST_MARKER", "kept")
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+
+	cmd := exec.Command("true")
+	setJobEnv(cmd, ws)
+	for _, want := range []string{
+		"RCODEGEN_JOB_ID=" + ws.JobID,
+		"RCODEGEN_JOB_DIR=" + ws.JobDir,
+		"RCODEGEN_TEST_MARKER=kept", // the process environment is passed through
+	} {
+		if !slices.Contains(cmd.Env, want) {
+			t.Errorf("command env is missing %q", want)
+		}
+	}
+
+	// An environment the tool set itself is extended, not replaced
+	cmd = exec.Command("true")
+	cmd.Env = []string{"TOOL_VAR=1"}
+	setJobEnv(cmd, ws)
+	if len(cmd.Env) != 3 || cmd.Env[0] != "TOOL_VAR=1" {
+		t.Errorf("tool env should be kept, got %v", cmd.Env)
+	}
+}
+
+func TestToolExecutor_JobEnvVisibleToTool(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	env, err := e.Execute(&bundle.Step{Name: "env", Tool: "sh", Task: "echo \"$RCODEGEN_JOB_ID|$RCODEGEN_JOB_DIR\""}, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("step failed: %v %+v", err, env)
+	}
+	data, err := os.ReadFile(env.OutputRef)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	if want := ws.JobID + "|" + ws.JobDir; !strings.Contains(string(data), want) {
+		t.Errorf("tool saw %s, want %s", data, want)
+	}
+}
+
+// configTool is the shell tool, recording the config it is given
+type configTool struct {
+	shellTool
+	cfg *runner.Config
+}
+
+func (c *configTool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	c.cfg = cfg
+	return c.shellTool.BuildCommand(cfg, workDir, task)
+}
+
+func TestToolExecutor_SystemPromptFiles(t *testing.T) {
+	_, ctx, ws := newShellExecutor(t)
+	tool := &configTool{}
+	e := &ToolExecutor{
+		Tools:             map[string]runner.Tool{"sh": tool},
+		SystemPromptFiles: map[string]string{"sh": "/p/conventions.md", "other": "/p/other.md"},
+	}
+
+	if _, err := e.Execute(&bundle.Step{Name: "prompted", Tool: "sh", Task: "true"}, ctx, ws); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tool.cfg == nil || tool.cfg.SystemPromptFile != "/p/conventions.md" {
+		t.Errorf("tool config system prompt file = %+v, want /p/conventions.md", tool.cfg)
+	}
+}
+
+// quietDisplay keeps orchestrator runs in tests silent
+type quietDisplay struct{}
+
+func (quietDisplay) Start()                                                 {}
+func (quietDisplay) Stop()                                                  {}
+func (quietDisplay) SetStepRunning(int)                                     {}
+func (quietDisplay) SetStepModel(int, string)                               {}
+func (quietDisplay) SetStepComplete(int, float64, time.Duration, int, bool) {}
+func (quietDisplay) SetStepSkipped(int)                                     {}
+func (quietDisplay) PrintFinalSummary(float64, int, int, int, int)          {}
+
+// costDisplay is a quietDisplay recording the running costs it is shown
+type costDisplay struct {
+	quietDisplay
+	mu    sync.Mutex
+	costs []float64
+}
+
+func (d *costDisplay) UpdateCost(cost float64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.costs = append(d.costs, cost)
+}
+
+func TestToolExecutor_StreamsRunningCost(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	saved := orchestrator.DispatcherFactory
+	orchestrator.DispatcherFactory = func(map[string]runner.Tool) orchestrator.StepExecutor {
+		return NewDispatcher(map[string]runner.Tool{"sh": shellTool{}})
+	}
+	defer func() { orchestrator.DispatcherFactory = saved }()
+
+	d := &costDisplay{}
+	o := orchestrator.New(&settings.Settings{})
+	o.SetDisplay(d)
+
+	b := &bundle.Bundle{Name: "costs", Steps: []bundle.Step{{Name: "work", Tool: "sh", Task: `
+echo '{"type":"result","total_cost_usd":0.1}'
+echo '{"type":"assistant","message":{"content":[{"type":"text","text":"more"}]}}'
+echo '{"type":"result","total_cost_usd":0.25}'`}}}
+	if _, err := o.Run(b, map[string]string{"codebase": t.TempDir()}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.costs) != 2 || d.costs[0] != 0.1 || d.costs[1] != 0.25 {
+		t.Errorf("UpdateCost calls = %v, want [0.1 0.25]", d.costs)
+	}
+}
+
+func TestToolExecutor_PartialOutputKeptOnTimeout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	saved := orchestrator.DispatcherFactory
+	orchestrator.DispatcherFactory = func(map[string]runner.Tool) orchestrator.StepExecutor {
+		return NewDispatcher(map[string]runner.Tool{"sh": shellTool{}})
+	}
+	defer func() { orchestrator.DispatcherFactory = saved }()
+
+	o := orchestrator.New(&settings.Settings{})
+	o.SetDisplay(quietDisplay{})
+	o.SetTimeout(300 * time.Millisecond)
+
+	b := &bundle.Bundle{Name: "hang", Steps: []bundle.Step{
+		{Name: "slow", Tool: "sh", Task: "echo started; sleep 30"},
+	}}
+	started := time.Now()
+	env, err := o.Run(b, map[string]string{"codebase": t.TempDir()})
+	if err == nil {
+		t.Fatal("expected the run to time out")
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("timed out run should stop promptly, took %s", elapsed)
+	}
+	if env.Error == nil || env.Error.Code != envelope.CodeRunTimeout {
+		t.Fatalf("error = %+v, want %s", env.Error, envelope.CodeRunTimeout)
+	}
+
+	ref, _ := env.Result["partial_output_ref"].(string)
+	if ref == "" {
+		t.Fatalf("expected a partial_output_ref, result %v", env.Result)
+	}
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		t.Fatalf("reading partial output: %v", err)
+	}
+	if !strings.Contains(string(data), "started") {
+		t.Errorf("partial output should contain what the step printed before hanging, got %q", data)
+	}
+}
+
+func TestRunCmd_KillsOnAbort(t *testing.T) {
+	abort := make(chan struct{})
+	cmd := exec.Command("sleep", "30")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(abort)
+	}()
+
+	started := time.Now()
+	err := runCmd(cmd, abort, 0)
+	if !errors.Is(err, errCmdAborted) {
+		t.Fatalf("runCmd error = %v, want errCmdAborted", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("runCmd should return promptly on abort, took %s", elapsed)
+	}
+	if cmd.ProcessState == nil || cmd.ProcessState.Success() {
+		t.Errorf("the aborted process should have been killed, state %v", cmd.ProcessState)
+	}
+}
+
+func TestRunCmd_KillsOnTimeout(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	started := time.Now()
+	err := runCmd(cmd, nil, 50*time.Millisecond)
+	if !errors.Is(err, errCmdTimedOut) {
+		t.Fatalf("runCmd error = %v, want errCmdTimedOut", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("runCmd should return promptly on timeout, took %s", elapsed)
+	}
+	if cmd.ProcessState == nil || cmd.ProcessState.Success() {
+		t.Errorf("the timed out process should have been killed, state %v", cmd.ProcessState)
+	}
+}
+
+func TestToolExecutor_StepTimeout(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	step := &bundle.Step{Name: "hung", Tool: "sh", Task: "echo started; sleep 30", Timeout: "200ms"}
+	started := time.Now()
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("timed out step should stop promptly, took %s", elapsed)
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "TIMEOUT" {
+		t.Fatalf("expected a TIMEOUT failure, got %+v", env)
+	}
+	if env.Metrics == nil || env.Metrics.DurationMs < 200 {
+		t.Errorf("the elapsed duration should be recorded, metrics %+v", env.Metrics)
+	}
+	data, err := os.ReadFile(env.OutputRef)
+	if err != nil || !strings.Contains(string(data), "started") {
+		t.Errorf("partial output should be kept, got %q (%v)", data, err)
+	}
+	if env.OutputHash != envelope.HashOutput("started\n") {
+		t.Errorf("output_hash should cover the partial output, got %q", env.OutputHash)
+	}
+}
+
+func TestToolExecutor_StepWithinTimeout(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	env, err := e.Execute(&bundle.Step{Name: "quick", Tool: "sh", Task: "echo done", Timeout: "1m"}, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Fatalf("step finishing within its timeout should succeed, got %+v", env.Error)
+	}
+}
+
+func TestToolExecutor_InvalidTimeout(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	for _, timeout := range []string{"soon", "-5s"} {
+		env, err := e.Execute(&bundle.Step{Name: "bad", Tool: "sh", Task: "echo hi", Timeout: timeout}, ctx, ws)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if env.Error == nil || env.Error.Code != "INVALID_TIMEOUT" {
+			t.Errorf("timeout %q: expected INVALID_TIMEOUT, got %+v", timeout, env.Error)
+		}
+	}
+}
+
+func TestRunCmd_NilAbortRunsToCompletion(t *testing.T) {
+	if err := runCmd(exec.Command("sh", "-c", "exit 0"), nil, 0); err != nil {
+		t.Errorf("runCmd = %v, want nil", err)
+	}
+	if err := runCmd(exec.Command("sh", "-c", "exit 4"), nil, 0); err == nil {
+		t.Error("runCmd should return the exit error")
+	}
+}
+
+// streamShellTool is shellTool for a tool that prints stream-json
+type streamShellTool struct{ shellTool }
+
+func (streamShellTool) UsesStreamOutput() bool { return true }
+
+func TestToolExecutor_AssistantTurnsAndToolCalls(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	e.Tools["stream"] = streamShellTool{}
+
+	stream := filepath.Join(t.TempDir(), "stream.jsonl")
+	lines := []string{
+		`{"type":"assistant","message":{"id":"m1","content":[{"type":"text","text":"Checking"},{"type":"tool_use","id":"t1","name":"Read"}]}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result"}]}}`,
+		`{"type":"assistant","message":{"id":"m2","content":[{"type":"tool_use","id":"t2","name":"Edit"}]}}`,
+		`{"type":"assistant","message":{"id":"m3","content":[{"type":"text","text":"Fixed"}]}}`,
+		`{"type":"result","result":"Fixed","total_cost_usd":0.02}`,
+	}
+	if err := os.WriteFile(stream, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := e.Execute(&bundle.Step{Name: "fix", Tool: "stream", Task: "cat " + stream}, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success, got %v %+v", err, env)
+	}
+	if env.Result["assistant_turns"] != 3 || env.Result["tool_calls"] != 2 {
+		t.Errorf("assistant_turns = %v, tool_calls = %v, want 3 and 2", env.Result["assistant_turns"], env.Result["tool_calls"])
+	}
+
+	// Tools without stream output record neither
+	env, _ = e.Execute(&bundle.Step{Name: "plain", Tool: "sh", Task: "echo hi"}, ctx, ws)
+	if _, ok := env.Result["assistant_turns"]; ok {
+		t.Errorf("plain tool should not record assistant_turns: %v", env.Result)
+	}
+}
+
+func TestToolExecutor_FailureIncludesStderr(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	step := &bundle.Step{Name: "broken", Tool: "sh", Task: "echo 'compiling' >&2; echo 'error: missing module foo' >&2; exit 2"}
+	env, err := e.Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil {
+		t.Fatalf("expected a failure, got %+v", env)
+	}
+	if env.Error.Message != "exit status 2: error: missing module foo" {
+		t.Errorf("message = %q, want the exit status and stderr's last line", env.Error.Message)
+	}
+	if env.Result["stderr"] != "compiling\nerror: missing module foo" {
+		t.Errorf("stderr result = %q", env.Result["stderr"])
+	}
+
+	// A failure without stderr keeps the plain exit status
+	env, _ = e.Execute(&bundle.Step{Name: "quiet", Tool: "sh", Task: "exit 1"}, ctx, ws)
+	if env.Error.Message != "exit status 1" {
+		t.Errorf("message = %q", env.Error.Message)
+	}
+	if _, ok := env.Result["stderr"]; ok {
+		t.Error("a failure without stderr should not record one")
+	}
+}
+
+func TestToolExecutor_ReportsOutputLines(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+
+	var mu sync.Mutex
+	var lines []string
+	ctx.SetOutputReporter(func(step, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, step+": "+line)
+	})
+
+	task := `echo 'checking out'; printf '%s\n' '{"type":"assistant","message":{"content":[{"type":"text","text":"Looks good"}]}}'; printf 'no newline'`
+	env, err := e.Execute(&bundle.Step{Name: "watch", Tool: "sh", Task: task}, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Execute = %+v, %v", env, err)
+	}
+
+	want := []string{
+		"watch: checking out",
+		"watch: " + runner.White + "Looks good" + runner.Reset,
+		"watch: no newline",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(lines, want) {
+		t.Errorf("reported lines = %q, want %q", lines, want)
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	if got := stderrTail("  short\n"); got != "short" {
+		t.Errorf("stderrTail(short) = %q", got)
+	}
+
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("warning %d: é", i))
+	}
+	got := stderrTail(strings.Join(lines, "\n"))
+	if len(got) > maxStderrTailBytes+4 {
+		t.Errorf("tail is %d bytes, want at most %d", len(got), maxStderrTailBytes)
+	}
+	if !strings.HasPrefix(got, "...\nwarning ") || !strings.HasSuffix(got, "warning 999: é") {
+		t.Errorf("tail should start at a line boundary and keep the end, got %q...", got[:30])
+	}
+}
+
+func TestExtractCostInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		stdout string
+		want   UsageInfo
+	}{
+		{"claude", `{"type":"system","subtype":"init","session_id":"4f1c"}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Done."}]}}
+{"type":"result","subtype":"success","total_cost_usd":0.1842,"usage":{"input_tokens":31,"cache_creation_input_tokens":12410,"cache_read_input_tokens":203877,"output_tokens":2944}}`,
+			UsageInfo{CostUSD: 0.1842, InputTokens: 31, OutputTokens: 2944, CacheReadTokens: 203877, CacheWriteTokens: 12410}},
+		{"codex", `{"type":"thread.started","thread_id":"0199a213"}
+{"type":"turn.completed","usage":{"input_tokens":24763,"cached_input_tokens":24448,"output_tokens":122}}
+{"type":"turn.completed","usage":{"input_tokens":100,"cached_input_tokens":0,"output_tokens":10}}`,
+			UsageInfo{InputTokens: 24863, OutputTokens: 132, CacheReadTokens: 24448}},
+		{"gemini", `{"type":"init","session_id":"abc123","model":"gemini-2.5-pro"}
+{"type":"result","status":"success","stats":{"total_tokens":250,"input_tokens":200,"output_tokens":50,"cached":40,"tool_calls":2}}`,
+			UsageInfo{InputTokens: 200, OutputTokens: 50, CacheReadTokens: 40}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			parser := runner.NewStreamParser(io.Discard)
+			for _, line := range strings.Split(tc.stdout, "\n") {
+				parser.ProcessLine(line)
+			}
+			if got := extractCostInfo(parser); got != tc.want {
+				t.Errorf("usage = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestToolExecutor_CodexStreamUsage(t *testing.T) {
+	e, ctx, ws := newShellExecutor(t)
+	e.Tools["codex"] = streamShellTool{}
+
+	stream := filepath.Join(t.TempDir(), "stream.jsonl")
+	lines := []string{
+		`{"type":"thread.started","thread_id":"0199a213-81c0"}`,
+		`{"type":"item.completed","item":{"id":"item_0","type":"command_execution","command":"go test ./..."}}`,
+		`{"type":"turn.completed","usage":{"input_tokens":1000,"cached_input_tokens":400,"output_tokens":50}}`,
+		`{"type":"item.completed","item":{"id":"item_1","type":"agent_message","text":"All tests pass."}}`,
+		`{"type":"turn.completed","usage":{"input_tokens":200,"cached_input_tokens":0,"output_tokens":20}}`,
+	}
+	if err := os.WriteFile(stream, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := e.Execute(&bundle.Step{Name: "check", Tool: "codex", Task: "cat " + stream}, ctx, ws)
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("expected success, got %v %+v", err, env)
+	}
+	if env.Result["input_tokens"] != 1200 || env.Result["output_tokens"] != 70 || env.Result["cache_read_tokens"] != 400 {
+		t.Errorf("usage = %v in, %v out, %v cached; want 1200, 70 and 400", env.Result["input_tokens"], env.Result["output_tokens"], env.Result["cache_read_tokens"])
+	}
+	if env.Result["tool_calls"] != 1 || env.Result["assistant_turns"] != 1 {
+		t.Errorf("tool_calls = %v, assistant_turns = %v, want 1 and 1", env.Result["tool_calls"], env.Result["assistant_turns"])
+	}
+	if got := ctx.GetToolSession("codex"); got != "0199a213-81c0" {
+		t.Errorf("session = %q, want the thread id", got)
+	}
+	ctx.SetResult("check", env)
+	if got := ctx.Resolve("${steps.check.output}"); got != "All tests pass." {
+		t.Errorf("output = %q, want the final agent message", got)
+	}
+}
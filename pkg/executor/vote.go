@@ -1,6 +1,12 @@
 package executor
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
 	"rcodegen/pkg/bundle"
 	"rcodegen/pkg/envelope"
 	"rcodegen/pkg/orchestrator"
@@ -9,54 +15,368 @@ import (
 
 type VoteExecutor struct{}
 
+// failedVote is the vote key and tally label of a failed input. Failed
+// inputs are counted apart from the values successful inputs vote for, so
+// an answer that happens to read "failure" is still an ordinary value.
+const failedVote = "failure"
+
+// Execute tallies the values the input steps vote for. An input votes for
+// its result.answer when it reports one, otherwise for its output: inputs
+// are grouped by output_hash, and a group's value is its first voter's
+// output with whitespace collapsed. An input with neither votes "success",
+// and a failed input counts as a "failure" vote. "majority" approves the
+// most common value only if it has more votes than any other value and
+// than the failures, so a tie is rejected; "unanimous" approves only a
+// value every vote is for. When no value is approved the step fails. An
+// approved vote's output is the output of the first input that voted for
+// the winning value. The "agreement" result is the fraction of votes cast
+// for the leading value, and "scores" (with return_scores) gives that
+// fraction for every candidate value.
 func (e *VoteExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
-	// Count votes from input steps
-	votes := make(map[string]int)
+	if step.Vote.Strategy == "ranked" {
+		return e.executeRanked(step, ctx, ws)
+	}
+
+	counts := make(map[string]int) // Successful value -> votes
+	var values []string            // Values in the order first voted for
+	failed := 0                    // Failed inputs
+	firstVoter := make(map[string]string)
+	groups := make(map[string]string) // Vote key -> value of its first voter
 
 	for _, inputRef := range step.Vote.Inputs {
-		// Extract step name from ${steps.name.output_ref}
-		// For now, just count successful steps
 		stepName := extractStepName(inputRef)
-		if env, ok := ctx.GetResult(stepName); ok && env != nil {
-			if env.Status == envelope.StatusSuccess {
-				votes["success"]++
-			} else {
-				votes["failure"]++
+		env, ok := ctx.GetResult(stepName)
+		if !ok || env == nil {
+			continue
+		}
+		if env.Status != envelope.StatusSuccess {
+			failed++
+			continue
+		}
+		key := voteKey(ctx, stepName, env)
+		value, seen := groups[key]
+		if !seen {
+			// Only the first voter of each group has its output read
+			value = voteValue(ctx, stepName, env)
+			groups[key] = value
+		}
+		if _, seen := firstVoter[value]; !seen {
+			firstVoter[value] = stepName
+			values = append(values, value)
+		}
+		counts[value]++
+	}
+
+	total := failed
+	winner := ""
+	runnerUp := failed // Most votes for anything other than the winner
+	for _, value := range values {
+		total += counts[value]
+		switch {
+		case winner == "" || counts[value] > counts[winner]:
+			if winner != "" {
+				runnerUp = max(runnerUp, counts[winner])
 			}
+			winner = value
+		default:
+			runnerUp = max(runnerUp, counts[value])
 		}
 	}
 
-	total := votes["success"] + votes["failure"]
+	// The tally shows failed inputs as "failure"; a value that reads the
+	// same is reported as it is, and the failures only as "failed"
+	votes := make(map[string]int, len(counts)+1)
+	for value, n := range counts {
+		votes[value] = n
+	}
+	if _, clash := counts[failedVote]; failed > 0 && !clash {
+		votes[failedVote] = failed
+	}
+
+	// Each candidate value scores the share of votes cast for it
+	scores := make(map[string]float64)
+	for _, value := range values {
+		scores[value] = float64(counts[value]) / float64(total)
+	}
 
 	var decision string
 	switch step.Vote.Strategy {
 	case "majority":
-		if votes["success"] > total/2 {
+		decision = "rejected"
+		if winner != "" && counts[winner] > runnerUp {
 			decision = "approved"
-		} else {
-			decision = "rejected"
 		}
 	case "unanimous":
-		if votes["failure"] == 0 {
+		decision = "rejected"
+		if winner != "" && counts[winner] == total {
 			decision = "approved"
-		} else {
-			decision = "rejected"
 		}
 	default:
 		decision = "unknown"
 	}
 
-	outputPath, _ := ws.WriteOutput(step.Name, map[string]interface{}{
-		"votes":    votes,
+	agreement := 0.0
+	if winner != "" {
+		agreement = float64(counts[winner]) / float64(total)
+	}
+
+	output := map[string]interface{}{
+		"votes":     votes,
+		"failed":    failed,
+		"decision":  decision,
+		"agreement": agreement,
+	}
+	chosen := decision
+	if decision == "approved" {
+		chosen = winner
+		if text, ok := ctx.StepOutput(firstVoter[winner]); ok {
+			chosen = text
+		}
+		output["winner"] = winner
+		output["winner_step"] = firstVoter[winner]
+		output["output"] = chosen
+	}
+	if step.Vote.ReturnScores {
+		output["scores"] = scores
+	}
+	outputPath, err := ws.WriteOutput(step.Name, output)
+	if err != nil {
+		return envelope.New().Failure("WRITE_ERROR", err.Error()).Build(), err
+	}
+
+	builder := envelope.New().
+		WithOutputRef(outputPath).
+		WithOutputHash(chosen)
+	switch {
+	case step.Vote.Strategy == "unanimous" && decision != "approved":
+		builder.Failure("NO_CONSENSUS", fmt.Sprintf("vote %s: inputs disagree (%d distinct votes and %d failed of %d)", step.Name, len(values), failed, total))
+	case step.Vote.Strategy == "majority" && decision != "approved":
+		builder.Failure("NO_CONSENSUS", fmt.Sprintf("vote %s: no value leads outright (%d votes for the most common, %d failed of %d)", step.Name, counts[winner], failed, total))
+	default:
+		builder.Success()
+	}
+	builder.WithResult("decision", decision).
+		WithResult("votes", votes).
+		WithResult("failed", failed).
+		WithResult("agreement", agreement)
+	if decision == "approved" {
+		builder.WithResult("winner", winner).
+			WithResult("winner_step", firstVoter[winner])
+	}
+	if step.Vote.ReturnScores {
+		builder.WithResult("scores", scores)
+	}
+	return builder.Build(), nil
+}
+
+// voteKey returns the key successful inputs voting together share: the
+// answer value for inputs that have one, otherwise the output hash
+func voteKey(ctx *orchestrator.Context, name string, env *envelope.Envelope) string {
+	if answer, ok := env.Result["answer"]; ok && answer != nil {
+		if value := strings.TrimSpace(fmt.Sprint(answer)); value != "" {
+			return "answer:" + value
+		}
+	}
+	if env.OutputHash != "" {
+		return "hash:" + env.OutputHash
+	}
+	if output, ok := ctx.StepOutput(name); ok && strings.TrimSpace(output) != "" {
+		return "hash:" + envelope.HashOutput(output)
+	}
+	return "success"
+}
+
+// voteValue returns the value the successful input step name votes for
+func voteValue(ctx *orchestrator.Context, name string, env *envelope.Envelope) string {
+	if answer, ok := env.Result["answer"]; ok && answer != nil {
+		if value := strings.TrimSpace(fmt.Sprint(answer)); value != "" {
+			return value
+		}
+	}
+	if output, ok := ctx.StepOutput(name); ok {
+		if value := strings.Join(strings.Fields(output), " "); value != "" {
+			return value
+		}
+	}
+	if env.OutputHash != "" {
+		return env.OutputHash
+	}
+	return "success"
+}
+
+// numericScore converts a result.score value to a number
+func numericScore(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// executeScored ranks the inputs that report a numeric result.score, highest
+// first (ties go to the first name in alphabetical order). The decision is
+// the best-scoring step, whose output becomes the vote's output.
+func (e *VoteExecutor) executeScored(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace, scores map[string]float64) (*envelope.Envelope, error) {
+	ranking := make([]string, 0, len(scores))
+	for name := range scores {
+		ranking = append(ranking, name)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if scores[ranking[i]] != scores[ranking[j]] {
+			return scores[ranking[i]] > scores[ranking[j]]
+		}
+		return ranking[i] < ranking[j]
+	})
+
+	decision := ranking[0]
+	chosen, _ := ctx.StepOutput(decision)
+	output := map[string]interface{}{
 		"decision": decision,
+		"ranking":  ranking,
+		"ballots":  len(scores),
+		"output":   chosen,
+	}
+	if step.Vote.ReturnScores {
+		output["scores"] = scores
+	}
+	outputPath, err := ws.WriteOutput(step.Name, output)
+	if err != nil {
+		return envelope.New().Failure("WRITE_ERROR", err.Error()).Build(), err
+	}
+
+	builder := envelope.New().
+		Success().
+		WithOutputRef(outputPath).
+		WithOutputHash(chosen).
+		WithResult("decision", decision).
+		WithResult("ranking", ranking).
+		WithResult("ballots", len(scores)).
+		WithResult("score", scores[decision])
+	if step.Vote.ReturnScores {
+		builder.WithResult("scores", scores)
+	}
+	return builder.Build(), nil
+}
+
+// executeRanked ranks inputs reporting a numeric result.score by it (see
+// executeScored). Otherwise it treats each input's output as a ballot
+// ranking candidates, best first, one per line or comma-separated.
+// Candidates get a Borda count:
+// on a ballot of n, the first gets n points, the second n-1, and so on. The
+// decision is the highest-scoring candidate (ties go to the first name in
+// alphabetical order) and "ranking" lists all candidates best first. The
+// "agreement" result is the fraction of ballots ranking the decision first.
+func (e *VoteExecutor) executeRanked(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	// Inputs that score themselves are ranked by score instead of ballots
+	scored := make(map[string]float64)
+	for _, inputRef := range step.Vote.Inputs {
+		stepName := extractStepName(inputRef)
+		env, ok := ctx.GetResult(stepName)
+		if !ok || env == nil || env.Status != envelope.StatusSuccess {
+			continue
+		}
+		if score, ok := numericScore(env.Result["score"]); ok {
+			scored[stepName] = score
+		}
+	}
+	if len(scored) > 0 {
+		return e.executeScored(step, ctx, ws, scored)
+	}
+
+	scores := make(map[string]float64)
+	firstChoices := make(map[string]int)
+	ballots := 0
+
+	for _, inputRef := range step.Vote.Inputs {
+		stepName := extractStepName(inputRef)
+		env, ok := ctx.GetResult(stepName)
+		if !ok || env == nil || env.Status != envelope.StatusSuccess {
+			continue
+		}
+		ballot := parseBallot(ctx.Resolve("${steps." + stepName + ".output}"))
+		if len(ballot) == 0 {
+			continue
+		}
+		ballots++
+		firstChoices[ballot[0]]++
+		for i, candidate := range ballot {
+			scores[candidate] += float64(len(ballot) - i)
+		}
+	}
+
+	ranking := make([]string, 0, len(scores))
+	for candidate := range scores {
+		ranking = append(ranking, candidate)
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if scores[ranking[i]] != scores[ranking[j]] {
+			return scores[ranking[i]] > scores[ranking[j]]
+		}
+		return ranking[i] < ranking[j]
 	})
 
-	return envelope.New().
+	if len(ranking) == 0 {
+		return envelope.New().Failure("NO_BALLOTS",
+			fmt.Sprintf("vote %s: no input produced a score or a ballot", step.Name)).
+			WithResult("ballots", 0).
+			Build(), nil
+	}
+	decision := ranking[0]
+	agreement := float64(firstChoices[decision]) / float64(ballots)
+
+	output := map[string]interface{}{
+		"decision":  decision,
+		"ranking":   ranking,
+		"ballots":   ballots,
+		"agreement": agreement,
+	}
+	if step.Vote.ReturnScores {
+		output["scores"] = scores
+	}
+	outputPath, err := ws.WriteOutput(step.Name, output)
+	if err != nil {
+		return envelope.New().Failure("WRITE_ERROR", err.Error()).Build(), err
+	}
+
+	builder := envelope.New().
 		Success().
 		WithOutputRef(outputPath).
+		WithOutputHash(decision).
 		WithResult("decision", decision).
-		WithResult("votes", votes).
-		Build(), nil
+		WithResult("ranking", ranking).
+		WithResult("ballots", ballots).
+		WithResult("agreement", agreement)
+	if step.Vote.ReturnScores {
+		builder.WithResult("scores", scores)
+	}
+	return builder.Build(), nil
+}
+
+// ballotMarker matches a leading list marker on a ballot line
+var ballotMarker = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*])\s*`)
+
+// parseBallot splits a ranked ballot into candidate names, dropping list
+// markers such as "1.", "2)" and "-" and ignoring repeated candidates
+func parseBallot(output string) []string {
+	var ballot []string
+	seen := make(map[string]bool)
+	fields := strings.FieldsFunc(output, func(r rune) bool { return r == '\n' || r == ',' })
+	for _, field := range fields {
+		name := strings.TrimSpace(ballotMarker.ReplaceAllString(field, ""))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		ballot = append(ballot, name)
+	}
+	return ballot
 }
 
 func extractStepName(ref string) string {
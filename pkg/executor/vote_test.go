@@ -1,6 +1,9 @@
 package executor
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"rcodegen/pkg/bundle"
@@ -125,6 +128,70 @@ func TestVoteExecutor_Majority_Tie(t *testing.T) {
 	}
 }
 
+func TestVoteExecutor_Majority_Plurality(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []string
+		winner  string // "" when the vote is rejected
+		step    string
+	}{
+		{"all differ", []string{"x", "y", "z"}, "", ""},
+		{"two-way tie", []string{"y", "x", "x", "y", "z"}, "", ""},
+		{"plurality", []string{"z", "x", "y", "x", "y", "x"}, "x", "b"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := orchestrator.NewContext(nil)
+			ws, err := workspace.New(t.TempDir())
+			if err != nil {
+				t.Fatalf("workspace.New: %v", err)
+			}
+			var inputs []string
+			for i, answer := range tc.answers {
+				name := string(rune('a' + i))
+				answerStep(t, ctx, ws, name, answer, map[string]interface{}{"answer": answer})
+				inputs = append(inputs, name)
+			}
+
+			step := &bundle.Step{Name: "pick", Vote: &bundle.VoteDef{Inputs: inputs, Strategy: "majority"}}
+			env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+			if tc.winner == "" {
+				// A tie for the most votes approves nothing
+				if env.Status != envelope.StatusFailure || env.Result["decision"] != "rejected" {
+					t.Errorf("status %s decision %v, want a rejected failure", env.Status, env.Result["decision"])
+				}
+				return
+			}
+			if env.Status != envelope.StatusSuccess || env.Result["decision"] != "approved" {
+				t.Fatalf("status %s decision %v, want an approved success", env.Status, env.Result["decision"])
+			}
+			if env.Result["winner"] != tc.winner || env.Result["winner_step"] != tc.step {
+				t.Errorf("winner %v from %v, want %s from %s", env.Result["winner"], env.Result["winner_step"], tc.winner, tc.step)
+			}
+		})
+	}
+}
+
+func TestVoteExecutor_Majority_FailuresLead(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ctx.SetResult("step1", &envelope.Envelope{Status: envelope.StatusFailure})
+	ctx.SetResult("step2", &envelope.Envelope{Status: envelope.StatusSuccess})
+
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+
+	step := &bundle.Step{Name: "pick", Vote: &bundle.VoteDef{Inputs: []string{"step1", "step2"}, Strategy: "majority"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Result["decision"] != "rejected" {
+		t.Errorf("expected 'rejected' when failures lead, got %v", env.Result["decision"])
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "NO_CONSENSUS" {
+		t.Errorf("expected a NO_CONSENSUS failure, got %s %+v", env.Status, env.Error)
+	}
+}
+
 func TestVoteExecutor_Unanimous_Approved(t *testing.T) {
 	ctx := orchestrator.NewContext(nil)
 	ctx.SetResult("step1", &envelope.Envelope{Status: envelope.StatusSuccess})
@@ -226,3 +293,373 @@ func TestVoteExecutor_MissingStep(t *testing.T) {
 		t.Errorf("expected 1 total vote (missing step skipped), got %d", total)
 	}
 }
+
+// ballotStep records a successful step whose output is the given ballot
+func ballotStep(t *testing.T, ctx *orchestrator.Context, ws *workspace.Workspace, name, ballot string) {
+	t.Helper()
+	path, err := ws.WriteStepResult(name, ballot, ballot, "")
+	if err != nil {
+		t.Fatalf("WriteStepResult: %v", err)
+	}
+	ctx.SetResult(name, &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: path})
+}
+
+func TestVoteExecutor_Ranked_ReturnScores(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	ballotStep(t, ctx, ws, "judge1", "1. alpha\n2. beta\n3. gamma\n")
+	ballotStep(t, ctx, ws, "judge2", "beta, alpha, gamma")
+	ballotStep(t, ctx, ws, "judge3", "- alpha\n- gamma\n- beta\n")
+
+	step := &bundle.Step{
+		Name: "rank",
+		Vote: &bundle.VoteDef{
+			Inputs:       []string{"${steps.judge1.output_ref}", "${steps.judge2.output_ref}", "${steps.judge3.output_ref}"},
+			Strategy:     "ranked",
+			ReturnScores: true,
+		},
+	}
+
+	env, execErr := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if execErr != nil {
+		t.Fatalf("unexpected error: %v", execErr)
+	}
+
+	scores, ok := env.Result["scores"].(map[string]float64)
+	if !ok {
+		t.Fatalf("expected a scores map, got %T", env.Result["scores"])
+	}
+	want := map[string]float64{"alpha": 8, "beta": 6, "gamma": 4}
+	total := 0.0
+	for candidate, score := range want {
+		if scores[candidate] != score {
+			t.Errorf("scores[%s] = %v, want %v", candidate, scores[candidate], score)
+		}
+	}
+	for _, score := range scores {
+		total += score
+	}
+	// Each 3-candidate ballot hands out 3+2+1 points
+	if total != 3*6 {
+		t.Errorf("scores should sum to 18, got %v", total)
+	}
+
+	ranking := env.Result["ranking"].([]string)
+	if strings.Join(ranking, ",") != "alpha,beta,gamma" {
+		t.Errorf("ranking = %v, want [alpha beta gamma]", ranking)
+	}
+	if env.Result["decision"] != "alpha" {
+		t.Errorf("decision = %v, want alpha", env.Result["decision"])
+	}
+}
+
+func TestVoteExecutor_Ranked_TieBreaksAlphabetically(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	ballotStep(t, ctx, ws, "judge1", "zeta\nalpha")
+	ballotStep(t, ctx, ws, "judge2", "alpha\nzeta")
+
+	step := &bundle.Step{
+		Name: "rank",
+		Vote: &bundle.VoteDef{
+			Inputs:   []string{"${steps.judge1.output_ref}", "${steps.judge2.output_ref}"},
+			Strategy: "ranked",
+		},
+	}
+
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Result["decision"] != "alpha" {
+		t.Errorf("tied candidates should resolve alphabetically, got %v", env.Result["decision"])
+	}
+	if _, ok := env.Result["scores"]; ok {
+		t.Error("scores should only be returned when return_scores is set")
+	}
+}
+
+func TestVoteExecutor_Majority_ReturnScores(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	answerStep(t, ctx, ws, "step1", "x", map[string]interface{}{"answer": "x"})
+	answerStep(t, ctx, ws, "step2", "y", map[string]interface{}{"answer": "y"})
+	answerStep(t, ctx, ws, "step3", "x", map[string]interface{}{"answer": "x"})
+	ctx.SetResult("step4", &envelope.Envelope{Status: envelope.StatusFailure})
+
+	step := &bundle.Step{
+		Name: "vote-test",
+		Vote: &bundle.VoteDef{
+			Inputs:       []string{"step1", "step2", "step3", "step4"},
+			Strategy:     "majority",
+			ReturnScores: true,
+		},
+	}
+
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	scores, ok := env.Result["scores"].(map[string]float64)
+	if !ok {
+		t.Fatalf("expected a scores map, got %T", env.Result["scores"])
+	}
+	// Scores are keyed by candidate value; failed inputs aren't candidates
+	if scores["x"] != 0.5 || scores["y"] != 0.25 || len(scores) != 2 {
+		t.Errorf("scores = %v, want x=0.5 y=0.25", scores)
+	}
+}
+
+// answerStep records a successful step with the given output and result
+func answerStep(t *testing.T, ctx *orchestrator.Context, ws *workspace.Workspace, name, output string, result map[string]interface{}) {
+	t.Helper()
+	path, err := ws.WriteStepResult(name, output, output, "")
+	if err != nil {
+		t.Fatalf("WriteStepResult: %v", err)
+	}
+	ctx.SetResult(name, &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: path, Result: result})
+}
+
+func TestVoteExecutor_Majority_ByAnswer(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	answerStep(t, ctx, ws, "claude", "The bug is in the parser.", map[string]interface{}{"answer": "parser"})
+	answerStep(t, ctx, ws, "codex", "It's the lexer.", map[string]interface{}{"answer": "lexer"})
+	answerStep(t, ctx, ws, "gemini", "Parser, clearly.", map[string]interface{}{"answer": "parser"})
+
+	step := &bundle.Step{Name: "vote", Vote: &bundle.VoteDef{Inputs: []string{"claude", "codex", "gemini"}, Strategy: "majority"}}
+	env, err := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Result["decision"] != "approved" || env.Result["winner"] != "parser" || env.Result["winner_step"] != "claude" {
+		t.Fatalf("expected parser to win for claude, got %v", env.Result)
+	}
+	votes := env.Result["votes"].(map[string]int)
+	if votes["parser"] != 2 || votes["lexer"] != 1 {
+		t.Errorf("votes = %v, want parser=2 lexer=1", votes)
+	}
+
+	// The chosen output is the winning input's output
+	ctx.SetResult("vote", env)
+	if got := ctx.Resolve("${steps.vote.output}"); got != "The bug is in the parser." {
+		t.Errorf("vote output = %q, want the winning step's output", got)
+	}
+}
+
+func TestVoteExecutor_Majority_ByNormalizedOutput(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	answerStep(t, ctx, ws, "a", "42\n", nil)
+	answerStep(t, ctx, ws, "b", "  42 ", nil)
+	answerStep(t, ctx, ws, "c", "41", nil)
+
+	step := &bundle.Step{Name: "vote", Vote: &bundle.VoteDef{Inputs: []string{"${steps.a.output}", "${steps.b.output}", "${steps.c.output}"}, Strategy: "majority"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Result["winner"] != "42" {
+		t.Errorf("outputs differing only in whitespace should vote together, got %v", env.Result)
+	}
+}
+
+func TestVoteExecutor_Unanimous_DisagreementFails(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	answerStep(t, ctx, ws, "a", "yes", nil)
+	answerStep(t, ctx, ws, "b", "no", nil)
+
+	step := &bundle.Step{Name: "vote", Vote: &bundle.VoteDef{Inputs: []string{"a", "b"}, Strategy: "unanimous"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "NO_CONSENSUS" {
+		t.Fatalf("expected a NO_CONSENSUS failure, got %+v", env)
+	}
+	votes := env.Result["votes"].(map[string]int)
+	if votes["yes"] != 1 || votes["no"] != 1 {
+		t.Errorf("the tally should still be reported, got %v", votes)
+	}
+
+	answerStep(t, ctx, ws, "b", "yes", nil)
+	env, _ = (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Status != envelope.StatusSuccess || env.Result["winner"] != "yes" {
+		t.Errorf("agreeing inputs should succeed, got %s %v", env.Status, env.Result)
+	}
+}
+
+func TestVoteExecutor_Ranked_ByScore(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	answerStep(t, ctx, ws, "draft1", "first draft", map[string]interface{}{"score": 6.5})
+	answerStep(t, ctx, ws, "draft2", "second draft", map[string]interface{}{"score": 9})
+	answerStep(t, ctx, ws, "draft3", "third draft", map[string]interface{}{"score": "7"})
+
+	step := &bundle.Step{Name: "pick", Vote: &bundle.VoteDef{Inputs: []string{"draft1", "draft2", "draft3"}, Strategy: "ranked"}}
+	env, err := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Result["decision"] != "draft2" {
+		t.Errorf("decision = %v, want the highest-scoring draft2", env.Result["decision"])
+	}
+	if ranking := env.Result["ranking"].([]string); strings.Join(ranking, ",") != "draft2,draft3,draft1" {
+		t.Errorf("ranking = %v, want [draft2 draft3 draft1]", ranking)
+	}
+	ctx.SetResult("pick", env)
+	if got := ctx.Resolve("${steps.pick.output}"); got != "second draft" {
+		t.Errorf("pick output = %q, want the best draft's output", got)
+	}
+}
+
+func TestVoteExecutor_Agreement(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ctx.SetResult("a", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"answer": "yes"}})
+	ctx.SetResult("b", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"answer": "yes"}})
+	ctx.SetResult("c", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"answer": "no"}})
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+
+	step := &bundle.Step{Name: "pick", Vote: &bundle.VoteDef{Inputs: []string{"a", "b", "c"}, Strategy: "majority"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if got := env.Result["agreement"]; got != 2.0/3.0 {
+		t.Fatalf("agreement = %v, want 2/3", got)
+	}
+	ctx.SetResult("pick", env)
+
+	if !orchestrator.EvaluateCondition("agreement(pick) >= 0.66", ctx) {
+		t.Error("expected agreement(pick) >= 0.66 with 2 of 3 votes")
+	}
+	if orchestrator.EvaluateCondition("agreement(pick) >= 0.75", ctx) {
+		t.Error("expected agreement(pick) < 0.75 with 2 of 3 votes")
+	}
+	if !orchestrator.EvaluateCondition("${steps.pick.result.agreement} > 0.5", ctx) {
+		t.Error("expected the agreement result to resolve as a reference")
+	}
+
+	// Ranked ballots agree when they put the decision first
+	ballotStep(t, ctx, ws, "judge1", "alpha\nbeta")
+	ballotStep(t, ctx, ws, "judge2", "beta\nalpha")
+	ballotStep(t, ctx, ws, "judge3", "alpha\nbeta")
+	ballotStep(t, ctx, ws, "judge4", "alpha\nbeta")
+	ranked := &bundle.Step{Name: "rank", Vote: &bundle.VoteDef{Inputs: []string{"judge1", "judge2", "judge3", "judge4"}, Strategy: "ranked"}}
+	env, _ = (&VoteExecutor{}).Execute(ranked, ctx, ws)
+	if env.Result["decision"] != "alpha" || env.Result["agreement"] != 0.75 {
+		t.Errorf("ranked decision %v agreement %v, want alpha at 0.75", env.Result["decision"], env.Result["agreement"])
+	}
+}
+
+func TestParseBallot(t *testing.T) {
+	got := parseBallot("1. alpha\n2) beta\n- gamma\n* 3d-model\nalpha\n\n")
+	want := "alpha|beta|gamma|3d-model"
+	if strings.Join(got, "|") != want {
+		t.Errorf("parseBallot = %q, want %q", got, want)
+	}
+}
+
+func TestVoteExecutor_Majority_ByOutputHash(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	// Inputs are grouped by their recorded hash; only the first voter of a
+	// group has its output read
+	hashed := func(name, output, hash string) {
+		answerStep(t, ctx, ws, name, output, nil)
+		env, _ := ctx.GetResult(name)
+		env.OutputHash = hash
+	}
+	hashed("a", "use a mutex", envelope.HashOutput("use a mutex"))
+	hashed("b", "unread", envelope.HashOutput("use a channel"))
+	hashed("c", "unread", envelope.HashOutput("use a mutex"))
+	ctx.SetResult("d", &envelope.Envelope{Status: envelope.StatusSuccess, OutputHash: envelope.HashOutput("use a channel")})
+	hashed("e", "unread", envelope.HashOutput("use a mutex"))
+
+	step := &bundle.Step{Name: "vote", Vote: &bundle.VoteDef{Inputs: []string{"a", "b", "c", "d", "e"}, Strategy: "majority"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	votes := env.Result["votes"].(map[string]int)
+	if votes["use a mutex"] != 3 || votes["unread"] != 2 || len(votes) != 2 {
+		t.Errorf("votes = %v, want 3 and 2 by output hash", votes)
+	}
+	if env.Result["winner"] != "use a mutex" || env.Result["winner_step"] != "a" {
+		t.Errorf("winner %v from %v, want use a mutex from a", env.Result["winner"], env.Result["winner_step"])
+	}
+}
+
+func TestVoteExecutor_Majority_FailureAnswerCanWin(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	// Two successful inputs answer "failure"; one input actually failed
+	answerStep(t, ctx, ws, "a", "failure", map[string]interface{}{"answer": "failure"})
+	answerStep(t, ctx, ws, "b", "failure", map[string]interface{}{"answer": "failure"})
+	ctx.SetResult("c", &envelope.Envelope{Status: envelope.StatusFailure})
+
+	step := &bundle.Step{Name: "pick", Vote: &bundle.VoteDef{Inputs: []string{"a", "b", "c"}, Strategy: "majority"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Status != envelope.StatusSuccess || env.Result["winner"] != "failure" || env.Result["winner_step"] != "a" {
+		t.Fatalf("status %s winner %v from %v, want the answer failure from a", env.Status, env.Result["winner"], env.Result["winner_step"])
+	}
+	if votes := env.Result["votes"].(map[string]int); votes["failure"] != 2 || env.Result["failed"] != 1 {
+		t.Errorf("votes = %v failed = %v, want 2 for the answer and 1 failed input", votes, env.Result["failed"])
+	}
+}
+
+func TestVoteExecutor_WriteError(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ctx.SetResult("step1", &envelope.Envelope{Status: envelope.StatusSuccess})
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	// A file where the outputs directory should be makes every write fail
+	if err := os.RemoveAll(filepath.Join(ws.JobDir, "outputs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws.JobDir, "outputs"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, strategy := range []string{"majority", "ranked"} {
+		step := &bundle.Step{Name: "pick", Vote: &bundle.VoteDef{Inputs: []string{"step1"}, Strategy: strategy}}
+		if strategy == "ranked" {
+			ctx.SetResult("step1", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"score": 0.5}})
+		}
+		env, execErr := (&VoteExecutor{}).Execute(step, ctx, ws)
+		if execErr == nil || env.Status != envelope.StatusFailure || env.Error.Code != "WRITE_ERROR" {
+			t.Errorf("%s: got %s %+v (%v), want a WRITE_ERROR failure", strategy, env.Status, env.Error, execErr)
+		}
+	}
+}
+
+func TestVoteExecutor_Ranked_NoBallots(t *testing.T) {
+	ctx := orchestrator.NewContext(nil)
+	ws, err := workspace.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("workspace.New: %v", err)
+	}
+	ballotStep(t, ctx, ws, "judge1", "   \n")
+	ctx.SetResult("judge2", &envelope.Envelope{Status: envelope.StatusFailure})
+
+	step := &bundle.Step{Name: "rank", Vote: &bundle.VoteDef{Inputs: []string{"judge1", "judge2"}, Strategy: "ranked"}}
+	env, _ := (&VoteExecutor{}).Execute(step, ctx, ws)
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "NO_BALLOTS" {
+		t.Errorf("got %s %+v, want a NO_BALLOTS failure", env.Status, env.Error)
+	}
+}
@@ -3,6 +3,9 @@
 package lock
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -60,33 +63,79 @@ func getLockDir() (string, error) {
 	return filepath.Join(home, ".rcodegen", "locks"), nil
 }
 
-// Acquire acquires a file lock, waiting if necessary
+// DefaultLockName is the lock shared by all runs of the single-tool commands
+const DefaultLockName = "rcodegen"
+
+// ErrLocked is returned by TryAcquire when another run holds the lock
+var ErrLocked = errors.New("lock is held by another run")
+
+// BundleLockName derives the lock name for running a bundle against a
+// codebase, so identical workflows queue while unrelated ones (another
+// bundle, or the same bundle on another codebase) run concurrently
+func BundleLockName(bundleName, codebase string) string {
+	if abs, err := filepath.Abs(codebase); err == nil {
+		codebase = abs
+	}
+	sum := sha256.Sum256([]byte(bundleName + "\x00" + codebase))
+	return "bundle-" + sanitizeIdentifier(bundleName) + "-" + hex.EncodeToString(sum[:6])
+}
+
+// Acquire acquires the shared file lock, waiting if necessary
 // identifier is used to identify who holds the lock (e.g., codebase name)
 func Acquire(identifier string, useLock bool) (*FileLock, error) {
 	if !useLock {
 		return nil, nil
 	}
+	return AcquireNamed(DefaultLockName, identifier)
+}
 
+// openLock opens (creating as needed) the lock file for name and returns
+// it with the path of its holder info file
+func openLock(name string) (*os.File, string, error) {
 	lockDir, err := getLockDir()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	// Create lock directory with secure permissions (owner only)
 	if err := os.MkdirAll(lockDir, 0700); err != nil {
-		return nil, fmt.Errorf("could not create lock directory %s: %w", lockDir, err)
+		return nil, "", fmt.Errorf("could not create lock directory %s: %w", lockDir, err)
 	}
 
-	lockPath := filepath.Join(lockDir, "rcodegen.lock")
-	lockInfoPath := filepath.Join(lockDir, "rcodegen.lock.info")
+	lockPath := filepath.Join(lockDir, sanitizeIdentifier(name)+".lock")
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open lock file %s: %w", lockPath, err)
+	}
+	return lockFile, lockPath + ".info", nil
+}
 
-	// Sanitize identifier for safe use
-	identifier = sanitizeIdentifier(identifier)
+// TryAcquire takes the named lock without waiting, returning ErrLocked if
+// another run holds it
+func TryAcquire(name, identifier string) (*FileLock, error) {
+	lockFile, lockInfoPath, err := openLock(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lockFile.Close()
+		return nil, ErrLocked
+	}
+	os.WriteFile(lockInfoPath, []byte(sanitizeIdentifier(identifier)), 0600)
+	return &FileLock{file: lockFile, path: lockFile.Name()}, nil
+}
 
-	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+// AcquireNamed acquires the named file lock, waiting if necessary
+// identifier is used to identify who holds the lock (e.g., codebase name)
+func AcquireNamed(name, identifier string) (*FileLock, error) {
+	lockFile, lockInfoPath, err := openLock(name)
 	if err != nil {
-		return nil, fmt.Errorf("could not open lock file %s: %w", lockPath, err)
+		return nil, err
 	}
+	lockPath := lockFile.Name()
+
+	// Sanitize identifier for safe use
+	identifier = sanitizeIdentifier(identifier)
 
 	// Try non-blocking lock first
 	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
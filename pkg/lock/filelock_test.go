@@ -1,6 +1,7 @@
 package lock
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -62,3 +63,52 @@ func TestAcquire_Disabled(t *testing.T) {
 		t.Error("expected nil FileLock when useLock=false")
 	}
 }
+
+func TestBundleLockName(t *testing.T) {
+	a := BundleLockName("build-review", "/src/app")
+	if a != BundleLockName("build-review", "/src/app/") {
+		t.Error("the same bundle and codebase should share a lock name")
+	}
+	if a == BundleLockName("security-review", "/src/app") {
+		t.Error("different bundles should get different lock names")
+	}
+	if a == BundleLockName("build-review", "/src/other") {
+		t.Error("different codebases should get different lock names")
+	}
+	if strings.ContainsAny(BundleLockName("a/b", "/src"), "/\\") {
+		t.Error("lock names must be safe file names")
+	}
+}
+
+func TestTryAcquire_BundleLocks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	review, err := TryAcquire(BundleLockName("review", "/src/app"), "review")
+	if err != nil {
+		t.Fatalf("TryAcquire review: %v", err)
+	}
+	defer review.Release()
+
+	// An unrelated bundle on the same codebase gets its own lock
+	audit, err := TryAcquire(BundleLockName("audit", "/src/app"), "audit")
+	if err != nil {
+		t.Fatalf("a different bundle should not contend: %v", err)
+	}
+	defer audit.Release()
+	if audit.path == review.path {
+		t.Errorf("different bundles share lock file %s", audit.path)
+	}
+
+	// The identical workflow contends until the first run releases
+	if _, err := TryAcquire(BundleLockName("review", "/src/app"), "review again"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("identical bundle and codebase should contend, got %v", err)
+	}
+	if err := review.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	again, err := TryAcquire(BundleLockName("review", "/src/app"), "review again")
+	if err != nil {
+		t.Fatalf("lock should be free after release: %v", err)
+	}
+	again.Release()
+}
@@ -0,0 +1,86 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rcodegen/pkg/bundle"
+)
+
+// bookkeepingFiles are written by rcodegen itself after a run and are never
+// its primary output
+var bookkeepingFiles = map[string]bool{
+	"Run Report.md":     true,
+	"final-report.json": true,
+	"bundle-used.json":  true,
+}
+
+// primaryOutput infers the main artifact a run produced from the files under
+// dirs saved since the run started: the last-saved file wins, and among files
+// saved in the same second the largest one. Hidden files and directories are
+// ignored. Returns "" when nothing was saved.
+func primaryOutput(dirs []string, since time.Time) string {
+	since = since.Truncate(time.Second)
+
+	var best string
+	var bestTime time.Time
+	var bestSize int64
+	seen := make(map[string]bool)
+
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if strings.HasPrefix(info.Name(), ".") && path != dir {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || seen[path] || bookkeepingFiles[info.Name()] {
+				return nil
+			}
+			seen[path] = true
+
+			mod := info.ModTime().Truncate(time.Second)
+			if mod.Before(since) {
+				return nil
+			}
+			if best == "" || mod.After(bestTime) || (mod.Equal(bestTime) && info.Size() > bestSize) {
+				best, bestTime, bestSize = path, mod, info.Size()
+			}
+			return nil
+		})
+	}
+	return best
+}
+
+// artifactDirs returns the directories a run saves its artifacts to: the
+// article or project output directory and the codebase's report directory
+func artifactDirs(inputs map[string]string, outputDir string) []string {
+	var dirs []string
+	if outputDir != "" {
+		dirs = append(dirs, outputDir)
+	}
+	if project := inputs["project_name"]; project != "" && inputs["output_dir"] != "" {
+		dirs = append(dirs, filepath.Join(inputs["output_dir"], project))
+	}
+	if codebase := inputs["codebase"]; codebase != "" {
+		dirs = append(dirs, filepath.Join(codebase, "_rcodegen"))
+	}
+	return dirs
+}
+
+// lastOutputRef returns the output of the last top-level step that
+// persisted one, the fallback primary output for runs that saved no files
+func lastOutputRef(b *bundle.Bundle, ctx *Context) string {
+	for i := len(b.Steps) - 1; i >= 0; i-- {
+		if env, ok := ctx.GetResult(b.Steps[i].Name); ok && env != nil && env.OutputRef != "" {
+			return env.OutputRef
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// writeAt creates a file with the given size and modification time
+func writeAt(t *testing.T, path string, size int, mod time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrimaryOutput_LastSavedWins(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeAt(t, filepath.Join(dir, "stale.md"), 5000, start.Add(-time.Minute))
+	writeAt(t, filepath.Join(dir, "draft.md"), 900, start.Add(10*time.Second))
+	writeAt(t, filepath.Join(dir, "sub", "report.md"), 300, start.Add(40*time.Second))
+
+	if got := primaryOutput([]string{dir}, start); got != filepath.Join(dir, "sub", "report.md") {
+		t.Errorf("primaryOutput = %q, want the last-saved report.md", got)
+	}
+}
+
+func TestPrimaryOutput_LargestAmongSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	saved := start.Add(30 * time.Second)
+
+	writeAt(t, filepath.Join(dir, "notes.txt"), 100, saved)
+	writeAt(t, filepath.Join(dir, "article.md"), 4000, saved.Add(200*time.Millisecond))
+	writeAt(t, filepath.Join(dir, "summary.md"), 800, saved.Add(400*time.Millisecond))
+
+	if got := primaryOutput([]string{dir}, start); got != filepath.Join(dir, "article.md") {
+		t.Errorf("primaryOutput = %q, want the largest file article.md", got)
+	}
+}
+
+func TestPrimaryOutput_IgnoresBookkeepingAndHiddenFiles(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeAt(t, filepath.Join(dir, "app.go"), 200, start.Add(5*time.Second))
+	writeAt(t, filepath.Join(dir, "final-report.json"), 9000, start.Add(50*time.Second))
+	writeAt(t, filepath.Join(dir, "Run Report.md"), 9000, start.Add(50*time.Second))
+	writeAt(t, filepath.Join(dir, ".git", "index"), 9000, start.Add(50*time.Second))
+	writeAt(t, filepath.Join(dir, ".DS_Store"), 9000, start.Add(50*time.Second))
+
+	if got := primaryOutput([]string{dir}, start); got != filepath.Join(dir, "app.go") {
+		t.Errorf("primaryOutput = %q, want app.go", got)
+	}
+	if got := primaryOutput([]string{filepath.Join(dir, "missing")}, start); got != "" {
+		t.Errorf("primaryOutput of a missing dir = %q, want empty", got)
+	}
+}
+
+func TestRun_ReportsPrimaryOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	codebase := t.TempDir()
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		dir := filepath.Join(codebase, "_rcodegen")
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, step.Name+".md"), []byte("report from "+step.Name), 0644)
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{Name: "review", Steps: []bundle.Step{{Name: "review", Tool: "claude"}}}
+	env, err := o.Run(b, map[string]string{"codebase": codebase})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := env.Result["primary_output"]; got != filepath.Join(codebase, "_rcodegen", "review.md") {
+		t.Errorf("primary_output = %v, want the saved report", got)
+	}
+}
+
+func TestRun_PrimaryOutputFallsBackToLastStepOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: "/jobs/x/outputs/" + step.Name + ".json"}, nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{Name: "chain", Steps: []bundle.Step{
+		{Name: "first", Tool: "claude"},
+		{Name: "second", Tool: "claude"},
+	}}
+	env, err := o.Run(b, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := env.Result["primary_output"]; got != "/jobs/x/outputs/second.json" {
+		t.Errorf("primary_output = %v, want the last step's output", got)
+	}
+}
@@ -0,0 +1,177 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// BatchResult holds the outcome of running one bundle over many input sets
+type BatchResult struct {
+	Runs      []*envelope.Envelope // One envelope per input set, in input order
+	Aggregate *envelope.Envelope   // Combined status, job IDs, cost and token totals
+}
+
+// SetBatchConcurrency sets how many batch runs may execute at once (default 1)
+func (o *Orchestrator) SetBatchConcurrency(n int) {
+	o.batchConcurrency = n
+}
+
+// errBatchDisplay is returned by RunBatch when concurrent runs would share
+// a display set with SetDisplay
+var errBatchDisplay = errors.New("batch concurrency above 1 cannot share a display; each run needs its own")
+
+// RunBatch executes the bundle once per input set, each in its own job
+// directory, for evals and parameter sweeps. Runs use the static display
+// since several may be in flight at once, and a display set with SetDisplay
+// is only allowed when they run one at a time. Observers and the event
+// stream receive every run's events (told apart by job ID) one at a time,
+// and the Controller steers all the runs. The returned error is non-nil if
+// any run failed; per-run details are in the result either way.
+func (o *Orchestrator) RunBatch(b *bundle.Bundle, inputSets []map[string]string) (*BatchResult, error) {
+	start := time.Now()
+
+	concurrency := o.batchConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > 1 && o.display != nil {
+		return nil, errBatchDisplay
+	}
+
+	// Runs share the observers, event stream and controller, so events are
+	// delivered under one lock and each run registers its steps with the
+	// same multi-run Controller
+	var eventsMu sync.Mutex
+	observers := make([]Observer, len(o.observers))
+	for i, obs := range o.observers {
+		observers[i] = lockedObserver{mu: &eventsMu, obs: obs}
+	}
+	var stream io.Writer
+	if o.eventStream != nil {
+		stream = lockedWriter{mu: &eventsMu, w: o.eventStream}
+	}
+	control := o.Controller()
+
+	runs := make([]*envelope.Envelope, len(inputSets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, set := range inputSets {
+		// Run mutates its inputs (defaults, output_dir), so give each run its own copy
+		inputs := make(map[string]string, len(set))
+		for k, v := range set {
+			inputs[k] = v
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, inputs map[string]string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			run := *o
+			run.liveMode = false
+			run.observers = observers
+			run.eventStream = stream
+			run.control = control
+			env, err := run.Run(b, inputs)
+			if env == nil {
+				msg := "run produced no result"
+				if err != nil {
+					msg = err.Error()
+				}
+				env = envelope.New().Failure("BATCH_RUN_FAILED", msg).Build()
+			} else if err != nil && env.Status != envelope.StatusFailure {
+				env.Status = envelope.StatusFailure
+			}
+			runs[i] = env
+		}(i, inputs)
+	}
+	wg.Wait()
+
+	aggregate := aggregateBatch(runs, time.Since(start))
+
+	result := &BatchResult{Runs: runs, Aggregate: aggregate}
+	if failed, _ := aggregate.Result["failed"].(int); failed > 0 {
+		return result, fmt.Errorf("%d of %d batch runs failed", failed, len(runs))
+	}
+	return result, nil
+}
+
+// aggregateBatch combines per-run envelopes into a single summary envelope
+func aggregateBatch(runs []*envelope.Envelope, duration time.Duration) *envelope.Envelope {
+	var succeeded, failed int
+	var totalCost float64
+	var inputTokens, outputTokens int
+	jobIDs := make([]string, 0, len(runs))
+
+	for _, env := range runs {
+		if env.Status == envelope.StatusFailure {
+			failed++
+		} else {
+			succeeded++
+		}
+		if id, ok := env.Result["job_id"].(string); ok {
+			jobIDs = append(jobIDs, id)
+		}
+		if c, ok := env.Result["total_cost_usd"].(float64); ok {
+			totalCost += c
+		}
+		if t, ok := env.Result["input_tokens"].(int); ok {
+			inputTokens += t
+		}
+		if t, ok := env.Result["output_tokens"].(int); ok {
+			outputTokens += t
+		}
+	}
+
+	builder := envelope.New().Success()
+	if failed > 0 {
+		builder = envelope.New().Failure("BATCH_FAILED", fmt.Sprintf("%d of %d runs failed", failed, len(runs)))
+	}
+
+	env := builder.
+		WithResult("runs", len(runs)).
+		WithResult("succeeded", succeeded).
+		WithResult("failed", failed).
+		WithResult("job_ids", jobIDs).
+		WithResult("total_cost_usd", totalCost).
+		WithResult("input_tokens", inputTokens).
+		WithResult("output_tokens", outputTokens).
+		WithDuration(duration.Milliseconds()).
+		Build()
+	if failed > 0 && succeeded > 0 {
+		env.Status = envelope.StatusPartial
+	}
+	return env
+}
+
+// lockedObserver passes events to obs one at a time across concurrent runs
+type lockedObserver struct {
+	mu  *sync.Mutex
+	obs Observer
+}
+
+func (l lockedObserver) OnEvent(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.obs.OnEvent(e)
+}
+
+// lockedWriter serializes writes to w across concurrent runs
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
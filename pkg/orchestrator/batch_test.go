@@ -0,0 +1,252 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+// fakeExecutor succeeds with a fixed cost unless the "fail" input is "yes"
+type fakeExecutor struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeExecutor) Execute(step *bundle.Step, ctx *Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+
+	if ctx.Inputs["fail"] == "yes" {
+		return envelope.New().Failure("EXEC_FAILED", "asked to fail").Build(), nil
+	}
+	return envelope.New().Success().
+		WithResult("cost_usd", 0.25).
+		WithResult("input_tokens", 100).
+		WithResult("output_tokens", 10).
+		Build(), nil
+}
+
+func newBatchTestOrchestrator(t *testing.T) (*Orchestrator, *fakeExecutor) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	fake := &fakeExecutor{}
+	return &Orchestrator{dispatcher: fake}, fake
+}
+
+func trivialBundle() *bundle.Bundle {
+	return &bundle.Bundle{
+		Name: "echo",
+		Inputs: []bundle.Input{
+			{Name: "topic", Required: true},
+		},
+		Steps: []bundle.Step{
+			{Name: "say", Tool: "claude", Task: "Say ${inputs.topic}"},
+		},
+	}
+}
+
+func TestRunBatch_ThreeInputSets(t *testing.T) {
+	o, fake := newBatchTestOrchestrator(t)
+
+	sets := []map[string]string{
+		{"topic": "a"},
+		{"topic": "b"},
+		{"topic": "c"},
+	}
+	res, err := o.RunBatch(trivialBundle(), sets)
+	if err != nil {
+		t.Fatalf("RunBatch() error: %v", err)
+	}
+
+	if len(res.Runs) != 3 {
+		t.Fatalf("expected 3 run envelopes, got %d", len(res.Runs))
+	}
+	if fake.calls != 3 {
+		t.Errorf("expected 3 step executions, got %d", fake.calls)
+	}
+
+	seen := make(map[string]bool)
+	home := os.Getenv("HOME")
+	for i, env := range res.Runs {
+		if env.Status != envelope.StatusSuccess {
+			t.Errorf("run %d: status = %s, want success", i, env.Status)
+		}
+		jobID, _ := env.Result["job_id"].(string)
+		if jobID == "" || seen[jobID] {
+			t.Errorf("run %d: expected a distinct job ID, got %q", i, jobID)
+		}
+		seen[jobID] = true
+		if _, err := os.Stat(filepath.Join(home, ".rcodegen", "workspace", "jobs", jobID)); err != nil {
+			t.Errorf("run %d: job dir missing: %v", i, err)
+		}
+	}
+
+	agg := res.Aggregate
+	if agg.Status != envelope.StatusSuccess {
+		t.Errorf("aggregate status = %s, want success", agg.Status)
+	}
+	if agg.Result["runs"] != 3 || agg.Result["succeeded"] != 3 || agg.Result["failed"] != 0 {
+		t.Errorf("unexpected aggregate counts: %v", agg.Result)
+	}
+	if ids, _ := agg.Result["job_ids"].([]string); len(ids) != 3 {
+		t.Errorf("expected 3 aggregate job IDs, got %v", agg.Result["job_ids"])
+	}
+	if cost, _ := agg.Result["total_cost_usd"].(float64); cost != 0.75 {
+		t.Errorf("aggregate cost = %v, want 0.75", cost)
+	}
+	if in, _ := agg.Result["input_tokens"].(int); in != 300 {
+		t.Errorf("aggregate input tokens = %v, want 300", in)
+	}
+
+	// Input sets must not be mutated by the runs
+	if len(sets[0]) != 1 {
+		t.Errorf("input set was mutated: %v", sets[0])
+	}
+}
+
+func TestRunBatch_ConcurrentWithFailure(t *testing.T) {
+	o, _ := newBatchTestOrchestrator(t)
+	o.SetBatchConcurrency(3)
+
+	res, err := o.RunBatch(trivialBundle(), []map[string]string{
+		{"topic": "a"},
+		{"topic": "b", "fail": "yes"},
+		{"topic": "c"},
+	})
+	if err == nil {
+		t.Error("expected an error when a run fails")
+	}
+
+	if res.Runs[1].Status != envelope.StatusFailure {
+		t.Errorf("run 1 status = %s, want failure", res.Runs[1].Status)
+	}
+	if res.Aggregate.Status != envelope.StatusPartial {
+		t.Errorf("aggregate status = %s, want partial", res.Aggregate.Status)
+	}
+	if res.Aggregate.Result["succeeded"] != 2 || res.Aggregate.Result["failed"] != 1 {
+		t.Errorf("unexpected aggregate counts: %v", res.Aggregate.Result)
+	}
+}
+
+func TestRunBatch_MissingInputFailsThatRunOnly(t *testing.T) {
+	o, fake := newBatchTestOrchestrator(t)
+
+	res, _ := o.RunBatch(trivialBundle(), []map[string]string{
+		{"topic": "a"},
+		{},
+	})
+
+	if res.Runs[0].Status != envelope.StatusSuccess {
+		t.Errorf("run 0 status = %s, want success", res.Runs[0].Status)
+	}
+	if res.Runs[1].Status != envelope.StatusFailure {
+		t.Errorf("run 1 status = %s, want failure", res.Runs[1].Status)
+	}
+	if fake.calls != 1 {
+		t.Errorf("expected only the valid run to execute, got %d calls", fake.calls)
+	}
+}
+
+// unsyncedObserver records events without a lock of its own, relying on
+// RunBatch to deliver them one at a time
+type unsyncedObserver struct{ events []Event }
+
+func (u *unsyncedObserver) OnEvent(e Event) { u.events = append(u.events, e) }
+
+func TestRunBatch_ConcurrentRunsShareObserverAndController(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// Both runs block in "stuck" until it is aborted
+	started := make(chan struct{}, 2)
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "stuck" {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetBatchConcurrency(2)
+	var observer unsyncedObserver
+	o.AddObserver(&observer)
+	var stream bytes.Buffer
+	o.SetEventStream(&stream)
+	control := o.Controller()
+
+	go func() {
+		<-started
+		<-started
+		if control.RunningStep() != "stuck" {
+			t.Errorf("running step = %q, want stuck", control.RunningStep())
+		}
+		if !control.AbortStep("stuck") {
+			t.Error("AbortStep should find the running steps")
+		}
+	}()
+
+	b := &bundle.Bundle{Name: "batch-abort", Steps: []bundle.Step{{Name: "stuck", Tool: "claude"}}}
+	res, err := o.RunBatch(b, []map[string]string{{}, {}})
+	if err == nil {
+		t.Error("expected an error when the runs are aborted")
+	}
+	for i, env := range res.Runs {
+		if env.Error == nil || env.Error.Code != StepAbortedCode {
+			t.Errorf("run %d: expected %s, got %+v", i, StepAbortedCode, env)
+		}
+	}
+	if control.RunningStep() != "" {
+		t.Errorf("no step should be running after the batch, got %q", control.RunningStep())
+	}
+
+	// Each run's events arrive whole, told apart by job ID
+	completed := make(map[string]int)
+	for _, e := range observer.events {
+		if e.Type == EventRunStart || e.Type == EventRunComplete {
+			completed[e.JobID]++
+		}
+	}
+	if len(completed) != 2 {
+		t.Errorf("observer should see two runs, got %v", completed)
+	}
+	for jobID, n := range completed {
+		if n != 2 {
+			t.Errorf("job %s: saw %d of its run start and complete events, want 2", jobID, n)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(stream.String()), "\n")
+	if len(lines) != len(observer.events) {
+		t.Fatalf("event stream has %d lines, observer saw %d events", len(lines), len(observer.events))
+	}
+	for _, line := range lines {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Errorf("event stream line %q: %v", line, err)
+		}
+	}
+}
+
+func TestRunBatch_ConcurrentRunsRejectSharedDisplay(t *testing.T) {
+	o, fake := newBatchTestOrchestrator(t)
+	o.SetBatchConcurrency(2)
+	o.SetDisplay(newRecordingDisplay())
+
+	if _, err := o.RunBatch(trivialBundle(), []map[string]string{{"topic": "a"}, {"topic": "b"}}); !errors.Is(err, errBatchDisplay) {
+		t.Errorf("err = %v, want %v", err, errBatchDisplay)
+	}
+	if fake.calls != 0 {
+		t.Errorf("no run should start, got %d step executions", fake.calls)
+	}
+}
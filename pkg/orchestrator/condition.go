@@ -1,33 +1,99 @@
 package orchestrator
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
+// EvaluateCondition evaluates condition leniently: an unresolved reference
+// stays a literal placeholder, which typically makes the condition false.
 func EvaluateCondition(condition string, ctx *Context) bool {
 	if condition == "" {
 		return true
 	}
 
-	resolved := ctx.Resolve(condition)
+	resolved := expandFunctions(ctx.Resolve(condition), ctx)
 	return evaluate(resolved)
 }
 
+// EvaluateConditionStrict evaluates condition like EvaluateCondition, but
+// returns an error if any reference in it cannot be resolved (such as a
+// typo'd or not yet run step), instead of silently evaluating to false.
+// References passed to num() are optional by design and never an error.
+func EvaluateConditionStrict(condition string, ctx *Context) (bool, error) {
+	if ref := unresolvedReference(condition, ctx); ref != "" {
+		return false, fmt.Errorf("condition %q: unresolved reference %s", condition, ref)
+	}
+	return EvaluateCondition(condition, ctx), nil
+}
+
+// SetStrictConditions makes EvaluateIf fail on unresolved references, for
+// bundles with strict_conditions set
+func (c *Context) SetStrictConditions(strict bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strictConditions = strict
+}
+
+// EvaluateIf evaluates a step's if condition in the run's mode: strictly
+// (see EvaluateConditionStrict) when SetStrictConditions is set, otherwise
+// leniently. Executors running substeps use it so nested conditions follow
+// the bundle's strict_conditions too.
+func (c *Context) EvaluateIf(condition string) (bool, error) {
+	c.mu.RLock()
+	strict := c.strictConditions
+	c.mu.RUnlock()
+	if strict {
+		return EvaluateConditionStrict(condition, c)
+	}
+	return EvaluateCondition(condition, c), nil
+}
+
+// unresolvedReference returns the first ${...} reference in condition,
+// outside num() calls, that the context cannot resolve, or "" if none
+func unresolvedReference(condition string, ctx *Context) string {
+	required := funcPattern.ReplaceAllStringFunc(condition, func(match string) string {
+		if funcPattern.FindStringSubmatch(match)[1] == "num" {
+			return ""
+		}
+		return match
+	})
+	for _, ref := range varPattern.FindAllString(required, -1) {
+		if ctx.Resolve(ref) == ref {
+			return ref
+		}
+	}
+	return ""
+}
+
 func evaluate(expr string) bool {
 	expr = strings.TrimSpace(expr)
 
 	// Handle OR first (lower precedence - evaluated at top level)
-	if idx := strings.Index(expr, " OR "); idx != -1 {
+	if idx := indexTopLevel(expr, " OR "); idx != -1 {
 		return evaluate(expr[:idx]) || evaluate(expr[idx+4:])
 	}
 	// Handle AND (higher precedence - evaluated deeper in recursion)
-	if idx := strings.Index(expr, " AND "); idx != -1 {
+	if idx := indexTopLevel(expr, " AND "); idx != -1 {
 		return evaluate(expr[:idx]) && evaluate(expr[idx+5:])
 	}
+	// Handle NOT (binds tighter than AND, inverting the rest of the operand)
+	if rest, ok := strings.CutPrefix(expr, "NOT "); ok {
+		return !evaluate(rest)
+	}
+	if rest, ok := strings.CutPrefix(expr, "NOT("); ok {
+		return !evaluate("(" + rest)
+	}
+	// Handle a parenthesized subexpression
+	if isWrapped(expr) {
+		return evaluate(expr[1 : len(expr)-1])
+	}
 
-	// Handle comparisons
-	ops := []string{">=", "<=", "!=", "==", ">", "<", " contains "}
+	// Handle comparisons; matches comes first because its pattern may
+	// contain the other operators
+	ops := []string{" matches ", " between ", ">=", "<=", "!=", "==", ">", "<", " contains "}
 	for _, op := range ops {
 		if idx := strings.Index(expr, op); idx != -1 {
 			left := strings.TrimSpace(expr[:idx])
@@ -40,6 +106,65 @@ func evaluate(expr string) bool {
 	return expr == "true"
 }
 
+// indexTopLevel returns the index of the first occurrence of op in expr that
+// is outside parentheses and quotes, or -1
+func indexTopLevel(expr, op string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && strings.HasPrefix(expr[i:], op):
+			return i
+		}
+	}
+	return -1
+}
+
+// isWrapped reports whether expr is entirely enclosed in one pair of
+// matching parentheses, as in "(a OR b)" but not "(a) OR (b)"
+func isWrapped(expr string) bool {
+	if len(expr) < 2 || expr[0] != '(' || expr[len(expr)-1] != ')' {
+		return false
+	}
+	return balanced(expr[1 : len(expr)-1])
+}
+
+// balanced reports whether the parentheses outside quotes in expr never
+// close more than they open and all match
+func balanced(expr string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
 func compare(left, op, right string) bool {
 	// Strip quotes from strings
 	left = strings.Trim(left, "'\"")
@@ -52,6 +177,25 @@ func compare(left, op, right string) bool {
 		return left != right
 	case " contains ":
 		return strings.Contains(left, right)
+	case " matches ":
+		re, err := regexp.Compile(right)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(left)
+	case " between ":
+		// Inclusive range: "<value> between <low> and <high>"
+		bounds := strings.SplitN(right, " and ", 2)
+		if len(bounds) != 2 {
+			return false
+		}
+		v, verr := strconv.ParseFloat(left, 64)
+		lo, loerr := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+		hi, hierr := strconv.ParseFloat(strings.TrimSpace(bounds[1]), 64)
+		if verr != nil || loerr != nil || hierr != nil {
+			return false
+		}
+		return v >= lo && v <= hi
 	case ">", "<", ">=", "<=":
 		lf, lerr := strconv.ParseFloat(left, 64)
 		rf, rerr := strconv.ParseFloat(right, 64)
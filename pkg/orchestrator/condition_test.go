@@ -1,6 +1,7 @@
 package orchestrator
 
 import (
+	"strings"
 	"testing"
 
 	"rcodegen/pkg/envelope"
@@ -134,6 +135,69 @@ func TestEvaluate_Comparisons(t *testing.T) {
 	}
 }
 
+func TestEvaluateCondition_Between(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetResult("grade", &envelope.Envelope{
+		Status: envelope.StatusSuccess,
+		Result: map[string]interface{}{"score": 0.8, "low": 0.7, "high": 0.9, "label": "n/a"},
+	})
+
+	tests := []struct {
+		name      string
+		condition string
+		expected  bool
+	}{
+		{"inside", "${steps.grade.result.score} between 0.7 and 0.9", true},
+		{"lower boundary", "${steps.grade.result.low} between 0.7 and 0.9", true},
+		{"upper boundary", "${steps.grade.result.high} between 0.7 and 0.9", true},
+		{"below", "0.69 between 0.7 and 0.9", false},
+		{"above", "0.91 between 0.7 and 0.9", false},
+		{"non-numeric value", "${steps.grade.result.label} between 0.7 and 0.9", false},
+		{"missing upper bound", "0.8 between 0.7", false},
+		{"with num default", "num(${steps.grade.result.missing}, 0) between 0.7 and 0.9", false},
+		{"combined with AND", "${steps.grade.result.score} between 0.7 and 0.9 AND ${steps.grade.status} == 'success'", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := EvaluateCondition(tc.condition, ctx)
+			if result != tc.expected {
+				t.Errorf("EvaluateCondition(%q) = %v, want %v", tc.condition, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_Matches(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetResult("scan", &envelope.Envelope{
+		Status: envelope.StatusSuccess,
+		Result: map[string]interface{}{"summary": "found CVE-2024-3094 in xz", "clean": "no findings"},
+	})
+
+	tests := []struct {
+		name      string
+		condition string
+		expected  bool
+	}{
+		{"matching", `${steps.scan.result.summary} matches 'CVE-\d+'`, true},
+		{"non-matching", `${steps.scan.result.clean} matches 'CVE-\d+'`, false},
+		{"malformed regex", `${steps.scan.result.summary} matches 'CVE-(\d+'`, false},
+		{"anchored", `${steps.scan.result.summary} matches '^found'`, true},
+		{"pattern with operators", `${steps.scan.result.summary} matches 'CVE-\d{4}-\d{4,}'`, true},
+		{"pattern with alternation group", `${steps.scan.result.summary} matches '(xz|zlib)$' AND ${steps.scan.status} == 'success'`, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := EvaluateCondition(tc.condition, ctx)
+			if result != tc.expected {
+				t.Errorf("EvaluateCondition(%q) = %v, want %v", tc.condition, result, tc.expected)
+			}
+		})
+	}
+}
+
 func TestEvaluate_LogicalOperators(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -197,6 +261,74 @@ func TestEvaluate_OperatorPrecedence(t *testing.T) {
 	}
 }
 
+func TestEvaluate_Not(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{"not true", "NOT true", false},
+		{"not false", "NOT false", true},
+		// NOT (true == false) = NOT false = true
+		{"not comparison", "NOT true == false", true},
+		// (NOT false) AND true = true
+		{"not binds tighter than and", "NOT false AND true", true},
+		// (NOT true) AND true = false
+		{"not applies to left operand only", "NOT true AND true", false},
+		// NOT (false OR true) = false
+		{"not group", "NOT (false OR true)", false},
+		{"not group false", "NOT (false OR false)", true},
+		{"not group no space", "NOT(false OR false)", true},
+		{"double not", "NOT NOT true", true},
+		{"not in or", "false OR NOT false", true},
+		{"not status", "NOT ('failure' == 'failure')", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := evaluate(tc.expr)
+			if result != tc.expected {
+				t.Errorf("evaluate(%q) = %v, want %v", tc.expr, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluate_Parentheses(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected bool
+	}{
+		{"group", "(true)", true},
+		{"group overrides precedence", "(true OR false) AND false", false},
+		{"separate groups", "(false) OR (true)", true},
+		{"nested", "((false OR true) AND (true))", true},
+		{"parenthesis in string", "'a (b' == 'a (b' AND true", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := evaluate(tc.expr)
+			if result != tc.expected {
+				t.Errorf("evaluate(%q) = %v, want %v", tc.expr, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_NotWithStepResults(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetResult("build", &envelope.Envelope{Status: envelope.StatusSuccess})
+
+	if !EvaluateCondition("NOT (${steps.build.status} == 'failure')", ctx) {
+		t.Error("expected a successful build not to match failure")
+	}
+	if EvaluateCondition("NOT ${steps.build.status} == 'success'", ctx) {
+		t.Error("expected NOT to invert a matching status")
+	}
+}
+
 func TestCompare(t *testing.T) {
 	tests := []struct {
 		left, op, right string
@@ -220,3 +352,45 @@ func TestCompare(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluateConditionStrict(t *testing.T) {
+	ctx := NewContext(map[string]string{"mode": "fast"})
+	ctx.SetResult("analyze", &envelope.Envelope{Status: envelope.StatusSuccess})
+
+	tests := []struct {
+		name      string
+		condition string
+		expected  bool
+		wantErr   bool
+	}{
+		{"resolved step", "${steps.analyze.status} == 'success'", true, false},
+		{"typo'd step", "${steps.analyse.status} == 'success'", false, true},
+		{"typo'd step negated", "${steps.analyse.status} != 'failure'", false, true},
+		{"missing input", "${inputs.mdoe} == 'fast'", false, true},
+		{"typo in second clause", "${inputs.mode} == 'fast' AND ${steps.analyse.status} == 'success'", false, true},
+		{"optional via num", "num(${steps.analyse.result.count}, 0) == 0", true, false},
+		{"no references", "true", true, false},
+		{"empty", "", true, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := EvaluateConditionStrict(tc.condition, ctx)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("EvaluateConditionStrict(%q) error = %v, wantErr %v", tc.condition, err, tc.wantErr)
+			}
+			if result != tc.expected {
+				t.Errorf("EvaluateConditionStrict(%q) = %v, want %v", tc.condition, result, tc.expected)
+			}
+		})
+	}
+
+	// Lenient evaluation silently treats the typo as false
+	if EvaluateCondition("${steps.analyse.status} == 'success'", ctx) {
+		t.Error("lenient mode should evaluate the typo'd reference to false")
+	}
+	_, err := EvaluateConditionStrict("${steps.analyse.status} == 'success'", ctx)
+	if err == nil || !strings.Contains(err.Error(), "${steps.analyse.status}") {
+		t.Errorf("strict error should name the reference, got %v", err)
+	}
+}
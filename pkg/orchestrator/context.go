@@ -2,21 +2,114 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 
 	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
 )
 
+// Context holds what a run's steps can refer to. Parallel substeps share it
+// from their own goroutines, so mu guards its maps: while a run is in
+// progress, use the methods (SetResult, GetResult, Resolve, BindItem, ...)
+// rather than the fields.
 type Context struct {
 	mu           sync.RWMutex
 	Inputs       map[string]string
 	StepResults  map[string]*envelope.Envelope
 	Variables    map[string]string
+	Constants    map[string]string // Bundle constants, resolved once at run start
 	ToolSessions map[string]string // Tool name -> session ID for reuse
+
+	templateEngine   string // TemplateSimple (default) or TemplateGo
+	strictConditions bool   // Conditions fail on unresolved references, see EvaluateIf
+
+	secretMu sync.Mutex
+	secrets  map[string]string // ${secret.NAME} values resolved so far, for masking
+
+	done <-chan struct{} // Closed when the running step is aborted or the run times out
+
+	store workspace.OutputStore // Where step output refs are read from (nil = local disk)
+
+	costReporter   func(step string, costUSD float64) // Receives running step costs (nil outside of a run)
+	outputReporter func(step, line string)            // Receives running step output (nil outside of a run)
+}
+
+// ReportCost tells the run how much a step still in progress has cost so
+// far, e.g. from the result events its tool streams, so the display can
+// show the cost growing. It does nothing outside of a run.
+func (c *Context) ReportCost(step string, costUSD float64) {
+	c.mu.RLock()
+	report := c.costReporter
+	c.mu.RUnlock()
+	if report != nil {
+		report(step, costUSD)
+	}
+}
+
+// setCostReporter installs the function ReportCost passes costs to
+func (c *Context) setCostReporter(report func(step string, costUSD float64)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.costReporter = report
+}
+
+// ReportOutput passes a line a step still in progress has printed to the
+// run's display as it arrives. It does nothing outside of a run or when the
+// display does not show live output.
+func (c *Context) ReportOutput(step, line string) {
+	c.mu.RLock()
+	report := c.outputReporter
+	c.mu.RUnlock()
+	if report != nil {
+		report(step, line)
+	}
+}
+
+// SetOutputReporter installs the function ReportOutput passes lines to
+func (c *Context) SetOutputReporter(report func(step, line string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outputReporter = report
+}
+
+// SetOutputStore sets the store step output refs are read from when
+// resolving ${steps.x.output} and similar references
+func (c *Context) SetOutputStore(store workspace.OutputStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+// outputStore returns the context's output store. Callers must hold c.mu.
+func (c *Context) outputStore() workspace.OutputStore {
+	if c.store != nil {
+		return c.store
+	}
+	return workspace.LocalStore{}
+}
+
+// Done returns a channel that is closed when the running step should stop,
+// because it was aborted or the run timed out. Executors kill their
+// subprocesses when it closes. It is nil (never closes) outside of a run.
+func (c *Context) Done() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.done
+}
+
+// setDone installs the cancellation channel of the step about to run
+func (c *Context) setDone(done <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = done
 }
 
 func NewContext(inputs map[string]string) *Context {
@@ -24,6 +117,7 @@ func NewContext(inputs map[string]string) *Context {
 		Inputs:       inputs,
 		StepResults:  make(map[string]*envelope.Envelope),
 		Variables:    make(map[string]string),
+		Constants:    make(map[string]string),
 		ToolSessions: make(map[string]string),
 	}
 }
@@ -42,6 +136,67 @@ func (c *Context) SetToolSession(toolName, sessionID string) {
 	c.ToolSessions[toolName] = sessionID
 }
 
+// BindItem makes ${item} resolve to item, for the iteration of a foreach
+// step about to run. The returned function restores the previous binding,
+// so nested loops see their own items once an inner loop finishes.
+func (c *Context) BindItem(item string) (restore func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev, had := c.Variables["item"]
+	c.Variables["item"] = item
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if had {
+			c.Variables["item"] = prev
+		} else {
+			delete(c.Variables, "item")
+		}
+	}
+}
+
+// BindFailure makes the failed step and its error available as
+// ${failure.step} and ${failure.message}, for a bundle's on_failure step
+func (c *Context) BindFailure(step, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Variables["failure.step"] = step
+	c.Variables["failure.message"] = message
+}
+
+// SetConstants stores the bundle constants with their own references resolved.
+// Constants may refer to inputs and to each other; resolution repeats until
+// stable, so a reference cycle is simply left unresolved.
+func (c *Context) SetConstants(consts map[string]string) {
+	resolved := make(map[string]string, len(consts))
+	for k, v := range consts {
+		resolved[k] = v
+	}
+
+	for pass := 0; pass <= len(consts); pass++ {
+		c.mu.Lock()
+		c.Constants = resolved
+		c.mu.Unlock()
+
+		next := make(map[string]string, len(resolved))
+		changed := false
+		for k, v := range resolved {
+			next[k] = c.Resolve(v)
+			if next[k] != v {
+				changed = true
+			}
+		}
+		resolved = next
+		if !changed {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	c.Constants = resolved
+	c.mu.Unlock()
+}
+
 var varPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
 
 func (c *Context) Resolve(s string) string {
@@ -51,6 +206,8 @@ func (c *Context) Resolve(s string) string {
 
 	return varPattern.ReplaceAllStringFunc(s, func(match string) string {
 		ref := match[2 : len(match)-1] // Strip ${ and }
+		// ${ref:-default} falls back to the default when ref can't be resolved
+		ref, def, hasDefault := strings.Cut(ref, ":-")
 		parts := strings.Split(ref, ".")
 
 		switch parts[0] {
@@ -60,6 +217,40 @@ func (c *Context) Resolve(s string) string {
 					return v
 				}
 			}
+		case "const":
+			if len(parts) >= 2 {
+				if v, ok := c.Constants[strings.Join(parts[1:], ".")]; ok {
+					return v
+				}
+			}
+		case "item":
+			// The current item of the enclosing foreach step
+			if len(parts) == 1 {
+				if v, ok := c.Variables["item"]; ok {
+					return v
+				}
+			}
+		case "failure":
+			// The step whose failure is being handled, in on_failure
+			if len(parts) == 2 {
+				if v, ok := c.Variables["failure."+parts[1]]; ok {
+					return v
+				}
+			}
+		case "env":
+			// Deployment-specific values; unset variables resolve to ""
+			if len(parts) == 2 {
+				if v, ok := os.LookupEnv(parts[1]); ok || !hasDefault {
+					return v
+				}
+			}
+		case "secret":
+			// Read from the environment, never stored in the bundle
+			if len(parts) == 2 {
+				if v, ok := c.secret(parts[1]); ok {
+					return v
+				}
+			}
 		case "steps":
 			if len(parts) >= 3 {
 				stepName := parts[1]
@@ -67,22 +258,35 @@ func (c *Context) Resolve(s string) string {
 					switch parts[2] {
 					case "output_ref":
 						return env.OutputRef
+					case "output_hash":
+						return env.OutputHash
 					case "status":
 						return string(env.Status)
-					case "stdout", "stderr":
+					case "duration_ms":
+						if env.Metrics != nil && env.Metrics.DurationMs > 0 {
+							return strconv.FormatInt(env.Metrics.DurationMs, 10)
+						}
+						if ms, ok := resultNumber(env.Result["duration_ms"]); ok {
+							return strconv.FormatFloat(ms, 'f', -1, 64)
+						}
+					case "cost":
+						if cost, ok := resultNumber(env.Result["cost_usd"]); ok {
+							return strconv.FormatFloat(cost, 'f', -1, 64)
+						}
+					case "tokens":
+						in, inOK := resultNumber(env.Result["input_tokens"])
+						out, outOK := resultNumber(env.Result["output_tokens"])
+						if inOK || outOK {
+							return strconv.FormatFloat(in+out, 'f', -1, 64)
+						}
+					case "output", "stdout", "stderr":
 						// Read from output file
 						if env.OutputRef != "" {
 							// NOTE: Reading file IO inside the lock.
 							// For high throughput this might be a bottleneck, but for correctness it's safe.
-							if data, err := os.ReadFile(env.OutputRef); err == nil {
-								var output map[string]interface{}
-								if err := json.Unmarshal(data, &output); err == nil {
-									if v, ok := output[parts[2]]; ok {
-										content := fmt.Sprintf("%v", v)
-										// For Claude/Codex streaming JSON output, extract the result
-										return extractStreamingResult(content)
-									}
-								}
+							if content, ok := readStepStream(c.outputStore(), env.OutputRef, parts[2]); ok {
+								// For Claude/Codex streaming JSON output, extract the result
+								return extractStreamingResult(content)
 							}
 						}
 					case "result":
@@ -99,10 +303,27 @@ func (c *Context) Resolve(s string) string {
 				}
 			}
 		}
+		if hasDefault {
+			return def
+		}
 		return match // Leave unresolved
 	})
 }
 
+// resultNumber reads a numeric result value, whether stored as a Go number
+// by an executor or as a float64 decoded from JSON
+func resultNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
 func (c *Context) SetResult(name string, env *envelope.Envelope) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -117,8 +338,75 @@ func (c *Context) GetResult(name string) (*envelope.Envelope, bool) {
 	return env, ok
 }
 
-// extractStreamingResult parses streaming JSON output (from Claude/Codex)
-// and extracts the final result text from the "type":"result" object.
+// StepOutput returns the primary output text of a completed step, read from
+// its output_ref; ok is false if the step has no readable output
+func (c *Context) StepOutput(name string) (string, bool) {
+	c.mu.RLock()
+	env, ok := c.StepResults[name]
+	c.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	return c.EnvelopeOutput(env)
+}
+
+// EnvelopeOutput returns the final output text of a step result that may not
+// be recorded in the context yet, as StepOutput does for recorded steps
+func (c *Context) EnvelopeOutput(env *envelope.Envelope) (string, bool) {
+	if env == nil || env.OutputRef == "" {
+		return "", false
+	}
+	c.mu.RLock()
+	store := c.outputStore()
+	c.mu.RUnlock()
+	content, ok := readStepStream(store, env.OutputRef, "output")
+	if !ok {
+		return "", false
+	}
+	return extractStreamingResult(content), true
+}
+
+// readStepStream returns the primary output, stdout or stderr persisted at
+// outputRef. JSON refs hold all three in one object; raw refs hold the
+// primary output directly, with stderr in the sibling errors/ directory.
+func readStepStream(store workspace.OutputStore, outputRef, stream string) (string, bool) {
+	if filepath.Ext(outputRef) == ".json" {
+		data, err := store.Read(outputRef)
+		if err != nil {
+			return "", false
+		}
+		var output map[string]interface{}
+		if err := json.Unmarshal(data, &output); err != nil {
+			return "", false
+		}
+		v, ok := output[stream]
+		if !ok && stream == "output" {
+			v, ok = output["stdout"] // Written before output streams were selectable
+		}
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%v", v), true
+	}
+
+	if stream == "stderr" {
+		errPath := filepath.Join(filepath.Dir(filepath.Dir(outputRef)), "errors", filepath.Base(outputRef))
+		data, err := store.Read(errPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", true // Empty stderr is not written in raw format
+		}
+		return string(data), err == nil
+	}
+	data, err := store.Read(outputRef)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// extractStreamingResult parses streaming JSON output and extracts the final
+// result text: Claude's "type":"result" object, or else the last completed
+// agent message of a Codex --json stream.
 func extractStreamingResult(content string) string {
 	// Try to find and parse the final result object
 	// Streaming output has newline-delimited JSON objects
@@ -138,7 +426,23 @@ func extractStreamingResult(content string) string {
 				return result
 			}
 		}
+		if reply, ok := codexReply(obj); ok {
+			return reply
+		}
 	}
 	// If no result object found, return as-is (might be plain text output)
 	return content
 }
+
+// codexReply returns the text of a completed Codex agent message event
+func codexReply(obj map[string]interface{}) (string, bool) {
+	if obj["type"] != "item.completed" {
+		return "", false
+	}
+	item, _ := obj["item"].(map[string]interface{})
+	if item == nil || item["type"] != "agent_message" {
+		return "", false
+	}
+	text, ok := item["text"].(string)
+	return text, ok
+}
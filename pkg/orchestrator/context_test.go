@@ -2,12 +2,15 @@ package orchestrator
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 
 	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
 )
 
 func TestNewContext(t *testing.T) {
@@ -66,6 +69,114 @@ func TestContext_Resolve_Inputs(t *testing.T) {
 	}
 }
 
+func TestContext_Resolve_Env(t *testing.T) {
+	t.Setenv("FOO", "bar")
+	t.Setenv("MY_API_BASE", "https://api.internal")
+	os.Unsetenv("RCODEGEN_TEST_UNSET")
+	ctx := NewContext(map[string]string{"name": "proj"})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"set variable", "${env.FOO}", "bar"},
+		{"in a task", "Call ${env.MY_API_BASE}/v1 for ${inputs.name}", "Call https://api.internal/v1 for proj"},
+		{"unset variable", "[${env.RCODEGEN_TEST_UNSET}]", "[]"},
+		{"no variable name", "${env}", "${env}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ctx.Resolve(tc.input)
+			if result != tc.expected {
+				t.Errorf("Resolve(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestContext_Resolve_Defaults(t *testing.T) {
+	t.Setenv("RCODEGEN_TEST_EMPTY", "")
+	os.Unsetenv("RCODEGEN_TEST_UNSET")
+	ctx := NewContext(map[string]string{"model": "opus", "empty": ""})
+	ctx.SetResult("grade", &envelope.Envelope{
+		Status: envelope.StatusSuccess,
+		Result: map[string]interface{}{"score": 87},
+	})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"present input ignores default", "${inputs.model:-claude-sonnet}", "opus"},
+		{"absent input uses default", "${inputs.missing:-claude-sonnet}", "claude-sonnet"},
+		{"empty input is present", "[${inputs.empty:-x}]", "[]"},
+		{"default with dots", "${inputs.version:-1.2.3}", "1.2.3"},
+		{"empty default", "[${inputs.missing:-}]", "[]"},
+		{"present step field", "${steps.grade.result.score:-0}", "87"},
+		{"absent step field", "${steps.grade.result.missing:-0}", "0"},
+		{"absent step", "${steps.never.status:-skipped}", "skipped"},
+		{"unset env", "${env.RCODEGEN_TEST_UNSET:-/tmp}", "/tmp"},
+		{"empty env is set", "[${env.RCODEGEN_TEST_EMPTY:-/tmp}]", "[]"},
+		{"no default stays unresolved", "${inputs.missing}", "${inputs.missing}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ctx.Resolve(tc.input)
+			if result != tc.expected {
+				t.Errorf("Resolve(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+
+	if _, err := EvaluateConditionStrict("${steps.never.status:-skipped} == 'skipped'", ctx); err != nil {
+		t.Errorf("a reference with a default should not be unresolved in strict mode: %v", err)
+	}
+}
+
+func TestContext_Resolve_Constants(t *testing.T) {
+	ctx := NewContext(map[string]string{"repo": "rcodegen"})
+	ctx.SetConstants(map[string]string{
+		"model":    "opus",
+		"repo_dir": "/src/${inputs.repo}",
+		"report":   "${const.repo_dir}/REPORT.md",
+		"loop_a":   "${const.loop_b}",
+		"loop_b":   "${const.loop_a}",
+	})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain constant", "use ${const.model}", "use opus"},
+		{"constant referencing input", "${const.repo_dir}", "/src/rcodegen"},
+		{"constant referencing constant", "${const.report}", "/src/rcodegen/REPORT.md"},
+		{"missing constant", "${const.missing}", "${const.missing}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ctx.Resolve(tc.input)
+			if result != tc.expected {
+				t.Errorf("Resolve(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+
+	// A reference cycle terminates and stays unresolved
+	if got := ctx.Resolve("${const.loop_a}"); got != "${const.loop_a}" && got != "${const.loop_b}" {
+		t.Errorf("cyclic constant resolved unexpectedly to %q", got)
+	}
+
+	if !EvaluateCondition("${const.model} == 'opus'", ctx) {
+		t.Error("constants should be usable in conditions")
+	}
+}
+
 func TestContext_Resolve_StepResults(t *testing.T) {
 	ctx := NewContext(nil)
 
@@ -100,6 +211,53 @@ func TestContext_Resolve_StepResults(t *testing.T) {
 	}
 }
 
+func TestContext_Resolve_DurationCostTokens(t *testing.T) {
+	ctx := NewContext(nil)
+
+	ctx.SetResult("build", envelope.New().Success().
+		WithDuration(4200).
+		WithResult("cost_usd", 0.35).
+		WithResult("input_tokens", 1200).
+		WithResult("output_tokens", 300).
+		Build())
+	// As loaded from JSON, with the duration only in the result
+	ctx.SetResult("loaded", &envelope.Envelope{
+		Status: envelope.StatusSuccess,
+		Result: map[string]interface{}{"duration_ms": float64(900), "cost_usd": float64(0), "output_tokens": float64(50)},
+	})
+	ctx.SetResult("bare", &envelope.Envelope{Status: envelope.StatusSkipped})
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"duration from metrics", "${steps.build.duration_ms}", "4200"},
+		{"cost", "${steps.build.cost}", "0.35"},
+		{"tokens", "${steps.build.tokens}", "1500"},
+		{"duration from result", "${steps.loaded.duration_ms}", "900"},
+		{"zero cost", "${steps.loaded.cost}", "0"},
+		{"output tokens only", "${steps.loaded.tokens}", "50"},
+		{"no duration", "${steps.bare.duration_ms}", "${steps.bare.duration_ms}"},
+		{"no cost", "${steps.bare.cost}", "${steps.bare.cost}"},
+		{"no tokens", "${steps.bare.tokens}", "${steps.bare.tokens}"},
+		{"in a prompt", "Build took ${steps.build.duration_ms}ms and cost $${steps.build.cost}", "Build took 4200ms and cost $0.35"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ctx.Resolve(tc.input)
+			if result != tc.expected {
+				t.Errorf("Resolve(%q) = %q, want %q", tc.input, result, tc.expected)
+			}
+		})
+	}
+
+	if !EvaluateCondition("${steps.build.cost} < 1 AND ${steps.build.duration_ms} > 4000", ctx) {
+		t.Error("expected cost and duration to be usable in conditions")
+	}
+}
+
 func TestContext_Resolve_StdoutStderr(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputFile := filepath.Join(tmpDir, "output.json")
@@ -133,6 +291,114 @@ func TestContext_Resolve_StdoutStderr(t *testing.T) {
 	}
 }
 
+func TestContext_BindItem(t *testing.T) {
+	ctx := NewContext(nil)
+	if got := ctx.Resolve("${item}"); got != "${item}" {
+		t.Errorf("unbound ${item} should be left as is, got %q", got)
+	}
+
+	restoreOuter := ctx.BindItem("pkg/a")
+	restoreInner := ctx.BindItem("a_test.go")
+	if got := ctx.Resolve("Review ${item}"); got != "Review a_test.go" {
+		t.Errorf("Resolve = %q, want the innermost item", got)
+	}
+	restoreInner()
+	if got := ctx.Resolve("${item}"); got != "pkg/a" {
+		t.Errorf("after the inner loop ${item} = %q, want the outer item", got)
+	}
+	restoreOuter()
+	if got := ctx.Resolve("${item}"); got != "${item}" {
+		t.Errorf("after both loops ${item} = %q, want it unbound", got)
+	}
+}
+
+func TestContext_Resolve_RawOutput(t *testing.T) {
+	jobDir := t.TempDir()
+	for _, dir := range []string{"outputs", "errors"} {
+		if err := os.MkdirAll(filepath.Join(jobDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outputFile := filepath.Join(jobDir, "outputs", "report.txt")
+	if err := os.WriteFile(outputFile, []byte("# Findings\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(jobDir, "errors", "report.txt"), []byte("rate limited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	quietFile := filepath.Join(jobDir, "outputs", "quiet.txt")
+	if err := os.WriteFile(quietFile, []byte("done"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext(nil)
+	ctx.SetResult("report", &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: outputFile})
+	ctx.SetResult("quiet", &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: quietFile})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"${steps.report.output_ref}", outputFile},
+		{"${steps.report.stdout}", "# Findings\n"},
+		{"${steps.report.stderr}", "rate limited"},
+		{"${steps.quiet.stderr}", ""},
+	}
+	for _, tc := range tests {
+		if got := ctx.Resolve(tc.input); got != tc.expected {
+			t.Errorf("Resolve(%q) = %q, want %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
+// memStore is an in-memory workspace.OutputStore
+type memStore map[string][]byte
+
+func (m memStore) Write(path string, data []byte) error {
+	m[path] = data
+	return nil
+}
+
+func (m memStore) Read(path string) ([]byte, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func TestContext_Resolve_OutputStore(t *testing.T) {
+	ws := &workspace.Workspace{JobDir: "/remote/job", PersistFormat: workspace.PersistRaw, Store: memStore{}}
+	ref, err := ws.WriteStepResult("report", "# Findings\n", "# Findings\n", "rate limited")
+	if err != nil {
+		t.Fatalf("WriteStepResult() error: %v", err)
+	}
+	quietRef, err := ws.WriteStepResult("quiet", "done", "done", "")
+	if err != nil {
+		t.Fatalf("WriteStepResult() error: %v", err)
+	}
+
+	ctx := NewContext(nil)
+	ctx.SetOutputStore(ws.Store)
+	ctx.SetResult("report", &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: ref})
+	ctx.SetResult("quiet", &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: quietRef})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"${steps.report.stdout}", "# Findings\n"},
+		{"${steps.report.stderr}", "rate limited"},
+		{"${steps.quiet.stdout}", "done"},
+		{"${steps.quiet.stderr}", ""},
+	}
+	for _, tc := range tests {
+		if got := ctx.Resolve(tc.input); got != tc.expected {
+			t.Errorf("Resolve(%q) = %q, want %q", tc.input, got, tc.expected)
+		}
+	}
+}
+
 func TestContext_Resolve_FullResultJSON(t *testing.T) {
 	ctx := NewContext(nil)
 	ctx.SetResult("step1", &envelope.Envelope{
@@ -246,6 +512,46 @@ func TestContext_ThreadSafety_SetResult(t *testing.T) {
 	// If we get here without race condition, test passes
 }
 
+func TestContext_ThreadSafety_ResultsAndVariables(t *testing.T) {
+	ctx := NewContext(map[string]string{"topic": "go"})
+	ctx.SetTemplateEngine(TemplateGo)
+	var wg sync.WaitGroup
+
+	// What parallel substeps do at once: record results, bind loop items,
+	// and resolve tasks, conditions and templates against the context
+	for i := 0; i < 50; i++ {
+		wg.Add(4)
+		name := fmt.Sprintf("sub-%d", i)
+		go func() {
+			defer wg.Done()
+			ctx.SetResult(name, envelope.New().Success().WithResult("n", i).WithOutputRef("/missing/"+name+".json").Build())
+		}()
+		go func() {
+			defer wg.Done()
+			restore := ctx.BindItem(name)
+			_ = ctx.Resolve("${item} ${steps.sub-0.result.n}")
+			restore()
+		}()
+		go func() {
+			defer wg.Done()
+			_ = EvaluateCondition("count_status(sub-, success) >= 1", ctx)
+			_, _ = ctx.StepOutput("sub-1")
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = ctx.RenderTask("{{ .Inputs.topic }} {{ len .Steps }}")
+		}()
+	}
+
+	wg.Wait()
+	if n := EvaluateCondition("count_status(sub-, success) == 50", ctx); !n {
+		t.Error("every concurrently recorded result should be kept")
+	}
+	if got := ctx.Resolve("${item}"); got != "${item}" {
+		t.Errorf("item bindings should all be restored, got %q", got)
+	}
+}
+
 func TestExtractStreamingResult(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -277,6 +583,15 @@ func TestExtractStreamingResult(t *testing.T) {
 			input:    `{"type":"result","status":"ok"}`,
 			expected: `{"type":"result","status":"ok"}`,
 		},
+		{
+			name: "codex json stream",
+			input: `{"type":"thread.started","thread_id":"0199a213"}
+{"type":"item.completed","item":{"id":"item_0","type":"agent_message","text":"Looking."}}
+{"type":"item.completed","item":{"id":"item_1","type":"command_execution","command":"ls"}}
+{"type":"item.completed","item":{"id":"item_2","type":"agent_message","text":"All tests pass."}}
+{"type":"turn.completed","usage":{"input_tokens":24763,"cached_input_tokens":24448,"output_tokens":122}}`,
+			expected: "All tests pass.",
+		},
 		{
 			name:     "multiple lines no result",
 			input:    "{\"type\":\"assistant\"}\n{\"type\":\"tool_use\"}",
@@ -0,0 +1,91 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// StepAbortedCode is the error code of a step aborted through a Controller
+const StepAbortedCode = "STEP_ABORTED"
+
+// errStepAborted is returned by executeStep when the running step is aborted
+var errStepAborted = errors.New("step aborted")
+
+// Controller steers a running orchestrator from outside, e.g. from a control
+// panel that follows the run through an Observer. It is safe for concurrent
+// use, and one Controller can steer the concurrent runs of a batch.
+type Controller struct {
+	mu      sync.Mutex
+	running []*runningStep // In the order they started
+}
+
+// runningStep is a top-level step in progress in one of the runs
+type runningStep struct {
+	name   string
+	cancel context.CancelFunc
+}
+
+// Controller returns the controller for the runs of this orchestrator
+func (o *Orchestrator) Controller() *Controller {
+	if o.control == nil {
+		o.control = &Controller{}
+	}
+	return o.control
+}
+
+// AbortStep cancels the running top-level step named step ("" aborts
+// whichever step is running), in every run that is running it. The step's
+// process is killed and the step fails with STEP_ABORTED; the run then
+// stops, unless the step sets "on_abort": "continue". It returns false when
+// no matching step is running.
+func (c *Controller) AbortStep(step string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	aborted := false
+	kept := c.running[:0]
+	for _, r := range c.running {
+		if step != "" && step != r.name {
+			kept = append(kept, r)
+			continue
+		}
+		r.cancel()
+		aborted = true
+	}
+	c.running = kept
+	return aborted
+}
+
+// RunningStep returns the name of the most recently started top-level step
+// still running, if any
+func (c *Controller) RunningStep() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.running) == 0 {
+		return ""
+	}
+	return c.running[len(c.running)-1].name
+}
+
+// begin registers the cancel func of a step that is starting; the returned
+// handle is passed to end when it finishes
+func (c *Controller) begin(step string, cancel context.CancelFunc) *runningStep {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &runningStep{name: step, cancel: cancel}
+	c.running = append(c.running, r)
+	return r
+}
+
+// end clears a step once it has finished, leaving other runs' steps
+func (c *Controller) end(r *runningStep) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, running := range c.running {
+		if running == r {
+			c.running = append(c.running[:i], c.running[i+1:]...)
+			return
+		}
+	}
+}
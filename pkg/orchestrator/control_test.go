@@ -0,0 +1,154 @@
+package orchestrator
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// abortWhenRunning aborts step through c as soon as it is running
+func abortWhenRunning(t *testing.T, c *Controller, step string) {
+	t.Helper()
+	go func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if c.AbortStep(step) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+}
+
+// blockUntilDone is an executor whose "stuck" step runs until it is cancelled
+func blockUntilDone(ran *sync.Map, cancelled chan<- string) funcExecutor {
+	return func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		ran.Store(step.Name, true)
+		if step.Name == "stuck" {
+			select {
+			case <-ctx.Done():
+				cancelled <- step.Name
+			case <-time.After(5 * time.Second):
+			}
+		}
+		return envelope.New().Success().Build(), nil
+	}
+}
+
+func TestRun_AbortStepFailsRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var ran sync.Map
+	cancelled := make(chan string, 1)
+	o := &Orchestrator{dispatcher: blockUntilDone(&ran, cancelled)}
+	o.SetDisplay(newRecordingDisplay())
+	var events collectingObserver
+	o.AddObserver(&events)
+
+	b := &bundle.Bundle{
+		Name: "abort-test",
+		Steps: []bundle.Step{
+			{Name: "first", Tool: "claude"},
+			{Name: "stuck", Tool: "claude"},
+			{Name: "never", Tool: "claude"},
+		},
+	}
+
+	abortWhenRunning(t, o.Controller(), "stuck")
+	started := time.Now()
+	env, err := o.Run(b, map[string]string{})
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("Run did not return promptly after abort (%s)", elapsed)
+	}
+	if err == nil {
+		t.Error("expected an error when a step is aborted")
+	}
+	if env.Error == nil || env.Error.Code != StepAbortedCode {
+		t.Fatalf("expected %s failure, got %+v", StepAbortedCode, env)
+	}
+
+	select {
+	case name := <-cancelled:
+		if name != "stuck" {
+			t.Errorf("cancelled step = %s, want stuck", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("the aborted step's context should be cancelled")
+	}
+	if _, ok := ran.Load("never"); ok {
+		t.Error("steps after an aborted step should not run by default")
+	}
+
+	var complete *Event
+	for i, e := range events.events {
+		if e.Type == EventStepComplete && e.Step == "stuck" {
+			complete = &events.events[i]
+		}
+	}
+	if complete == nil || complete.Status != string(envelope.StatusFailure) || complete.Error == "" {
+		t.Errorf("aborted step should complete as a failure, got %+v", complete)
+	}
+	if o.Controller().RunningStep() != "" {
+		t.Errorf("no step should be running after the run, got %q", o.Controller().RunningStep())
+	}
+}
+
+func TestRun_AbortStepContinuePolicy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var ran sync.Map
+	cancelled := make(chan string, 1)
+	o := &Orchestrator{dispatcher: blockUntilDone(&ran, cancelled)}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name: "abort-continue",
+		Steps: []bundle.Step{
+			{Name: "stuck", Tool: "claude", OnAbort: bundle.OnAbortContinue},
+			{Name: "after", Tool: "claude"},
+		},
+	}
+
+	abortWhenRunning(t, o.Controller(), "stuck")
+	env, err := o.Run(b, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Errorf("run should carry on past a step with on_abort continue, got %+v", env)
+	}
+	if _, ok := ran.Load("after"); !ok {
+		t.Error("the step after the aborted one should run")
+	}
+
+	o2 := &Orchestrator{}
+	if o2.Controller().AbortStep("") {
+		t.Error("AbortStep should report false when nothing is running")
+	}
+}
+
+func TestController_ConcurrentSteps(t *testing.T) {
+	c := &Controller{}
+	var cancelled []string
+	a := c.begin("build", func() { cancelled = append(cancelled, "a") })
+	b := c.begin("test", func() { cancelled = append(cancelled, "b") })
+
+	// One run finishing its step leaves the other run's step registered
+	c.end(a)
+	if got := c.RunningStep(); got != "test" {
+		t.Fatalf("running step = %q, want test", got)
+	}
+	if c.AbortStep("build") {
+		t.Error("a finished step should not be abortable")
+	}
+	if !c.AbortStep("test") || len(cancelled) != 1 || cancelled[0] != "b" {
+		t.Errorf("AbortStep(test) should cancel only b, cancelled %v", cancelled)
+	}
+	c.end(b)
+	if c.RunningStep() != "" {
+		t.Errorf("no step should be running, got %q", c.RunningStep())
+	}
+}
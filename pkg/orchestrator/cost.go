@@ -0,0 +1,205 @@
+package orchestrator
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CostFormatter renders USD costs in the user's currency and locale
+type CostFormatter struct {
+	Symbol      string
+	SymbolAfter bool // "12,50 €" rather than "€12.50"
+	Decimals    int
+	DecimalSep  string
+	ThousandSep string
+	Rate        float64 // Currency units per USD; costs are converted when not 1
+}
+
+// DefaultCostFormatter formats costs as US dollars ("$1,234.56")
+var DefaultCostFormatter = CostFormatter{
+	Symbol:      "$",
+	Decimals:    2,
+	DecimalSep:  ".",
+	ThousandSep: ",",
+	Rate:        1,
+}
+
+// currencySymbols maps ISO 4217 codes to display symbols
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "¥",
+	"INR": "₹",
+	"KRW": "₩",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"CHF": "CHF ",
+	"BRL": "R$",
+}
+
+// zeroDecimalCurrencies have no minor unit in everyday use
+var zeroDecimalCurrencies = map[string]bool{"JPY": true, "KRW": true}
+
+// localeFormat holds the separator conventions of a locale
+type localeFormat struct {
+	decimal     string
+	thousands   string
+	symbolAfter bool
+}
+
+// localeFormats is keyed by full locale ("de-CH") or language ("de")
+var localeFormats = map[string]localeFormat{
+	"en":    {".", ",", false},
+	"ja":    {".", ",", false},
+	"zh":    {".", ",", false},
+	"ko":    {".", ",", false},
+	"de":    {",", ".", true},
+	"de-CH": {".", "'", false},
+	"fr":    {",", " ", true},
+	"es":    {",", ".", true},
+	"it":    {",", ".", true},
+	"pt":    {",", ".", true},
+	"pt-BR": {",", ".", false},
+	"nl":    {",", ".", false},
+	"sv":    {",", " ", true},
+	"pl":    {",", " ", true},
+}
+
+// NewCostFormatter builds a formatter for an ISO currency code and a locale
+// such as "de-DE" or "fr_FR". Empty values default to USD and en-US; a
+// non-positive rate means costs are shown unconverted.
+func NewCostFormatter(currency, locale string, rate float64) CostFormatter {
+	f := DefaultCostFormatter
+
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency != "" {
+		if sym, ok := currencySymbols[currency]; ok {
+			f.Symbol = sym
+		} else {
+			f.Symbol = currency + " "
+		}
+		if zeroDecimalCurrencies[currency] {
+			f.Decimals = 0
+		}
+	}
+
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	lf, ok := localeFormats[locale]
+	if !ok {
+		lang, _, _ := strings.Cut(locale, "-")
+		lf, ok = localeFormats[strings.ToLower(lang)]
+	}
+	if ok {
+		f.DecimalSep = lf.decimal
+		f.ThousandSep = lf.thousands
+		f.SymbolAfter = lf.symbolAfter
+	}
+
+	if rate > 0 {
+		f.Rate = rate
+	}
+	return f
+}
+
+// Format renders a USD amount, e.g. "$1,234.56" or "1.234,56 €"
+func (f CostFormatter) Format(usd float64) string {
+	rate := f.Rate
+	if rate <= 0 {
+		rate = 1
+	}
+	amount := usd * rate
+
+	neg := amount < 0
+	digits := strconv.FormatFloat(math.Abs(amount), 'f', f.Decimals, 64)
+	whole, frac, _ := strings.Cut(digits, ".")
+
+	// Group the whole part in threes from the right
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(f.ThousandSep)
+		}
+		grouped.WriteRune(r)
+	}
+	number := grouped.String()
+	if frac != "" {
+		number += f.DecimalSep + frac
+	}
+
+	var s string
+	if f.SymbolAfter {
+		s = number + " " + strings.TrimSpace(f.Symbol)
+	} else {
+		s = f.Symbol + number
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// costFormatSetter is implemented by displays that render costs
+type costFormatSetter interface {
+	SetCostFormatter(f CostFormatter)
+}
+
+// tokenBudgetSetter is implemented by displays that show token usage
+// against the configured budget
+type tokenBudgetSetter interface {
+	SetTokenBudget(budget int)
+}
+
+// costUpdater is implemented by displays that show the run's cost while a
+// step is still running
+type costUpdater interface {
+	UpdateCost(cost float64)
+}
+
+// liveCost adds the running cost reported by steps in progress to the cost
+// of completed steps and passes the total to a display as it grows
+type liveCost struct {
+	mu      sync.Mutex
+	display costUpdater
+	settled float64            // Cost of completed steps
+	running map[string]float64 // Step name -> cost so far
+}
+
+// report records the running cost of step; costs only ever go up, so a
+// stale or out of order report is ignored
+func (l *liveCost) report(step string, cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if cost <= l.running[step] {
+		return
+	}
+	if l.running == nil {
+		l.running = make(map[string]float64)
+	}
+	l.running[step] = cost
+	total := l.settled
+	for _, c := range l.running {
+		total += c
+	}
+	l.display.UpdateCost(total)
+}
+
+// settle records the total cost once a top-level step has completed,
+// replacing the running costs of it and its substeps
+func (l *liveCost) settle(total float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settled = total
+	clear(l.running)
+}
+
+// costFormatter returns the formatter configured in settings
+func (o *Orchestrator) costFormatter() CostFormatter {
+	if o.settings == nil {
+		return DefaultCostFormatter
+	}
+	return NewCostFormatter(o.settings.Currency, o.settings.Locale, o.settings.CurrencyRate)
+}
@@ -0,0 +1,183 @@
+package orchestrator
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/settings"
+)
+
+func TestCostFormatter_Format(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		locale   string
+		rate     float64
+		usd      float64
+		want     string
+	}{
+		{"default USD", "", "", 0, 1234.567, "$1,234.57"},
+		{"small USD", "USD", "en-US", 0, 0.42, "$0.42"},
+		{"euro in Germany", "EUR", "de-DE", 0, 1234.5, "1.234,50 €"},
+		{"euro in France", "EUR", "fr_FR", 0, 1234567.891, "1 234 567,89 €"},
+		{"pound in UK", "GBP", "en-GB", 0, 12.3, "£12.30"},
+		{"yen has no decimals", "JPY", "ja-JP", 150, 2.5, "¥375"},
+		{"Swiss franc in Switzerland", "CHF", "de-CH", 0, 1000, "CHF 1'000.00"},
+		{"unknown currency uses code", "SEK", "sv-SE", 0, 5, "5,00 SEK"},
+		{"conversion rate", "EUR", "de-DE", 0.5, 10, "5,00 €"},
+		{"negative amount", "USD", "", 0, -3.2, "-$3.20"},
+		{"unknown locale keeps defaults", "USD", "xx-YY", 0, 1000, "$1,000.00"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := NewCostFormatter(tc.currency, tc.locale, tc.rate).Format(tc.usd)
+			if got != tc.want {
+				t.Errorf("Format(%v) = %q, want %q", tc.usd, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrchestrator_CostFormatterFromSettings(t *testing.T) {
+	o := &Orchestrator{settings: &settings.Settings{Currency: "EUR", Locale: "de-DE"}}
+	if got := o.costFormatter().Format(2.5); got != "2,50 €" {
+		t.Errorf("costFormatter().Format = %q, want %q", got, "2,50 €")
+	}
+
+	o = &Orchestrator{}
+	if got := o.costFormatter().Format(2.5); got != "$2.50" {
+		t.Errorf("default costFormatter().Format = %q, want %q", got, "$2.50")
+	}
+}
+
+// costRecorder records the totals passed to UpdateCost
+type costRecorder struct {
+	mu    sync.Mutex
+	costs []float64
+}
+
+func (r *costRecorder) UpdateCost(cost float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.costs = append(r.costs, cost)
+}
+
+func (r *costRecorder) updates() []float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]float64(nil), r.costs...)
+}
+
+func TestLiveCost(t *testing.T) {
+	rec := &costRecorder{}
+	l := &liveCost{display: rec}
+
+	l.report("a", 0.1)
+	l.report("a", 0.3)
+	l.report("a", 0.2) // Stale: ignored
+	l.settle(0.4)      // a finished costing more than last reported
+	l.report("b", 0.05)
+	l.report("c", 0.1) // Parallel substeps add up
+
+	want := []float64{0.1, 0.3, 0.45, 0.55}
+	got := rec.updates()
+	if len(got) != len(want) {
+		t.Fatalf("UpdateCost calls = %v, want %v", got, want)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("UpdateCost calls = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+// costDisplay is a recordingDisplay that also shows live costs
+type costDisplay struct {
+	*recordingDisplay
+	costRecorder
+}
+
+func TestRun_ReportsRunningCost(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	d := &costDisplay{recordingDisplay: newRecordingDisplay()}
+	o := &Orchestrator{display: d, dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		costs := map[string][]float64{"first": {0.1, 0.2}, "second": {0.05, 0.15}}[step.Name]
+		for _, c := range costs {
+			ctx.ReportCost(step.Name, c)
+		}
+		return envelope.New().Success().WithResult("cost_usd", costs[len(costs)-1]).Build(), nil
+	})}
+
+	b := &bundle.Bundle{Name: "costs", Steps: []bundle.Step{
+		{Name: "first", Tool: "claude"},
+		{Name: "second", Tool: "claude"},
+	}}
+	if _, err := o.Run(b, map[string]string{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// The second step's running cost is added to the first step's final cost
+	want := []float64{0.1, 0.2, 0.25, 0.35}
+	got := d.updates()
+	if len(got) != len(want) {
+		t.Fatalf("UpdateCost calls = %v, want %v", got, want)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Errorf("running cost should only increase, got %v", got)
+		}
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("UpdateCost calls = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestLiveDisplay_StepCompleteReplacesRunningCost(t *testing.T) {
+	var buf bytes.Buffer
+	b := &bundle.Bundle{Name: "live", Steps: []bundle.Step{{Name: "one", Tool: "claude"}, {Name: "two", Tool: "claude"}}}
+	d := NewLiveDisplay(b, "job", map[string]string{})
+	d.SetOutput(&buf)
+
+	d.UpdateCost(0.8) // Running cost of step one
+	d.SetStepComplete(0, 1.0, time.Second, 0, true)
+	d.UpdateCost(1.3) // Step one plus step two's running cost
+	d.SetStepComplete(1, 0.5, time.Second, 0, true)
+
+	d.mu.Lock()
+	total := d.totalCost
+	d.mu.Unlock()
+	if total != 1.5 {
+		t.Errorf("total cost = %v, want 1.5 (running costs must not be counted twice)", total)
+	}
+}
+
+func TestLiveDisplay_UsesCostFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	b := &bundle.Bundle{Name: "fmt", Steps: []bundle.Step{{Name: "one", Tool: "claude"}}}
+	d := NewLiveDisplay(b, "job", map[string]string{})
+	d.SetOutput(&buf)
+	d.SetCostFormatter(NewCostFormatter("EUR", "de-DE", 0))
+
+	d.SetStepComplete(0, 1234.5, time.Second, 0, true)
+	d.PrintFinalSummary(1234.5, 0, 0, 0, 0)
+
+	out := stripAnsi(buf.String())
+	if !strings.Contains(out, "1.234,50 €") {
+		t.Errorf("display should use the configured currency:\n%s", out)
+	}
+	if strings.Contains(out, "$") {
+		t.Errorf("display should not show dollar amounts:\n%s", out)
+	}
+}
@@ -0,0 +1,163 @@
+package orchestrator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"rcodegen/pkg/workspace"
+)
+
+// EventLogFile is the name of the event log written to every job directory
+const EventLogFile = workspace.EventLogFile
+
+// EventType identifies what happened during a run
+type EventType string
+
+const (
+	EventRunStart     EventType = "run_start"
+	EventStepStart    EventType = "step_start"
+	EventStepComplete EventType = "step_complete"
+	EventStepSkipped  EventType = "step_skipped"
+	EventRunComplete  EventType = "run_complete"
+)
+
+// Event is one entry of the run event log. The same events drive the
+// display, so a run can be replayed or monitored from the log alone.
+type Event struct {
+	Type   EventType `json:"event"`
+	Time   time.Time `json:"time"`
+	JobID  string    `json:"job_id,omitempty"`
+	Bundle string    `json:"bundle,omitempty"`
+
+	// Step events
+	Step  string `json:"step,omitempty"`
+	Index int    `json:"index"`
+	Tool  string `json:"tool,omitempty"`
+	Model string `json:"model,omitempty"`
+
+	// Outcome (step_complete and run_complete)
+	Status           string  `json:"status,omitempty"`
+	Error            string  `json:"error,omitempty"`
+	CostUSD          float64 `json:"cost_usd,omitempty"`
+	InputTokens      int     `json:"input_tokens,omitempty"`
+	OutputTokens     int     `json:"output_tokens,omitempty"`
+	CacheReadTokens  int     `json:"cache_read_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	DurationMs       int64   `json:"duration_ms,omitempty"`
+	Steps            int     `json:"steps,omitempty"` // run_start: number of top-level steps
+}
+
+// Observer receives run events as they happen
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// AddObserver registers an observer for the events of every run
+func (o *Orchestrator) AddObserver(obs Observer) {
+	o.observers = append(o.observers, obs)
+}
+
+// eventBus stamps events and fans them out to observers in order
+type eventBus struct {
+	mu        sync.Mutex
+	jobID     string
+	bundle    string
+	observers []Observer
+}
+
+func (b *eventBus) emit(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.JobID = b.jobID
+	e.Bundle = b.bundle
+	for _, obs := range b.observers {
+		obs.OnEvent(e)
+	}
+}
+
+// eventLog appends events as newline-delimited JSON
+type eventLog struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func newEventLog(path string) (*eventLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *eventLog) OnEvent(e Event) {
+	l.enc.Encode(e)
+}
+
+func (l *eventLog) Close() error {
+	return l.f.Close()
+}
+
+// eventStream writes events as newline-delimited JSON, e.g. to stdout for a
+// dashboard following the run
+type eventStream struct {
+	enc *json.Encoder
+}
+
+func (s eventStream) OnEvent(e Event) {
+	s.enc.Encode(e)
+}
+
+// displayObserver drives a Display from run events
+type displayObserver struct {
+	display Display
+}
+
+func (d displayObserver) OnEvent(e Event) {
+	switch e.Type {
+	case EventStepStart:
+		d.display.SetStepRunning(e.Index)
+		d.display.SetStepModel(e.Index, e.Model)
+	case EventStepComplete:
+		if e.Model != "" {
+			d.display.SetStepModel(e.Index, e.Model)
+		}
+		d.display.SetStepComplete(e.Index, e.CostUSD, time.Duration(e.DurationMs)*time.Millisecond,
+			e.InputTokens+e.OutputTokens, e.Status != "failure")
+	case EventStepSkipped:
+		d.display.SetStepSkipped(e.Index)
+	}
+}
+
+// ReadEvents loads an event log written during a run
+func ReadEvents(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return events, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,198 @@
+package orchestrator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// collectingObserver records every event it receives
+type collectingObserver struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (c *collectingObserver) OnEvent(e Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, e)
+}
+
+func TestRun_WritesEventLog(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().
+			WithResult("cost_usd", 0.25).
+			WithResult("input_tokens", 100).
+			WithResult("output_tokens", 20).
+			Build(), nil
+	})}
+	display := newRecordingDisplay()
+	o.SetDisplay(display)
+	observer := &collectingObserver{}
+	o.AddObserver(observer)
+
+	b := &bundle.Bundle{
+		Name: "events-test",
+		Steps: []bundle.Step{
+			{Name: "analyze", Tool: "claude"},
+			{Name: "optional", Tool: "codex", If: "${steps.analyze.status} == 'failure'"},
+			{Name: "report", Tool: "gemini"},
+		},
+	}
+	env, err := o.Run(b, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jobID, _ := env.Result["job_id"].(string)
+	path := filepath.Join(home, ".rcodegen", "workspace", "jobs", jobID, EventLogFile)
+	events, err := ReadEvents(path)
+	if err != nil {
+		t.Fatalf("ReadEvents: %v", err)
+	}
+
+	want := []struct {
+		typ  EventType
+		step string
+	}{
+		{EventRunStart, ""},
+		{EventStepStart, "analyze"},
+		{EventStepComplete, "analyze"},
+		{EventStepStart, "optional"},
+		{EventStepSkipped, "optional"},
+		{EventStepStart, "report"},
+		{EventStepComplete, "report"},
+		{EventRunComplete, ""},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Type != w.typ || e.Step != w.step {
+			t.Errorf("event %d = %s/%q, want %s/%q", i, e.Type, e.Step, w.typ, w.step)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event %d (%s) has no timestamp", i, e.Type)
+		}
+		if e.JobID != jobID || e.Bundle != "events-test" {
+			t.Errorf("event %d job/bundle = %q/%q", i, e.JobID, e.Bundle)
+		}
+		if i > 0 && e.Time.Before(events[i-1].Time) {
+			t.Errorf("event %d is earlier than the event before it", i)
+		}
+	}
+
+	if events[0].Steps != 3 {
+		t.Errorf("run_start steps = %d, want 3", events[0].Steps)
+	}
+	complete := events[2]
+	if complete.Status != "success" || complete.CostUSD != 0.25 || complete.InputTokens != 100 || complete.OutputTokens != 20 {
+		t.Errorf("unexpected step_complete event: %+v", complete)
+	}
+	last := events[len(events)-1]
+	if last.Status != "success" || last.CostUSD != 0.5 || last.InputTokens != 200 {
+		t.Errorf("unexpected run_complete event: %+v", last)
+	}
+
+	// Observers see exactly what the log records
+	if len(observer.events) != len(events) {
+		t.Fatalf("observer got %d events, log has %d", len(observer.events), len(events))
+	}
+	for i := range events {
+		if observer.events[i].Type != events[i].Type || observer.events[i].Step != events[i].Step {
+			t.Errorf("observer event %d = %s/%q, log has %s/%q", i,
+				observer.events[i].Type, observer.events[i].Step, events[i].Type, events[i].Step)
+		}
+	}
+
+	// The display is driven from the same events
+	wantStates := []StepState{StepSuccess, StepSkipped, StepSuccess}
+	for i, want := range wantStates {
+		if got := display.state(i); got != want {
+			t.Errorf("step %d display state = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestRun_EventLogRecordsFailure(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Failure("TOOL_ERROR", "tool exploded").Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	observer := &collectingObserver{}
+	o.AddObserver(observer)
+
+	b := &bundle.Bundle{Name: "fails", Steps: []bundle.Step{{Name: "boom", Tool: "claude"}}}
+	if _, err := o.Run(b, map[string]string{}); err == nil {
+		t.Fatal("expected an error from the failing step")
+	}
+
+	events := observer.events
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want 4: %+v", len(events), events)
+	}
+	if events[2].Type != EventStepComplete || events[2].Status != "failure" || events[2].Error != "tool exploded" {
+		t.Errorf("unexpected step_complete event: %+v", events[2])
+	}
+	if events[3].Type != EventRunComplete || events[3].Status != "failure" {
+		t.Errorf("unexpected run_complete event: %+v", events[3])
+	}
+}
+
+func TestRun_EventStream(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().WithResult("cost_usd", 0.03).Build(), nil
+	})}
+	var out bytes.Buffer
+	o.SetEventStream(&out)
+	if o.textOutput() != io.Discard {
+		t.Error("streaming events should turn off the printed summary")
+	}
+
+	b := &bundle.Bundle{Name: "stream", Steps: []bundle.Step{{Name: "build", Tool: "codex"}}}
+	if _, err := o.Run(b, map[string]string{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// Every line is a JSON event, in order
+	var got []map[string]interface{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var e map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		got = append(got, e)
+	}
+	want := []string{"run_start", "step_start", "step_complete", "run_complete"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %v:\n%s", len(got), want, out.String())
+	}
+	for i, e := range got {
+		if e["event"] != want[i] {
+			t.Errorf("event %d = %v, want %s", i, e["event"], want[i])
+		}
+	}
+	if got[1]["step"] != "build" || got[1]["tool"] != "codex" {
+		t.Errorf("step_start = %v", got[1])
+	}
+	if got[2]["status"] != "success" || got[2]["cost_usd"] != 0.03 {
+		t.Errorf("step_complete = %v", got[2])
+	}
+}
@@ -0,0 +1,63 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+// onFailureStepName is what an unnamed on_failure step records its result as
+const onFailureStepName = "on_failure"
+
+// runOnFailure runs the bundle's on_failure step after failedStep failed,
+// returning env with the handler's status in its "on_failure" result. The
+// run's failure stands either way; a handler that fails is only warned about.
+func (o *Orchestrator) runOnFailure(handler *bundle.Step, failedStep string, env *envelope.Envelope, runErr error, ctx *Context, ws *workspace.Workspace, warnings *runWarnings, text io.Writer) *envelope.Envelope {
+	message := ""
+	if env.Error != nil {
+		message = env.Error.Message
+	} else if runErr != nil {
+		message = runErr.Error()
+	}
+	ctx.BindFailure(failedStep, message)
+
+	step := *handler
+	if step.Name == "" {
+		step.Name = onFailureStepName
+	}
+	fmt.Fprintf(text, "  %sStep %s failed; running %s%s\n", colorDim, failedStep, step.Name, colorReset)
+	execStep := o.withToolModels(SelectTool(&step, ctx))
+	warnings.checkTask(execStep, ctx)
+
+	// The run may have timed out, so the handler is not bound by it
+	henv, err := o.executeStep(context.Background(), step.Name, execStep, ctx, ws)
+	status := envelope.StatusFailure
+	switch {
+	case err != nil:
+		warnings.add("on_failure step %s: %v", step.Name, err)
+	case henv == nil:
+		warnings.add("on_failure step %s returned no result", step.Name)
+	default:
+		ctx.SetResult(step.Name, henv)
+		status = henv.Status
+		if status == envelope.StatusFailure {
+			reason := "failed"
+			if henv.Error != nil {
+				reason = henv.Error.Message
+			}
+			warnings.add("on_failure step %s: %s", step.Name, reason)
+		}
+	}
+
+	out := *env
+	out.Result = make(map[string]interface{}, len(env.Result)+1)
+	for k, v := range env.Result {
+		out.Result[k] = v
+	}
+	out.Result["on_failure"] = string(status)
+	return &out
+}
@@ -0,0 +1,149 @@
+package orchestrator
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// handlerRecorder runs bundle steps, failing the one named fail, and records
+// the task the on_failure step resolved
+type handlerRecorder struct {
+	mu      sync.Mutex
+	fail    string
+	ran     []string
+	handled string
+}
+
+func (h *handlerRecorder) executor() funcExecutor {
+	return func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.ran = append(h.ran, step.Name)
+		if step.Name == "notify" {
+			h.handled = ctx.Resolve(step.Task)
+			return envelope.New().Success().Build(), nil
+		}
+		if step.Name == h.fail {
+			return envelope.New().Failure("TESTS_FAILED", "3 tests failed").Build(), nil
+		}
+		return envelope.New().Success().Build(), nil
+	}
+}
+
+func failureBundle() *bundle.Bundle {
+	return &bundle.Bundle{
+		Name: "guarded",
+		Steps: []bundle.Step{
+			{Name: "build", Tool: "claude"},
+			{Name: "test", Tool: "claude"},
+			{Name: "ship", Tool: "claude"},
+		},
+		OnFailure: &bundle.Step{Name: "notify", Tool: "claude", Task: "${failure.step}: ${failure.message}"},
+	}
+}
+
+func TestRun_OnFailureRunsWhenAStepFails(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	h := &handlerRecorder{fail: "test"}
+	o := &Orchestrator{dispatcher: h.executor()}
+	o.SetDisplay(newRecordingDisplay())
+
+	env, err := o.Run(failureBundle(), map[string]string{})
+	if err == nil || env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "TESTS_FAILED" {
+		t.Fatalf("the run should still fail with the step's error, got %+v, %v", env, err)
+	}
+	if got := strings.Join(h.ran, ","); got != "build,test,notify" {
+		t.Errorf("ran %s, want the handler after the failing step and nothing after", got)
+	}
+	if h.handled != "test: 3 tests failed" {
+		t.Errorf("handler task = %q", h.handled)
+	}
+	if env.Result["on_failure"] != "success" {
+		t.Errorf("on_failure = %v, want success", env.Result["on_failure"])
+	}
+	if env.Result["resume_token"] == nil {
+		t.Error("the failure should keep its resume token")
+	}
+}
+
+func TestRun_OnFailureSkippedOnSuccess(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	h := &handlerRecorder{}
+	o := &Orchestrator{dispatcher: h.executor()}
+	o.SetDisplay(newRecordingDisplay())
+
+	env, err := o.Run(failureBundle(), map[string]string{})
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Run = %+v, %v", env, err)
+	}
+	if got := strings.Join(h.ran, ","); got != "build,test,ship" {
+		t.Errorf("ran %s, the handler should not run", got)
+	}
+	if _, ok := env.Result["on_failure"]; ok {
+		t.Error("a successful run should have no on_failure result")
+	}
+}
+
+func TestRun_OnFailureFailingIsAWarning(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "on_failure" {
+			return envelope.New().Failure("WEBHOOK_DOWN", "webhook unreachable").Build(), nil
+		}
+		return envelope.New().Failure("BUILD_FAILED", "does not compile").Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name:      "noisy",
+		Steps:     []bundle.Step{{Name: "build", Tool: "claude"}},
+		OnFailure: &bundle.Step{Tool: "claude", Task: "notify"},
+	}
+	env, _ := o.Run(b, map[string]string{})
+	if env.Error == nil || env.Error.Code != "BUILD_FAILED" {
+		t.Fatalf("the step's failure should be returned, got %+v", env.Error)
+	}
+	if env.Result["on_failure"] != "failure" {
+		t.Errorf("on_failure = %v, want failure", env.Result["on_failure"])
+	}
+	if !strings.Contains(strings.Join(env.Warnings, "\n"), "on_failure step on_failure: webhook unreachable") {
+		t.Errorf("warnings = %v", env.Warnings)
+	}
+}
+
+func TestRun_OnFailureRunsAfterTimeout(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var handled string
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "notify" {
+			handled = ctx.Resolve(step.Task)
+			return envelope.New().Success().Build(), nil
+		}
+		time.Sleep(time.Second)
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	o.SetTimeout(50 * time.Millisecond)
+
+	b := &bundle.Bundle{
+		Name:      "slow",
+		Steps:     []bundle.Step{{Name: "crawl", Tool: "claude"}},
+		OnFailure: &bundle.Step{Name: "notify", Tool: "claude", Task: "${failure.step} ${failure.message}"},
+	}
+	env, _ := o.Run(b, map[string]string{})
+	if env.Error == nil || env.Error.Code != envelope.CodeRunTimeout {
+		t.Fatalf("expected a timeout, got %+v", env.Error)
+	}
+	if !strings.HasPrefix(handled, "crawl run exceeded timeout") || env.Result["on_failure"] != "success" {
+		t.Errorf("handler task = %q, on_failure = %v", handled, env.Result["on_failure"])
+	}
+}
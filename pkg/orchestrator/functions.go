@@ -0,0 +1,183 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"rcodegen/pkg/envelope"
+)
+
+// conditionFunc computes the replacement text for a function call in a condition.
+// Args are the raw comma-separated arguments after variable resolution.
+type conditionFunc func(args []string, ctx *Context) string
+
+// conditionFunctions holds the functions callable from step conditions
+var conditionFunctions = map[string]conditionFunc{
+	"num":          numFunc,
+	"count_status": countStatusFunc,
+	"duration_gt":  durationGtFunc,
+
+	"any_failed":    anyFailedFunc,
+	"all_succeeded": allSucceededFunc,
+
+	"agreement": agreementFunc,
+}
+
+var funcPattern = regexp.MustCompile(`\b([a-z_]+)\(([^()]*)\)`)
+
+// expandFunctions replaces known function calls in an already-resolved
+// condition with their computed values. Unknown names are left untouched.
+func expandFunctions(expr string, ctx *Context) string {
+	return funcPattern.ReplaceAllStringFunc(expr, func(match string) string {
+		m := funcPattern.FindStringSubmatch(match)
+		fn, ok := conditionFunctions[m[1]]
+		if !ok {
+			return match
+		}
+		var args []string
+		if strings.TrimSpace(m[2]) != "" {
+			for _, a := range strings.Split(m[2], ",") {
+				args = append(args, strings.Trim(strings.TrimSpace(a), "'\""))
+			}
+		}
+		return fn(args, ctx)
+	})
+}
+
+// numFunc implements num(value, default): the value as a number, or the
+// default when the value is missing, unresolved, or not numeric.
+func numFunc(args []string, ctx *Context) string {
+	def := "0"
+	if len(args) >= 2 {
+		def = args[1]
+	}
+	if len(args) == 0 {
+		return def
+	}
+	f, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return def
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// countStatusFunc implements count_status(prefix, status): how many step
+// results have a name starting with prefix and the given status, e.g.
+// count_status(candidate-, success) >= 2 after a fan-out of candidates.
+func countStatusFunc(args []string, ctx *Context) string {
+	if len(args) != 2 {
+		return "0"
+	}
+	prefix, status := args[0], args[1]
+	ctx.mu.RLock()
+	defer ctx.mu.RUnlock()
+	count := 0
+	for name, env := range ctx.StepResults {
+		if env != nil && strings.HasPrefix(name, prefix) && string(env.Status) == status {
+			count++
+		}
+	}
+	return strconv.Itoa(count)
+}
+
+// durationGtFunc implements duration_gt(ms, duration): whether a millisecond
+// value exceeds a Go duration such as '30s' or '2m30s'. It is false when
+// either argument is missing or malformed.
+func durationGtFunc(args []string, ctx *Context) string {
+	if len(args) != 2 {
+		return "false"
+	}
+	ms, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return "false"
+	}
+	threshold, err := time.ParseDuration(args[1])
+	if err != nil {
+		return "false"
+	}
+	return strconv.FormatBool(ms > float64(threshold.Milliseconds()))
+}
+
+// childStatuses returns the statuses of a group step's children (a parallel
+// block or foreach loop), or the step's own status for any other step; ok is
+// false if the step has no result
+func childStatuses(name string, ctx *Context) (statuses []envelope.Status, ok bool) {
+	env, ok := ctx.GetResult(name)
+	if !ok || env == nil {
+		return nil, false
+	}
+	children, has := env.Result["children"]
+	if !has {
+		return []envelope.Status{env.Status}, true
+	}
+	// Children are typed by the executor that ran the group, or plain maps
+	// once loaded from JSON; both marshal to the same fields
+	var decoded []struct {
+		Status envelope.Status `json:"status"`
+	}
+	data, err := json.Marshal(children)
+	if err != nil || json.Unmarshal(data, &decoded) != nil {
+		return []envelope.Status{env.Status}, true
+	}
+	for _, child := range decoded {
+		statuses = append(statuses, child.Status)
+	}
+	return statuses, true
+}
+
+// anyFailedFunc implements any_failed(step): whether any child of a parallel
+// or foreach step failed (or, for a nested group, partially failed). For
+// other steps it is whether the step itself failed.
+func anyFailedFunc(args []string, ctx *Context) string {
+	if len(args) != 1 {
+		return "false"
+	}
+	statuses, _ := childStatuses(args[0], ctx)
+	for _, status := range statuses {
+		if status == envelope.StatusFailure || status == envelope.StatusPartial {
+			return "true"
+		}
+	}
+	return "false"
+}
+
+// allSucceededFunc implements all_succeeded(step): whether every child of a
+// parallel or foreach step succeeded. For other steps it is whether the step
+// itself succeeded; it is false for a step that has not run. A skipped child
+// did not fail, so like the group's own status it does not count against it.
+func allSucceededFunc(args []string, ctx *Context) string {
+	if len(args) != 1 {
+		return "false"
+	}
+	statuses, ok := childStatuses(args[0], ctx)
+	if !ok {
+		return "false"
+	}
+	for _, status := range statuses {
+		if status != envelope.StatusSuccess && status != envelope.StatusSkipped {
+			return "false"
+		}
+	}
+	return "true"
+}
+
+// agreementFunc implements agreement(step): the fraction of a vote step's
+// votes (or ranked ballots) that went to its decision, from 0 to 1, e.g.
+// agreement(pick) >= 0.66. It is 0 for a step without an agreement result.
+func agreementFunc(args []string, ctx *Context) string {
+	if len(args) != 1 {
+		return "0"
+	}
+	env, ok := ctx.GetResult(args[0])
+	if !ok || env == nil {
+		return "0"
+	}
+	agreement, ok := resultNumber(env.Result["agreement"])
+	if !ok {
+		return "0"
+	}
+	return strconv.FormatFloat(agreement, 'f', -1, 64)
+}
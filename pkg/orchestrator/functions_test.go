@@ -0,0 +1,215 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"rcodegen/pkg/envelope"
+)
+
+func TestEvaluateCondition_Num(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetResult("scan", &envelope.Envelope{
+		Status: envelope.StatusSuccess,
+		Result: map[string]interface{}{
+			"count": 12,
+			"label": "many",
+		},
+	})
+
+	tests := []struct {
+		name      string
+		condition string
+		expected  bool
+	}{
+		{"present numeric", "num(${steps.scan.result.count}, 0) > 5", true},
+		{"present numeric eq", "num(${steps.scan.result.count}, 0) == 12", true},
+		{"absent field uses default", "num(${steps.scan.result.missing}, 0) > 5", false},
+		{"absent field default compared", "num(${steps.scan.result.missing}, 7) > 5", true},
+		{"absent step uses default", "num(${steps.nope.result.count}, 0) == 0", true},
+		{"non-numeric uses default", "num(${steps.scan.result.label}, 3) == 3", true},
+		{"combined with AND", "num(${steps.scan.result.count}, 0) > 5 AND ${steps.scan.status} == 'success'", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := EvaluateCondition(tc.condition, ctx)
+			if result != tc.expected {
+				t.Errorf("EvaluateCondition(%q) = %v, want %v", tc.condition, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestExpandFunctions(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"num(4.50, 0)", "4.5"},
+		{"num(abc, 1)", "1"},
+		{"num('', 2)", "2"},
+		{"num(x)", "0"},
+		{"unknown(1) == 1", "unknown(1) == 1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			if got := expandFunctions(tc.expr, NewContext(nil)); got != tc.expected {
+				t.Errorf("expandFunctions(%q) = %q, want %q", tc.expr, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_CountStatus(t *testing.T) {
+	ctx := NewContext(nil)
+	for name, status := range map[string]envelope.Status{
+		"candidate-a": envelope.StatusSuccess,
+		"candidate-b": envelope.StatusFailure,
+		"candidate-c": envelope.StatusSuccess,
+		"candidate-d": envelope.StatusPartial,
+		"review":      envelope.StatusSuccess,
+	} {
+		ctx.SetResult(name, &envelope.Envelope{Status: status})
+	}
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"count_status(candidate-, success)", "2"},
+		{"count_status(candidate-, failure)", "1"},
+		{"count_status(candidate-, partial)", "1"},
+		{"count_status(candidate-, skipped)", "0"},
+		{"count_status('', success)", "3"},
+		{"count_status(review, success)", "1"},
+		{"count_status(other-, success)", "0"},
+		{"count_status(candidate-)", "0"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			if got := expandFunctions(tc.expr, ctx); got != tc.expected {
+				t.Errorf("expandFunctions(%q) = %q, want %q", tc.expr, got, tc.expected)
+			}
+		})
+	}
+
+	if !EvaluateCondition("count_status(candidate-, success) >= 2", ctx) {
+		t.Error("expected at least two successful candidates")
+	}
+	if EvaluateCondition("count_status(candidate-, success) > 2", ctx) {
+		t.Error("expected no more than two successful candidates")
+	}
+}
+
+func TestEvaluateCondition_DurationGt(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetResult("slow", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"duration_ms": 45000}})
+	ctx.SetResult("fast", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"duration_ms": int64(1200)}})
+
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{"duration_gt(${steps.slow.result.duration_ms}, '30s')", true},
+		{"duration_gt(${steps.fast.result.duration_ms}, '30s')", false},
+		{"duration_gt(${steps.fast.result.duration_ms}, '1s')", true},
+		{"duration_gt(${steps.fast.result.duration_ms}, '1.2s')", false},
+		{"duration_gt(${steps.slow.result.duration_ms}, '1m')", false},
+		{"duration_gt(${steps.slow.result.duration_ms}, 500ms)", true},
+		{"duration_gt(${steps.slow.result.duration_ms}, '30s') AND ${steps.slow.status} == 'success'", true},
+		{"duration_gt(${steps.missing.result.duration_ms}, '1s')", false},
+		{"duration_gt(${steps.slow.result.duration_ms}, 'soon')", false},
+		{"duration_gt(${steps.slow.result.duration_ms})", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.condition, func(t *testing.T) {
+			if got := EvaluateCondition(tc.condition, ctx); got != tc.expected {
+				t.Errorf("EvaluateCondition(%q) = %v, want %v", tc.condition, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition_AnyFailedAllSucceeded(t *testing.T) {
+	type child struct {
+		Name   string          `json:"name"`
+		Status envelope.Status `json:"status"`
+	}
+	ctx := NewContext(nil)
+	ctx.SetResult("partial-group", &envelope.Envelope{Status: envelope.StatusPartial, Result: map[string]interface{}{
+		"children": []child{{"a", envelope.StatusSuccess}, {"b", envelope.StatusFailure}},
+	}})
+	ctx.SetResult("clean-group", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{
+		"children": []child{{"a", envelope.StatusSuccess}, {"b", envelope.StatusSuccess}},
+	}})
+	// Children as decoded from a saved result
+	ctx.SetResult("loaded-group", &envelope.Envelope{Status: envelope.StatusPartial, Result: map[string]interface{}{
+		"children": []interface{}{
+			map[string]interface{}{"name": "a", "status": "success"},
+			map[string]interface{}{"name": "b", "status": "partial"},
+		},
+	}})
+	ctx.SetResult("skipped-group", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{
+		"children": []child{{"a", envelope.StatusSuccess}, {"b", envelope.StatusSkipped}},
+	}})
+	ctx.SetResult("single", &envelope.Envelope{Status: envelope.StatusFailure})
+
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"any_failed(partial-group)", "true"},
+		{"all_succeeded(partial-group)", "false"},
+		{"any_failed(clean-group)", "false"},
+		{"all_succeeded(clean-group)", "true"},
+		{"any_failed('loaded-group')", "true"},
+		{"all_succeeded(loaded-group)", "false"},
+		{"any_failed(skipped-group)", "false"},
+		{"all_succeeded(skipped-group)", "true"},
+		{"any_failed(single)", "true"},
+		{"all_succeeded(single)", "false"},
+		{"any_failed(missing)", "false"},
+		{"all_succeeded(missing)", "false"},
+		{"any_failed()", "false"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			if got := expandFunctions(tc.expr, ctx); got != tc.expected {
+				t.Errorf("expandFunctions(%q) = %q, want %q", tc.expr, got, tc.expected)
+			}
+		})
+	}
+
+	if !EvaluateCondition("any_failed(partial-group) AND all_succeeded(clean-group)", ctx) {
+		t.Error("expected partial-group to have a failure and clean-group to be clean")
+	}
+	if !EvaluateCondition("${steps.skipped-group.status} == 'success' AND all_succeeded(skipped-group)", ctx) {
+		t.Error("expected all_succeeded to agree with the status of a group with a skipped child")
+	}
+}
+
+func TestEvaluateCondition_Agreement(t *testing.T) {
+	ctx := NewContext(nil)
+	ctx.SetResult("pick", &envelope.Envelope{Status: envelope.StatusSuccess, Result: map[string]interface{}{"agreement": 2.0 / 3.0}})
+	ctx.SetResult("plain", &envelope.Envelope{Status: envelope.StatusSuccess})
+
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{"agreement(pick) >= 0.66", true},
+		{"agreement(pick) >= 0.7", false},
+		{"agreement('pick') > 0.5 AND ${steps.pick.status} == 'success'", true},
+		{"agreement(plain) > 0", false},
+		{"agreement(missing) >= 0", true},
+		{"agreement() > 0", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.condition, func(t *testing.T) {
+			if got := EvaluateCondition(tc.condition, ctx); got != tc.expected {
+				t.Errorf("EvaluateCondition(%q) = %v, want %v", tc.condition, got, tc.expected)
+			}
+		})
+	}
+}
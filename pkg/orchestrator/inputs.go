@@ -0,0 +1,76 @@
+package orchestrator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"rcodegen/pkg/bundle"
+)
+
+// inputShown reports whether an input applies given the inputs collected so
+// far. Inputs without a ShowIf condition always apply.
+func inputShown(input bundle.Input, inputs map[string]string) bool {
+	if input.ShowIf == "" {
+		return true
+	}
+	return EvaluateCondition(input.ShowIf, NewContext(inputs))
+}
+
+// CollectInputs interactively prompts for the bundle inputs that were not
+// supplied, in the order they are declared. Required inputs and inputs with a
+// ShowIf condition are asked for; a ShowIf input is only asked for when its
+// condition holds against the answers collected before it. An empty answer
+// takes the input's default. The given inputs map is updated and returned.
+func CollectInputs(b *bundle.Bundle, inputs map[string]string, r io.Reader, w io.Writer) (map[string]string, error) {
+	if inputs == nil {
+		inputs = make(map[string]string)
+	}
+	reader := bufio.NewReader(r)
+
+	for _, input := range b.Inputs {
+		if _, ok := inputs[input.Name]; ok {
+			continue
+		}
+		if !input.Required && input.ShowIf == "" {
+			continue
+		}
+		if !inputShown(input, inputs) {
+			continue
+		}
+
+		for {
+			prompt := input.Name
+			if input.Description != "" {
+				prompt += " (" + input.Description + ")"
+			}
+			if input.Default != "" {
+				prompt += " [" + input.Default + "]"
+			}
+			fmt.Fprintf(w, "%s: ", prompt)
+
+			line, err := reader.ReadString('\n')
+			answer := strings.TrimSpace(line)
+			if err != nil && (err != io.EOF || answer == "") {
+				if err == io.EOF && !input.Required {
+					break
+				}
+				return inputs, fmt.Errorf("reading input %s: %w", input.Name, err)
+			}
+
+			if answer == "" {
+				answer = input.Default
+			}
+			if answer == "" && input.Required {
+				fmt.Fprintf(w, "%s is required\n", input.Name)
+				continue
+			}
+			if answer != "" {
+				inputs[input.Name] = answer
+			}
+			break
+		}
+	}
+	return inputs, nil
+}
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func deployBundle() *bundle.Bundle {
+	return &bundle.Bundle{
+		Name: "deploy",
+		Inputs: []bundle.Input{
+			{Name: "task", Required: true, Description: "What to build"},
+			{Name: "deploy", Default: "no"},
+			{Name: "environment", Required: true, ShowIf: "${inputs.deploy} == 'yes'"},
+		},
+	}
+}
+
+func TestCollectInputs_PromptsConditionalInputWhenShowIfHolds(t *testing.T) {
+	var out bytes.Buffer
+	inputs, err := CollectInputs(deployBundle(), map[string]string{"deploy": "yes"},
+		strings.NewReader("add login\nstaging\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inputs["task"] != "add login" || inputs["environment"] != "staging" {
+		t.Errorf("inputs = %v", inputs)
+	}
+	if !strings.Contains(out.String(), "task (What to build): ") || !strings.Contains(out.String(), "environment: ") {
+		t.Errorf("unexpected prompts: %q", out.String())
+	}
+}
+
+func TestCollectInputs_SkipsConditionalInputWhenShowIfFails(t *testing.T) {
+	var out bytes.Buffer
+	inputs, err := CollectInputs(deployBundle(), map[string]string{"deploy": "no"},
+		strings.NewReader("add login\nstaging\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := inputs["environment"]; ok {
+		t.Errorf("environment should not be collected: %v", inputs)
+	}
+	if strings.Contains(out.String(), "environment") {
+		t.Errorf("environment should not be prompted: %q", out.String())
+	}
+}
+
+func TestCollectInputs_ShowIfSeesEarlierAnswers(t *testing.T) {
+	b := &bundle.Bundle{Inputs: []bundle.Input{
+		{Name: "deploy", ShowIf: "${inputs.task} != ''"},
+		{Name: "environment", Required: true, ShowIf: "${inputs.deploy} == 'yes'"},
+	}}
+
+	var out bytes.Buffer
+	inputs, err := CollectInputs(b, map[string]string{"task": "x"}, strings.NewReader("yes\nprod\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inputs["deploy"] != "yes" || inputs["environment"] != "prod" {
+		t.Errorf("inputs = %v", inputs)
+	}
+}
+
+func TestCollectInputs_DefaultsAndRequiredRetry(t *testing.T) {
+	b := &bundle.Bundle{Inputs: []bundle.Input{
+		{Name: "task", Required: true},
+		{Name: "length", Default: "short", ShowIf: "${inputs.task} != ''"},
+	}}
+
+	var out bytes.Buffer
+	inputs, err := CollectInputs(b, nil, strings.NewReader("\nsummarize\n\n"), &out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inputs["task"] != "summarize" || inputs["length"] != "short" {
+		t.Errorf("inputs = %v", inputs)
+	}
+	if !strings.Contains(out.String(), "task is required") {
+		t.Errorf("expected a required-input message: %q", out.String())
+	}
+}
+
+func TestRun_HiddenRequiredInputNotNeeded(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := deployBundle()
+	b.Steps = []bundle.Step{{Name: "build", Tool: "claude", Task: "${inputs.task}"}}
+
+	env, _ := o.Run(b, map[string]string{"task": "add login"})
+	if env.Status != envelope.StatusSuccess {
+		t.Errorf("environment is hidden and should not be required, got %+v", env.Error)
+	}
+
+	b = deployBundle()
+	b.Steps = []bundle.Step{{Name: "build", Tool: "claude", Task: "${inputs.task}"}}
+	env, _ = o.Run(b, map[string]string{"task": "add login", "deploy": "yes"})
+	if env.Error == nil || env.Error.Code != "MISSING_INPUT" {
+		t.Errorf("expected MISSING_INPUT for environment, got %+v", env)
+	}
+}
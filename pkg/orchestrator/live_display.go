@@ -3,6 +3,7 @@ package orchestrator
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,6 +27,9 @@ const (
 	restoreCursor = "\033[u"
 )
 
+// DefaultScrollback is how many output lines LiveDisplay keeps per step
+const DefaultScrollback = 50
+
 // Spinner frames for animation
 var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
 
@@ -42,14 +46,25 @@ type LiveDisplay struct {
 	steps       []LiveStep
 	startTime   time.Time
 	width       int
+	out         io.Writer // Where the display renders (os.Stdout by default)
+
+	// Plain mode: no spinner or cursor control, just a line per step
+	// transition and periodic progress lines for dumb terminals and logs
+	plain            bool
+	noAnimation      bool // Plain mode even on a capable terminal
+	progressInterval time.Duration
+
+	cost CostFormatter // Currency/locale used for displayed costs
 
 	// Live state
-	currentStep    int
-	spinnerFrame   int
-	liveOutput     string // Single line of current activity
-	maxOutputLines int
-	totalCost      float64
-	totalTokens    int
+	currentStep  int
+	spinnerFrame int
+	liveOutput   string  // Single line of current activity
+	scrollback   int     // Output lines kept per step for DumpOutput
+	totalCost    float64 // Shown in the header; includes the running step's cost so far
+	stepsCost    float64 // Cost of completed steps
+	totalTokens  int
+	tokenBudget  int // Shown against totalTokens in the header when set
 
 	// Control
 	done     chan struct{}
@@ -58,14 +73,18 @@ type LiveDisplay struct {
 
 // LiveStep tracks progress for a single step
 type LiveStep struct {
-	Name      string
-	Tool      string
-	Model     string
-	State     StepState
-	Cost      float64
-	Duration  time.Duration
-	Tokens    int
-	StartTime time.Time
+	Name        string
+	Description string
+	Tool        string
+	Model       string
+	State       StepState
+	Cost        float64
+	Duration    time.Duration
+	Tokens      int
+	StartTime   time.Time
+
+	output   []string // The step's latest meaningful output lines, at most the scrollback
+	streamed bool     // Output arrives through AddOutput, so the log is not re-read
 }
 
 // NewLiveDisplay creates a new animated display
@@ -77,9 +96,10 @@ func NewLiveDisplay(b *bundle.Bundle, jobID string, inputs map[string]string) *L
 			tool = "parallel"
 		}
 		steps[i] = LiveStep{
-			Name:  step.Name,
-			Tool:  tool,
-			State: StepPending,
+			Name:        step.Name,
+			Description: step.Description,
+			Tool:        tool,
+			State:       StepPending,
 		}
 	}
 
@@ -91,20 +111,141 @@ func NewLiveDisplay(b *bundle.Bundle, jobID string, inputs map[string]string) *L
 		task = task[:52] + "..."
 	}
 
-	return &LiveDisplay{
-		bundleName:     b.Name,
-		jobID:          jobID,
-		projectName:    inputs["project_name"],
-		task:           task,
-		outputDir:      inputs["output_dir"],
-		steps:          steps,
-		startTime:      time.Now(),
-		width:          72,
-		currentStep:    -1,
-		maxOutputLines: 1,
-		liveOutput:     "",
-		done:           make(chan struct{}),
+	d := &LiveDisplay{
+		bundleName:  b.Name,
+		jobID:       jobID,
+		projectName: inputs["project_name"],
+		task:        task,
+		outputDir:   inputs["output_dir"],
+		steps:       steps,
+		startTime:   time.Now(),
+		width:       72,
+		out:         os.Stdout,
+		currentStep: -1,
+		scrollback:  DefaultScrollback,
+		liveOutput:  "",
+		done:        make(chan struct{}),
+
+		plain:            isDumbTerminal(os.Stdout),
+		progressInterval: 10 * time.Second,
+		cost:             DefaultCostFormatter,
+	}
+	if d.plain {
+		d.out = plainWriter{os.Stdout}
+	}
+	return d
+}
+
+// isDumbTerminal reports whether w can't handle the animated display:
+// TERM=dumb, or w is a file that is not a terminal (redirected to a log or
+// pipe). Other writers, such as an embedding TUI's buffer, are assumed capable.
+func isDumbTerminal(w io.Writer) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return true
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	return (stat.Mode() & os.ModeCharDevice) == 0
+}
+
+// plainWriter strips ANSI escape codes from everything written through it
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(p.w, stripAnsi(string(b))); err != nil {
+		return 0, err
 	}
+	return len(b), nil
+}
+
+// SetCostFormatter sets the currency and locale used for displayed costs
+func (d *LiveDisplay) SetCostFormatter(f CostFormatter) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cost = f
+}
+
+// minDisplayWidth is the narrowest layout the display draws; smaller widths,
+// such as the 0 some CI terminals report, fall back to it
+const minDisplayWidth = 20
+
+// SetTokenBudget shows the run's token usage against budget in the header,
+// colored by how close it is to the limit (0 hides it)
+func (d *LiveDisplay) SetTokenBudget(budget int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tokenBudget = budget
+}
+
+// SetWidth sets the terminal width the display lays out for (72 by default)
+func (d *LiveDisplay) SetWidth(width int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.width = width
+}
+
+// lineWidth returns the layout width, at least minDisplayWidth so box and
+// rule lengths derived from it are never negative
+func (d *LiveDisplay) lineWidth() int {
+	return max(d.width, minDisplayWidth)
+}
+
+// SetProgressInterval sets how often plain mode prints a progress line
+func (d *LiveDisplay) SetProgressInterval(interval time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.progressInterval = interval
+}
+
+// SetScrollback sets how many of each step's latest output lines are kept
+// for DumpOutput (0 or less restores DefaultScrollback)
+func (d *LiveDisplay) SetScrollback(lines int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if lines <= 0 {
+		lines = DefaultScrollback
+	}
+	d.scrollback = lines
+	for i := range d.steps {
+		d.steps[i].output = lastLines(d.steps[i].output, lines)
+	}
+}
+
+// DumpOutput returns the output lines kept for a step, oldest first, so a
+// post-run inspector can show more than the single line of live activity
+func (d *LiveDisplay) DumpOutput(stepIndex int) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if stepIndex < 0 || stepIndex >= len(d.steps) {
+		return nil
+	}
+	return append([]string(nil), d.steps[stepIndex].output...)
+}
+
+// AddOutput adds a line a running step has printed to its kept output, so
+// the live output box follows the step as it works rather than polling its
+// log. Once a step has streamed a line its log is no longer read.
+func (d *LiveDisplay) AddOutput(stepIndex int, line string) {
+	line = strings.TrimSpace(stripAnsi(line))
+	if line == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if stepIndex < 0 || stepIndex >= len(d.steps) {
+		return
+	}
+	step := &d.steps[stepIndex]
+	step.output = lastLines(append(step.output, line), d.scrollback)
+	step.streamed = true
 }
 
 // SetLogDir sets the directory where step logs are written
@@ -114,11 +255,56 @@ func (d *LiveDisplay) SetLogDir(dir string) {
 	d.logDir = dir
 }
 
+// SetOutput redirects rendering to w instead of stdout, e.g. a buffer in
+// tests or a pane when embedding the display in a larger TUI. Plain mode is
+// re-detected for the new writer.
+func (d *LiveDisplay) SetOutput(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setOutput(w)
+}
+
+// setOutput renders to w, plain if animation is off or w can't animate.
+// Callers must hold d.mu.
+func (d *LiveDisplay) setOutput(w io.Writer) {
+	d.plain = d.noAnimation || isDumbTerminal(w)
+	if d.plain {
+		w = plainWriter{w}
+	}
+	d.out = w
+}
+
+// SetAnimation turns the animated display off (or back on), so a terminal
+// gets the same line-per-step output as a log. Call it before Start.
+func (d *LiveDisplay) SetAnimation(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.noAnimation = !enabled
+	w := d.out
+	if pw, ok := w.(plainWriter); ok {
+		w = pw.w
+	}
+	d.setOutput(w)
+}
+
+// printTransition writes one plain line for a step changing state, like
+// "[2/5] review (claude) started". Callers must hold d.mu.
+func (d *LiveDisplay) printTransition(stepIndex int, status string) {
+	step := d.steps[stepIndex]
+	fmt.Fprintf(d.out, "[%d/%d] %s (%s) %s\n", stepIndex+1, len(d.steps), step.Name, step.Tool, status)
+}
+
 // Start begins the animated display
 func (d *LiveDisplay) Start() {
-	fmt.Print(cursorHide)
-	fmt.Print(clearScreen)
-	fmt.Print(cursorHome)
+	if d.plain {
+		fmt.Fprintf(d.out, "rcodegen · %s (job %s)\n", d.bundleName, d.jobID)
+		go d.progressLoop()
+		return
+	}
+
+	fmt.Fprint(d.out, cursorHide)
+	fmt.Fprint(d.out, clearScreen)
+	fmt.Fprint(d.out, cursorHome)
 
 	// Start the animation loop
 	go d.animationLoop()
@@ -128,7 +314,9 @@ func (d *LiveDisplay) Start() {
 func (d *LiveDisplay) Stop() {
 	d.stopOnce.Do(func() {
 		close(d.done)
-		fmt.Print(cursorShow)
+		if !d.plain {
+			fmt.Fprint(d.out, cursorShow)
+		}
 	})
 }
 
@@ -144,10 +332,13 @@ func (d *LiveDisplay) animationLoop() {
 		case <-ticker.C:
 			d.mu.Lock()
 			d.spinnerFrame = (d.spinnerFrame + 1) % len(spinnerFrames)
-			// Read latest line from current step's log
-			if d.currentStep >= 0 && d.currentStep < len(d.steps) && d.logDir != "" {
-				stepName := d.steps[d.currentStep].Name
-				d.liveOutput = d.readLastMeaningfulLine(stepName)
+			// Read the latest lines from the current step's log
+			if d.currentStep >= 0 && d.currentStep < len(d.steps) {
+				d.captureOutput(d.currentStep)
+				d.liveOutput = ""
+				if lines := d.steps[d.currentStep].output; len(lines) > 0 {
+					d.liveOutput = lines[len(lines)-1]
+				}
 			}
 			d.render()
 			d.mu.Unlock()
@@ -155,17 +346,73 @@ func (d *LiveDisplay) animationLoop() {
 	}
 }
 
-// readLastMeaningfulLine reads the last non-empty, meaningful line from a step's log
-func (d *LiveDisplay) readLastMeaningfulLine(stepName string) string {
+// progressLoop prints a plain progress line every progressInterval
+func (d *LiveDisplay) progressLoop() {
+	d.mu.Lock()
+	interval := d.progressInterval
+	d.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			d.printProgressLine()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// printProgressLine writes one line like
+// "[2m30s] 1/3 steps (33%) · running: implement · $0.42"
+func (d *LiveDisplay) printProgressLine() {
+	finished := 0
+	for _, step := range d.steps {
+		if step.State == StepSuccess || step.State == StepFailure || step.State == StepSkipped {
+			finished++
+		}
+	}
+	pct := 100
+	if len(d.steps) > 0 {
+		pct = finished * 100 / len(d.steps)
+	}
+
+	line := fmt.Sprintf("[%s] %d/%d steps (%d%%)", formatDuration(time.Since(d.startTime)), finished, len(d.steps), pct)
+	if d.currentStep >= 0 && d.currentStep < len(d.steps) && d.steps[d.currentStep].State == StepRunning {
+		line += " · running: " + d.steps[d.currentStep].Name
+	}
+	line += " · " + d.cost.Format(d.totalCost)
+	fmt.Fprintln(d.out, line)
+}
+
+// captureOutput refreshes a step's kept output from its log, if there is
+// one and the step's output is not streamed. Callers must hold d.mu.
+func (d *LiveDisplay) captureOutput(stepIndex int) {
+	if d.logDir == "" || d.steps[stepIndex].streamed {
+		return
+	}
+	if lines := d.readMeaningfulLines(d.steps[stepIndex].Name, d.scrollback); lines != nil {
+		d.steps[stepIndex].output = lines
+	}
+}
+
+// readMeaningfulLines reads the last n non-empty, meaningful lines from a
+// step's log, oldest first
+func (d *LiveDisplay) readMeaningfulLines(stepName string, n int) []string {
 	logPath := filepath.Join(d.logDir, stepName+".log")
 	f, err := os.Open(logPath)
 	if err != nil {
-		return ""
+		return nil
 	}
 	defer f.Close()
 
-	var lastLine string
+	var lines []string
 	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		// Skip empty lines and JSON-only lines
@@ -174,10 +421,21 @@ func (d *LiveDisplay) readLastMeaningfulLine(stepName string) string {
 		}
 		// Extract meaningful content from stream-json format
 		if meaningful := extractMeaningfulContent(line); meaningful != "" {
-			lastLine = meaningful
+			lines = append(lines, meaningful)
+			if len(lines) > 2*n {
+				lines = lastLines(lines, n)
+			}
 		}
 	}
-	return lastLine
+	return lastLines(lines, n)
+}
+
+// lastLines returns the last n of lines
+func lastLines(lines []string, n int) []string {
+	if len(lines) <= n {
+		return lines
+	}
+	return append([]string(nil), lines[len(lines)-n:]...)
 }
 
 // extractMeaningfulContent pulls human-readable content from tool output
@@ -272,13 +530,13 @@ func extractMeaningfulContent(line string) string {
 
 // render draws the entire display
 func (d *LiveDisplay) render() {
-	fmt.Print(cursorHome)
+	fmt.Fprint(d.out, cursorHome)
 
-	w := d.width
+	w := d.lineWidth()
 	elapsed := time.Since(d.startTime)
 
 	// Header box
-	fmt.Printf("%s%s%s%s%s%s\n",
+	fmt.Fprintf(d.out, "%s%s%s%s%s%s\n",
 		colorCyan, boxTopLeft,
 		strings.Repeat(boxHorizontal, w-2),
 		boxTopRight, colorReset, clearLine)
@@ -288,42 +546,50 @@ func (d *LiveDisplay) render() {
 	if padding < 0 {
 		padding = 0
 	}
-	fmt.Printf("%s%s%s%s%s%s%s%s\n",
+	fmt.Fprintf(d.out, "%s%s%s%s%s%s%s%s\n",
 		colorCyan, boxVertical, colorReset,
 		colorBold, title, colorReset,
 		strings.Repeat(" ", padding),
 		colorCyan+boxVertical+colorReset+clearLine)
 
-	// Elapsed time and cost in header
+	// Elapsed time, cost and token budget in header
 	elapsedStr := formatDuration(elapsed)
-	costStr := fmt.Sprintf("$%.2f", d.totalCost)
-	// Visual format: "  {elapsed}  ·  {cost}" = 2 + elapsed + 5 + cost
-	infoLineVisualLen := 2 + len(elapsedStr) + 5 + len(costStr)
+	costStr := d.cost.Format(d.totalCost)
+	// Visual format: "  {elapsed}  ·  {cost}[  ·  {tokens}]" = 2 + elapsed + 5 + cost (+ 5 + tokens)
+	infoLineVisualLen := 2 + len(elapsedStr) + 5 + utf8.RuneCountInString(costStr)
+	tokensPart := ""
+	if d.tokenBudget > 0 {
+		tokensStr := formatTokenCount(d.totalTokens) + "/" + formatTokenCount(d.tokenBudget) + " tokens"
+		infoLineVisualLen += 5 + len(tokensStr)
+		tokensPart = fmt.Sprintf("  %s·%s  %s%s%s", colorDim, colorReset,
+			tokenBudgetColor(float64(d.totalTokens)/float64(d.tokenBudget)), tokensStr, colorReset)
+	}
 	infoPadding := w - 2 - infoLineVisualLen
 	if infoPadding < 0 {
 		infoPadding = 0
 	}
-	fmt.Printf("%s%s%s  %s%s%s  %s·%s  %s%s%s%s%s%s\n",
+	fmt.Fprintf(d.out, "%s%s%s  %s%s%s  %s·%s  %s%s%s%s%s%s%s\n",
 		colorCyan, boxVertical, colorReset,
 		colorYellow, elapsedStr, colorReset,
 		colorDim, colorReset,
 		colorGreen, costStr, colorReset,
+		tokensPart,
 		strings.Repeat(" ", infoPadding),
 		colorCyan+boxVertical+colorReset, clearLine)
 
-	fmt.Printf("%s%s%s%s%s%s\n",
+	fmt.Fprintf(d.out, "%s%s%s%s%s%s\n",
 		colorCyan, boxBottomLeft,
 		strings.Repeat(boxHorizontal, w-2),
 		boxBottomRight, colorReset, clearLine)
 
 	// Task info
 	if d.task != "" {
-		fmt.Printf("\n  %sTask:%s %s\"%s\"%s%s\n",
+		fmt.Fprintf(d.out, "\n  %sTask:%s %s\"%s\"%s%s\n",
 			colorDim, colorReset, colorDim, d.task, colorReset, clearLine)
 	} else {
-		fmt.Printf("\n%s\n", clearLine)
+		fmt.Fprintf(d.out, "\n%s\n", clearLine)
 	}
-	fmt.Printf("%s\n", clearLine)
+	fmt.Fprintf(d.out, "%s\n", clearLine)
 
 	// Steps list
 	for i, step := range d.steps {
@@ -331,7 +597,7 @@ func (d *LiveDisplay) render() {
 	}
 
 	// Live output section (if we have a running step)
-	fmt.Printf("\n%s\n", clearLine)
+	fmt.Fprintf(d.out, "\n%s\n", clearLine)
 	if d.currentStep >= 0 && d.currentStep < len(d.steps) && d.steps[d.currentStep].State == StepRunning {
 		// Show single line of current activity
 		activity := d.liveOutput
@@ -341,14 +607,46 @@ func (d *LiveDisplay) render() {
 		if len(activity) > w-8 {
 			activity = activity[:w-11] + "..."
 		}
-		fmt.Printf("  %s→%s %s%s%s%s\n",
+		fmt.Fprintf(d.out, "  %s→%s %s%s%s%s\n",
 			colorCyan, colorReset,
 			colorWhite, activity, colorReset, clearLine)
 	} else {
 		// Empty line to maintain layout
-		fmt.Printf("%s\n", clearLine)
+		fmt.Fprintf(d.out, "%s\n", clearLine)
+	}
+
+}
+
+// Fractions of the token budget at which the header turns yellow, then red
+const (
+	tokenBudgetWarn   = 0.75
+	tokenBudgetDanger = 0.9
+)
+
+// tokenBudgetColor returns the header color for having used fraction of
+// the token budget: green, yellow from tokenBudgetWarn, red from
+// tokenBudgetDanger
+func tokenBudgetColor(fraction float64) string {
+	switch {
+	case fraction >= tokenBudgetDanger:
+		return colorRed
+	case fraction >= tokenBudgetWarn:
+		return colorYellow
+	default:
+		return colorGreen
 	}
+}
 
+// formatTokenCount abbreviates a token count for the header, e.g. 950,
+// 12.5k or 1.2M
+func formatTokenCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1_000_000), ".0") + "M"
+	case n >= 1_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1_000), ".0") + "k"
+	}
+	return fmt.Sprint(n)
 }
 
 // renderStep renders a single step line
@@ -363,14 +661,17 @@ func (d *LiveDisplay) renderStep(index int, step *LiveStep) {
 		iconColor = colorDim
 	case StepRunning:
 		icon = spinnerFrames[d.spinnerFrame]
+		if d.plain {
+			icon = iconRunning
+		}
 		iconColor = colorCyan
 		elapsed := time.Since(step.StartTime)
 		statusInfo = fmt.Sprintf(" %s%s%s", colorDim, formatDuration(elapsed), colorReset)
 	case StepSuccess:
 		icon = iconSuccess
 		iconColor = colorGreen
-		statusInfo = fmt.Sprintf(" %s$%.2f%s %s%s%s",
-			colorGreen, step.Cost, colorReset,
+		statusInfo = fmt.Sprintf(" %s%s%s %s%s%s",
+			colorGreen, d.cost.Format(step.Cost), colorReset,
 			colorDim, formatDuration(step.Duration), colorReset)
 	case StepFailure:
 		icon = iconFailure
@@ -408,11 +709,20 @@ func (d *LiveDisplay) renderStep(index int, step *LiveStep) {
 		toolDisplay = fmt.Sprintf("%s/%s", toolName, modelName)
 	}
 
-	fmt.Printf("  %s%s%s  %-12s %s%-14s%s%s%s\n",
+	fmt.Fprintf(d.out, "  %s%s%s  %-12s %s%-14s%s%s%s\n",
 		iconColor, icon, colorReset,
 		step.Name,
 		toolClr, toolDisplay, colorReset,
 		statusInfo, clearLine)
+
+	// Description as a dim subtitle aligned with the step name
+	if step.Description != "" {
+		desc := step.Description
+		if max := d.lineWidth() - 8; max > 3 && utf8.RuneCountInString(desc) > max {
+			desc = string([]rune(desc)[:max-3]) + "..."
+		}
+		fmt.Fprintf(d.out, "     %s%s%s%s\n", colorDim, desc, colorReset, clearLine)
+	}
 }
 
 // SetStepRunning marks a step as running
@@ -425,6 +735,9 @@ func (d *LiveDisplay) SetStepRunning(stepIndex int) {
 		d.steps[stepIndex].StartTime = time.Now()
 		d.currentStep = stepIndex
 		d.liveOutput = "" // Clear live output for new step
+		if d.plain {
+			d.printTransition(stepIndex, "started")
+		}
 	}
 }
 
@@ -452,8 +765,17 @@ func (d *LiveDisplay) SetStepComplete(stepIndex int, cost float64, duration time
 		d.steps[stepIndex].Cost = cost
 		d.steps[stepIndex].Duration = duration
 		d.steps[stepIndex].Tokens = tokens
-		d.totalCost += cost
+		d.captureOutput(stepIndex) // Keep the lines written since the last frame
+		d.stepsCost += cost
+		d.totalCost = d.stepsCost // The step's final cost replaces its running cost
 		d.totalTokens += tokens
+		if d.plain {
+			status := "success"
+			if !success {
+				status = "failure"
+			}
+			d.printTransition(stepIndex, fmt.Sprintf("%s %s %s", status, d.cost.Format(cost), formatDuration(duration)))
+		}
 	}
 }
 
@@ -464,10 +786,14 @@ func (d *LiveDisplay) SetStepSkipped(stepIndex int) {
 
 	if stepIndex >= 0 && stepIndex < len(d.steps) {
 		d.steps[stepIndex].State = StepSkipped
+		if d.plain {
+			d.printTransition(stepIndex, "skipped")
+		}
 	}
 }
 
-// UpdateCost updates the total cost display
+// UpdateCost updates the total cost display, e.g. with the cost of completed
+// steps plus what the running step has spent so far
 func (d *LiveDisplay) UpdateCost(cost float64) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -496,20 +822,20 @@ func (d *LiveDisplay) PrintFinalSummary(totalCost float64, totalInputTokens, tot
 		}
 	}
 
-	fmt.Println()
-	fmt.Printf("  %s%s%s\n", colorCyan, strings.Repeat("─", d.width-4), colorReset)
-	fmt.Println()
+	fmt.Fprintln(d.out)
+	fmt.Fprintf(d.out, "  %s%s%s\n", colorCyan, strings.Repeat("─", d.lineWidth()-4), colorReset)
+	fmt.Fprintln(d.out)
 
 	// Summary line
 	durStr := formatDuration(duration)
-	costStr := fmt.Sprintf("$%.2f", totalCost)
+	costStr := d.cost.Format(totalCost)
 
 	status := fmt.Sprintf("%s%d/%d complete%s", colorGreen, successes, len(d.steps), colorReset)
 	if failures > 0 {
 		status = fmt.Sprintf("%s%d failed%s", colorRed, failures, colorReset)
 	}
 
-	fmt.Printf("  %sElapsed:%s %s  %s·%s  %sCost:%s %s%s%s  %s·%s  %s\n",
+	fmt.Fprintf(d.out, "  %sElapsed:%s %s  %s·%s  %sCost:%s %s%s%s  %s·%s  %s\n",
 		colorDim, colorReset, durStr,
 		colorDim, colorReset,
 		colorDim, colorReset, colorGreen, costStr, colorReset,
@@ -517,15 +843,15 @@ func (d *LiveDisplay) PrintFinalSummary(totalCost float64, totalInputTokens, tot
 		status)
 
 	// Token info
-	fmt.Printf("  %sTokens:%s %s%d%s in, %s%d%s out",
+	fmt.Fprintf(d.out, "  %sTokens:%s %s%d%s in, %s%d%s out",
 		colorDim, colorReset,
 		colorWhite, totalInputTokens, colorReset,
 		colorWhite, totalOutputTokens, colorReset)
 	if cacheRead > 0 || cacheWrite > 0 {
-		fmt.Printf(" %s(cache: %d read, %d write)%s", colorDim, cacheRead, cacheWrite, colorReset)
+		fmt.Fprintf(d.out, " %s(cache: %d read, %d write)%s", colorDim, cacheRead, cacheWrite, colorReset)
 	}
-	fmt.Println()
-	fmt.Println()
+	fmt.Fprintln(d.out)
+	fmt.Fprintln(d.out)
 }
 
 // stripAnsi removes ANSI escape codes from a string
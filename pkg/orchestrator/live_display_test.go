@@ -0,0 +1,474 @@
+package orchestrator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func newTestLiveDisplay(buf *bytes.Buffer) *LiveDisplay {
+	b := &bundle.Bundle{
+		Name: "review-pipeline",
+		Steps: []bundle.Step{
+			{Name: "analyze", Tool: "claude"},
+			{Name: "implement", Tool: "codex"},
+			{Name: "check", Tool: "gemini"},
+		},
+	}
+	d := NewLiveDisplay(b, "job-1", map[string]string{"task": "tidy the parser"})
+	d.SetOutput(buf)
+	return d
+}
+
+func TestLiveDisplay_RenderToBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+
+	d.SetStepModel(0, "sonnet")
+	d.SetStepComplete(0, 0.42, 3*time.Second, 1000, true)
+	d.SetStepRunning(1)
+	d.SetStepSkipped(2)
+
+	d.mu.Lock()
+	d.render()
+	d.mu.Unlock()
+
+	out := stripAnsi(buf.String())
+	for _, want := range []string{
+		"rcodegen · review-pipeline",
+		`Task: "tidy the parser"`,
+		"analyze",
+		"Claude/Sonnet",
+		"$0.42",
+		"implement",
+		"Working...",
+		"check",
+		"(skipped)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("rendered output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTokenBudgetColor(t *testing.T) {
+	tests := []struct {
+		name     string
+		fraction float64
+		want     string
+	}{
+		{"unused", 0, colorGreen},
+		{"low", 0.3, colorGreen},
+		{"just below warning", 0.749, colorGreen},
+		{"medium", 0.75, colorYellow},
+		{"approaching", 0.85, colorYellow},
+		{"high", 0.9, colorRed},
+		{"over budget", 1.4, colorRed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tokenBudgetColor(tc.fraction); got != tc.want {
+				t.Errorf("tokenBudgetColor(%v) = %q, want %q", tc.fraction, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatTokenCount(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 950: "950", 1000: "1k", 12500: "12.5k", 1_200_000: "1.2M", 2_000_000: "2M"} {
+		if got := formatTokenCount(n); got != want {
+			t.Errorf("formatTokenCount(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestLiveDisplay_TokenBudgetInHeader(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+	d.SetTokenBudget(10000)
+	d.SetStepComplete(0, 0.42, 3*time.Second, 8000, true)
+
+	d.mu.Lock()
+	d.render()
+	d.mu.Unlock()
+
+	if !strings.Contains(buf.String(), colorYellow+"8k/10k tokens"+colorReset) {
+		t.Errorf("expected yellow token usage in the header:\n%s", stripAnsi(buf.String()))
+	}
+
+	// Without a budget the header shows no token usage
+	buf.Reset()
+	d.SetTokenBudget(0)
+	d.mu.Lock()
+	d.render()
+	d.mu.Unlock()
+	if strings.Contains(buf.String(), "tokens") {
+		t.Errorf("expected no token usage without a budget:\n%s", stripAnsi(buf.String()))
+	}
+}
+
+func TestLiveDisplay_SetTokenBudgetWhileRendering(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+
+	// Run with -race: the budget may be set while frames are drawn
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			d.mu.Lock()
+			d.render()
+			d.mu.Unlock()
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		d.SetTokenBudget(1000 * i)
+	}
+	wg.Wait()
+}
+
+func TestLiveDisplay_TinyWidth(t *testing.T) {
+	for _, width := range []int{0, 1, -5} {
+		var buf bytes.Buffer
+		d := newTestLiveDisplay(&buf)
+		d.SetWidth(width)
+		d.SetStepRunning(0)
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("width %d: render panicked: %v", width, r)
+				}
+			}()
+			d.mu.Lock()
+			d.render()
+			d.mu.Unlock()
+			d.PrintFinalSummary(0, 0, 0, 0, 0)
+		}()
+
+		out := stripAnsi(buf.String())
+		rule := boxTopLeft + strings.Repeat(boxHorizontal, minDisplayWidth-2) + boxTopRight
+		if !strings.Contains(out, rule) {
+			t.Errorf("width %d: header should fall back to %d columns:\n%s", width, minDisplayWidth, out)
+		}
+		if !strings.Contains(out, "analyze") {
+			t.Errorf("width %d: steps should still be listed:\n%s", width, out)
+		}
+	}
+}
+
+func TestLiveDisplay_FinalSummaryToBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+
+	d.SetStepComplete(0, 1.00, time.Second, 10, true)
+	d.SetStepComplete(1, 0.50, time.Second, 10, true)
+	d.SetStepComplete(2, 0.25, time.Second, 10, true)
+	d.PrintFinalSummary(1.75, 1200, 340, 0, 0)
+
+	out := stripAnsi(buf.String())
+	for _, want := range []string{"3/3 complete", "Cost: $1.75", "Tokens: 1200 in, 340 out"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLiveDisplay_StartStopUseOutput(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+
+	// Stop without Start must still restore the cursor on the configured writer
+	d.Stop()
+	d.Stop()
+
+	if got := buf.String(); got != cursorShow {
+		t.Errorf("expected only cursor-show sequence, got %q", got)
+	}
+}
+
+func TestLiveDisplay_DumbTerminalPlainProgress(t *testing.T) {
+	t.Setenv("TERM", "dumb")
+
+	var out syncBuffer
+	d := newTestLiveDisplay(&bytes.Buffer{})
+	d.SetOutput(&out)
+	d.SetProgressInterval(20 * time.Millisecond)
+
+	d.Start()
+	d.SetStepRunning(0)
+	time.Sleep(70 * time.Millisecond)
+	d.SetStepComplete(0, 0.30, time.Second, 100, true)
+	d.SetStepRunning(1)
+	time.Sleep(70 * time.Millisecond)
+	d.Stop()
+	d.PrintFinalSummary(0.30, 100, 10, 0, 0)
+
+	got := out.String()
+	if strings.Contains(got, "\033") {
+		t.Errorf("plain mode output contains escape codes: %q", got)
+	}
+
+	progress := regexp.MustCompile(`(?m)^\[[^\]]+\] \d+/3 steps \(\d+%\)`)
+	lines := progress.FindAllString(got, -1)
+	if len(lines) < 2 {
+		t.Fatalf("expected periodic progress lines, got %d:\n%s", len(lines), got)
+	}
+	if !strings.Contains(got, "0/3 steps (0%) · running: analyze") {
+		t.Errorf("missing progress line for first running step:\n%s", got)
+	}
+	if !strings.Contains(got, "1/3 steps (33%) · running: implement · $0.30") {
+		t.Errorf("missing progress line after first step completed:\n%s", got)
+	}
+	for _, frame := range spinnerFrames {
+		if strings.Contains(got, frame) {
+			t.Errorf("plain mode output contains spinner frame %q", frame)
+		}
+	}
+}
+
+func TestLiveDisplay_NoAnimationPrintsTransitions(t *testing.T) {
+	t.Setenv("TERM", "xterm-256color")
+
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+	d.SetAnimation(false)
+	d.SetProgressInterval(time.Hour)
+
+	d.Start()
+	d.SetStepRunning(0)
+	d.SetStepComplete(0, 0.04, 12*time.Second, 100, true)
+	d.SetStepRunning(1)
+	d.SetStepComplete(1, 0.5, 90*time.Second, 100, false)
+	d.SetStepSkipped(2)
+	d.Stop()
+
+	got := buf.String()
+	if strings.Contains(got, "\033") {
+		t.Errorf("output contains escape codes: %q", got)
+	}
+	for _, line := range []string{
+		"[1/3] analyze (claude) started",
+		"[1/3] analyze (claude) success $0.04 12s",
+		"[2/3] implement (codex) started",
+		"[2/3] implement (codex) failure $0.50 1m 30s",
+		"[3/3] check (gemini) skipped",
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, got)
+		}
+	}
+
+	// Turning animation back on restores the animated display on a capable writer
+	d = newTestLiveDisplay(&bytes.Buffer{})
+	d.SetAnimation(false)
+	d.SetAnimation(true)
+	if d.plain {
+		t.Error("SetAnimation(true) should leave plain mode")
+	}
+}
+
+func TestIsDumbTerminal(t *testing.T) {
+	t.Setenv("TERM", "xterm-256color")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if !isDumbTerminal(f) {
+		t.Error("a regular file should not be treated as a terminal")
+	}
+	if isDumbTerminal(&bytes.Buffer{}) {
+		t.Error("non-file writers should keep the animated display")
+	}
+
+	t.Setenv("TERM", "dumb")
+	if !isDumbTerminal(&bytes.Buffer{}) {
+		t.Error("TERM=dumb should force plain mode")
+	}
+}
+
+func TestLiveDisplay_RendersStepDescription(t *testing.T) {
+	render := func(b *bundle.Bundle) []string {
+		var buf bytes.Buffer
+		d := NewLiveDisplay(b, "job-1", map[string]string{})
+		d.SetOutput(&buf)
+		d.mu.Lock()
+		d.render()
+		d.mu.Unlock()
+		return strings.Split(stripAnsi(buf.String()), "\n")
+	}
+
+	plain := render(&bundle.Bundle{Name: "docs", Steps: []bundle.Step{
+		{Name: "analyze", Tool: "claude"},
+		{Name: "report", Tool: "gemini"},
+	}})
+	described := render(&bundle.Bundle{Name: "docs", Steps: []bundle.Step{
+		{Name: "analyze", Tool: "claude", Description: "Map the package structure"},
+		{Name: "report", Tool: "gemini"},
+	}})
+
+	var analyzeLine int
+	for i, line := range described {
+		if strings.Contains(line, "analyze") {
+			analyzeLine = i
+			break
+		}
+	}
+	if got := strings.TrimRight(described[analyzeLine+1], " "); !strings.HasPrefix(got, "     Map the package structure") {
+		t.Errorf("description should follow the step line, got %q", got)
+	}
+	if !strings.Contains(described[analyzeLine+2], "report") {
+		t.Errorf("next step should follow the description, got %q", described[analyzeLine+2])
+	}
+	if len(described) != len(plain)+1 {
+		t.Errorf("description should add exactly one line: %d vs %d", len(described), len(plain))
+	}
+}
+
+// writeStepLog writes a step's log with the given lines
+func writeStepLog(t *testing.T, dir, step string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, step+".log"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLiveDisplay_AddOutput(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+	logDir := t.TempDir()
+	d.SetLogDir(logDir)
+	d.SetScrollback(2)
+	writeStepLog(t, logDir, "analyze", []string{"from the log"})
+
+	d.SetStepRunning(0)
+	d.AddOutput(0, "\x1b[37mreading files\x1b[0m")
+	d.AddOutput(0, "   ")
+	d.AddOutput(0, "writing code")
+	d.AddOutput(0, "running tests")
+	d.AddOutput(7, "out of range")
+	d.SetStepComplete(0, 0.1, time.Second, 10, true)
+
+	// Streamed lines are kept instead of the log's
+	want := []string{"writing code", "running tests"}
+	if got := d.DumpOutput(0); !slices.Equal(got, want) {
+		t.Errorf("DumpOutput = %q, want %q", got, want)
+	}
+}
+
+// outputDisplay is a recordingDisplay that also shows running output
+type outputDisplay struct {
+	*recordingDisplay
+	outMu sync.Mutex
+	lines []string
+}
+
+func (d *outputDisplay) AddOutput(stepIndex int, line string) {
+	d.outMu.Lock()
+	defer d.outMu.Unlock()
+	d.lines = append(d.lines, fmt.Sprintf("%d %s", stepIndex, line))
+}
+
+func TestRun_StreamsOutputToDisplay(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	d := &outputDisplay{recordingDisplay: newRecordingDisplay()}
+	o := &Orchestrator{display: d, dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		ctx.ReportOutput(step.Name, "working on "+step.Name)
+		if step.Name == "review" {
+			ctx.ReportOutput("review-substep", "nested line")
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+
+	b := &bundle.Bundle{Name: "output", Steps: []bundle.Step{
+		{Name: "build", Tool: "claude"},
+		{Name: "review", Tool: "claude"},
+	}}
+	if _, err := o.Run(b, map[string]string{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// A substep's lines go to the top-level step running it
+	want := []string{"0 working on build", "1 working on review", "1 nested line"}
+	if !slices.Equal(d.lines, want) {
+		t.Errorf("AddOutput calls = %q, want %q", d.lines, want)
+	}
+}
+
+func TestLiveDisplay_ScrollbackKeepsLatestLines(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+	logDir := t.TempDir()
+	d.SetLogDir(logDir)
+	d.SetScrollback(3)
+
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i), "", "{")
+	}
+	writeStepLog(t, logDir, "analyze", lines)
+
+	d.SetStepRunning(0)
+	d.SetStepComplete(0, 0.1, time.Second, 10, true)
+
+	got := d.DumpOutput(0)
+	want := []string{"line 8", "line 9", "line 10"}
+	if !slices.Equal(got, want) {
+		t.Errorf("DumpOutput = %q, want %q", got, want)
+	}
+
+	// Shrinking the scrollback trims what is kept
+	d.SetScrollback(1)
+	if got := d.DumpOutput(0); !slices.Equal(got, []string{"line 10"}) {
+		t.Errorf("after SetScrollback(1), DumpOutput = %q", got)
+	}
+	if d.DumpOutput(1) != nil || d.DumpOutput(9) != nil {
+		t.Error("steps without output should dump nothing")
+	}
+}
+
+func TestLiveDisplay_DefaultScrollback(t *testing.T) {
+	var buf bytes.Buffer
+	d := newTestLiveDisplay(&buf)
+	logDir := t.TempDir()
+	d.SetLogDir(logDir)
+
+	var lines []string
+	for i := 1; i <= 2*DefaultScrollback; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	writeStepLog(t, logDir, "implement", lines)
+	d.SetStepRunning(1)
+	d.SetStepComplete(1, 0, time.Second, 0, false)
+
+	got := d.DumpOutput(1)
+	if len(got) != DefaultScrollback || got[0] != fmt.Sprintf("line %d", DefaultScrollback+1) || got[len(got)-1] != lines[len(lines)-1] {
+		t.Errorf("expected the last %d lines, got %d starting %q", DefaultScrollback, len(got), got[0])
+	}
+
+	// A running step's output is kept the same way, frame by frame
+	d.SetScrollback(0)
+	d.SetStepRunning(2)
+	writeStepLog(t, logDir, "check", []string{"checking", "almost done"})
+	d.mu.Lock()
+	d.captureOutput(2)
+	d.mu.Unlock()
+	if got := d.DumpOutput(2); !slices.Equal(got, []string{"checking", "almost done"}) {
+		t.Errorf("running step output = %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+package orchestrator
+
+import (
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+// buildManifest records a run for its job directory's manifest: the steps
+// that produced a result, in bundle order with parallel substeps after their
+// group, and the run's outcome from env or, without one, err
+func buildManifest(jobID string, b *bundle.Bundle, inputs map[string]string, ctx *Context, env *envelope.Envelope, err error) *workspace.Manifest {
+	m := &workspace.Manifest{
+		JobID:  jobID,
+		Bundle: b.Name,
+		Inputs: inputs,
+		Steps:  []workspace.ManifestStep{},
+	}
+	switch {
+	case env != nil:
+		m.Status = string(env.Status)
+		if env.Error != nil {
+			m.Error = env.Error.Message
+		}
+	case err != nil:
+		m.Status = string(envelope.StatusFailure)
+		m.Error = err.Error()
+	}
+	var add func(steps []bundle.Step)
+	add = func(steps []bundle.Step) {
+		for i := range steps {
+			if result, ok := ctx.GetResult(steps[i].Name); ok && result != nil {
+				m.Steps = append(m.Steps, manifestStep(&steps[i], result))
+			}
+			add(steps[i].Parallel)
+		}
+	}
+	add(b.Steps)
+	return m
+}
+
+// manifestStep keeps the parts of a step's envelope worth auditing
+func manifestStep(step *bundle.Step, env *envelope.Envelope) workspace.ManifestStep {
+	s := workspace.ManifestStep{
+		Name:      step.Name,
+		Status:    string(env.Status),
+		Tool:      step.Tool,
+		OutputRef: env.OutputRef,
+		Result:    env.Result,
+	}
+	if env.Metrics != nil {
+		if env.Metrics.Tool != "" {
+			s.Tool = env.Metrics.Tool
+		}
+		s.DurationMs = env.Metrics.DurationMs
+	}
+	if s.DurationMs == 0 {
+		if ms, ok := resultNumber(env.Result["duration_ms"]); ok {
+			s.DurationMs = int64(ms)
+		}
+	}
+	if cost, ok := resultNumber(env.Result["cost_usd"]); ok {
+		s.CostUSD = cost
+	}
+	if env.Error != nil {
+		s.Error = env.Error.Message
+	}
+	return s
+}
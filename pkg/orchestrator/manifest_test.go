@@ -0,0 +1,102 @@
+package orchestrator
+
+import (
+	"reflect"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+func TestRun_WritesManifest(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().
+			WithTool(step.Tool).
+			WithDuration(1200).
+			WithResult("cost_usd", 0.25).
+			WithOutputRef("/out/" + step.Name + ".json").
+			Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name: "manifest-test",
+		Steps: []bundle.Step{
+			{Name: "analyze", Tool: "claude"},
+			{Name: "optional", Tool: "codex", If: "${steps.analyze.status} == 'failure'"},
+			{Name: "report", Tool: "gemini"},
+		},
+	}
+	env, err := o.Run(b, map[string]string{"codebase": "demo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jobID, _ := env.Result["job_id"].(string)
+	m, err := workspace.LoadManifest(jobID)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if m.JobID != jobID || m.Bundle != "manifest-test" || m.Inputs["codebase"] != "demo" || m.Status != "success" {
+		t.Errorf("manifest header = %+v", m)
+	}
+	result := map[string]interface{}{"cost_usd": 0.25}
+	want := []workspace.ManifestStep{
+		{Name: "analyze", Status: "success", Tool: "claude", CostUSD: 0.25, DurationMs: 1200, OutputRef: "/out/analyze.json", Result: result},
+		{Name: "optional", Status: "skipped", Tool: "codex"},
+		{Name: "report", Status: "success", Tool: "gemini", CostUSD: 0.25, DurationMs: 1200, OutputRef: "/out/report.json", Result: result},
+	}
+	if len(m.Steps) != len(want) {
+		t.Fatalf("got %d manifest steps, want %d: %+v", len(m.Steps), len(want), m.Steps)
+	}
+	for i, w := range want {
+		if !reflect.DeepEqual(m.Steps[i], w) {
+			t.Errorf("step %d = %+v, want %+v", i, m.Steps[i], w)
+		}
+	}
+}
+
+func TestRun_WritesManifestOnFailure(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "build" {
+			return envelope.New().Failure("TOOL_ERROR", "exit status 1").Build(), nil
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name: "manifest-fail",
+		Steps: []bundle.Step{
+			{Name: "prepare", Tool: "claude"},
+			{Name: "build", Tool: "claude"},
+			{Name: "never", Tool: "claude"},
+		},
+	}
+	if _, err := o.Run(b, nil); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+
+	jobs, err := workspace.ListJobs(workspace.DefaultBaseDir(), nil)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("expected one job, got %v (%v)", jobs, err)
+	}
+	m, err := workspace.LoadManifest(jobs[0].JobID)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if m.Status != "failure" {
+		t.Errorf("manifest status = %q, want failure", m.Status)
+	}
+	if len(m.Steps) != 2 || m.Steps[0].Name != "prepare" || m.Steps[1].Name != "build" {
+		t.Fatalf("manifest should list the steps that ran, got %+v", m.Steps)
+	}
+	if m.Steps[1].Status != "failure" || m.Steps[1].Error != "exit status 1" {
+		t.Errorf("failed step = %+v", m.Steps[1])
+	}
+}
@@ -3,16 +3,21 @@
 package orchestrator
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"rcodegen/pkg/bundle"
 	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/lock"
 	"rcodegen/pkg/runner"
 	"rcodegen/pkg/settings"
 	"rcodegen/pkg/tools/claude"
@@ -51,34 +56,231 @@ type Display interface {
 	PrintFinalSummary(totalCost float64, totalInputTokens, totalOutputTokens int, cacheRead, cacheWrite int)
 }
 
+// quietDisplay shows nothing, for runs followed through their events
+type quietDisplay struct{}
+
+func (quietDisplay) Start()                                                 {}
+func (quietDisplay) Stop()                                                  {}
+func (quietDisplay) SetStepRunning(int)                                     {}
+func (quietDisplay) SetStepModel(int, string)                               {}
+func (quietDisplay) SetStepComplete(int, float64, time.Duration, int, bool) {}
+func (quietDisplay) SetStepSkipped(int)                                     {}
+func (quietDisplay) PrintFinalSummary(float64, int, int, int, int)          {}
+
+// outputAdder is implemented by displays that show a step's output while
+// it is still running
+type outputAdder interface {
+	AddOutput(stepIndex int, line string)
+}
+
 // DispatcherFactory creates a dispatcher from a tool registry.
 // This is set by the executor package to break the circular dependency.
 var DispatcherFactory func(tools map[string]runner.Tool) StepExecutor
 
 type Orchestrator struct {
-	settings   *settings.Settings
-	dispatcher StepExecutor
-	tools      map[string]runner.Tool
-	liveMode   bool
-	opusOnly   bool
-	flashOnly  bool
+	settings    *settings.Settings
+	dispatcher  StepExecutor
+	tools       map[string]runner.Tool
+	liveMode    bool
+	noAnimation bool // Live display prints plain lines even on a terminal
+	opusOnly    bool
+	flashOnly   bool
+
+	batchConcurrency int                   // Max simultaneous runs in RunBatch
+	timeout          time.Duration         // Whole-run timeout (0 = none)
+	display          Display               // Overrides the live/static display when set
+	eventStream      io.Writer             // Receives the run's events as JSON lines (nil = none)
+	observers        []Observer            // Receive the events of every run
+	spanExporter     SpanExporter          // Receives each run's trace (nil = not traced)
+	control          *Controller           // Aborts running steps on request
+	useLock          bool                  // Queue behind runs of the same bundle on the same codebase
+	toolModels       map[string]string     // Tool name -> model for steps that don't set one
+	sandbox          bool                  // Run tools in a copy of the codebase
+	store            workspace.OutputStore // Where step outputs are written and read (nil = local disk)
+	confirmIn        io.Reader             // Answers to the pre-run confirmation (nil = don't ask)
+	confirmOut       io.Writer             // Where the plan and confirmation prompt are shown
+	dryRun           io.Writer             // Plan instead of running, printing the plan here (nil = run)
+	resumeJob        string                // Job whose successful steps are reused (empty = run all)
 }
 
+// parallelDepthSetter is implemented by dispatchers that limit how deeply
+// parallel blocks may nest
+type parallelDepthSetter interface {
+	SetMaxParallelDepth(depth int)
+}
+
+// promptWarnSetter is implemented by dispatchers that warn about
+// oversized resolved prompts
+type promptWarnSetter interface {
+	SetPromptWarnTokens(tokens int)
+}
+
+// systemPromptSetter is implemented by dispatchers that pass per-tool
+// system prompt files to the tools
+type systemPromptSetter interface {
+	SetSystemPromptFiles(files map[string]string)
+}
+
+// errRunTimeout is returned by executeStep when the whole-run timeout fires
+var errRunTimeout = errors.New("run timed out")
+
 // SetLiveMode enables or disables the animated live display
 func (o *Orchestrator) SetLiveMode(enabled bool) {
 	o.liveMode = enabled
 }
 
+// SetNoAnimation makes the live display print a plain line per step
+// transition instead of animating, even on a terminal
+func (o *Orchestrator) SetNoAnimation(enabled bool) {
+	o.noAnimation = enabled
+}
+
 // SetOpusOnly forces all Claude steps to use Opus model
 func (o *Orchestrator) SetOpusOnly(enabled bool) {
 	o.opusOnly = enabled
 }
 
+// SetToolModels sets per-tool default models for the run (tool name -> model).
+// They apply only to steps, including parallel substeps and branches, that
+// don't specify a model themselves.
+func (o *Orchestrator) SetToolModels(models map[string]string) {
+	o.toolModels = models
+}
+
 // SetFlashOnly forces all Gemini steps to use flash preview model
 func (o *Orchestrator) SetFlashOnly(enabled bool) {
 	o.flashOnly = enabled
 }
 
+// SetTimeout limits the whole run. When it fires, the run stops with a
+// partial summary of the costs incurred so far (0 disables the limit).
+func (o *Orchestrator) SetTimeout(d time.Duration) {
+	o.timeout = d
+}
+
+// SetLock makes runs wait for any other run of the same bundle on the
+// same codebase to finish; other bundles and codebases are not blocked
+func (o *Orchestrator) SetLock(enabled bool) {
+	o.useLock = enabled
+}
+
+// SetDisplay replaces the built-in live/static display, e.g. for tests
+// or when embedding the orchestrator in another UI
+func (o *Orchestrator) SetDisplay(d Display) {
+	o.display = d
+}
+
+// SetEventStream writes every run event to w as a line of JSON, such as
+// {"event":"step_start","step":"build","tool":"codex",...}, for a dashboard
+// or script to follow. The display and printed summary are turned off so w
+// can be stdout.
+func (o *Orchestrator) SetEventStream(w io.Writer) {
+	o.eventStream = w
+}
+
+// textOutput is where Run prints its summary: stdout, or nowhere when the
+// run's events are streamed instead
+func (o *Orchestrator) textOutput() io.Writer {
+	if o.eventStream != nil {
+		return io.Discard
+	}
+	return os.Stdout
+}
+
+// SetOutputStore writes step outputs to store instead of the job directory
+// on local disk; references to them are read back through the same store
+func (o *Orchestrator) SetOutputStore(store workspace.OutputStore) {
+	o.store = store
+}
+
+// executeStep runs the top-level step name (or its chosen branch, step) through the dispatcher under a step
+// context derived from runCtx. It gives up with errRunTimeout if runCtx
+// expires first, or errStepAborted if the step is aborted through the
+// Controller. Either way ctx.Done() closes so executors kill the step's
+// processes; a result reported within cancelGrace (typically referencing the
+// step's partial output) is returned with the error, anything later is
+// discarded.
+func (o *Orchestrator) executeStep(runCtx context.Context, name string, step *bundle.Step, ctx *Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	stepCtx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	control := o.Controller()
+	defer control.end(control.begin(name, cancel))
+	ctx.setDone(stepCtx.Done())
+
+	type result struct {
+		env *envelope.Envelope
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		env, err := o.dispatcher.Execute(step, ctx, ws)
+		done <- result{env, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.env, r.err
+	case <-stepCtx.Done():
+		err := errStepAborted
+		if runCtx.Err() != nil {
+			err = errRunTimeout
+		}
+		select {
+		case r := <-done:
+			return r.env, err
+		case <-time.After(cancelGrace):
+			return nil, err
+		}
+	}
+}
+
+// withToolModels returns step with the run's per-tool models filled in where
+// the step, or any of its parallel substeps or branches, has no model of its
+// own. step is returned unchanged when no per-tool models are set.
+func (o *Orchestrator) withToolModels(step *bundle.Step) *bundle.Step {
+	if len(o.toolModels) == 0 || step == nil {
+		return step
+	}
+	c := *step
+	if c.Model == "" && c.Tool != "" {
+		c.Model = o.toolModels[c.Tool]
+	}
+	if len(step.Parallel) > 0 {
+		c.Parallel = make([]bundle.Step, len(step.Parallel))
+		for i := range step.Parallel {
+			c.Parallel[i] = *o.withToolModels(&step.Parallel[i])
+		}
+	}
+	c.Then = o.withToolModels(step.Then)
+	c.Else = o.withToolModels(step.Else)
+	c.Do = o.withToolModels(step.Do)
+	return &c
+}
+
+// cancelGrace is how long executeStep waits for a cancelled step to stop
+// and report its partial output
+const cancelGrace = time.Second
+
+// abortedEnvelope is the result of a step aborted through the Controller,
+// referencing the output the step produced before it was stopped, if any
+func abortedEnvelope(step *bundle.Step, partial *envelope.Envelope) *envelope.Envelope {
+	b := envelope.New().
+		WithTool(step.Tool).
+		Failure(StepAbortedCode, "step "+step.Name+" was aborted")
+	if ref := partialOutputRef(partial); ref != "" {
+		b.WithOutputRef(ref).WithResult("partial_output", true)
+	}
+	return b.Build()
+}
+
+// partialOutputRef returns the output reference of a stopped step's envelope
+func partialOutputRef(partial *envelope.Envelope) string {
+	if partial == nil {
+		return ""
+	}
+	return partial.OutputRef
+}
+
 func New(s *settings.Settings) *Orchestrator {
 	// Build tool registry
 	tools := map[string]runner.Tool{
@@ -91,12 +293,27 @@ func New(s *settings.Settings) *Orchestrator {
 	if DispatcherFactory != nil {
 		dispatcher = DispatcherFactory(tools)
 	}
+	if d, ok := dispatcher.(parallelDepthSetter); ok && s != nil && s.MaxParallelDepth > 0 {
+		d.SetMaxParallelDepth(s.MaxParallelDepth)
+	}
+	if d, ok := dispatcher.(promptWarnSetter); ok && s != nil && s.PromptWarnTokens != 0 {
+		d.SetPromptWarnTokens(s.PromptWarnTokens)
+	}
+	if d, ok := dispatcher.(systemPromptSetter); ok && s != nil {
+		if files := s.SystemPromptFiles(); len(files) > 0 {
+			d.SetSystemPromptFiles(files)
+		}
+	}
 
-	return &Orchestrator{
+	o := &Orchestrator{
 		settings:   s,
 		dispatcher: dispatcher,
 		tools:      tools,
 	}
+	if endpoint := otlpEndpoint(s); endpoint != "" {
+		o.spanExporter = NewOTLPExporter(endpoint)
+	}
+	return o
 }
 
 // getStepModel returns the model that will be used for a step
@@ -113,6 +330,10 @@ func (o *Orchestrator) getStepModel(toolName, stepModel string) string {
 	if stepModel != "" {
 		return stepModel
 	}
+	// Use the run's model for this tool
+	if model := o.toolModels[toolName]; model != "" {
+		return model
+	}
 	// Use tool's default model
 	if tool, ok := o.tools[toolName]; ok {
 		return tool.DefaultModel()
@@ -123,12 +344,17 @@ func (o *Orchestrator) getStepModel(toolName, stepModel string) string {
 func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelope.Envelope, error) {
 	start := time.Now()
 
-	// Validate required inputs and apply defaults
+	if err := b.Validate(); err != nil {
+		return envelope.New().Failure("INVALID_BUNDLE", err.Error()).Build(), err
+	}
+
+	// Validate required inputs and apply defaults; a required input whose
+	// show_if condition does not hold is not needed
 	for _, input := range b.Inputs {
 		if _, ok := inputs[input.Name]; !ok {
 			if input.Default != "" {
 				inputs[input.Name] = input.Default
-			} else if input.Required {
+			} else if input.Required && inputShown(input, inputs) {
 				return envelope.New().
 					Failure("MISSING_INPUT", "Required input: "+input.Name).
 					Build(), nil
@@ -143,16 +369,73 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 		}
 	}
 
-	// Create workspace
-	home, err := os.UserHomeDir()
-	if err != nil {
-		home = os.Getenv("HOME")
+	// Dry runs report what would run without starting anything
+	if o.dryRun != nil {
+		plan := o.dryRunPlan(b, inputs)
+		writeDryRun(o.dryRun, b, plan)
+		return envelope.New().Success().
+			WithResult("dry_run", true).
+			WithResult("plan", plan).
+			WithDuration(time.Since(start).Milliseconds()).
+			Build(), nil
+	}
+
+	// Expensive runs need the user's go-ahead
+	if ok, err := o.confirmRun(b); err != nil {
+		return envelope.New().Failure("CONFIRM_ERROR", err.Error()).Build(), err
+	} else if !ok {
+		return envelope.New().Failure("DECLINED", "run of "+b.Name+" declined at confirmation").Build(), nil
+	}
+
+	// Queue behind identical runs (same bundle and codebase)
+	if o.useLock {
+		codebase := inputs["codebase"]
+		fl, err := lock.AcquireNamed(lock.BundleLockName(b.Name, codebase), b.Name+" on "+lock.GetIdentifier(codebase))
+		if err != nil {
+			return envelope.New().Failure("LOCK_ERROR", err.Error()).Build(), err
+		}
+		defer fl.Release()
 	}
-	wsDir := filepath.Join(home, ".rcodegen", "workspace")
-	ws, err := workspace.New(wsDir)
+
+	// Reuse what a previous job of this bundle already did
+	var resumed map[string]*envelope.Envelope
+	if o.resumeJob != "" {
+		var err error
+		if resumed, err = resumedSteps(o.resumeJob, b); err != nil {
+			return envelope.New().Failure("RESUME_ERROR", err.Error()).Build(), err
+		}
+	}
+
+	// Create workspace
+	ws, err := workspace.New(workspace.DefaultBaseDir())
 	if err != nil {
 		return envelope.New().Failure("WORKSPACE_ERROR", err.Error()).Build(), err
 	}
+	if o.settings != nil {
+		ws.PersistFormat = o.settings.PersistFormat
+	}
+	ws.Store = o.store
+
+	// Sandboxed runs point the tools at a copy of the codebase
+	var realCodebase, sandboxDir string
+	if o.sandbox {
+		realCodebase = inputs["codebase"]
+		if realCodebase == "" {
+			realCodebase, _ = os.Getwd()
+		}
+		sandboxDir = filepath.Join(ws.JobDir, SandboxDirName)
+		// A codebase holding the workspace (a run from $HOME) must not copy
+		// the sandbox into itself
+		if err := copyTree(realCodebase, sandboxDir, ws.BaseDir, ws.JobDir); err != nil {
+			return envelope.New().Failure("SANDBOX_ERROR", err.Error()).Build(), err
+		}
+		sandboxed := make(map[string]string, len(inputs))
+		for k, v := range inputs {
+			sandboxed[k] = v
+		}
+		sandboxed["codebase"] = sandboxDir
+		inputs = sandboxed
+	}
 
 	// For article bundles, create a timestamped output directory
 	var outputDir string
@@ -172,14 +455,53 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 
 	// Initialize display (live animated or static)
 	var display Display
-	if o.liveMode {
+	if o.display != nil {
+		display = o.display
+	} else if o.eventStream != nil {
+		display = quietDisplay{}
+	} else if o.liveMode {
 		ld := NewLiveDisplay(b, ws.JobID, inputs)
 		ld.SetLogDir(filepath.Join(ws.JobDir, "logs"))
+		if o.noAnimation {
+			ld.SetAnimation(false)
+		}
+		if o.settings != nil {
+			ld.SetScrollback(o.settings.LiveScrollback)
+		}
 		display = ld
 	} else {
 		display = NewProgressDisplay(b, ws.JobID, inputs)
 	}
 
+	text := o.textOutput()
+	costFmt := o.costFormatter()
+	if cd, ok := display.(costFormatSetter); ok {
+		cd.SetCostFormatter(costFmt)
+	}
+	if td, ok := display.(tokenBudgetSetter); ok && o.settings != nil && o.settings.TokenBudget > 0 {
+		td.SetTokenBudget(o.settings.TokenBudget)
+	}
+
+	// Every run writes its events to the job's event log; the display is
+	// driven by the same events
+	bus := &eventBus{jobID: ws.JobID, bundle: b.Name}
+	warnings := &runWarnings{}
+	if log, err := newEventLog(filepath.Join(ws.JobDir, EventLogFile)); err == nil {
+		defer log.Close()
+		bus.observers = append(bus.observers, log)
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: failed to create event log: %v\n", err)
+		warnings.add("failed to create event log: %v", err)
+	}
+	bus.observers = append(bus.observers, displayObserver{display})
+	bus.observers = append(bus.observers, o.observers...)
+	if o.eventStream != nil {
+		bus.observers = append(bus.observers, eventStream{enc: json.NewEncoder(o.eventStream)})
+	}
+	if o.spanExporter != nil {
+		bus.observers = append(bus.observers, newTracer(o.spanExporter))
+	}
+
 	// Set models for ALL steps upfront so they show immediately
 	for i, step := range b.Steps {
 		display.SetStepModel(i, o.getStepModel(step.Tool, step.Model))
@@ -187,70 +509,298 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 
 	display.Start()
 	defer display.Stop()
+	bus.emit(Event{Type: EventRunStart, Steps: len(b.Steps)})
 
 	// Create context
 	ctx := NewContext(inputs)
+	ctx.SetConstants(b.Constants)
+	ctx.SetTemplateEngine(b.TemplateEngine)
+	ctx.SetStrictConditions(b.StrictConditions)
+	ctx.SetOutputStore(ws.OutputStore())
 
 	// Track costs
+	var live *liveCost
+	if cu, ok := display.(costUpdater); ok {
+		live = &liveCost{display: cu}
+		ctx.setCostReporter(live.report)
+	}
+
+	// Stream running output to the display; top-level steps run one at a
+	// time, so a substep's lines belong to the step in progress
+	var running atomic.Int64
+	if oa, ok := display.(outputAdder); ok {
+		ctx.SetOutputReporter(func(_, line string) { oa.AddOutput(int(running.Load()), line) })
+	}
 	var totalCost float64
 	var totalInputTokens, totalOutputTokens int
 	var totalCacheRead, totalCacheWrite int
 	var stepStats []StepStats
 
+	// Where a failed run stopped, for its resume token
+	var lastCompleted, resumeFrom string
+	// Steps that only partly succeeded make the whole run partial
+	var partialSteps []string
+
+	// finish records the run's outcome in the event log and the job's
+	// manifest before returning; failed runs first run the bundle's
+	// on_failure step and get a resume token pointing at the step to re-run,
+	// and every run gets the warnings it collected
+	finish := func(env *envelope.Envelope, err error) (*envelope.Envelope, error) {
+		if env != nil && env.Status == envelope.StatusFailure && b.OnFailure != nil && resumeFrom != "" {
+			env = o.runOnFailure(b.OnFailure, resumeFrom, env, err, ctx, ws, warnings, text)
+		}
+		if env != nil && env.Status == envelope.StatusFailure && resumeFrom != "" {
+			env = withResumeToken(env, ResumeToken{
+				JobID:         ws.JobID,
+				Bundle:        b.Name,
+				LastCompleted: lastCompleted,
+				ResumeFrom:    resumeFrom,
+			})
+		}
+		if env != nil && sandboxDir != "" {
+			if changes, derr := diffTrees(realCodebase, sandboxDir, ws.BaseDir, ws.JobDir); derr == nil {
+				env = withSandboxChanges(env, sandboxDir, changes)
+			} else {
+				fmt.Fprintf(os.Stderr, "Warning: failed to diff sandbox: %v\n", derr)
+				warnings.add("failed to diff sandbox: %v", derr)
+			}
+		}
+		if env != nil {
+			env = withWarnings(env, warnings.all())
+		}
+		e := Event{
+			Type:             EventRunComplete,
+			CostUSD:          totalCost,
+			InputTokens:      totalInputTokens,
+			OutputTokens:     totalOutputTokens,
+			CacheReadTokens:  totalCacheRead,
+			CacheWriteTokens: totalCacheWrite,
+			DurationMs:       time.Since(start).Milliseconds(),
+		}
+		if env != nil {
+			e.Status = string(env.Status)
+			if env.Error != nil {
+				e.Error = env.Error.Message
+			}
+		} else if err != nil {
+			e.Status = string(envelope.StatusFailure)
+			e.Error = err.Error()
+		}
+		bus.emit(e)
+		if _, merr := ws.WriteManifest(buildManifest(ws.JobID, b, inputs, ctx, env, err)); merr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write manifest: %v\n", merr)
+		}
+		return env, err
+	}
+
+	runCtx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, o.timeout)
+		defer cancel()
+	}
+
+	// timedOut ends the run after the whole-run timeout fires: the step that
+	// was running is marked failed, the rest skipped, and the summary shows
+	// the totals of the steps that did complete.
+	timedOut := func(index int, running bool, stepStart time.Time, partial *envelope.Envelope) (*envelope.Envelope, error) {
+		if running {
+			bus.emit(Event{
+				Type:       EventStepComplete,
+				Step:       b.Steps[index].Name,
+				Index:      index,
+				Tool:       b.Steps[index].Tool,
+				Status:     string(envelope.StatusFailure),
+				Error:      "run timed out",
+				DurationMs: time.Since(stepStart).Milliseconds(),
+			})
+			index++
+		}
+		for j := index; j < len(b.Steps); j++ {
+			bus.emit(Event{Type: EventStepSkipped, Step: b.Steps[j].Name, Index: j})
+		}
+		display.PrintFinalSummary(totalCost, totalInputTokens, totalOutputTokens, totalCacheRead, totalCacheWrite)
+		fmt.Fprintf(text, "  %sTimed out after %s.%s Output: %s\n\n", colorRed, o.timeout, colorReset, ws.JobDir)
+
+		builder := envelope.New().
+			Failure(envelope.CodeRunTimeout, fmt.Sprintf("run exceeded timeout of %s", o.timeout)).
+			WithResult("job_id", ws.JobID)
+		if ref := partialOutputRef(partial); ref != "" {
+			// Output the interrupted step produced before it was stopped
+			builder.WithResult("partial_output_ref", ref)
+		}
+		return finish(builder.
+			WithResult("completed_steps", len(stepStats)).
+			WithResult("total_cost_usd", totalCost).
+			WithResult("input_tokens", totalInputTokens).
+			WithResult("output_tokens", totalOutputTokens).
+			WithResult("cache_read_tokens", totalCacheRead).
+			WithResult("cache_write_tokens", totalCacheWrite).
+			WithDuration(time.Since(start).Milliseconds()).
+			Build(), fmt.Errorf("run timed out after %s", o.timeout))
+	}
+
+	// overBudget ends the run before step index once the completed steps
+	// have used the settings' token_budget: the remaining steps are skipped
+	// and the run fails with BUDGET_EXCEEDED, resumable from that step
+	var tokenBudget int
+	if o.settings != nil {
+		tokenBudget = o.settings.TokenBudget
+	}
+	overBudget := func(index int) (*envelope.Envelope, error) {
+		for j := index; j < len(b.Steps); j++ {
+			bus.emit(Event{Type: EventStepSkipped, Step: b.Steps[j].Name, Index: j})
+		}
+		used := totalInputTokens + totalOutputTokens
+		display.PrintFinalSummary(totalCost, totalInputTokens, totalOutputTokens, totalCacheRead, totalCacheWrite)
+		fmt.Fprintf(text, "  %sToken budget of %d exceeded (%d used).%s Output: %s\n\n", colorRed, tokenBudget, used, colorReset, ws.JobDir)
+
+		return finish(envelope.New().
+			Failure(envelope.CodeBudgetExceeded, fmt.Sprintf("run used %d tokens of its %d token budget", used, tokenBudget)).
+			WithResult("job_id", ws.JobID).
+			WithResult("completed_steps", len(stepStats)).
+			WithResult("total_cost_usd", totalCost).
+			WithResult("input_tokens", totalInputTokens).
+			WithResult("output_tokens", totalOutputTokens).
+			WithResult("cache_read_tokens", totalCacheRead).
+			WithResult("cache_write_tokens", totalCacheWrite).
+			WithDuration(time.Since(start).Milliseconds()).
+			Build(), fmt.Errorf("token budget of %d exceeded", tokenBudget))
+	}
+
 	// Execute steps
+	resuming := resumed != nil
 	for i, step := range b.Steps {
 		stepStart := time.Now()
-		display.SetStepRunning(i)
-		// Set model immediately so it shows while running
-		display.SetStepModel(i, o.getStepModel(step.Tool, step.Model))
+		resumeFrom = step.Name
+		if runCtx.Err() != nil {
+			return timedOut(i, false, stepStart, nil)
+		}
+		if tokenBudget > 0 && totalInputTokens+totalOutputTokens >= tokenBudget {
+			return overBudget(i)
+		}
+		// A resumed run skips the steps its previous job completed, up to
+		// the first one that has to run again
+		if resuming {
+			if restoreStep(&step, resumed, ctx) {
+				bus.emit(Event{Type: EventStepSkipped, Step: step.Name, Index: i, Tool: step.Tool})
+				lastCompleted = step.Name
+				continue
+			}
+			resuming = false
+		}
+		running.Store(int64(i))
+		// Model is set immediately so it shows while running
+		bus.emit(Event{
+			Type:  EventStepStart,
+			Step:  step.Name,
+			Index: i,
+			Tool:  step.Tool,
+			Model: o.getStepModel(step.Tool, step.Model),
+		})
 
 		// Check condition
-		if step.If != "" && !EvaluateCondition(step.If, ctx) {
-			display.SetStepSkipped(i)
+		if !b.StrictConditions && step.If != "" {
+			warnings.checkCondition(&step, ctx)
+		}
+		holds, condErr := ctx.EvaluateIf(step.If)
+		if condErr != nil {
+			env := envelope.New().WithTool(step.Tool).Failure("CONDITION_ERROR", condErr.Error()).Build()
+			ctx.SetResult(step.Name, env)
+			bus.emit(Event{
+				Type:       EventStepComplete,
+				Step:       step.Name,
+				Index:      i,
+				Tool:       step.Tool,
+				Status:     string(env.Status),
+				Error:      condErr.Error(),
+				DurationMs: time.Since(stepStart).Milliseconds(),
+			})
+			return finish(env, condErr)
+		}
+		if step.If != "" && !holds {
+			bus.emit(Event{Type: EventStepSkipped, Step: step.Name, Index: i})
 			ctx.SetResult(step.Name, &envelope.Envelope{Status: envelope.StatusSkipped})
+			lastCompleted = step.Name
 			continue
 		}
 
 		// Handle conditional step
 		if step.Then != nil {
-			if EvaluateCondition(step.If, ctx) {
-				env, err := o.dispatcher.Execute(step.Then, ctx, ws)
-				ctx.SetResult(step.Name, env)
-				if err != nil {
-					return env, err
-				}
-			} else if step.Else != nil {
-				env, err := o.dispatcher.Execute(step.Else, ctx, ws)
-				ctx.SetResult(step.Name, env)
-				if err != nil {
-					return env, err
-				}
+			branch := step.Then
+			if !holds {
+				branch = step.Else
+			}
+			if branch == nil {
+				bus.emit(Event{Type: EventStepSkipped, Step: step.Name, Index: i})
+				lastCompleted = step.Name
+				continue
 			}
+			branch = o.withToolModels(SelectTool(branch, ctx))
+			warnings.checkTask(branch, ctx)
+			env, err := o.executeStep(runCtx, step.Name, branch, ctx, ws)
+			if errors.Is(err, errRunTimeout) {
+				return timedOut(i, true, stepStart, env)
+			}
+			aborted := errors.Is(err, errStepAborted)
+			if aborted {
+				env, err = abortedEnvelope(branch, env), nil
+			}
+			ctx.SetResult(step.Name, env)
+			warnings.addStepResult(branch, env, ctx)
+			if err != nil {
+				return finish(env, err)
+			}
+			complete := Event{
+				Type:       EventStepComplete,
+				Step:       step.Name,
+				Index:      i,
+				Tool:       branch.Tool,
+				Status:     string(env.Status),
+				DurationMs: time.Since(stepStart).Milliseconds(),
+			}
+			if env.Error != nil {
+				complete.Error = env.Error.Message
+			}
+			bus.emit(complete)
+			if aborted && step.OnAbort != bundle.OnAbortContinue {
+				return finish(env, fmt.Errorf("step %s aborted", step.Name))
+			}
+			lastCompleted = step.Name
 			continue
 		}
 
-		// Apply model overrides
-		execStep := &step
-		if o.opusOnly && step.Tool == "claude" {
+		// Apply tool rules and model overrides
+		execStep := o.withToolModels(SelectTool(&step, ctx))
+		if o.opusOnly && execStep.Tool == "claude" {
 			// Create a copy with opus model
-			stepCopy := step
+			stepCopy := *execStep
 			stepCopy.Model = "opus"
 			execStep = &stepCopy
 		}
-		if o.flashOnly && step.Tool == "gemini" {
+		if o.flashOnly && execStep.Tool == "gemini" {
 			// Create a copy with flash preview model
-			stepCopy := step
+			stepCopy := *execStep
 			stepCopy.Model = "gemini-3-flash-preview"
 			execStep = &stepCopy
 		}
 
 		// Execute step
-		env, err := o.dispatcher.Execute(execStep, ctx, ws)
+		warnings.checkTask(execStep, ctx)
+		env, err := o.executeStep(runCtx, step.Name, execStep, ctx, ws)
+		if errors.Is(err, errRunTimeout) {
+			return timedOut(i, true, stepStart, env)
+		}
+		aborted := errors.Is(err, errStepAborted)
+		if aborted {
+			env, err = abortedEnvelope(execStep, env), nil
+		}
 		if err != nil {
-			return env, err
+			return finish(env, err)
 		}
 
 		ctx.SetResult(step.Name, env)
+		warnings.addStepResult(execStep, env, ctx)
 
 		// Extract and display cost info
 		stepCost := 0.0
@@ -273,6 +823,9 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 		if t, ok := env.Result["cache_write_tokens"].(int); ok {
 			totalCacheWrite += t
 		}
+		if live != nil {
+			live.settle(totalCost)
+		}
 
 		// Extract model used
 		stepModel := ""
@@ -285,7 +838,7 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 		isParallel := len(step.Parallel) > 0
 		stepStats = append(stepStats, StepStats{
 			Name:         step.Name,
-			Tool:         step.Tool,
+			Tool:         execStep.Tool,
 			Model:        stepModel,
 			Parallel:     isParallel,
 			Cost:         stepCost,
@@ -294,21 +847,53 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 			Duration:     stepDuration,
 		})
 
-		// Update display
-		display.SetStepModel(i, stepModel)
-		success := env.Status != envelope.StatusFailure
-		display.SetStepComplete(i, stepCost, stepDuration, stepIn+stepOut, success)
+		complete := Event{
+			Type:         EventStepComplete,
+			Step:         step.Name,
+			Index:        i,
+			Tool:         execStep.Tool,
+			Model:        stepModel,
+			Status:       string(env.Status),
+			CostUSD:      stepCost,
+			InputTokens:  stepIn,
+			OutputTokens: stepOut,
+			DurationMs:   stepDuration.Milliseconds(),
+		}
+		if env.Error != nil {
+			complete.Error = env.Error.Message
+		}
+		bus.emit(complete)
 
+		if aborted && step.OnAbort == bundle.OnAbortContinue {
+			lastCompleted = step.Name
+			continue
+		}
 		if env.Status == envelope.StatusFailure {
-			return env, fmt.Errorf("step %s failed", step.Name)
+			return finish(env, fmt.Errorf("step %s failed", step.Name))
 		}
+		if env.Status == envelope.StatusPartial {
+			partialSteps = append(partialSteps, step.Name)
+		}
+		lastCompleted = step.Name
 	}
 
 	duration := time.Since(start)
 
+	// Surface the main artifact the run produced
+	primary := primaryOutput(artifactDirs(inputs, outputDir), start)
+	if primary == "" {
+		primary = lastOutputRef(b, ctx)
+	}
+
 	// Print summary
 	display.PrintFinalSummary(totalCost, totalInputTokens, totalOutputTokens, totalCacheRead, totalCacheWrite)
-	fmt.Printf("  %sOutput:%s %s\n\n", colorDim, colorReset, ws.JobDir)
+	writeWarnings(text, warnings.all())
+	if primary != "" {
+		fmt.Fprintf(text, "  %sOutput:%s %s%s%s\n", colorDim, colorReset, colorBold, primary, colorReset)
+		fmt.Fprintf(text, "  %sJob:%s    %s\n\n", colorDim, colorReset, ws.JobDir)
+	} else {
+		fmt.Fprintf(text, "  %sOutput:%s %s\n\n", colorDim, colorReset, ws.JobDir)
+	}
 
 	// Generate run report for article bundles
 	if strings.HasPrefix(b.Name, "article") && outputDir != "" {
@@ -316,29 +901,29 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 		generateRunReport(reportPath, ws.JobID, b.Name, duration, totalCost, stepStats, ctx, outputDir)
 
 		// Print final summary box
-		fmt.Printf("\n  %s╭─────────────────────────────────────────────────────────────────╮%s\n", colorMagenta, colorReset)
-		fmt.Printf("  %s│%s  %s✎ ARTICLES COMPLETE%s                                            %s│%s\n",
+		fmt.Fprintf(text, "\n  %s╭─────────────────────────────────────────────────────────────────╮%s\n", colorMagenta, colorReset)
+		fmt.Fprintf(text, "  %s│%s  %s✎ ARTICLES COMPLETE%s                                            %s│%s\n",
 			colorMagenta, colorReset, colorBold+colorMagenta, colorReset, colorMagenta, colorReset)
-		fmt.Printf("  %s╰─────────────────────────────────────────────────────────────────╯%s\n\n", colorMagenta, colorReset)
+		fmt.Fprintf(text, "  %s╰─────────────────────────────────────────────────────────────────╯%s\n\n", colorMagenta, colorReset)
 
 		// Print generated articles
 		articles := findArticleFilesInDir(outputDir)
 		if len(articles) > 0 {
-			fmt.Printf("  %sGenerated Articles:%s\n", colorCyan+colorBold, colorReset)
+			fmt.Fprintf(text, "  %sGenerated Articles:%s\n", colorCyan+colorBold, colorReset)
 			for _, a := range articles {
-				fmt.Printf("    %s✓%s %s%s%s\n", colorGreen, colorReset, colorWhite, filepath.Base(a), colorReset)
+				fmt.Fprintf(text, "    %s✓%s %s%s%s\n", colorGreen, colorReset, colorWhite, filepath.Base(a), colorReset)
 			}
-			fmt.Println()
+			fmt.Fprintln(text)
 		}
 
 		// Print cost and time with colors
-		fmt.Printf("  %sCost:%s        %s$%.2f%s\n",
+		fmt.Fprintf(text, "  %sCost:%s        %s%s%s\n",
 			colorCyan, colorReset,
-			colorGreen+colorBold, totalCost, colorReset)
-		fmt.Printf("  %sTime:%s        %s%s%s\n",
+			colorGreen+colorBold, costFmt.Format(totalCost), colorReset)
+		fmt.Fprintf(text, "  %sTime:%s        %s%s%s\n",
 			colorCyan, colorReset,
 			colorYellow, duration.Round(time.Second), colorReset)
-		fmt.Printf("  %sOutput:%s      %s%s%s\n\n",
+		fmt.Fprintf(text, "  %sOutput:%s      %s%s%s\n\n",
 			colorCyan, colorReset,
 			colorBlue, outputDir, colorReset)
 	}
@@ -355,6 +940,7 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 				if bundleData, err := os.ReadFile(b.SourcePath); err == nil {
 					if err := os.WriteFile(bundleDest, bundleData, 0644); err != nil {
 						fmt.Fprintf(os.Stderr, "Warning: failed to copy bundle to %s: %v\n", bundleDest, err)
+						warnings.add("failed to copy bundle to %s: %v", bundleDest, err)
 					}
 				}
 			}
@@ -377,16 +963,16 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 			)
 
 			// Print final summary box
-			fmt.Printf("\n  %s╭─────────────────────────────────────────────────────────────────╮%s\n", colorGreen, colorReset)
-			fmt.Printf("  %s│%s  %s✓ BUILD COMPLETE%s                                               %s│%s\n",
+			fmt.Fprintf(text, "\n  %s╭─────────────────────────────────────────────────────────────────╮%s\n", colorGreen, colorReset)
+			fmt.Fprintf(text, "  %s│%s  %s✓ BUILD COMPLETE%s                                               %s│%s\n",
 				colorGreen, colorReset, colorBold+colorGreen, colorReset, colorGreen, colorReset)
-			fmt.Printf("  %s╰─────────────────────────────────────────────────────────────────╯%s\n\n", colorGreen, colorReset)
+			fmt.Fprintf(text, "  %s╰─────────────────────────────────────────────────────────────────╯%s\n\n", colorGreen, colorReset)
 
 			// Extract and print overview from IMPLEMENTATION_SUMMARY.md
 			overview := extractOverviewFromSummary(filepath.Join(projectDir, "IMPLEMENTATION_SUMMARY.md"))
 			if overview != "" {
-				fmt.Printf("  %sOverview:%s\n", colorCyan+colorBold, colorReset)
-				fmt.Printf("  %s%s%s\n\n", colorWhite, overview, colorReset)
+				fmt.Fprintf(text, "  %sOverview:%s\n", colorCyan+colorBold, colorReset)
+				fmt.Fprintf(text, "  %s%s%s\n\n", colorWhite, overview, colorReset)
 			}
 
 			// Print grade if available
@@ -398,26 +984,26 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 				} else if grade.Score < 85 {
 					gradeColor = colorYellow
 				}
-				fmt.Printf("  %sGrade:%s       %s%s%s %s(%d/100)%s\n",
+				fmt.Fprintf(text, "  %sGrade:%s       %s%s%s %s(%d/100)%s\n",
 					colorCyan, colorReset,
 					gradeColor+colorBold, grade.Letter, colorReset,
 					colorDim, grade.Score, colorReset)
 			}
 
 			// Print cost and time with colors
-			fmt.Printf("  %sCost:%s        %s$%.2f%s\n",
+			fmt.Fprintf(text, "  %sCost:%s        %s%s%s\n",
 				colorCyan, colorReset,
-				colorGreen+colorBold, totalCost, colorReset)
-			fmt.Printf("  %sTime:%s        %s%s%s\n",
+				colorGreen+colorBold, costFmt.Format(totalCost), colorReset)
+			fmt.Fprintf(text, "  %sTime:%s        %s%s%s\n",
 				colorCyan, colorReset,
 				colorYellow, duration.Round(time.Second), colorReset)
-			fmt.Printf("  %sOutput:%s      %s%s%s\n\n",
+			fmt.Fprintf(text, "  %sOutput:%s      %s%s%s\n\n",
 				colorCyan, colorReset,
 				colorBlue, projectDir, colorReset)
 		}
 	}
 
-	return envelope.New().
+	result := envelope.New().
 		Success().
 		WithResult("steps", len(b.Steps)).
 		WithResult("job_id", ws.JobID).
@@ -426,8 +1012,18 @@ func (o *Orchestrator) Run(b *bundle.Bundle, inputs map[string]string) (*envelop
 		WithResult("output_tokens", totalOutputTokens).
 		WithResult("cache_read_tokens", totalCacheRead).
 		WithResult("cache_write_tokens", totalCacheWrite).
-		WithDuration(duration.Milliseconds()).
-		Build(), nil
+		WithDuration(duration.Milliseconds())
+	if primary != "" {
+		result.WithResult("primary_output", primary)
+	}
+	if len(partialSteps) > 0 {
+		result.WithResult("partial_steps", partialSteps)
+	}
+	env := result.Build()
+	if len(partialSteps) > 0 {
+		env.Status = envelope.StatusPartial
+	}
+	return finish(env, nil)
 }
 
 // generateRunReport creates a markdown report for article runs
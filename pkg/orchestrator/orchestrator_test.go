@@ -0,0 +1,503 @@
+package orchestrator
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+	"rcodegen/pkg/workspace"
+)
+
+// funcExecutor adapts a function to StepExecutor
+type funcExecutor func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error)
+
+func (f funcExecutor) Execute(step *bundle.Step, ctx *Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	return f(step, ctx)
+}
+
+// recordingDisplay is a Display that records step states and the final summary
+type recordingDisplay struct {
+	mu           sync.Mutex
+	states       map[int]StepState
+	summaryCalls int
+	summaryCost  float64
+	summaryIn    int
+	summaryOut   int
+	summaryCache [2]int // Cache read, cache write
+}
+
+func newRecordingDisplay() *recordingDisplay {
+	return &recordingDisplay{states: make(map[int]StepState)}
+}
+
+func (d *recordingDisplay) Start()                       {}
+func (d *recordingDisplay) Stop()                        {}
+func (d *recordingDisplay) SetStepModel(i int, m string) {}
+
+func (d *recordingDisplay) SetStepRunning(i int) { d.set(i, StepRunning) }
+func (d *recordingDisplay) SetStepSkipped(i int) { d.set(i, StepSkipped) }
+
+func (d *recordingDisplay) SetStepComplete(i int, cost float64, duration time.Duration, tokens int, success bool) {
+	if success {
+		d.set(i, StepSuccess)
+	} else {
+		d.set(i, StepFailure)
+	}
+}
+
+func (d *recordingDisplay) PrintFinalSummary(totalCost float64, totalInputTokens, totalOutputTokens int, cacheRead, cacheWrite int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.summaryCalls++
+	d.summaryCost = totalCost
+	d.summaryIn = totalInputTokens
+	d.summaryOut = totalOutputTokens
+	d.summaryCache = [2]int{cacheRead, cacheWrite}
+}
+
+func (d *recordingDisplay) set(i int, s StepState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.states[i] = s
+}
+
+func (d *recordingDisplay) state(i int) StepState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.states[i]
+}
+
+func TestRun_TimeoutPrintsPartialSummary(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "slow" {
+			<-release
+		}
+		return envelope.New().Success().
+			WithResult("cost_usd", 0.40).
+			WithResult("input_tokens", 1000).
+			WithResult("output_tokens", 200).
+			Build(), nil
+	})}
+	display := newRecordingDisplay()
+	o.SetDisplay(display)
+	o.SetTimeout(150 * time.Millisecond)
+
+	b := &bundle.Bundle{
+		Name: "timeout-test",
+		Steps: []bundle.Step{
+			{Name: "first", Tool: "claude"},
+			{Name: "second", Tool: "claude"},
+			{Name: "slow", Tool: "claude"},
+			{Name: "never", Tool: "claude"},
+		},
+	}
+
+	started := time.Now()
+	env, err := o.Run(b, map[string]string{})
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("Run did not return promptly after timeout (%s)", elapsed)
+	}
+	if err == nil {
+		t.Error("expected an error on timeout")
+	}
+	if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "RUN_TIMEOUT" {
+		t.Fatalf("expected RUN_TIMEOUT failure, got %+v", env)
+	}
+
+	if display.summaryCalls != 1 {
+		t.Fatalf("expected the final summary to be printed once, got %d", display.summaryCalls)
+	}
+	if display.summaryCost < 0.799 || display.summaryCost > 0.801 {
+		t.Errorf("partial summary cost = %v, want 0.80 from the two completed steps", display.summaryCost)
+	}
+	if display.summaryIn != 2000 || display.summaryOut != 400 {
+		t.Errorf("partial summary tokens = %d/%d, want 2000/400", display.summaryIn, display.summaryOut)
+	}
+	if cost, _ := env.Result["total_cost_usd"].(float64); cost < 0.799 || cost > 0.801 {
+		t.Errorf("envelope total cost = %v, want 0.80", cost)
+	}
+	if env.Result["completed_steps"] != 2 {
+		t.Errorf("completed_steps = %v, want 2", env.Result["completed_steps"])
+	}
+
+	wantStates := []StepState{StepSuccess, StepSuccess, StepFailure, StepSkipped}
+	for i, want := range wantStates {
+		if got := display.state(i); got != want {
+			t.Errorf("step %d state = %v, want %v", i, got, want)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for the live display's render goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRun_TimeoutLiveDisplaySummary(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "slow" {
+			<-release
+		}
+		return envelope.New().Success().WithResult("cost_usd", 1.25).Build(), nil
+	})}
+	b := &bundle.Bundle{
+		Name: "timeout-live",
+		Steps: []bundle.Step{
+			{Name: "done", Tool: "claude"},
+			{Name: "slow", Tool: "claude"},
+		},
+	}
+
+	var out syncBuffer
+	ld := NewLiveDisplay(b, "job", map[string]string{})
+	ld.SetOutput(&out)
+	o.SetDisplay(ld)
+	o.SetTimeout(150 * time.Millisecond)
+
+	if _, err := o.Run(b, map[string]string{}); err == nil {
+		t.Fatal("expected timeout error")
+	}
+
+	summary := stripAnsi(out.String())
+	if !strings.Contains(summary, "Cost: $1.25") {
+		t.Errorf("partial summary should show completed-step cost $1.25:\n%s", summary)
+	}
+	if !strings.Contains(summary, "1 failed") {
+		t.Errorf("partial summary should report the interrupted step as failed:\n%s", summary)
+	}
+}
+
+func TestRun_NoTimeoutCompletes(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().WithResult("cost_usd", 0.10).Build(), nil
+	})}
+	display := newRecordingDisplay()
+	o.SetDisplay(display)
+	o.SetTimeout(5 * time.Second)
+
+	b := &bundle.Bundle{Name: "quick", Steps: []bundle.Step{{Name: "only", Tool: "claude"}}}
+	env, err := o.Run(b, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess {
+		t.Errorf("status = %s, want success", env.Status)
+	}
+	if display.state(0) != StepSuccess {
+		t.Errorf("step state = %v, want success", display.state(0))
+	}
+}
+
+// depthLimitedExecutor records the parallel depth limit it is given
+type depthLimitedExecutor struct {
+	funcExecutor
+	depth int
+}
+
+func (d *depthLimitedExecutor) SetMaxParallelDepth(depth int) { d.depth = depth }
+
+func TestNew_AppliesMaxParallelDepthSetting(t *testing.T) {
+	saved := DispatcherFactory
+	defer func() { DispatcherFactory = saved }()
+
+	var exec *depthLimitedExecutor
+	DispatcherFactory = func(tools map[string]runner.Tool) StepExecutor {
+		exec = &depthLimitedExecutor{}
+		return exec
+	}
+
+	New(&settings.Settings{MaxParallelDepth: 5})
+	if exec.depth != 5 {
+		t.Errorf("dispatcher depth limit = %d, want 5 from settings", exec.depth)
+	}
+
+	New(&settings.Settings{})
+	if exec.depth != 0 {
+		t.Errorf("dispatcher should keep its default when the setting is unset, got %d", exec.depth)
+	}
+}
+
+// promptWarnExecutor records the prompt warning threshold it is given
+type promptWarnExecutor struct {
+	funcExecutor
+	tokens int
+}
+
+func (p *promptWarnExecutor) SetPromptWarnTokens(tokens int) { p.tokens = tokens }
+
+func TestNew_AppliesPromptWarnSetting(t *testing.T) {
+	saved := DispatcherFactory
+	defer func() { DispatcherFactory = saved }()
+
+	var exec *promptWarnExecutor
+	DispatcherFactory = func(tools map[string]runner.Tool) StepExecutor {
+		exec = &promptWarnExecutor{}
+		return exec
+	}
+
+	New(&settings.Settings{PromptWarnTokens: 2000})
+	if exec.tokens != 2000 {
+		t.Errorf("dispatcher prompt warning threshold = %d, want 2000 from settings", exec.tokens)
+	}
+
+	New(&settings.Settings{PromptWarnTokens: -1})
+	if exec.tokens != -1 {
+		t.Errorf("a negative setting should be passed through to disable the warning, got %d", exec.tokens)
+	}
+}
+
+// systemPromptExecutor records the system prompt files it is given
+type systemPromptExecutor struct {
+	funcExecutor
+	files map[string]string
+}
+
+func (p *systemPromptExecutor) SetSystemPromptFiles(files map[string]string) { p.files = files }
+
+func TestNew_AppliesSystemPromptFiles(t *testing.T) {
+	saved := DispatcherFactory
+	defer func() { DispatcherFactory = saved }()
+
+	var exec *systemPromptExecutor
+	DispatcherFactory = func(tools map[string]runner.Tool) StepExecutor {
+		exec = &systemPromptExecutor{}
+		return exec
+	}
+
+	New(&settings.Settings{Defaults: settings.Defaults{
+		Claude: settings.ClaudeDefaults{SystemPromptFile: "/p/claude.md"},
+		Gemini: settings.GeminiDefaults{SystemPromptFile: "/p/gemini.md"},
+	}})
+	want := map[string]string{"claude": "/p/claude.md", "gemini": "/p/gemini.md"}
+	if !reflect.DeepEqual(exec.files, want) {
+		t.Errorf("dispatcher system prompt files = %v, want %v", exec.files, want)
+	}
+
+	New(&settings.Settings{})
+	if exec.files != nil {
+		t.Errorf("no files should be set without settings, got %v", exec.files)
+	}
+}
+
+func TestRun_ToolModelsFillModelLessSteps(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var mu sync.Mutex
+	models := map[string]string{}
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		models[step.Name] = step.Model
+		for _, sub := range step.Parallel {
+			models[sub.Name] = sub.Model
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	o.SetToolModels(map[string]string{"claude": "haiku", "gemini": "gemini-flash"})
+
+	b := &bundle.Bundle{
+		Name: "models",
+		Steps: []bundle.Step{
+			{Name: "plan", Tool: "claude"},
+			{Name: "review", Tool: "claude", Model: "opus"},
+			{Name: "check", Tool: "gemini"},
+			{Name: "build", Tool: "codex"},
+			{Name: "fan", Parallel: []bundle.Step{
+				{Name: "fan-a", Tool: "claude"},
+				{Name: "fan-b", Tool: "claude", Model: "sonnet"},
+			}},
+		},
+	}
+	if _, err := o.Run(b, map[string]string{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	want := map[string]string{
+		"plan":   "haiku",
+		"review": "opus",
+		"check":  "gemini-flash",
+		"build":  "",
+		"fan":    "",
+		"fan-a":  "haiku",
+		"fan-b":  "sonnet",
+	}
+	for name, model := range want {
+		if models[name] != model {
+			t.Errorf("step %s ran with model %q, want %q", name, models[name], model)
+		}
+	}
+	if b.Steps[0].Model != "" || b.Steps[4].Parallel[0].Model != "" {
+		t.Error("the bundle's steps should not be modified")
+	}
+}
+
+func TestRun_StrictConditionsFailOnUnresolvedReference(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, strict := range []bool{false, true} {
+		var ran []string
+		o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+			ran = append(ran, step.Name)
+			return envelope.New().Success().Build(), nil
+		})}
+		o.SetDisplay(newRecordingDisplay())
+
+		b := &bundle.Bundle{
+			Name:             "strict",
+			StrictConditions: strict,
+			Steps: []bundle.Step{
+				{Name: "analyze", Tool: "claude"},
+				{Name: "fix", Tool: "claude", If: "${steps.analyse.status} == 'success'"},
+				{Name: "report", Tool: "claude"},
+			},
+		}
+		env, err := o.Run(b, map[string]string{})
+
+		if !strict {
+			if err != nil || env.Status != envelope.StatusSuccess {
+				t.Fatalf("lenient run should succeed, got %v %+v", err, env)
+			}
+			if strings.Join(ran, ",") != "analyze,report" {
+				t.Errorf("lenient run should skip the typo'd step, ran %v", ran)
+			}
+			continue
+		}
+		if err == nil || env.Error == nil || env.Error.Code != "CONDITION_ERROR" {
+			t.Fatalf("strict run should fail with CONDITION_ERROR, got %v %+v", err, env)
+		}
+		if !strings.Contains(env.Error.Message, "${steps.analyse.status}") {
+			t.Errorf("error should name the reference: %s", env.Error.Message)
+		}
+		if strings.Join(ran, ",") != "analyze" {
+			t.Errorf("strict run should stop at the bad condition, ran %v", ran)
+		}
+	}
+}
+
+func TestRun_SummaryIncludesCacheTokens(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().
+			WithResult("input_tokens", 30).
+			WithResult("cache_read_tokens", 2000).
+			WithResult("cache_write_tokens", 150).
+			Build(), nil
+	})}
+	display := newRecordingDisplay()
+	o.SetDisplay(display)
+
+	b := &bundle.Bundle{Name: "cache", Steps: []bundle.Step{{Name: "a", Tool: "claude"}, {Name: "b", Tool: "claude"}}}
+	if _, err := o.Run(b, map[string]string{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if display.summaryCache != [2]int{4000, 300} {
+		t.Errorf("summary cache tokens = %v, want 4000 read and 300 write", display.summaryCache)
+	}
+}
+
+func TestRun_PartialStepMakesRunPartial(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		env := envelope.New().Success().Build()
+		if step.Name == "fanout" {
+			env.Status = envelope.StatusPartial
+		}
+		return env, nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{Name: "partial", Steps: []bundle.Step{{Name: "fanout", Tool: "claude"}, {Name: "after", Tool: "claude"}}}
+	env, err := o.Run(b, map[string]string{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if env.Status != envelope.StatusPartial {
+		t.Fatalf("status = %s, want partial", env.Status)
+	}
+	if steps, _ := env.Result["partial_steps"].([]string); !reflect.DeepEqual(steps, []string{"fanout"}) {
+		t.Errorf("partial_steps = %v, want [fanout]", env.Result["partial_steps"])
+	}
+	if code := env.ExitCode(); code != envelope.ExitPartial {
+		t.Errorf("ExitCode() = %d, want %d", code, envelope.ExitPartial)
+	}
+}
+
+func TestRun_TokenBudgetStopsRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var ran []string
+	o := &Orchestrator{
+		settings: &settings.Settings{TokenBudget: 1500},
+		dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+			ran = append(ran, step.Name)
+			return envelope.New().Success().
+				WithResult("input_tokens", 700).
+				WithResult("output_tokens", 100).
+				Build(), nil
+		}),
+	}
+	display := newRecordingDisplay()
+	o.SetDisplay(display)
+
+	b := &bundle.Bundle{Name: "budget", Steps: []bundle.Step{
+		{Name: "a", Tool: "claude"},
+		{Name: "b", Tool: "claude"},
+		{Name: "c", Tool: "claude"},
+	}}
+	env, err := o.Run(b, map[string]string{})
+	if err == nil {
+		t.Error("expected an error when the budget is exceeded")
+	}
+	if env.Error == nil || env.Error.Code != envelope.CodeBudgetExceeded {
+		t.Fatalf("error = %+v, want %s", env.Error, envelope.CodeBudgetExceeded)
+	}
+	if code := env.ExitCode(); code != envelope.ExitBudgetExceeded {
+		t.Errorf("ExitCode() = %d, want %d", code, envelope.ExitBudgetExceeded)
+	}
+	// 1600 tokens after two steps reaches the budget before the third
+	if !reflect.DeepEqual(ran, []string{"a", "b"}) {
+		t.Errorf("ran %v, want [a b]", ran)
+	}
+	if display.state(2) != StepSkipped {
+		t.Errorf("step c state = %v, want skipped", display.state(2))
+	}
+	encoded, _ := env.Result["resume_token"].(string)
+	if token, err := ParseResumeToken(encoded); err != nil || token.ResumeFrom != "c" {
+		t.Errorf("resume token = %+v (%v), want one resuming from c", token, err)
+	}
+}
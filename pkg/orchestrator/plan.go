@@ -0,0 +1,256 @@
+package orchestrator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/workspace"
+)
+
+// DefaultConfirmAboveUSD is the estimated run cost at or above which a run
+// with confirmation enabled asks before starting
+const DefaultConfirmAboveUSD = 1.0
+
+// PlannedStep is one step of a RunPlan. Dry runs also fill in what the
+// step would do: its resolved task, its condition and nested steps.
+type PlannedStep struct {
+	Name             string        `json:"name"`
+	Kind             string        `json:"kind"` // Tool and model, or the step type (parallel, foreach, ...)
+	Tool             string        `json:"tool,omitempty"`
+	Model            string        `json:"model,omitempty"`
+	Task             string        `json:"task,omitempty"`  // Resolved against the inputs, secrets masked
+	Error            string        `json:"error,omitempty"` // Why the task could not be resolved
+	If               string        `json:"if,omitempty"`
+	Skipped          bool          `json:"skipped,omitempty"`            // The condition is false for these inputs
+	ConditionPending bool          `json:"condition_pending,omitempty"`  // The condition depends on results of earlier steps
+	Substeps         []PlannedStep `json:"substeps,omitempty"`           // Parallel substeps, foreach body or chosen branch
+	EstimatedCostUSD float64       `json:"estimated_cost_usd,omitempty"` // Average cost over past runs (0 if it never ran)
+}
+
+// RunPlan lists the steps a run will execute and what they cost in the
+// past. Estimates average the completed previous runs of the same bundle.
+type RunPlan struct {
+	Bundle           string
+	Steps            []PlannedStep
+	EstimatedCostUSD float64
+	PastRuns         int // Previous runs the estimate is based on
+}
+
+// PlanRun builds the plan for running b, estimating costs from history
+// (job summaries as returned by workspace.ListJobs). Only completed runs of
+// the same bundle count.
+func (o *Orchestrator) PlanRun(b *bundle.Bundle, history []*workspace.JobSummary) RunPlan {
+	plan := RunPlan{Bundle: b.Name}
+
+	stepCosts := make(map[string]float64)
+	for _, job := range history {
+		if job.Bundle != b.Name || job.Status == "" {
+			continue
+		}
+		plan.PastRuns++
+		plan.EstimatedCostUSD += job.CostUSD
+		for _, step := range job.Steps {
+			stepCosts[step.Name] += step.CostUSD
+		}
+	}
+	if plan.PastRuns > 0 {
+		plan.EstimatedCostUSD /= float64(plan.PastRuns)
+	}
+
+	for _, step := range b.Steps {
+		planned := PlannedStep{Name: step.Name, Kind: o.stepKind(&step)}
+		if plan.PastRuns > 0 {
+			planned.EstimatedCostUSD = stepCosts[step.Name] / float64(plan.PastRuns)
+		}
+		plan.Steps = append(plan.Steps, planned)
+	}
+	return plan
+}
+
+// stepKind describes what a step runs, for the plan
+func (o *Orchestrator) stepKind(step *bundle.Step) string {
+	switch {
+	case step.Noop:
+		return "noop"
+	case len(step.Parallel) > 0:
+		return fmt.Sprintf("parallel (%d)", len(step.Parallel))
+	case step.Foreach != "":
+		return "foreach"
+	case step.Merge != nil:
+		return "merge"
+	case step.Vote != nil:
+		return "vote"
+	case step.Tool == "":
+		return "conditional"
+	}
+	if model := o.getStepModel(step.Tool, step.Model); model != "" {
+		return step.Tool + " (" + model + ")"
+	}
+	return step.Tool
+}
+
+// Write prints the plan, formatting costs with cost
+func (p RunPlan) Write(w io.Writer, cost CostFormatter) {
+	fmt.Fprintf(w, "Plan for %s (%d steps):\n", p.Bundle, len(p.Steps))
+	for i, step := range p.Steps {
+		fmt.Fprintf(w, "  %d. %-20s %-24s", i+1, step.Name, step.Kind)
+		if p.PastRuns > 0 {
+			fmt.Fprintf(w, " ~%s", cost.Format(step.EstimatedCostUSD))
+		}
+		fmt.Fprintln(w)
+	}
+	if p.PastRuns == 0 {
+		fmt.Fprintln(w, "Estimated cost: unknown (no previous runs)")
+		return
+	}
+	runs := "runs"
+	if p.PastRuns == 1 {
+		runs = "run"
+	}
+	fmt.Fprintf(w, "Estimated cost: ~%s (average of %d previous %s)\n", cost.Format(p.EstimatedCostUSD), p.PastRuns, runs)
+}
+
+// SetDryRun makes Run plan the bundle instead of running it: each step's
+// tool, model and resolved task, and whether its condition skips it, are
+// printed to w and returned as the envelope's "plan" result without
+// starting any tool. Pass io.Discard to only return the plan; nil restores
+// normal runs.
+func (o *Orchestrator) SetDryRun(w io.Writer) {
+	o.dryRun = w
+}
+
+// dryRunPlan plans every step of b against inputs without running anything
+func (o *Orchestrator) dryRunPlan(b *bundle.Bundle, inputs map[string]string) []PlannedStep {
+	ctx := NewContext(inputs)
+	ctx.SetConstants(b.Constants)
+	ctx.SetTemplateEngine(b.TemplateEngine)
+
+	steps := make([]PlannedStep, 0, len(b.Steps))
+	for i := range b.Steps {
+		steps = append(steps, o.planStep(o.withToolModels(&b.Steps[i]), ctx))
+	}
+	return steps
+}
+
+// planStep describes what step would do in a run with ctx's inputs
+func (o *Orchestrator) planStep(step *bundle.Step, ctx *Context) PlannedStep {
+	planned := PlannedStep{Name: step.Name, Kind: o.stepKind(step), If: step.If}
+
+	if step.If != "" {
+		holds, err := EvaluateConditionStrict(step.If, ctx)
+		if err != nil {
+			planned.ConditionPending = true
+		} else if !holds {
+			planned.Skipped = true
+			return planned
+		}
+	}
+
+	switch {
+	case step.Then != nil:
+		planned.Substeps = append(planned.Substeps, o.planStep(step.Then, ctx))
+		if planned.ConditionPending && step.Else != nil {
+			planned.Substeps = append(planned.Substeps, o.planStep(step.Else, ctx))
+		}
+	case len(step.Parallel) > 0:
+		for i := range step.Parallel {
+			planned.Substeps = append(planned.Substeps, o.planStep(&step.Parallel[i], ctx))
+		}
+	case step.Do != nil:
+		planned.Substeps = append(planned.Substeps, o.planStep(step.Do, ctx))
+	case step.Tool != "":
+		planned.Tool = step.Tool
+		planned.Model = o.getStepModel(step.Tool, step.Model)
+		task, err := ctx.RenderTask(step.Task)
+		if err != nil {
+			planned.Error = err.Error()
+		} else {
+			planned.Task = ctx.MaskSecrets(task)
+		}
+	}
+	return planned
+}
+
+// writeDryRun prints a dry run's plan
+func writeDryRun(w io.Writer, b *bundle.Bundle, steps []PlannedStep) {
+	fmt.Fprintf(w, "%s%sDry run - %s would execute (%d steps):%s\n", colorBold, colorCyan, b.Name, len(steps), colorReset)
+	for i, step := range steps {
+		writePlannedStep(w, fmt.Sprintf("%d.", i+1), step, "  ")
+	}
+}
+
+// writePlannedStep prints step and its substeps, indented by indent
+func writePlannedStep(w io.Writer, label string, step PlannedStep, indent string) {
+	fmt.Fprintf(w, "\n%s%s %s%s%s  %s", indent, label, colorBold, step.Name, colorReset, step.Kind)
+	switch {
+	case step.Skipped:
+		fmt.Fprintf(w, "  %s(skipped)%s", colorDim, colorReset)
+	case step.ConditionPending:
+		fmt.Fprintf(w, "  %s(depends on earlier steps)%s", colorYellow, colorReset)
+	}
+	fmt.Fprintln(w)
+
+	detail := indent + strings.Repeat(" ", len(label)+1)
+	if step.If != "" {
+		fmt.Fprintf(w, "%s%sIf:%s   %s\n", detail, colorDim, colorReset, step.If)
+	}
+	if step.Error != "" {
+		fmt.Fprintf(w, "%s%sError:%s %s\n", detail, colorRed, colorReset, step.Error)
+	}
+	if step.Task != "" {
+		lines := strings.Split(strings.TrimSpace(step.Task), "\n")
+		fmt.Fprintf(w, "%s%sTask:%s %s\n", detail, colorDim, colorReset, lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "%s      %s\n", detail, line)
+		}
+	}
+	for _, sub := range step.Substeps {
+		writePlannedStep(w, "-", sub, detail)
+	}
+}
+
+// SetConfirm makes Run show the plan and ask for confirmation on w, reading
+// the answer from r, before running a bundle whose estimated cost reaches
+// the confirm_above_usd setting. A nil reader disables confirmation.
+func (o *Orchestrator) SetConfirm(r io.Reader, w io.Writer) {
+	o.confirmIn = r
+	o.confirmOut = w
+}
+
+// confirmThreshold returns the estimated cost that requires confirmation;
+// negative means never
+func (o *Orchestrator) confirmThreshold() float64 {
+	if o.settings != nil && o.settings.ConfirmAboveUSD != 0 {
+		return o.settings.ConfirmAboveUSD
+	}
+	return DefaultConfirmAboveUSD
+}
+
+// confirmRun asks whether to run b if its estimated cost needs confirmation,
+// reporting false if the user declined
+func (o *Orchestrator) confirmRun(b *bundle.Bundle) (bool, error) {
+	threshold := o.confirmThreshold()
+	if o.confirmIn == nil || threshold < 0 {
+		return true, nil
+	}
+	history, _ := workspace.ListJobs(workspace.DefaultBaseDir(), nil)
+	plan := o.PlanRun(b, history)
+	if plan.EstimatedCostUSD < threshold {
+		return true, nil
+	}
+
+	plan.Write(o.confirmOut, o.costFormatter())
+	fmt.Fprint(o.confirmOut, "Proceed? [y/N]: ")
+	line, err := bufio.NewReader(o.confirmIn).ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	if err != nil && (err != io.EOF || answer == "") {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, fmt.Errorf("reading confirmation: %w", err)
+	}
+	return answer == "y" || answer == "yes", nil
+}
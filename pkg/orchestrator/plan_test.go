@@ -0,0 +1,202 @@
+package orchestrator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+// writePastRun records a completed run of bundleName costing cost in the
+// workspace history under HOME
+func writePastRun(t *testing.T, jobID, bundleName string, stepCost, cost float64) {
+	t.Helper()
+	dir := filepath.Join(workspace.DefaultBaseDir(), "jobs", jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	log := `{"event":"run_start","job_id":"` + jobID + `","bundle":"` + bundleName + `"}` + "\n" +
+		`{"event":"step_complete","step":"build","status":"success","cost_usd":` + strconv.FormatFloat(stepCost, 'f', -1, 64) + `}` + "\n" +
+		`{"event":"run_complete","status":"success","cost_usd":` + strconv.FormatFloat(cost, 'f', -1, 64) + `}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, EventLogFile), []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func confirmBundle() *bundle.Bundle {
+	return &bundle.Bundle{
+		Name:  "expensive",
+		Steps: []bundle.Step{{Name: "build", Tool: "claude", Model: "opus"}},
+	}
+}
+
+func TestPlanRun_AveragesPastRuns(t *testing.T) {
+	history := []*workspace.JobSummary{
+		{JobID: "1", Bundle: "expensive", Status: "success", CostUSD: 2, Steps: []workspace.StepSummary{{Name: "build", CostUSD: 2}}},
+		{JobID: "2", Bundle: "expensive", Status: "partial", CostUSD: 4, Steps: []workspace.StepSummary{{Name: "build", CostUSD: 3}}},
+		{JobID: "3", Bundle: "expensive", CostUSD: 100}, // Interrupted
+		{JobID: "4", Bundle: "other", Status: "success", CostUSD: 50},
+	}
+
+	o := &Orchestrator{}
+	plan := o.PlanRun(confirmBundle(), history)
+	if plan.PastRuns != 2 {
+		t.Errorf("PastRuns = %d, want 2", plan.PastRuns)
+	}
+	if plan.EstimatedCostUSD != 3 {
+		t.Errorf("EstimatedCostUSD = %v, want 3", plan.EstimatedCostUSD)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].EstimatedCostUSD != 2.5 || plan.Steps[0].Kind != "claude (opus)" {
+		t.Errorf("Steps = %+v, want build claude (opus) at 2.5", plan.Steps)
+	}
+
+	var out bytes.Buffer
+	plan.Write(&out, DefaultCostFormatter)
+	if !strings.Contains(out.String(), "Estimated cost: ~$3.00 (average of 2 previous runs)") {
+		t.Errorf("plan output missing estimate:\n%s", out.String())
+	}
+}
+
+func TestRun_ConfirmationAcceptedProceeds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writePastRun(t, "20260101-000000-aaaa", "expensive", 2.5, 2.5)
+
+	ran := false
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		ran = true
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	var out bytes.Buffer
+	o.SetConfirm(strings.NewReader("y\n"), &out)
+
+	env, err := o.Run(confirmBundle(), map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ran || env.Status != envelope.StatusSuccess {
+		t.Errorf("expected the run to proceed, ran=%v status=%s", ran, env.Status)
+	}
+	if !strings.Contains(out.String(), "Plan for expensive") || !strings.Contains(out.String(), "Proceed? [y/N]") {
+		t.Errorf("expected the plan and prompt, got:\n%s", out.String())
+	}
+}
+
+func TestRun_ConfirmationDeclinedAborts(t *testing.T) {
+	for _, answer := range []string{"n\n", "\n", ""} {
+		t.Run(strings.TrimSpace(answer), func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			writePastRun(t, "20260101-000000-aaaa", "expensive", 2.5, 2.5)
+
+			ran := false
+			o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+				ran = true
+				return envelope.New().Success().Build(), nil
+			})}
+			o.SetDisplay(newRecordingDisplay())
+			o.SetConfirm(strings.NewReader(answer), &bytes.Buffer{})
+
+			env, err := o.Run(confirmBundle(), map[string]string{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ran {
+				t.Error("expected the declined run not to execute any step")
+			}
+			if env.Status != envelope.StatusFailure || env.Error == nil || env.Error.Code != "DECLINED" {
+				t.Errorf("expected a DECLINED failure, got %+v", env)
+			}
+		})
+	}
+}
+
+func TestRun_CheapRunSkipsConfirmation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	writePastRun(t, "20260101-000000-aaaa", "expensive", 0.10, 0.10)
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	var out bytes.Buffer
+	o.SetConfirm(strings.NewReader("n\n"), &out)
+
+	env, _ := o.Run(confirmBundle(), map[string]string{})
+	if env.Status != envelope.StatusSuccess {
+		t.Errorf("expected a run below the threshold to proceed, got %s", env.Status)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no prompt, got:\n%s", out.String())
+	}
+}
+
+func TestRun_DryRunPlansWithoutExecuting(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("RCODEGEN_TEST_TOKEN", "s3cr3t")
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		t.Errorf("step %s executed during a dry run", step.Name)
+		return envelope.New().Success().Build(), nil
+	})}
+	var out bytes.Buffer
+	o.SetDryRun(&out)
+
+	b := &bundle.Bundle{
+		Name:   "pipeline",
+		Inputs: []bundle.Input{{Name: "deploy", Default: "no"}},
+		Steps: []bundle.Step{
+			{Name: "build", Tool: "claude", Model: "opus", Task: "Build ${inputs.task} with ${secret.RCODEGEN_TEST_TOKEN}"},
+			{Name: "reviews", Parallel: []bundle.Step{
+				{Name: "review-a", Tool: "codex", Model: "gpt-5", Task: "Review ${steps.build.output}"},
+				{Name: "review-b", Tool: "gemini", Model: "flash", Task: "Review"},
+			}},
+			{Name: "fix", Tool: "claude", Model: "sonnet", If: "${steps.reviews.status} == 'partial'", Task: "Fix"},
+			{Name: "deploy", Tool: "claude", Model: "sonnet", If: "${inputs.deploy} == 'yes'", Task: "Deploy"},
+		},
+	}
+
+	env, err := o.Run(b, map[string]string{"task": "a CLI"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if env.Status != envelope.StatusSuccess || env.Result["dry_run"] != true {
+		t.Fatalf("expected a successful dry run, got %+v", env)
+	}
+
+	plan, ok := env.Result["plan"].([]PlannedStep)
+	if !ok || len(plan) != 4 {
+		t.Fatalf("plan = %#v, want 4 steps", env.Result["plan"])
+	}
+	build := plan[0]
+	if build.Tool != "claude" || build.Model != "opus" || build.Task != "Build a CLI with ********" {
+		t.Errorf("build = %+v, want claude/opus with the resolved, masked task", build)
+	}
+	if len(plan[1].Substeps) != 2 || plan[1].Substeps[0].Task != "Review ${steps.build.output}" {
+		t.Errorf("reviews = %+v, want both substeps with step references left for the run", plan[1])
+	}
+	if !plan[2].ConditionPending || plan[2].Skipped {
+		t.Errorf("fix = %+v, want its condition pending on earlier steps", plan[2])
+	}
+	if !plan[3].Skipped || plan[3].Task != "" {
+		t.Errorf("deploy = %+v, want skipped for deploy=no", plan[3])
+	}
+
+	text := stripAnsi(out.String())
+	for _, want := range []string{"Dry run - pipeline would execute (4 steps)", "1. build  claude (opus)", "Task: Build a CLI with ********", "- review-a", "(depends on earlier steps)", "deploy  claude (sonnet)  (skipped)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("dry run output missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "s3cr3t") {
+		t.Error("dry run output leaked a secret")
+	}
+	if jobs, _ := workspace.ListJobs(workspace.DefaultBaseDir(), nil); len(jobs) != 0 {
+		t.Errorf("expected no job to be created, found %d", len(jobs))
+	}
+}
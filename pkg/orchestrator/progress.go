@@ -64,13 +64,14 @@ const (
 
 // StepProgress tracks progress for a single step
 type StepProgress struct {
-	Name     string
-	Tool     string
-	Model    string
-	State    StepState
-	Cost     float64
-	Duration time.Duration
-	Tokens   int
+	Name        string
+	Description string
+	Tool        string
+	Model       string
+	State       StepState
+	Cost        float64
+	Duration    time.Duration
+	Tokens      int
 }
 
 // ProgressDisplay handles the visual output
@@ -83,6 +84,7 @@ type ProgressDisplay struct {
 	steps       []StepProgress
 	startTime   time.Time
 	width       int
+	cost        CostFormatter // Currency/locale used for displayed costs
 }
 
 // NewProgressDisplay creates a new progress display
@@ -95,9 +97,10 @@ func NewProgressDisplay(b *bundle.Bundle, jobID string, inputs map[string]string
 			tool = "parallel"
 		}
 		steps[i] = StepProgress{
-			Name:  step.Name,
-			Tool:  tool,
-			State: StepPending,
+			Name:        step.Name,
+			Description: step.Description,
+			Tool:        tool,
+			State:       StepPending,
 		}
 	}
 
@@ -118,9 +121,15 @@ func NewProgressDisplay(b *bundle.Bundle, jobID string, inputs map[string]string
 		steps:       steps,
 		startTime:   time.Now(),
 		width:       72,
+		cost:        DefaultCostFormatter,
 	}
 }
 
+// SetCostFormatter sets the currency and locale used for displayed costs
+func (p *ProgressDisplay) SetCostFormatter(f CostFormatter) {
+	p.cost = f
+}
+
 // toolColor returns the appropriate color for a tool
 func toolColor(tool string) string {
 	switch tool {
@@ -300,6 +309,10 @@ func (p *ProgressDisplay) PrintStepStart(stepIndex int) {
 		colorCyan,
 		strings.Repeat("─", w-4),
 		colorReset)
+
+	if step.Description != "" {
+		fmt.Printf("    %s%s%s\n", colorDim, step.Description, colorReset)
+	}
 }
 
 // PrintStepComplete prints the completion of a step
@@ -327,7 +340,7 @@ func (p *ProgressDisplay) PrintStepComplete(stepIndex int, cost float64, duratio
 	durStr := formatDuration(duration)
 
 	// Format cost
-	costStr := fmt.Sprintf("$%.2f", cost)
+	costStr := p.cost.Format(cost)
 
 	fmt.Printf("\n  %s%s%s  %-12s %s%-8s%s  %s%8s%s  %s%s%s\n",
 		iconClr, icon, colorReset,
@@ -377,7 +390,7 @@ func (p *ProgressDisplay) PrintSummary(totalCost float64, totalInputTokens, tota
 
 	// Summary line
 	durStr := formatDuration(duration)
-	costStr := fmt.Sprintf("$%.2f", totalCost)
+	costStr := p.cost.Format(totalCost)
 
 	status := fmt.Sprintf("%s%d/%d complete%s", colorGreen, successes, len(p.steps), colorReset)
 	if failures > 0 {
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+// ResumeToken identifies where a failed run stopped so it can be resumed
+// later without guessing the job id. It travels as an opaque string in the
+// run envelope's "resume_token" result.
+type ResumeToken struct {
+	JobID         string `json:"job_id"`
+	Bundle        string `json:"bundle"`
+	LastCompleted string `json:"last_completed,omitempty"` // Empty when no step finished
+	ResumeFrom    string `json:"resume_from"`              // The step that failed or never ran
+}
+
+// Encode returns the token's opaque string form
+func (t ResumeToken) Encode() string {
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseResumeToken decodes a token produced by Encode
+func ParseResumeToken(s string) (ResumeToken, error) {
+	var t ResumeToken
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, fmt.Errorf("invalid resume token: %w", err)
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("invalid resume token: %w", err)
+	}
+	if t.JobID == "" || t.ResumeFrom == "" {
+		return t, fmt.Errorf("invalid resume token: missing job id or step")
+	}
+	return t, nil
+}
+
+// withResumeToken returns a copy of env carrying the token, leaving the
+// step result it may have come from untouched
+func withResumeToken(env *envelope.Envelope, t ResumeToken) *envelope.Envelope {
+	out := *env
+	out.Result = make(map[string]interface{}, len(env.Result)+1)
+	for k, v := range env.Result {
+		out.Result[k] = v
+	}
+	out.Result["resume_token"] = t.Encode()
+	return &out
+}
+
+// SetResume makes runs reuse the work of a previous job (an ID or a job
+// directory) of the same bundle: the steps its manifest records as
+// succeeded or skipped, up to the first that failed or never ran, are not
+// run again. Their
+// results are restored so later steps' references still resolve, and the
+// steps from that point on run normally. An empty job runs everything.
+func (o *Orchestrator) SetResume(job string) {
+	o.resumeJob = job
+}
+
+// resumedSteps loads the step results recorded in job's manifest that a
+// resumed run can reuse, by step name, after checking the job ran bundle b.
+// Steps that succeeded are reused, and so are those their condition skipped.
+func resumedSteps(job string, b *bundle.Bundle) (map[string]*envelope.Envelope, error) {
+	m, err := workspace.LoadManifest(job)
+	if err != nil {
+		return nil, fmt.Errorf("resuming: %w", err)
+	}
+	if m.Bundle != b.Name {
+		return nil, fmt.Errorf("resuming: job %s ran bundle %s, not %s", job, m.Bundle, b.Name)
+	}
+	steps := make(map[string]*envelope.Envelope)
+	for _, s := range m.Steps {
+		status := envelope.Status(s.Status)
+		if status != envelope.StatusSuccess && status != envelope.StatusSkipped {
+			continue
+		}
+		result := s.Result
+		if result == nil {
+			result = make(map[string]interface{})
+		}
+		steps[s.Name] = &envelope.Envelope{
+			Status:    status,
+			Result:    result,
+			OutputRef: s.OutputRef,
+			Metrics:   &envelope.Metrics{Tool: s.Tool, DurationMs: s.DurationMs},
+		}
+	}
+	return steps, nil
+}
+
+// restoreStep puts a reused step's result, and those of its parallel
+// substeps, into ctx. It reports false when the step has no result to reuse.
+func restoreStep(step *bundle.Step, resumed map[string]*envelope.Envelope, ctx *Context) bool {
+	env, ok := resumed[step.Name]
+	if !ok {
+		return false
+	}
+	ctx.SetResult(step.Name, env)
+	for i := range step.Parallel {
+		restoreStep(&step.Parallel[i], resumed, ctx)
+	}
+	return true
+}
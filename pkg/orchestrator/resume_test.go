@@ -0,0 +1,193 @@
+package orchestrator
+
+import (
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/workspace"
+)
+
+func TestResumeToken_RoundTrip(t *testing.T) {
+	tok := ResumeToken{JobID: "20261016-101500-abcd1234", Bundle: "review", LastCompleted: "analyze", ResumeFrom: "fix: part 2"}
+
+	got, err := ParseResumeToken(tok.Encode())
+	if err != nil {
+		t.Fatalf("ParseResumeToken: %v", err)
+	}
+	if got != tok {
+		t.Errorf("round trip = %+v, want %+v", got, tok)
+	}
+
+	for _, bad := range []string{"", "not base64!", ResumeToken{Bundle: "x"}.Encode()} {
+		if _, err := ParseResumeToken(bad); err == nil {
+			t.Errorf("ParseResumeToken(%q) should fail", bad)
+		}
+	}
+}
+
+func TestRun_FailedRunReturnsResumeToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "implement" {
+			return envelope.New().Failure("EXEC_FAILED", "exit status 1").Build(), nil
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{Name: "build", Steps: []bundle.Step{
+		{Name: "plan", Tool: "claude"},
+		{Name: "optional", Tool: "claude", If: "${steps.plan.status} == 'failure'"},
+		{Name: "implement", Tool: "codex"},
+		{Name: "review", Tool: "gemini"},
+	}}
+	env, err := o.Run(b, map[string]string{})
+	if err == nil {
+		t.Fatal("expected the failing step to fail the run")
+	}
+
+	raw, ok := env.Result["resume_token"].(string)
+	if !ok {
+		t.Fatalf("failed run envelope has no resume_token: %+v", env.Result)
+	}
+	tok, err := ParseResumeToken(raw)
+	if err != nil {
+		t.Fatalf("ParseResumeToken: %v", err)
+	}
+	if tok.ResumeFrom != "implement" || tok.LastCompleted != "optional" || tok.Bundle != "build" || tok.JobID == "" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestRun_TimedOutRunReturnsResumeToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	release := make(chan struct{})
+	defer close(release)
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "slow" {
+			<-release
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	o.SetTimeout(100 * time.Millisecond)
+
+	b := &bundle.Bundle{Name: "slow-run", Steps: []bundle.Step{
+		{Name: "fast", Tool: "claude"},
+		{Name: "slow", Tool: "claude"},
+	}}
+	env, _ := o.Run(b, map[string]string{})
+
+	tok, err := ParseResumeToken(env.Result["resume_token"].(string))
+	if err != nil {
+		t.Fatalf("ParseResumeToken: %v", err)
+	}
+	if tok.ResumeFrom != "slow" || tok.LastCompleted != "fast" {
+		t.Errorf("unexpected token: %+v", tok)
+	}
+}
+
+func TestRun_SuccessfulRunHasNoResumeToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	env, err := o.Run(&bundle.Bundle{Name: "ok", Steps: []bundle.Step{{Name: "only", Tool: "claude"}}}, map[string]string{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := env.Result["resume_token"]; ok {
+		t.Error("successful runs should not carry a resume token")
+	}
+}
+
+func TestRun_ResumeSkipsCompletedSteps(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	var ran []string
+	fail := true
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		ran = append(ran, step.Name)
+		switch step.Name {
+		case "plan":
+			return envelope.New().Success().WithResult("approach", "rewrite").WithOutputRef("/out/plan.json").Build(), nil
+		case "implement":
+			if fail {
+				return envelope.New().Failure("EXEC_FAILED", "exit status 1").Build(), nil
+			}
+			if got := ctx.Resolve("${steps.plan.result.approach} ${steps.plan.output_ref}"); got != "rewrite /out/plan.json" {
+				t.Errorf("resumed step references resolved to %q", got)
+			}
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{Name: "build", Steps: []bundle.Step{
+		{Name: "plan", Tool: "claude"},
+		{Name: "optional", Tool: "claude", If: "${steps.plan.status} == 'failure'"},
+		{Name: "implement", Tool: "codex"},
+		{Name: "review", Tool: "gemini"},
+	}}
+	env, err := o.Run(b, map[string]string{})
+	if err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	tok, _ := ParseResumeToken(env.Result["resume_token"].(string))
+
+	ran = nil
+	fail = false
+	display := newRecordingDisplay()
+	o.SetDisplay(display)
+	o.SetResume(tok.JobID)
+	env, err = o.Run(b, map[string]string{})
+	if err != nil {
+		t.Fatalf("resumed run failed: %v", err)
+	}
+	if len(ran) != 2 || ran[0] != "implement" || ran[1] != "review" {
+		t.Errorf("resumed run ran %v, want [implement review]", ran)
+	}
+	if display.state(0) != StepSkipped || display.state(2) != StepSuccess {
+		t.Errorf("step states = %v, %v", display.state(0), display.state(2))
+	}
+
+	// The resumed job's manifest carries the reused steps forward
+	m, err := workspace.LoadManifest(env.Result["job_id"].(string))
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if len(m.Steps) != 4 || m.Steps[0].Name != "plan" || m.Steps[0].Result["approach"] != "rewrite" {
+		t.Errorf("resumed manifest steps = %+v", m.Steps)
+	}
+}
+
+func TestRun_ResumeRejectsOtherBundle(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	env, err := o.Run(&bundle.Bundle{Name: "first", Steps: []bundle.Step{{Name: "a", Tool: "claude"}}}, map[string]string{})
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+
+	o.SetResume(env.Result["job_id"].(string))
+	env, err = o.Run(&bundle.Bundle{Name: "second", Steps: []bundle.Step{{Name: "a", Tool: "claude"}}}, map[string]string{})
+	if err == nil || env.Error == nil || env.Error.Code != "RESUME_ERROR" {
+		t.Errorf("expected RESUME_ERROR, got %+v (%v)", env, err)
+	}
+
+	o.SetResume("no-such-job")
+	if _, err := o.Run(&bundle.Bundle{Name: "first", Steps: []bundle.Step{{Name: "a", Tool: "claude"}}}, map[string]string{}); err == nil {
+		t.Error("expected an error resuming a job without a manifest")
+	}
+}
@@ -0,0 +1,247 @@
+package orchestrator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"rcodegen/pkg/envelope"
+)
+
+// SandboxDirName is the job subdirectory holding a sandboxed run's copy of
+// the codebase
+const SandboxDirName = "sandbox"
+
+// SandboxChanges lists the files a sandboxed run changed, as paths relative
+// to the codebase root
+type SandboxChanges struct {
+	Added    []string `json:"added,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Deleted  []string `json:"deleted,omitempty"`
+}
+
+// Empty reports whether the run changed nothing
+func (c SandboxChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Modified) == 0 && len(c.Deleted) == 0
+}
+
+// SetSandbox runs tools in a copy of the codebase inside the job directory
+// instead of the codebase itself; the run's result lists what they changed
+func (o *Orchestrator) SetSandbox(enabled bool) {
+	o.sandbox = enabled
+}
+
+// sandboxSkipped reports whether a sandbox copy or diff leaves out path:
+// .git directories, whose history tools don't need, and the directories in
+// skip, such as the workspace the sandbox itself is written to when the
+// codebase contains it
+func sandboxSkipped(path string, d fs.DirEntry, skip []string) bool {
+	if !d.IsDir() {
+		return false
+	}
+	if d.Name() == ".git" {
+		return true
+	}
+	for _, dir := range skip {
+		if dir != "" && filepath.Clean(dir) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyTree copies the directory tree src to dst, keeping file modes,
+// modification times and symbolic links. Directories sandboxSkipped leaves
+// out are not copied, and neither is dst itself.
+func copyTree(src, dst string, skip ...string) error {
+	skip = append(skip, dst)
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != src && sandboxSkipped(path, d, skip) {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			// Unchanged copies then match on size and time without reading
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		}
+		return nil // Sockets, devices and pipes are not part of a codebase
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// treeEntry is what diffTrees knows about a file before reading it
+type treeEntry struct {
+	size    int64
+	modTime time.Time
+	symlink bool
+	link    string // Target of a symlink
+}
+
+// treeFiles maps the relative path of every file and symlink under root to
+// its size and modification time (a symlink's target), leaving out what
+// sandboxSkipped does
+func treeFiles(root string, skip []string) (map[string]treeEntry, error) {
+	files := make(map[string]treeEntry)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && sandboxSkipped(path, d, skip) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			files[rel] = treeEntry{symlink: true, link: link}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = treeEntry{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// fileHash returns the sha256 of the file at path, read as a stream
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// sameFile reports whether two tree entries hold the same content: files of
+// different sizes differ, files with the same size and time are taken as
+// unchanged, and only the rest are hashed
+func sameFile(origPath, changedPath string, orig, changed treeEntry) (bool, error) {
+	switch {
+	case orig.symlink || changed.symlink:
+		return orig.symlink == changed.symlink && orig.link == changed.link, nil
+	case orig.size != changed.size:
+		return false, nil
+	case orig.modTime.Equal(changed.modTime):
+		return true, nil
+	}
+	before, err := fileHash(origPath)
+	if err != nil {
+		return false, err
+	}
+	after, err := fileHash(changedPath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(before, after), nil
+}
+
+// diffTrees reports how the tree at changed differs from the tree at orig,
+// leaving out the directories copyTree does (changed among them)
+func diffTrees(orig, changed string, skip ...string) (SandboxChanges, error) {
+	var c SandboxChanges
+	skip = append(skip, changed)
+	before, err := treeFiles(orig, skip)
+	if err != nil {
+		return c, err
+	}
+	after, err := treeFiles(changed, skip)
+	if err != nil {
+		return c, err
+	}
+	for path, entry := range after {
+		old, ok := before[path]
+		if !ok {
+			c.Added = append(c.Added, path)
+			continue
+		}
+		same, err := sameFile(filepath.Join(orig, path), filepath.Join(changed, path), old, entry)
+		if err != nil {
+			return c, err
+		}
+		if !same {
+			c.Modified = append(c.Modified, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			c.Deleted = append(c.Deleted, path)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Modified)
+	sort.Strings(c.Deleted)
+	return c, nil
+}
+
+// withSandboxChanges returns a copy of env reporting the sandbox directory
+// and the changes made in it
+func withSandboxChanges(env *envelope.Envelope, dir string, changes SandboxChanges) *envelope.Envelope {
+	out := *env
+	out.Result = make(map[string]interface{}, len(env.Result)+2)
+	for k, v := range env.Result {
+		out.Result[k] = v
+	}
+	out.Result["sandbox_dir"] = dir
+	out.Result["sandbox_changes"] = changes
+	return &out
+}
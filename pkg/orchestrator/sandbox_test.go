@@ -0,0 +1,167 @@
+package orchestrator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRun_SandboxLeavesCodebaseUntouched(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	codebase := t.TempDir()
+	writeTree(t, codebase, map[string]string{
+		"main.go":        "package main\n",
+		"docs/README.md": "old docs\n",
+		"obsolete.txt":   "remove me\n",
+	})
+	if err := os.Symlink("main.go", filepath.Join(codebase, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	var workDir string
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		// A tool editing its working directory
+		workDir = ctx.Inputs["codebase"]
+		writeTree(t, workDir, map[string]string{
+			"docs/README.md": "new docs\n",
+			"added.go":       "package main\n",
+		})
+		os.Remove(filepath.Join(workDir, "obsolete.txt"))
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	o.SetSandbox(true)
+
+	b := &bundle.Bundle{Name: "sandboxed", Steps: []bundle.Step{{Name: "edit", Tool: "claude"}}}
+	env, err := o.Run(b, map[string]string{"codebase": codebase})
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Run: %v %+v", err, env)
+	}
+
+	sandbox, _ := env.Result["sandbox_dir"].(string)
+	if sandbox == "" || workDir != sandbox {
+		t.Fatalf("tool ran in %q, want the sandbox %q", workDir, sandbox)
+	}
+
+	// The real codebase is untouched
+	if data, _ := os.ReadFile(filepath.Join(codebase, "docs/README.md")); string(data) != "old docs\n" {
+		t.Errorf("real codebase was modified: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(codebase, "obsolete.txt")); err != nil {
+		t.Errorf("real codebase file was deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(codebase, "added.go")); !os.IsNotExist(err) {
+		t.Error("file was added to the real codebase")
+	}
+
+	// The sandbox reflects the changes and kept the symlink
+	if data, _ := os.ReadFile(filepath.Join(sandbox, "docs/README.md")); string(data) != "new docs\n" {
+		t.Errorf("sandbox should hold the edit, got %q", data)
+	}
+	if link, err := os.Readlink(filepath.Join(sandbox, "link.go")); err != nil || link != "main.go" {
+		t.Errorf("symlink not copied: %q %v", link, err)
+	}
+
+	want := SandboxChanges{
+		Added:    []string{"added.go"},
+		Modified: []string{filepath.Join("docs", "README.md")},
+		Deleted:  []string{"obsolete.txt"},
+	}
+	if got, _ := env.Result["sandbox_changes"].(SandboxChanges); !reflect.DeepEqual(got, want) {
+		t.Errorf("sandbox_changes = %+v, want %+v", got, want)
+	}
+}
+
+func TestDiffTrees_NoChanges(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "dir/b.txt": "b"})
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+	changes, err := diffTrees(src, dst)
+	if err != nil {
+		t.Fatalf("diffTrees: %v", err)
+	}
+	if !changes.Empty() {
+		t.Errorf("an unchanged copy should have no changes, got %+v", changes)
+	}
+}
+
+func TestRun_SandboxSkipsWorkspaceAndGit(t *testing.T) {
+	// Running from $HOME puts the workspace inside the codebase
+	codebase := t.TempDir()
+	t.Setenv("HOME", codebase)
+	writeTree(t, codebase, map[string]string{
+		"main.go":   "package main\n",
+		".git/HEAD": "ref: refs/heads/main\n",
+	})
+
+	var workDir string
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		workDir = ctx.Inputs["codebase"]
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	o.SetSandbox(true)
+
+	b := &bundle.Bundle{Name: "sandboxed", Steps: []bundle.Step{{Name: "look", Tool: "claude"}}}
+	env, err := o.Run(b, map[string]string{"codebase": codebase})
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("Run: %v %+v", err, env)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "main.go")); err != nil {
+		t.Errorf("sandbox should hold the codebase: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git should not be copied, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, ".rcodegen", "workspace")); !os.IsNotExist(err) {
+		t.Errorf("the workspace should not be copied into the sandbox, got %v", err)
+	}
+	if got, _ := env.Result["sandbox_changes"].(SandboxChanges); !got.Empty() {
+		t.Errorf("skipped directories should not show as changes, got %+v", got)
+	}
+}
+
+func TestDiffTrees_SameSizeEdit(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "aaaa", "b.txt": "bbbb"})
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree: %v", err)
+	}
+
+	// An edit that keeps the size is found by its hash; a file only touched
+	// hashes the same
+	writeTree(t, dst, map[string]string{"a.txt": "AAAA"})
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dst, "b.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := diffTrees(src, dst)
+	if err != nil {
+		t.Fatalf("diffTrees: %v", err)
+	}
+	if want := (SandboxChanges{Modified: []string{"a.txt"}}); !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %+v, want %+v", changes, want)
+	}
+}
@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// SecretMask replaces secret values in anything rcodegen writes out
+const SecretMask = "********"
+
+// secret returns the value of the environment variable NAME referenced as
+// ${secret.NAME}, remembering it so it can be masked in logs and outputs.
+// The second result is false when the variable is unset or empty.
+func (c *Context) secret(name string) (string, bool) {
+	v := os.Getenv(name)
+	if v == "" {
+		return "", false
+	}
+
+	c.secretMu.Lock()
+	defer c.secretMu.Unlock()
+	if c.secrets == nil {
+		c.secrets = make(map[string]string)
+	}
+	c.secrets[name] = v
+	return v, true
+}
+
+// MaskSecrets replaces the value of every secret resolved so far with
+// SecretMask. Use it on anything derived from a resolved task before it is
+// logged, persisted or exported.
+func (c *Context) MaskSecrets(s string) string {
+	c.secretMu.Lock()
+	values := make([]string, 0, len(c.secrets))
+	for _, v := range c.secrets {
+		values = append(values, v)
+	}
+	c.secretMu.Unlock()
+
+	if len(values) == 0 || s == "" {
+		return s
+	}
+	// Longest first, so a secret containing another is masked whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, SecretMask)
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContext_Resolve_Secret(t *testing.T) {
+	t.Setenv("RCODEGEN_TEST_TOKEN", "s3cr3t-value")
+	ctx := NewContext(map[string]string{})
+
+	got := ctx.Resolve("Deploy with token ${secret.RCODEGEN_TEST_TOKEN}")
+	if got != "Deploy with token s3cr3t-value" {
+		t.Errorf("Resolve = %q, want the secret value substituted", got)
+	}
+	if got := ctx.Resolve("${secret.RCODEGEN_TEST_UNSET}"); got != "${secret.RCODEGEN_TEST_UNSET}" {
+		t.Errorf("unset secret should stay unresolved, got %q", got)
+	}
+}
+
+func TestContext_MaskSecrets(t *testing.T) {
+	t.Setenv("RCODEGEN_TEST_TOKEN", "s3cr3t-value")
+	t.Setenv("RCODEGEN_TEST_LONG", "s3cr3t-value-extended")
+	ctx := NewContext(map[string]string{})
+
+	logLine := "curl -H 'Authorization: s3cr3t-value' https://example.com"
+	if got := ctx.MaskSecrets(logLine); got != logLine {
+		t.Errorf("nothing should be masked before a secret is resolved, got %q", got)
+	}
+
+	ctx.Resolve("${secret.RCODEGEN_TEST_TOKEN} ${secret.RCODEGEN_TEST_LONG}")
+
+	masked := ctx.MaskSecrets(logLine + "\nlong: s3cr3t-value-extended")
+	if strings.Contains(masked, "s3cr3t") {
+		t.Errorf("secret leaked into masked output: %q", masked)
+	}
+	want := "curl -H 'Authorization: " + SecretMask + "' https://example.com\nlong: " + SecretMask
+	if masked != want {
+		t.Errorf("MaskSecrets = %q, want %q", masked, want)
+	}
+}
+
+func TestRenderTask_GoTemplateSecret(t *testing.T) {
+	t.Setenv("RCODEGEN_TEST_TOKEN", "s3cr3t-value")
+	ctx := NewContext(map[string]string{})
+	ctx.SetTemplateEngine(TemplateGo)
+
+	got, err := ctx.RenderTask(`token={{secret "RCODEGEN_TEST_TOKEN"}}`)
+	if err != nil {
+		t.Fatalf("RenderTask: %v", err)
+	}
+	if got != "token=s3cr3t-value" {
+		t.Errorf("RenderTask = %q", got)
+	}
+	if masked := ctx.MaskSecrets(got); masked != "token="+SecretMask {
+		t.Errorf("secret read by a template should be masked, got %q", masked)
+	}
+}
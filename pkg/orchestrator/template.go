@@ -0,0 +1,126 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"rcodegen/pkg/workspace"
+)
+
+// Template engines selectable per bundle
+const (
+	TemplateSimple = "simple" // ${inputs.x} / ${steps.x.y} substitution (default)
+	TemplateGo     = "go"     // Go text/template with conditionals and ranges
+)
+
+// TemplateData is the data exposed to Go templates
+type TemplateData struct {
+	Inputs map[string]string
+	Const  map[string]string
+	Steps  map[string]StepData
+	Item   string // Current item of the enclosing foreach step
+
+	// Failure is the failed step being handled, in a bundle's on_failure
+	Failure FailureData
+}
+
+// FailureData exposes a failed step to a bundle's on_failure step
+type FailureData struct {
+	Step    string
+	Message string
+}
+
+// StepData exposes a completed step to Go templates. Output, Stdout and
+// Stderr are methods so step files are only read when a template uses them.
+type StepData struct {
+	Name      string
+	Status    string
+	OutputRef string
+	Result    map[string]interface{}
+
+	store workspace.OutputStore
+}
+
+func (s StepData) Output() string { return s.stream("output") }
+func (s StepData) Stdout() string { return s.stream("stdout") }
+func (s StepData) Stderr() string { return s.stream("stderr") }
+
+func (s StepData) stream(name string) string {
+	if s.OutputRef == "" {
+		return ""
+	}
+	store := s.store
+	if store == nil {
+		store = workspace.LocalStore{}
+	}
+	content, ok := readStepStream(store, s.OutputRef, name)
+	if !ok {
+		return ""
+	}
+	return extractStreamingResult(content)
+}
+
+// SetTemplateEngine selects how RenderTask expands task templates
+func (c *Context) SetTemplateEngine(engine string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templateEngine = engine
+}
+
+// RenderTask expands a step's task with the bundle's template engine.
+// The simple engine never fails; Go templates report parse and exec errors.
+// Go templates read secrets with {{secret "NAME"}}.
+func (c *Context) RenderTask(s string) (string, error) {
+	c.mu.RLock()
+	engine := c.templateEngine
+	c.mu.RUnlock()
+
+	if engine != TemplateGo {
+		return c.Resolve(s), nil
+	}
+
+	secret := func(name string) string {
+		v, _ := c.secret(name)
+		return v
+	}
+	tmpl, err := template.New("task").Funcs(template.FuncMap{"secret": secret}).Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("parsing task template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, c.templateData()); err != nil {
+		return "", fmt.Errorf("rendering task template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// templateData snapshots the context for template execution
+func (c *Context) templateData() TemplateData {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	steps := make(map[string]StepData, len(c.StepResults))
+	for name, env := range c.StepResults {
+		if env == nil {
+			continue
+		}
+		steps[name] = StepData{
+			Name:      name,
+			Status:    string(env.Status),
+			OutputRef: env.OutputRef,
+			Result:    env.Result,
+			store:     c.outputStore(),
+		}
+	}
+	return TemplateData{
+		Inputs: c.Inputs,
+		Const:  c.Constants,
+		Steps:  steps,
+		Item:   c.Variables["item"],
+		Failure: FailureData{
+			Step:    c.Variables["failure.step"],
+			Message: c.Variables["failure.message"],
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rcodegen/pkg/envelope"
+)
+
+func newTemplateContext(t *testing.T) *Context {
+	t.Helper()
+	outputFile := filepath.Join(t.TempDir(), "summary.json")
+	data, _ := json.Marshal(map[string]string{"output": "all clear", "stdout": "all clear", "stderr": ""})
+	if err := os.WriteFile(outputFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext(map[string]string{"project": "rcodegen"})
+	ctx.SetConstants(map[string]string{"model": "opus"})
+	ctx.SetResult("scan", &envelope.Envelope{
+		Status: envelope.StatusSuccess,
+		Result: map[string]interface{}{
+			"files": []interface{}{"main.go", "parser.go", "lexer.go"},
+		},
+	})
+	ctx.SetResult("summary", &envelope.Envelope{Status: envelope.StatusSuccess, OutputRef: outputFile})
+	ctx.SetTemplateEngine(TemplateGo)
+	return ctx
+}
+
+func TestRenderTask_GoRangeOverStepResult(t *testing.T) {
+	ctx := newTemplateContext(t)
+
+	task := "Review {{.Inputs.project}}:\n{{range .Steps.scan.Result.files}}- {{.}}\n{{end}}"
+	got, err := ctx.RenderTask(task)
+	if err != nil {
+		t.Fatalf("RenderTask() error: %v", err)
+	}
+	want := "Review rcodegen:\n- main.go\n- parser.go\n- lexer.go\n"
+	if got != want {
+		t.Errorf("RenderTask() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderTask_GoConditionalsAndOutput(t *testing.T) {
+	ctx := newTemplateContext(t)
+
+	tests := []struct {
+		name string
+		task string
+		want string
+	}{
+		{"if on status", `{{if eq .Steps.scan.Status "success"}}scan ok{{else}}scan failed{{end}}`, "scan ok"},
+		{"constant", "Use {{.Const.model}}", "Use opus"},
+		{"step output", "Summary: {{.Steps.summary.Output}}", "Summary: all clear"},
+		{"len of result array", "{{len .Steps.scan.Result.files}} files", "3 files"},
+		{"simple syntax is literal", "${inputs.project}", "${inputs.project}"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ctx.RenderTask(tc.task)
+			if err != nil {
+				t.Fatalf("RenderTask() error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("RenderTask(%q) = %q, want %q", tc.task, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderTask_GoParseError(t *testing.T) {
+	ctx := newTemplateContext(t)
+	if _, err := ctx.RenderTask("{{range .Steps}}unterminated"); err == nil {
+		t.Error("expected a parse error for an unterminated range")
+	}
+}
+
+func TestRenderTask_SimpleEngineDefault(t *testing.T) {
+	ctx := NewContext(map[string]string{"project": "rcodegen"})
+
+	got, err := ctx.RenderTask("Review ${inputs.project} {{.Inputs.project}}")
+	if err != nil {
+		t.Fatalf("RenderTask() error: %v", err)
+	}
+	if got != "Review rcodegen {{.Inputs.project}}" {
+		t.Errorf("simple engine should only expand ${...}, got %q", got)
+	}
+}
+
+func TestRenderTask_GoFailure(t *testing.T) {
+	ctx := newTemplateContext(t)
+	task := "{{if .Failure.Step}}{{.Failure.Step}} failed: {{.Failure.Message}}{{end}}"
+	if got, _ := ctx.RenderTask(task); got != "" {
+		t.Errorf("RenderTask() before a failure = %q, want empty", got)
+	}
+
+	ctx.BindFailure("scan", "boom")
+	got, err := ctx.RenderTask(task)
+	if err != nil {
+		t.Fatalf("RenderTask() error: %v", err)
+	}
+	if got != "scan failed: boom" {
+		t.Errorf("RenderTask() = %q", got)
+	}
+	if got := ctx.Resolve("${failure.step}/${failure.message}"); got != "scan/boom" {
+		t.Errorf("Resolve() = %q", got)
+	}
+}
@@ -0,0 +1,27 @@
+package orchestrator
+
+import "rcodegen/pkg/bundle"
+
+// SelectTool applies a step's tool_if rules: it returns a copy of step with
+// the tool and model of the first rule whose condition holds, or step itself
+// when none does. The copy has no rules left, so selecting again is a no-op.
+// A rule naming a tool uses its own model, the tool's default when empty; a
+// rule with only a model keeps the step's tool.
+func SelectTool(step *bundle.Step, ctx *Context) *bundle.Step {
+	if step == nil || len(step.ToolIf) == 0 {
+		return step
+	}
+	c := *step
+	c.ToolIf = nil
+	for _, rule := range step.ToolIf {
+		if !EvaluateCondition(rule.If, ctx) {
+			continue
+		}
+		if rule.Tool != "" {
+			c.Tool = rule.Tool
+		}
+		c.Model = rule.Model
+		break
+	}
+	return &c
+}
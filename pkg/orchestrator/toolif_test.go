@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func TestSelectTool(t *testing.T) {
+	ctx := NewContext(map[string]string{"depth": "deep"})
+	ctx.SetResult("triage", envelope.New().Success().WithResult("complexity", 8).Build())
+
+	step := &bundle.Step{Name: "fix", Tool: "gemini", Model: "gemini-flash", ToolIf: []bundle.ToolRule{
+		{If: "${steps.triage.result.complexity} > 9", Tool: "codex"},
+		{If: "${steps.triage.result.complexity} > 5", Tool: "claude", Model: "opus"},
+		{If: "${inputs.depth} == 'deep'", Tool: "codex"},
+	}}
+	got := SelectTool(step, ctx)
+	if got.Tool != "claude" || got.Model != "opus" || got.ToolIf != nil {
+		t.Errorf("first matching rule should win, got %s/%s", got.Tool, got.Model)
+	}
+	if step.Tool != "gemini" || len(step.ToolIf) != 3 {
+		t.Error("SelectTool should not modify the bundle's step")
+	}
+
+	// A rule with only a model keeps the tool; one with only a tool uses
+	// that tool's default model
+	modelOnly := &bundle.Step{Name: "a", Tool: "claude", Model: "haiku", ToolIf: []bundle.ToolRule{{If: "1 == 1", Model: "opus"}}}
+	if got := SelectTool(modelOnly, ctx); got.Tool != "claude" || got.Model != "opus" {
+		t.Errorf("model-only rule = %s/%s, want claude/opus", got.Tool, got.Model)
+	}
+	toolOnly := &bundle.Step{Name: "b", Tool: "claude", Model: "haiku", ToolIf: []bundle.ToolRule{{If: "1 == 1", Tool: "codex"}}}
+	if got := SelectTool(toolOnly, ctx); got.Tool != "codex" || got.Model != "" {
+		t.Errorf("tool-only rule = %s/%s, want codex with its default model", got.Tool, got.Model)
+	}
+
+	// Without a matching rule the default tool applies
+	none := &bundle.Step{Name: "c", Tool: "claude", Model: "haiku", ToolIf: []bundle.ToolRule{{If: "${inputs.depth} == 'shallow'", Tool: "codex"}}}
+	if got := SelectTool(none, ctx); got.Tool != "claude" || got.Model != "haiku" {
+		t.Errorf("no matching rule = %s/%s, want claude/haiku", got.Tool, got.Model)
+	}
+}
+
+func TestRun_ToolIfSelectsAlternateTool(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	used := map[string]string{}
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		used[step.Name] = step.Tool + "/" + step.Model
+		if step.Name == "triage" {
+			return envelope.New().Success().WithResult("complex", true).Build(), nil
+		}
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	o.SetToolModels(map[string]string{"claude": "sonnet"})
+
+	b := &bundle.Bundle{Name: "tool-if", Steps: []bundle.Step{
+		{Name: "triage", Tool: "gemini"},
+		{Name: "fix", Tool: "gemini", ToolIf: []bundle.ToolRule{
+			{If: "${steps.triage.result.complex} == true", Tool: "claude"},
+		}},
+		{Name: "polish", Tool: "gemini", ToolIf: []bundle.ToolRule{
+			{If: "${steps.triage.result.complex} == false", Tool: "claude"},
+		}},
+	}}
+	if _, err := o.Run(b, map[string]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if used["fix"] != "claude/sonnet" {
+		t.Errorf("fix ran with %s, want claude with its --model default", used["fix"])
+	}
+	if used["polish"] != "gemini/" {
+		t.Errorf("polish ran with %s, want its default gemini", used["polish"])
+	}
+}
@@ -0,0 +1,139 @@
+package orchestrator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Span is a traced unit of a run: the run itself, or one of its steps as a
+// child of the run's span. IDs are hex encoded as in OpenTelemetry.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string // Empty for the run's root span
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Failed     bool
+	Error      string // Why it failed
+}
+
+// SpanExporter receives a run's spans once it completes, e.g. to send them
+// to an OpenTelemetry collector (see OTLPExporter)
+type SpanExporter interface {
+	ExportSpans(spans []Span) error
+}
+
+// SetSpanExporter traces every run, passing its spans to exp when it
+// completes (nil turns tracing off). New sets an OTLPExporter when an OTLP
+// endpoint is configured.
+func (o *Orchestrator) SetSpanExporter(exp SpanExporter) {
+	o.spanExporter = exp
+}
+
+// tracer builds a run's spans from its events. The event bus serializes
+// OnEvent calls, so it needs no lock of its own.
+type tracer struct {
+	exporter SpanExporter
+	root     *Span
+	open     map[int]*Span // Running steps by index
+	spans    []Span
+}
+
+func newTracer(exp SpanExporter) *tracer {
+	return &tracer{exporter: exp, open: make(map[int]*Span)}
+}
+
+func (t *tracer) OnEvent(e Event) {
+	switch e.Type {
+	case EventRunStart:
+		t.root = &Span{
+			TraceID: newTraceID(16),
+			SpanID:  newTraceID(8),
+			Name:    "run " + e.Bundle,
+			Start:   e.Time,
+			Attributes: map[string]interface{}{
+				"rcodegen.bundle": e.Bundle,
+				"rcodegen.job_id": e.JobID,
+				"rcodegen.steps":  e.Steps,
+			},
+		}
+	case EventStepStart:
+		if t.root == nil {
+			return
+		}
+		t.open[e.Index] = t.stepSpan(e)
+	case EventStepComplete, EventStepSkipped:
+		if t.root == nil {
+			return
+		}
+		span, ok := t.open[e.Index]
+		if !ok {
+			span = t.stepSpan(e)
+		}
+		delete(t.open, e.Index)
+		status := e.Status
+		if e.Type == EventStepSkipped {
+			status = "skipped"
+		}
+		if e.Model != "" {
+			span.Attributes["rcodegen.model"] = e.Model
+		}
+		span.Attributes["rcodegen.status"] = status
+		span.Attributes["rcodegen.cost_usd"] = e.CostUSD
+		span.Attributes["rcodegen.input_tokens"] = e.InputTokens
+		span.Attributes["rcodegen.output_tokens"] = e.OutputTokens
+		t.end(span, e)
+	case EventRunComplete:
+		if t.root == nil {
+			return
+		}
+		t.root.Attributes["rcodegen.status"] = e.Status
+		t.root.Attributes["rcodegen.cost_usd"] = e.CostUSD
+		t.root.Attributes["rcodegen.input_tokens"] = e.InputTokens
+		t.root.Attributes["rcodegen.output_tokens"] = e.OutputTokens
+		t.end(t.root, e)
+		if err := t.exporter.ExportSpans(t.spans); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to export trace: %v\n", err)
+		}
+		t.root, t.spans = nil, nil
+	}
+}
+
+// stepSpan starts the span of the step an event is about
+func (t *tracer) stepSpan(e Event) *Span {
+	span := &Span{
+		TraceID:  t.root.TraceID,
+		SpanID:   newTraceID(8),
+		ParentID: t.root.SpanID,
+		Name:     "step " + e.Step,
+		Start:    e.Time,
+		Attributes: map[string]interface{}{
+			"rcodegen.step": e.Step,
+			"rcodegen.tool": e.Tool,
+		},
+	}
+	if e.Model != "" {
+		span.Attributes["rcodegen.model"] = e.Model
+	}
+	return span
+}
+
+// end finishes a span with the outcome of the event ending it
+func (t *tracer) end(span *Span, e Event) {
+	span.End = e.Time
+	span.Failed = e.Status == "failure"
+	span.Error = e.Error
+	t.spans = append(t.spans, *span)
+}
+
+// newTraceID returns n random bytes, hex encoded
+func newTraceID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,173 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/settings"
+)
+
+// memoryExporter keeps exported spans for inspection
+type memoryExporter struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+func (m *memoryExporter) ExportSpans(spans []Span) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spans = append(m.spans, spans...)
+	return nil
+}
+
+func TestRun_TracesStepsAsChildSpans(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		if step.Name == "check" {
+			return envelope.New().Failure("TESTS_FAILED", "2 tests failed").Build(), nil
+		}
+		return envelope.New().Success().
+			WithResult("cost_usd", 0.12).
+			WithResult("model", "opus").
+			Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+	exp := &memoryExporter{}
+	o.SetSpanExporter(exp)
+
+	b := &bundle.Bundle{Name: "traced", Steps: []bundle.Step{
+		{Name: "build", Tool: "claude"},
+		{Name: "check", Tool: "codex"},
+	}}
+	o.Run(b, map[string]string{})
+
+	if len(exp.spans) != 3 {
+		t.Fatalf("got %d spans, want the run and one per step: %+v", len(exp.spans), exp.spans)
+	}
+	build, check, root := exp.spans[0], exp.spans[1], exp.spans[2]
+
+	if root.ParentID != "" || root.Name != "run traced" || !root.Failed {
+		t.Errorf("root span = %+v", root)
+	}
+	if len(root.TraceID) != 32 || len(root.SpanID) != 16 {
+		t.Errorf("IDs %q/%q should be 16 and 8 hex bytes", root.TraceID, root.SpanID)
+	}
+	for _, s := range []Span{build, check} {
+		if s.TraceID != root.TraceID || s.ParentID != root.SpanID {
+			t.Errorf("step span %s is not a child of the run: %+v", s.Name, s)
+		}
+		if s.End.Before(s.Start) || s.Start.Before(root.Start) || root.End.Before(s.End) {
+			t.Errorf("step span %s times fall outside the run", s.Name)
+		}
+	}
+
+	want := map[string]interface{}{
+		"rcodegen.step":     "build",
+		"rcodegen.tool":     "claude",
+		"rcodegen.model":    "opus",
+		"rcodegen.cost_usd": 0.12,
+		"rcodegen.status":   "success",
+	}
+	for k, v := range want {
+		if build.Attributes[k] != v {
+			t.Errorf("build %s = %v, want %v", k, build.Attributes[k], v)
+		}
+	}
+	if build.Failed {
+		t.Error("build span should not be failed")
+	}
+	if !check.Failed || check.Error != "2 tests failed" || check.Attributes["rcodegen.status"] != "failure" || check.Attributes["rcodegen.tool"] != "codex" {
+		t.Errorf("check span = %+v", check)
+	}
+}
+
+func TestRun_NotTracedWithoutExporter(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if o := New(&settings.Settings{}); o.spanExporter != nil {
+		t.Error("tracing should be off unless an endpoint is configured")
+	}
+}
+
+func TestOTLPEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		name, traces, base, disabled, setting, want string
+	}{
+		{name: "none"},
+		{name: "setting", setting: "http://collector:4318/", want: "http://collector:4318/v1/traces"},
+		{name: "env over setting", base: "http://env:4318", setting: "http://collector:4318", want: "http://env:4318/v1/traces"},
+		{name: "traces endpoint as-is", traces: "http://env:4318/custom", base: "http://other:4318", want: "http://env:4318/custom"},
+		{name: "disabled", base: "http://env:4318", disabled: "true"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", tc.traces)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tc.base)
+			t.Setenv("OTEL_SDK_DISABLED", tc.disabled)
+			if got := otlpEndpoint(&settings.Settings{OTLPEndpoint: tc.setting}); got != tc.want {
+				t.Errorf("otlpEndpoint = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOTLPExporter_PostsSpans(t *testing.T) {
+	var got map[string]interface{}
+	var path, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1700000000, 0)
+	err := NewOTLPExporter(srv.URL + "/v1/traces").ExportSpans([]Span{{
+		TraceID:    "0af7651916cd43dd8448eb211c80319c",
+		SpanID:     "b7ad6b7169203331",
+		ParentID:   "00f067aa0ba902b7",
+		Name:       "step build",
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]interface{}{"rcodegen.tool": "claude", "rcodegen.cost_usd": 0.5, "rcodegen.input_tokens": 42},
+		Failed:     true,
+		Error:      "boom",
+	}})
+	if err != nil {
+		t.Fatalf("ExportSpans: %v", err)
+	}
+	if path != "/v1/traces" || contentType != "application/json" {
+		t.Errorf("posted to %s as %s", path, contentType)
+	}
+
+	spans := got["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	span := spans[0].(map[string]interface{})
+	if span["parentSpanId"] != "00f067aa0ba902b7" || span["startTimeUnixNano"] != "1700000000000000000" || span["endTimeUnixNano"] != "1700000001000000000" {
+		t.Errorf("span = %v", span)
+	}
+	if status := span["status"].(map[string]interface{}); status["code"] != 2.0 || status["message"] != "boom" {
+		t.Errorf("status = %v", status)
+	}
+	attrs, _ := json.Marshal(span["attributes"])
+	want := `[{"key":"rcodegen.cost_usd","value":{"doubleValue":0.5}},{"key":"rcodegen.input_tokens","value":{"intValue":"42"}},{"key":"rcodegen.tool","value":{"stringValue":"claude"}}]`
+	if string(attrs) != want {
+		t.Errorf("attributes = %s\nwant %s", attrs, want)
+	}
+}
+
+func TestOTLPExporter_ReportsHTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := NewOTLPExporter(srv.URL).ExportSpans([]Span{{Name: "run"}})
+	if err == nil {
+		t.Fatal("expected an error for a 400 response")
+	}
+}
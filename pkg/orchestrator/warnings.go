@@ -0,0 +1,94 @@
+package orchestrator
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+// runWarnings collects the problems a run noticed but carried on past, so
+// they are reported on the run envelope and in the final summary instead of
+// only scrolling by on stderr
+type runWarnings struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (w *runWarnings) add(format string, args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = append(w.list, fmt.Sprintf(format, args...))
+}
+
+// all returns the warnings collected so far, in the order they were raised
+func (w *runWarnings) all() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.list...)
+}
+
+// checkCondition warns when a step's condition references something
+// unresolved, which lenient bundles evaluate against the literal reference
+func (w *runWarnings) checkCondition(step *bundle.Step, ctx *Context) {
+	if ref := unresolvedReference(step.If, ctx); ref != "" {
+		w.add("step %s: condition references %s, which is not resolved", step.Name, ref)
+	}
+}
+
+// taskNamespaces are the reference namespaces checked in tasks; anything
+// else, like a shell's ${HOME}, is left to the tool
+var taskNamespaces = map[string]bool{"inputs": true, "const": true, "env": true, "secret": true, "steps": true}
+
+// checkTask warns about ${...} references in a step's task, or those of its
+// parallel substeps, that nothing resolves: they reach the tool literally
+func (w *runWarnings) checkTask(step *bundle.Step, ctx *Context) {
+	for _, match := range varPattern.FindAllStringSubmatch(step.Task, -1) {
+		namespace, _, _ := strings.Cut(match[1], ".")
+		if taskNamespaces[namespace] && ctx.Resolve(match[0]) == match[0] {
+			w.add("step %s: task references %s, which is not resolved", step.Name, match[0])
+		}
+	}
+	for i := range step.Parallel {
+		w.checkTask(&step.Parallel[i], ctx)
+	}
+}
+
+// addStepResult records the warnings carried by a completed step's result,
+// and by those of its parallel substeps
+func (w *runWarnings) addStepResult(step *bundle.Step, env *envelope.Envelope, ctx *Context) {
+	if env != nil {
+		if warning, ok := env.Result["prompt_warning"].(string); ok && warning != "" {
+			w.add("%s", warning)
+		}
+	}
+	for i := range step.Parallel {
+		child, _ := ctx.GetResult(step.Parallel[i].Name)
+		w.addStepResult(&step.Parallel[i], child, ctx)
+	}
+}
+
+// withWarnings returns a copy of env carrying warnings after its own
+func withWarnings(env *envelope.Envelope, warnings []string) *envelope.Envelope {
+	if len(warnings) == 0 {
+		return env
+	}
+	out := *env
+	out.Warnings = append(append([]string(nil), env.Warnings...), warnings...)
+	return &out
+}
+
+// writeWarnings prints the run's warnings under the final summary
+func writeWarnings(out io.Writer, warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "  %sWarnings:%s\n", colorYellow, colorReset)
+	for _, warning := range warnings {
+		fmt.Fprintf(out, "    %s•%s %s\n", colorYellow, colorReset, warning)
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,86 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+)
+
+func TestRun_CollectsWarningsOnEnvelope(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		builder := envelope.New().Success()
+		if step.Name == "analyze" {
+			builder.WithResult("prompt_warning", "prompt for analyze is 9000 tokens")
+		}
+		return builder.Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name: "warned",
+		Steps: []bundle.Step{
+			{Name: "analyze", Tool: "claude", Task: "Analyze ${inputs.codebase} in ${HOME}"},
+			{Name: "fix", Tool: "claude", If: "${steps.analyse.status} == 'success'"},
+			{Name: "report", Tool: "claude", Task: "Report on ${inputs.topic:-everything}"},
+		},
+	}
+	env, err := o.Run(b, map[string]string{})
+	if err != nil || env.Status != envelope.StatusSuccess {
+		t.Fatalf("warnings should not fail the run, got %v %+v", err, env)
+	}
+
+	want := []string{
+		"step analyze: task references ${inputs.codebase}, which is not resolved",
+		"prompt for analyze is 9000 tokens",
+		"step fix: condition references ${steps.analyse.status}, which is not resolved",
+	}
+	if strings.Join(env.Warnings, "\n") != strings.Join(want, "\n") {
+		t.Errorf("warnings = %q, want %q", env.Warnings, want)
+	}
+
+	data, _ := json.Marshal(env)
+	if !strings.Contains(string(data), `"warnings":[`) {
+		t.Errorf("warnings should be serialized with the envelope: %s", data)
+	}
+}
+
+func TestRun_FailedRunKeepsWarnings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Failure("TOOL_FAILED", "boom").Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name:  "failing",
+		Steps: []bundle.Step{{Name: "build", Tool: "claude", Task: "Build ${steps.plan.output}"}},
+	}
+	env, _ := o.Run(b, map[string]string{})
+	if len(env.Warnings) != 1 || !strings.Contains(env.Warnings[0], "${steps.plan.output}") {
+		t.Errorf("failed run should carry its warnings, got %q", env.Warnings)
+	}
+}
+
+func TestRun_NoWarnings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	o := &Orchestrator{dispatcher: funcExecutor(func(step *bundle.Step, ctx *Context) (*envelope.Envelope, error) {
+		return envelope.New().Success().Build(), nil
+	})}
+	o.SetDisplay(newRecordingDisplay())
+
+	b := &bundle.Bundle{
+		Name:  "clean",
+		Steps: []bundle.Step{{Name: "build", Tool: "claude", Task: "Build ${inputs.task}"}},
+	}
+	env, _ := o.Run(b, map[string]string{"task": "a CLI"})
+	if env.Warnings != nil {
+		t.Errorf("clean run should have no warnings, got %q", env.Warnings)
+	}
+}
@@ -1,6 +1,12 @@
 package runner
 
-import "rcodegen/pkg/colors"
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"rcodegen/pkg/colors"
+)
 
 // Re-export color constants from colors package for backwards compatibility.
 // New code should import rcodegen/pkg/colors directly.
@@ -55,6 +61,11 @@ type Config struct {
 	SessionID   string // Session ID for resuming previous session
 	Flash       bool   // Gemini: use flash model variant
 
+	// SystemPromptFile adds to the tool's built-in system prompt: Claude
+	// appends it through --append-system-prompt-file, tools without an
+	// append channel get it ahead of the task (see PrependSystemPrompt)
+	SystemPromptFile string
+
 	// Execution control
 	DryRun bool // If true, show what would be executed without running
 
@@ -69,3 +80,23 @@ func NewConfig() *Config {
 		Vars: make(map[string]string),
 	}
 }
+
+// PrependSystemPrompt returns task preceded by the contents of the system
+// prompt file, for tools whose only system prompt channel would replace
+// their built-in instructions rather than add to them. An unreadable file
+// is reported and the task returned unchanged.
+func PrependSystemPrompt(path, task string) string {
+	if path == "" {
+		return task
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning:%s Could not read system prompt file: %v\n", Yellow, Reset, err)
+		return task
+	}
+	instructions := strings.TrimSpace(string(data))
+	if instructions == "" {
+		return task
+	}
+	return instructions + "\n\n" + task
+}
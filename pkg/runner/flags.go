@@ -116,6 +116,8 @@ func CommonFlagGroups() []FlagAliases {
 		{Names: []string{"-r", "--recursive"}, TakesArg: false},
 		{Names: []string{"--levels"}, TakesArg: true},
 		{Names: []string{"--list"}, TakesArg: true},
+		{Names: []string{"--task"}, TakesArg: true},
+		{Names: []string{"--task-file"}, TakesArg: true},
 	}
 }
 
@@ -162,7 +164,8 @@ func reorderArgsForFlagParsing(args []string, flagGroups []FlagAliases) []string
 			if knownFlags[arg] {
 				flagArgs = append(flagArgs, arg)
 				// If it takes an argument, include the next arg too
-				if flagTakesArg[arg] && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				// ("-" alone is a value, meaning stdin)
+				if flagTakesArg[arg] && i+1 < len(args) && (args[i+1] == "-" || !strings.HasPrefix(args[i+1], "-")) {
 					i++
 					flagArgs = append(flagArgs, args[i])
 				}
@@ -211,6 +211,16 @@ func TestReorderArgsForFlagParsing(t *testing.T) {
 			args:     []string{"-m", "claude", "-j"},
 			expected: []string{"-m", "claude", "-j"},
 		},
+		{
+			name:     "stdin dash is a flag value",
+			args:     []string{"--task", "-", "-j"},
+			expected: []string{"--task", "-", "-j"},
+		},
+		{
+			name:     "task file after positional",
+			args:     []string{"extra", "--task-file", "prompt.md"},
+			expected: []string{"--task-file", "prompt.md", "extra"},
+		},
 		{
 			name:     "only positional",
 			args:     []string{"task1", "task2"},
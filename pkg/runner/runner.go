@@ -5,6 +5,7 @@ package runner
 import (
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -21,6 +22,9 @@ import (
 // to capture the --no-status flag value, which is then applied after flag.Parse()
 var noTrackStatus bool
 
+// taskStdin is where --task - and --task-file - read the task from
+var taskStdin io.Reader = os.Stdin
+
 // Runner orchestrates the execution of a tool
 type Runner struct {
 	Tool         Tool
@@ -676,6 +680,51 @@ func applyVariableSubstitution(cfg *Config) {
 	}
 }
 
+// resolveTask returns the task given by --task (text, or "-" for stdin),
+// --task-file (a path, or "-" for stdin) or the first positional argument.
+// Only one source may be used.
+func resolveTask(taskText, taskFile string, args []string, stdin io.Reader) (string, error) {
+	sources := 0
+	for _, set := range []bool{taskText != "", taskFile != "", len(args) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("give the task only once: as an argument, with --task, or with --task-file")
+	}
+
+	switch {
+	case taskFile == "-" || taskText == "-":
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading task from stdin: %w", err)
+		}
+		return nonEmptyTask(string(data), "stdin")
+	case taskFile != "":
+		data, err := os.ReadFile(taskFile)
+		if err != nil {
+			return "", fmt.Errorf("reading task file: %w", err)
+		}
+		return nonEmptyTask(string(data), taskFile)
+	case taskText != "":
+		return taskText, nil
+	case len(args) > 0:
+		return args[0], nil
+	}
+	return "", nil
+}
+
+// nonEmptyTask trims surrounding whitespace from a task read from source,
+// which must not be empty
+func nonEmptyTask(task, source string) (string, error) {
+	task = strings.TrimSpace(task)
+	if task == "" {
+		return "", fmt.Errorf("task from %s is empty", source)
+	}
+	return task, nil
+}
+
 // validatePlaceholders checks for unsubstituted placeholders and returns an error if found.
 func validatePlaceholders(task string) error {
 	if task == "" || task == TaskSuite {
@@ -747,6 +796,7 @@ func (r *Runner) parseArgs() (*Config, error) {
 	// Define common flags
 	var codePath, dirPath string
 	var showTasks, showHelp, migrateGrades, migrateGradesAll bool
+	var taskText, taskFile string
 
 	flag.StringVar(&codePath, "c", "", "Project path relative to configured code directory")
 	flag.StringVar(&codePath, "code", "", "Project path relative to configured code directory")
@@ -779,6 +829,8 @@ func (r *Runner) parseArgs() (*Config, error) {
 	flag.BoolVar(&cfg.Recursive, "recursive", false, "Recursively scan subdirectories for git repos")
 	flag.IntVar(&cfg.RecurseLevels, "levels", 1, "Depth of recursive directory scan")
 	flag.StringVar(&cfg.DirList, "list", "", "Comma-separated subdirectory names to process")
+	flag.StringVar(&taskText, "task", "", "Task text, or - to read it from stdin")
+	flag.StringVar(&taskFile, "task-file", "", "Read the task from a file (- for stdin)")
 
 	// Define tool-specific flags
 	r.defineToolSpecificFlags(cfg)
@@ -929,11 +981,12 @@ func (r *Runner) parseArgs() (*Config, error) {
 		r.TaskConfig = r.Settings.ToTaskConfig(cfg.Codebase, r.Tool.ReportPrefix())
 	}
 
-	// Get task from remaining args
-	args := flag.Args()
-	if len(args) > 0 {
-		cfg.Task = args[0]
+	// Get task from --task/--task-file, or the remaining args
+	task, err := resolveTask(taskText, taskFile, flag.Args(), taskStdin)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Task = task
 
 	// Build original command string for summary
 	cfg.OriginalCmd = strings.Join(os.Args[1:], " ")
@@ -1102,6 +1155,8 @@ func (r *Runner) printUsage() {
 	// Execution Options
 	fmt.Printf("%s%sExecution Options:%s\n", Bold, Cyan, Reset)
 	fmt.Printf("  %s-m%s, %s--model%s %s<name>%s    Specify model %s(default: %s)%s\n", Green, Reset, Green, Reset, Yellow, Reset, Dim, r.Tool.DefaultModel(), Reset)
+	fmt.Printf("  %s--task%s %s<text|->%s      Task text, or %s-%s to read it from stdin\n", Green, Reset, Yellow, Reset, Yellow, Reset)
+	fmt.Printf("  %s--task-file%s %s<path>%s   Read the task from a file %s(- for stdin)%s\n", Green, Reset, Yellow, Reset, Dim, Reset)
 	fmt.Printf("  %s-n%s, %s--dry-run%s         Show command without executing\n", Green, Reset, Green, Reset)
 	fmt.Printf("  %s-l%s, %s--lock%s            Queue behind other running %s instances\n", Green, Reset, Green, Reset, toolName)
 	fmt.Printf("  %s-j%s, %s--json%s            Output as newline-delimited JSON\n", Green, Reset, Green, Reset)
@@ -2,6 +2,9 @@ package runner
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -66,3 +69,49 @@ func TestRunError_DifferentCodes(t *testing.T) {
 		}
 	}
 }
+
+func TestResolveTask(t *testing.T) {
+	dir := t.TempDir()
+	promptPath := filepath.Join(dir, "prompt.md")
+	if err := os.WriteFile(promptPath, []byte("\nRefactor the parser.\nKeep the API stable.\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyPath := filepath.Join(dir, "empty.md")
+	if err := os.WriteFile(emptyPath, []byte("  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		file    string
+		args    []string
+		stdin   string
+		want    string
+		wantErr bool
+	}{
+		{name: "positional argument", args: []string{"audit"}, want: "audit"},
+		{name: "task flag", text: "fix the tests", want: "fix the tests"},
+		{name: "task file", file: promptPath, want: "Refactor the parser.\nKeep the API stable."},
+		{name: "task file from stdin", file: "-", stdin: "from a pipe\n", want: "from a pipe"},
+		{name: "task flag from stdin", text: "-", stdin: "piped task", want: "piped task"},
+		{name: "no task", want: ""},
+		{name: "missing file", file: filepath.Join(dir, "missing.md"), wantErr: true},
+		{name: "empty file", file: emptyPath, wantErr: true},
+		{name: "empty stdin", text: "-", stdin: "", wantErr: true},
+		{name: "file and argument", file: promptPath, args: []string{"audit"}, wantErr: true},
+		{name: "flag and file", text: "x", file: promptPath, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := resolveTask(tc.text, tc.file, tc.args, strings.NewReader(tc.stdin))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("resolveTask error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("resolveTask = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
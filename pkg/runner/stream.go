@@ -1,4 +1,5 @@
-// Package runner provides the stream output parser for Claude's stream-json format.
+// Package runner provides the stream output parser for Claude's stream-json
+// format and the Codex and Gemini event streams.
 package runner
 
 import (
@@ -8,6 +9,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 )
 
 // StreamEvent represents a parsed stream-json event from Claude or Gemini
@@ -43,17 +45,27 @@ type GeminiStats struct {
 
 // AssistantMsg represents a message from the assistant
 type AssistantMsg struct {
+	ID      string         `json:"id,omitempty"`
 	Content []ContentBlock `json:"content,omitempty"`
 }
 
 // ContentBlock represents a content block in an assistant message
 type ContentBlock struct {
 	Type  string    `json:"type"`
+	ID    string    `json:"id,omitempty"`
 	Text  string    `json:"text,omitempty"`
 	Name  string    `json:"name,omitempty"`
 	Input json.RawMessage `json:"input,omitempty"`
 }
 
+// ToolUse is a tool call made by the model, as parsed from the stream
+type ToolUse struct {
+	ID    string                 `json:"id,omitempty"`
+	Name  string                 `json:"name"`
+	Input map[string]interface{} `json:"input,omitempty"`
+	Time  time.Time              `json:"time"` // When the event was parsed
+}
+
 // StreamParser processes stream-json output and formats it nicely
 type StreamParser struct {
 	writer       io.Writer
@@ -62,6 +74,22 @@ type StreamParser struct {
 	initialized  bool
 	Usage        *TokenUsage // Captured from result event
 	TotalCostUSD float64     // Captured from result event
+	ToolUses     []ToolUse   // Every tool call seen, in stream order
+
+	// AssistantTurns counts assistant messages and ToolCalls tool calls,
+	// for eval metrics. A message streamed as several events sharing its
+	// ID counts once; Gemini's result stats supply the tool calls when the
+	// stream has no tool_use events.
+	AssistantTurns int
+	ToolCalls      int
+	lastMessageID  string
+
+	seenItems map[string]bool // Codex items already shown
+	inDelta   bool            // Mid-way through a Gemini reply streamed in pieces
+
+	// OnCost, if set, is called with the running total cost each time a
+	// result event reports a new one
+	OnCost func(totalCostUSD float64)
 }
 
 // NewStreamParser creates a new stream parser
@@ -71,8 +99,17 @@ func NewStreamParser(w io.Writer) *StreamParser {
 	}
 }
 
-// ProcessLine processes a single JSON line from stream output
+// ProcessLine processes a single JSON line from stream output: Claude's,
+// Codex's or Gemini's (see stream_formats.go).
+// CRLF and bare CR line endings are treated as LF.
 func (p *StreamParser) ProcessLine(line string) {
+	line = normalizeNewlines(line)
+	if strings.Contains(strings.TrimSpace(line), "\n") {
+		for _, part := range strings.Split(line, "\n") {
+			p.ProcessLine(part)
+		}
+		return
+	}
 	line = strings.TrimSpace(line)
 	if line == "" {
 		return
@@ -85,6 +122,16 @@ func (p *StreamParser) ProcessLine(line string) {
 		return
 	}
 
+	switch {
+	case isGeminiEvent(event.Type):
+		p.handleGemini(line)
+		return
+	case strings.Contains(event.Type, "."):
+		p.handleCodex(line)
+		return
+	}
+	p.endDelta()
+
 	switch event.Type {
 	case "system":
 		p.handleSystem(event)
@@ -121,6 +168,10 @@ func (p *StreamParser) handleAssistant(event StreamEvent) {
 	if event.Message == nil {
 		return
 	}
+	if id := event.Message.ID; id == "" || id != p.lastMessageID {
+		p.AssistantTurns++
+		p.lastMessageID = id
+	}
 
 	for _, content := range event.Message.Content {
 		switch content.Type {
@@ -132,7 +183,7 @@ func (p *StreamParser) handleAssistant(event StreamEvent) {
 					p.inToolUse = false
 				}
 				// Print assistant text with color
-				fmt.Fprintf(p.writer, "%s%s%s\n", White, content.Text, Reset)
+				fmt.Fprintf(p.writer, "%s%s%s\n", White, normalizeNewlines(content.Text), Reset)
 			}
 		case "tool_use":
 			p.handleToolUse(content)
@@ -184,12 +235,14 @@ func (p *StreamParser) handleToolUse(content ContentBlock) {
 
 	// Try to extract useful info from input
 	var inputInfo string
+	var inputMap map[string]interface{}
 	if len(content.Input) > 0 {
-		var inputMap map[string]interface{}
 		if err := json.Unmarshal(content.Input, &inputMap); err == nil {
 			inputInfo = extractToolInfo(toolName, inputMap)
 		}
 	}
+	p.ToolUses = append(p.ToolUses, ToolUse{ID: content.ID, Name: toolName, Input: inputMap, Time: time.Now()})
+	p.ToolCalls++
 
 	// Format: icon name: info
 	if inputInfo != "" {
@@ -289,10 +342,16 @@ func (p *StreamParser) handleResult(event StreamEvent) {
 			OutputTokens:        event.Stats.OutputTokens,
 			CacheReadInputTokens: event.Stats.Cached,
 		}
+		if p.ToolCalls == 0 {
+			p.ToolCalls = event.Stats.ToolCalls
+		}
 	}
 
-	if event.TotalCostUSD > 0 {
+	if event.TotalCostUSD > 0 && event.TotalCostUSD != p.TotalCostUSD {
 		p.TotalCostUSD = event.TotalCostUSD
+		if p.OnCost != nil {
+			p.OnCost(p.TotalCostUSD)
+		}
 	}
 
 	// The result usually contains the final assistant output
@@ -308,6 +367,7 @@ func (p *StreamParser) ProcessReader(r io.Reader) error {
 	// Handle very long lines from stream output
 	buf := make([]byte, 0, 64*1024)
 	scanner.Buffer(buf, 1024*1024) // 1MB max line size
+	scanner.Split(scanLines)
 
 	for scanner.Scan() {
 		p.ProcessLine(scanner.Text())
@@ -315,3 +375,42 @@ func (p *StreamParser) ProcessReader(r io.Reader) error {
 
 	return scanner.Err()
 }
+
+// normalizeNewlines converts CRLF and bare CR line endings to LF
+func normalizeNewlines(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
+
+// scanLines is a bufio.SplitFunc like bufio.ScanLines that also ends
+// lines at CRLF and bare CR, as written by some Windows tools and shells
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, c := range data {
+		switch c {
+		case '\n':
+			return i + 1, data[:i], nil
+		case '\r':
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if !atEOF {
+				// Need the next byte to tell CRLF from a bare CR
+				return 0, nil, nil
+			}
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Codex (codex exec --json) and Gemini (--output-format stream-json) stream
+// events of their own shapes. They are told apart from Claude's by their
+// type: Codex types are dotted ("item.completed"), and Gemini's init,
+// message, tool_use and tool_result events never appear at Claude's top
+// level. Their text, tool calls and usage land in the same fields as
+// Claude's; neither reports a cost.
+
+// codexEvent is one line of codex exec --json output
+type codexEvent struct {
+	Type     string      `json:"type"`
+	ThreadID string      `json:"thread_id,omitempty"`
+	Item     *codexItem  `json:"item,omitempty"`
+	Usage    *codexUsage `json:"usage,omitempty"`
+	Error    *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// codexItem is a unit of a Codex turn: a message, a command, a file change...
+type codexItem struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"` // agent_message, reasoning, command_execution, file_change, mcp_tool_call, web_search, todo_list
+	Text    string `json:"text,omitempty"`
+	Command string `json:"command,omitempty"`
+	Query   string `json:"query,omitempty"`
+	Server  string `json:"server,omitempty"`
+	Tool    string `json:"tool,omitempty"`
+	Changes []struct {
+		Path string `json:"path"`
+		Kind string `json:"kind"`
+	} `json:"changes,omitempty"`
+}
+
+// codexUsage is the token usage of a completed Codex turn
+type codexUsage struct {
+	InputTokens       int `json:"input_tokens"`
+	CachedInputTokens int `json:"cached_input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+}
+
+// geminiEvent is one line of Gemini CLI stream-json output, other than its
+// result event, which shares Claude's shape
+type geminiEvent struct {
+	Type       string          `json:"type"`
+	Role       string          `json:"role,omitempty"`
+	Content    string          `json:"content,omitempty"`
+	Delta      bool            `json:"delta,omitempty"`
+	ToolName   string          `json:"tool_name,omitempty"`
+	ToolID     string          `json:"tool_id,omitempty"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// geminiToolNames maps Gemini's built-in tools to the Claude tools they
+// match, so they are shown the same way
+var geminiToolNames = map[string]string{
+	"read_file":           "Read",
+	"write_file":          "Write",
+	"replace":             "Edit",
+	"run_shell_command":   "Bash",
+	"glob":                "Glob",
+	"search_file_content": "Grep",
+	"web_fetch":           "WebFetch",
+	"google_web_search":   "WebSearch",
+	"write_todos":         "TodoWrite",
+}
+
+// isGeminiEvent reports whether an event type is one only Gemini emits
+func isGeminiEvent(eventType string) bool {
+	switch eventType {
+	case "init", "message", "tool_use", "tool_result":
+		return true
+	}
+	return false
+}
+
+// handleCodex handles a line of codex exec --json output
+func (p *StreamParser) handleCodex(line string) {
+	var event codexEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return
+	}
+	switch event.Type {
+	case "thread.started":
+		if !p.initialized {
+			fmt.Fprintf(p.writer, "%s%s⚡ Codex initialized%s\n", Dim, Cyan, Reset)
+			p.initialized = true
+		}
+	case "item.started", "item.updated", "item.completed":
+		if event.Item != nil {
+			p.handleCodexItem(event.Type, event.Item)
+		}
+	case "turn.completed":
+		if u := event.Usage; u != nil {
+			if p.Usage == nil {
+				p.Usage = &TokenUsage{}
+			}
+			// Each turn reports its own usage
+			p.Usage.InputTokens += u.InputTokens
+			p.Usage.OutputTokens += u.OutputTokens
+			p.Usage.CacheReadInputTokens += u.CachedInputTokens
+		}
+	case "turn.failed":
+		message := "Task failed"
+		if event.Error != nil && event.Error.Message != "" {
+			message += ": " + event.Error.Message
+		}
+		fmt.Fprintf(p.writer, "\n%s%s⚠️  %s%s\n", Bold, Red, message, Reset)
+	}
+}
+
+// handleCodexItem shows a Codex item: messages when they complete, and each
+// tool-like item once, when it is first seen
+func (p *StreamParser) handleCodexItem(eventType string, item *codexItem) {
+	if item.Type == "agent_message" {
+		if eventType == "item.completed" && item.Text != "" {
+			p.AssistantTurns++
+			p.printText(item.Text)
+		}
+		return
+	}
+
+	if p.seenItems[item.ID] {
+		return
+	}
+	var block ContentBlock
+	switch item.Type {
+	case "command_execution":
+		block = toolBlock("Bash", map[string]interface{}{"command": item.Command})
+	case "file_change":
+		if len(item.Changes) == 0 {
+			return
+		}
+		block = toolBlock("Edit", map[string]interface{}{"file_path": item.Changes[0].Path})
+	case "web_search":
+		block = toolBlock("WebSearch", map[string]interface{}{"query": item.Query})
+	case "mcp_tool_call":
+		block = toolBlock(item.Server+"."+item.Tool, nil)
+	default:
+		return // Reasoning and todo lists are not shown
+	}
+	if p.seenItems == nil {
+		p.seenItems = make(map[string]bool)
+	}
+	p.seenItems[item.ID] = true
+	block.ID = item.ID
+	p.handleToolUse(block)
+}
+
+// handleGemini handles a Gemini-only stream-json event
+func (p *StreamParser) handleGemini(line string) {
+	var event geminiEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return
+	}
+	if event.Type != "message" || !event.Delta {
+		p.endDelta()
+	}
+	switch event.Type {
+	case "init":
+		if !p.initialized {
+			fmt.Fprintf(p.writer, "%s%s⚡ Gemini initialized%s\n", Dim, Cyan, Reset)
+			p.initialized = true
+		}
+	case "message":
+		if event.Role != "assistant" || event.Content == "" {
+			return
+		}
+		if !event.Delta {
+			p.AssistantTurns++
+			p.printText(event.Content)
+			return
+		}
+		// A reply streamed in pieces is one turn, written as it arrives
+		if !p.inDelta {
+			p.AssistantTurns++
+			if p.inToolUse {
+				fmt.Fprintln(p.writer)
+				p.inToolUse = false
+			}
+			fmt.Fprint(p.writer, White)
+			p.inDelta = true
+		}
+		fmt.Fprint(p.writer, normalizeNewlines(event.Content))
+	case "tool_use":
+		var input map[string]interface{}
+		json.Unmarshal(event.Parameters, &input)
+		name := event.ToolName
+		if mapped, ok := geminiToolNames[name]; ok {
+			name = mapped
+			// Gemini names the file absolute_path where Claude says file_path
+			if path, ok := input["absolute_path"]; ok && input["file_path"] == nil {
+				input["file_path"] = path
+			}
+		}
+		block := toolBlock(name, input)
+		block.ID = event.ToolID
+		p.handleToolUse(block)
+	}
+}
+
+// endDelta finishes a reply that was being streamed in pieces
+func (p *StreamParser) endDelta() {
+	if p.inDelta {
+		fmt.Fprintf(p.writer, "%s\n", Reset)
+		p.inDelta = false
+	}
+}
+
+// printText writes assistant text the way Claude's is written
+func (p *StreamParser) printText(text string) {
+	if p.inToolUse {
+		fmt.Fprintln(p.writer)
+		p.inToolUse = false
+	}
+	fmt.Fprintf(p.writer, "%s%s%s\n", White, normalizeNewlines(strings.TrimRight(text, "\n")), Reset)
+}
+
+// toolBlock builds a tool_use content block for handleToolUse
+func toolBlock(name string, input map[string]interface{}) ContentBlock {
+	block := ContentBlock{Type: "tool_use", Name: name}
+	if input != nil {
+		block.Input, _ = json.Marshal(input)
+	}
+	return block
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStreamParser_Codex(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+	for _, line := range []string{
+		`{"type":"thread.started","thread_id":"0199a213-81c0-7800-8aa1-bbab2a035a53"}`,
+		`{"type":"turn.started"}`,
+		`{"type":"item.completed","item":{"id":"item_0","type":"reasoning","text":"**Scanning the repo**"}}`,
+		`{"type":"item.started","item":{"id":"item_1","type":"command_execution","command":"bash -lc ls","aggregated_output":"","exit_code":null,"status":"in_progress"}}`,
+		`{"type":"item.completed","item":{"id":"item_1","type":"command_execution","command":"bash -lc ls","aggregated_output":"README.md\n","exit_code":0,"status":"completed"}}`,
+		`{"type":"item.completed","item":{"id":"item_2","type":"file_change","changes":[{"path":"/repo/main.go","kind":"update"}],"status":"completed"}}`,
+		`{"type":"item.completed","item":{"id":"item_3","type":"agent_message","text":"Fixed the bug in main.go."}}`,
+		`{"type":"turn.completed","usage":{"input_tokens":24763,"cached_input_tokens":24448,"output_tokens":122}}`,
+	} {
+		p.ProcessLine(line)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"Codex initialized", "Running command", "bash -lc ls", "Editing file", "Fixed the bug in main.go."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Scanning the repo") {
+		t.Error("reasoning should not be shown")
+	}
+	if strings.Count(out, "bash -lc ls") != 1 {
+		t.Errorf("a command started and completed should show once:\n%s", out)
+	}
+	if p.ToolCalls != 2 || len(p.ToolUses) != 2 || p.ToolUses[0].Name != "Bash" || p.ToolUses[1].Name != "Edit" {
+		t.Errorf("ToolCalls = %d, ToolUses = %+v", p.ToolCalls, p.ToolUses)
+	}
+	if p.AssistantTurns != 1 {
+		t.Errorf("AssistantTurns = %d, want 1", p.AssistantTurns)
+	}
+	if p.Usage == nil || p.Usage.InputTokens != 24763 || p.Usage.OutputTokens != 122 || p.Usage.CacheReadInputTokens != 24448 {
+		t.Errorf("Usage = %+v", p.Usage)
+	}
+	if p.TotalCostUSD != 0 {
+		t.Errorf("TotalCostUSD = %v, Codex reports no cost", p.TotalCostUSD)
+	}
+
+	// Usage adds up over turns
+	p.ProcessLine(`{"type":"turn.completed","usage":{"input_tokens":100,"cached_input_tokens":0,"output_tokens":10}}`)
+	if p.Usage.InputTokens != 24863 || p.Usage.OutputTokens != 132 {
+		t.Errorf("Usage after a second turn = %+v", p.Usage)
+	}
+}
+
+func TestStreamParser_CodexTurnFailed(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+	p.ProcessLine(`{"type":"turn.failed","error":{"message":"stream disconnected"}}`)
+	if !strings.Contains(buf.String(), "Task failed: stream disconnected") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+func TestStreamParser_Gemini(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+	for _, line := range []string{
+		`{"type":"init","timestamp":"2025-10-10T12:00:00.000Z","session_id":"abc123","model":"gemini-2.5-pro"}`,
+		`{"type":"message","timestamp":"2025-10-10T12:00:01.000Z","role":"user","content":"Fix the bug"}`,
+		`{"type":"tool_use","timestamp":"2025-10-10T12:00:02.000Z","tool_name":"read_file","tool_id":"read-123","parameters":{"absolute_path":"/repo/main.go"}}`,
+		`{"type":"tool_result","timestamp":"2025-10-10T12:00:03.000Z","tool_id":"read-123","status":"success","output":"package main"}`,
+		`{"type":"tool_use","timestamp":"2025-10-10T12:00:04.000Z","tool_name":"run_shell_command","tool_id":"shell-1","parameters":{"command":"go test ./..."}}`,
+		`{"type":"message","timestamp":"2025-10-10T12:00:05.000Z","role":"assistant","content":"The bug is ","delta":true}`,
+		`{"type":"message","timestamp":"2025-10-10T12:00:05.100Z","role":"assistant","content":"fixed.","delta":true}`,
+		`{"type":"result","timestamp":"2025-10-10T12:00:06.000Z","status":"success","stats":{"total_tokens":250,"input_tokens":200,"output_tokens":50,"duration_ms":6000,"tool_calls":2}}`,
+	} {
+		p.ProcessLine(line)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"Gemini initialized", "Reading file", "main.go", "Running command", "go test ./...", "The bug is fixed."} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Fix the bug") || strings.Contains(out, "package main") {
+		t.Errorf("user messages and tool results should not be shown:\n%s", out)
+	}
+	if p.ToolCalls != 2 || p.ToolUses[0].Name != "Read" || p.ToolUses[0].Input["file_path"] != "/repo/main.go" {
+		t.Errorf("ToolCalls = %d, ToolUses = %+v", p.ToolCalls, p.ToolUses)
+	}
+	if p.AssistantTurns != 1 {
+		t.Errorf("AssistantTurns = %d, want one for a reply streamed in pieces", p.AssistantTurns)
+	}
+	if p.Usage == nil || p.Usage.InputTokens != 200 || p.Usage.OutputTokens != 50 {
+		t.Errorf("Usage = %+v", p.Usage)
+	}
+}
+
+func TestStreamParser_ClaudeUnchanged(t *testing.T) {
+	p := NewStreamParser(&bytes.Buffer{})
+	p.ProcessLine(`{"type":"result","total_cost_usd":0.25,"usage":{"input_tokens":7,"output_tokens":3}}`)
+	if p.TotalCostUSD != 0.25 || p.Usage.InputTokens != 7 {
+		t.Errorf("TotalCostUSD = %v, Usage = %+v", p.TotalCostUSD, p.Usage)
+	}
+}
@@ -1,9 +1,13 @@
 package runner
 
 import (
+	"bufio"
 	"bytes"
+	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 func TestStreamParser_ProcessLine_Empty(t *testing.T) {
@@ -81,6 +85,22 @@ func TestStreamParser_ProcessLine_Result(t *testing.T) {
 	}
 }
 
+func TestStreamParser_OnCost(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+	var costs []float64
+	p.OnCost = func(cost float64) { costs = append(costs, cost) }
+
+	p.ProcessLine(`{"type":"assistant","message":{"content":[{"type":"text","text":"working"}]}}`)
+	p.ProcessLine(`{"type":"result","total_cost_usd":0.1}`)
+	p.ProcessLine(`{"type":"result","total_cost_usd":0.1}`)
+	p.ProcessLine(`{"type":"result","usage":{"input_tokens":10,"output_tokens":5},"total_cost_usd":0.25}`)
+
+	if len(costs) != 2 || costs[0] != 0.1 || costs[1] != 0.25 {
+		t.Errorf("OnCost calls = %v, want [0.1 0.25]", costs)
+	}
+}
+
 func TestStreamParser_ProcessLine_ResultError(t *testing.T) {
 	var buf bytes.Buffer
 	p := NewStreamParser(&buf)
@@ -108,6 +128,113 @@ func TestStreamParser_ProcessLine_ToolUse(t *testing.T) {
 	}
 }
 
+func TestStreamParser_CollectsToolUses(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+
+	before := time.Now()
+	p.ProcessLine(`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"tu_1","name":"Read","input":{"file_path":"/src/main.go"}}]}}`)
+	p.ProcessLine(`{"type":"assistant","message":{"content":[{"type":"text","text":"Looking around"},{"type":"tool_use","id":"tu_2","name":"Bash","input":{"command":"go test ./...","timeout":60}}]}}`)
+	p.ProcessLine(`{"type":"user","message":{"content":[{"type":"tool_result"}]}}`)
+	p.ProcessLine(`{"type":"assistant","message":{"content":[{"type":"tool_use","id":"tu_3","name":"TodoWrite"}]}}`)
+
+	if len(p.ToolUses) != 3 {
+		t.Fatalf("expected 3 tool uses, got %d: %+v", len(p.ToolUses), p.ToolUses)
+	}
+	wantNames := []string{"Read", "Bash", "TodoWrite"}
+	wantIDs := []string{"tu_1", "tu_2", "tu_3"}
+	for i, use := range p.ToolUses {
+		if use.Name != wantNames[i] || use.ID != wantIDs[i] {
+			t.Errorf("tool use %d = %s (%s), want %s (%s)", i, use.Name, use.ID, wantNames[i], wantIDs[i])
+		}
+		if use.Time.Before(before) {
+			t.Errorf("tool use %d has no parse time: %v", i, use.Time)
+		}
+	}
+	if got := p.ToolUses[0].Input["file_path"]; got != "/src/main.go" {
+		t.Errorf("Read input file_path = %v", got)
+	}
+	if got := p.ToolUses[1].Input["command"]; got != "go test ./..." {
+		t.Errorf("Bash input command = %v", got)
+	}
+	if got := p.ToolUses[1].Input["timeout"]; got != float64(60) {
+		t.Errorf("Bash input timeout = %v", got)
+	}
+	if p.ToolUses[2].Input != nil {
+		t.Errorf("tool use without input should have a nil input map, got %v", p.ToolUses[2].Input)
+	}
+}
+
+func TestStreamParser_ProcessReader_CRLF(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+
+	input := "{\"type\":\"system\",\"subtype\":\"init\"}\r\n" +
+		"{\"type\":\"assistant\",\"message\":{\"content\":[{\"type\":\"text\",\"text\":\"line one\\r\\nline two\"}]}}\r\n" +
+		"{\"type\":\"result\",\"total_cost_usd\":0.25,\"usage\":{\"input_tokens\":10,\"output_tokens\":5}}\r\n"
+	if err := p.ProcessReader(strings.NewReader(input)); err != nil {
+		t.Fatalf("ProcessReader: %v", err)
+	}
+
+	output := buf.String()
+	if strings.Contains(output, "\r") {
+		t.Errorf("output should have no carriage returns, got %q", output)
+	}
+	if !strings.Contains(output, "initialized") {
+		t.Errorf("CRLF-terminated init event should parse, got %q", output)
+	}
+	if !strings.Contains(output, "line one\nline two") {
+		t.Errorf("assistant text should use LF line endings, got %q", output)
+	}
+	if p.TotalCostUSD != 0.25 || p.Usage == nil || p.Usage.InputTokens != 10 {
+		t.Errorf("CRLF-terminated result should parse, got cost=%v usage=%+v", p.TotalCostUSD, p.Usage)
+	}
+}
+
+func TestStreamParser_ProcessReader_BareCR(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+
+	input := "plain text\r{\"type\":\"result\",\"total_cost_usd\":1.5}\r"
+	if err := p.ProcessReader(strings.NewReader(input)); err != nil {
+		t.Fatalf("ProcessReader: %v", err)
+	}
+	if buf.String() != "plain text\n" {
+		t.Errorf("output = %q, want %q", buf.String(), "plain text\n")
+	}
+	if p.TotalCostUSD != 1.5 {
+		t.Errorf("result after a bare CR should parse, got cost %v", p.TotalCostUSD)
+	}
+}
+
+func TestStreamParser_ProcessLine_CRLF(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewStreamParser(&buf)
+
+	p.ProcessLine("not json\r\n{\"type\":\"result\",\"total_cost_usd\":0.5}\r\n")
+
+	if buf.String() != "not json\n" {
+		t.Errorf("output = %q, want %q", buf.String(), "not json\n")
+	}
+	if p.TotalCostUSD != 0.5 {
+		t.Errorf("JSON after CRLF should parse, got cost %v", p.TotalCostUSD)
+	}
+}
+
+func TestScanLines(t *testing.T) {
+	// One byte at a time, so a CR at the end of a read must wait for the next byte
+	r := bufio.NewScanner(iotest.OneByteReader(strings.NewReader("a\r\nb\rc\nd")))
+	r.Split(scanLines)
+	var got []string
+	for r.Scan() {
+		got = append(got, r.Text())
+	}
+	want := []string{"a", "b", "c", "d"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("scanLines = %q, want %q", got, want)
+	}
+}
+
 func TestExtractToolInfo(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -162,3 +289,50 @@ func TestExtractToolInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamParser_CountsTurnsAndToolCalls(t *testing.T) {
+	p := NewStreamParser(io.Discard)
+	stream := strings.Join([]string{
+		`{"type":"system","subtype":"init","session_id":"s1"}`,
+		`{"type":"assistant","message":{"id":"msg_1","content":[{"type":"text","text":"Let me look"}]}}`,
+		// The same message continued in a second event
+		`{"type":"assistant","message":{"id":"msg_1","content":[{"type":"tool_use","id":"tu_1","name":"Read"}]}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result"}]}}`,
+		`{"type":"assistant","message":{"id":"msg_2","content":[{"type":"tool_use","id":"tu_2","name":"Grep"},{"type":"tool_use","id":"tu_3","name":"Bash"}]}}`,
+		`{"type":"user","message":{"content":[{"type":"tool_result"}]}}`,
+		`not json`,
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"Done"}]}}`,
+		`{"type":"result","total_cost_usd":0.1}`,
+	}, "\n")
+	if err := p.ProcessReader(strings.NewReader(stream)); err != nil {
+		t.Fatalf("ProcessReader: %v", err)
+	}
+	if p.AssistantTurns != 3 {
+		t.Errorf("AssistantTurns = %d, want 3", p.AssistantTurns)
+	}
+	if p.ToolCalls != 3 {
+		t.Errorf("ToolCalls = %d, want 3", p.ToolCalls)
+	}
+}
+
+func TestStreamParser_GeminiToolCalls(t *testing.T) {
+	p := NewStreamParser(io.Discard)
+	p.ProcessLine(`{"type":"result","stats":{"input_tokens":10,"output_tokens":5,"tool_calls":4}}`)
+	if p.ToolCalls != 4 {
+		t.Errorf("ToolCalls = %d, want Gemini's reported 4", p.ToolCalls)
+	}
+}
+
+func TestStreamParser_CacheTokens(t *testing.T) {
+	p := NewStreamParser(io.Discard)
+	p.ProcessLine(`{"type":"result","subtype":"success","is_error":false,"duration_ms":48211,"num_turns":12,"result":"Done.","session_id":"4f1c","total_cost_usd":0.1842,"usage":{"input_tokens":31,"cache_creation_input_tokens":12410,"cache_read_input_tokens":203877,"output_tokens":2944,"server_tool_use":{"web_search_requests":0},"service_tier":"standard"}}`)
+	if p.Usage == nil {
+		t.Fatal("Usage not captured")
+	}
+	if p.Usage.CacheReadInputTokens != 203877 || p.Usage.CacheCreationInputTokens != 12410 {
+		t.Errorf("cache tokens = %d read, %d created, want 203877 and 12410", p.Usage.CacheReadInputTokens, p.Usage.CacheCreationInputTokens)
+	}
+	if p.Usage.InputTokens != 31 || p.Usage.OutputTokens != 2944 {
+		t.Errorf("Usage = %+v", p.Usage)
+	}
+}
@@ -0,0 +1,195 @@
+// Package server exposes the progress of orchestrator runs over HTTP for
+// monitoring when rcodegen is embedded as a service.
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"rcodegen/pkg/orchestrator"
+)
+
+// Run states reported by the monitor
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+)
+
+// Status is the JSON document served at /status
+type Status struct {
+	State          string       `json:"state"` // idle, running, or the final run status
+	JobID          string       `json:"job_id,omitempty"`
+	Bundle         string       `json:"bundle,omitempty"`
+	StartedAt      *time.Time   `json:"started_at,omitempty"`
+	UpdatedAt      *time.Time   `json:"updated_at,omitempty"`
+	TotalSteps     int          `json:"total_steps"`
+	CompletedSteps int          `json:"completed_steps"`
+	CurrentStep    string       `json:"current_step,omitempty"`
+	CostUSD        float64      `json:"cost_usd"`
+	InputTokens    int          `json:"input_tokens"`
+	OutputTokens   int          `json:"output_tokens"`
+	Error          string       `json:"error,omitempty"`
+	Steps          []StepStatus `json:"steps"`
+}
+
+// StepStatus is the progress of one top-level step
+type StepStatus struct {
+	Name       string  `json:"name"`
+	Tool       string  `json:"tool,omitempty"`
+	Model      string  `json:"model,omitempty"`
+	Status     string  `json:"status"` // running, skipped, or the step's final status
+	CostUSD    float64 `json:"cost_usd,omitempty"`
+	DurationMs int64   `json:"duration_ms,omitempty"`
+}
+
+// Monitor is an orchestrator observer that keeps the status of the latest
+// run for the HTTP endpoint
+type Monitor struct {
+	mu      sync.RWMutex
+	status  Status
+	control *orchestrator.Controller // Serves POST /abort when set
+}
+
+// Compile-time interface satisfaction check
+var _ orchestrator.Observer = (*Monitor)(nil)
+
+// NewMonitor returns a monitor with no run yet
+func NewMonitor() *Monitor {
+	return &Monitor{status: Status{State: StateIdle, Steps: []StepStatus{}}}
+}
+
+// OnEvent updates the status from a run event
+func (m *Monitor) OnEvent(e orchestrator.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := &m.status
+	// Concurrent runs (a batch) share the monitor; it follows the run that
+	// started last and ignores the others' events
+	if e.Type != orchestrator.EventRunStart && e.JobID != s.JobID {
+		return
+	}
+	at := e.Time
+	s.UpdatedAt = &at
+
+	switch e.Type {
+	case orchestrator.EventRunStart:
+		*s = Status{
+			State:      StateRunning,
+			JobID:      e.JobID,
+			Bundle:     e.Bundle,
+			StartedAt:  &at,
+			UpdatedAt:  &at,
+			TotalSteps: e.Steps,
+			Steps:      []StepStatus{},
+		}
+	case orchestrator.EventStepStart:
+		s.CurrentStep = e.Step
+		m.step(e).Status = StateRunning
+	case orchestrator.EventStepComplete:
+		step := m.step(e)
+		step.Status = e.Status
+		step.CostUSD = e.CostUSD
+		step.DurationMs = e.DurationMs
+		if e.Model != "" {
+			step.Model = e.Model
+		}
+		s.CompletedSteps++
+		s.CostUSD += e.CostUSD
+		s.InputTokens += e.InputTokens
+		s.OutputTokens += e.OutputTokens
+		if s.CurrentStep == e.Step {
+			s.CurrentStep = ""
+		}
+	case orchestrator.EventStepSkipped:
+		m.step(e).Status = "skipped"
+		s.CompletedSteps++
+		if s.CurrentStep == e.Step {
+			s.CurrentStep = ""
+		}
+	case orchestrator.EventRunComplete:
+		s.State = e.Status
+		s.Error = e.Error
+		s.CostUSD = e.CostUSD
+		s.InputTokens = e.InputTokens
+		s.OutputTokens = e.OutputTokens
+		s.CurrentStep = ""
+	}
+}
+
+// step returns the entry for the event's step, adding it on first sight.
+// Callers must hold m.mu.
+func (m *Monitor) step(e orchestrator.Event) *StepStatus {
+	for i := range m.status.Steps {
+		if m.status.Steps[i].Name == e.Step {
+			return &m.status.Steps[i]
+		}
+	}
+	m.status.Steps = append(m.status.Steps, StepStatus{Name: e.Step, Tool: e.Tool, Model: e.Model})
+	return &m.status.Steps[len(m.status.Steps)-1]
+}
+
+// Status returns a snapshot of the current run status
+func (m *Monitor) Status() Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := m.status
+	s.Steps = append([]StepStatus{}, m.status.Steps...)
+	return s
+}
+
+// SetController enables POST /abort, which aborts the running step through c
+func (m *Monitor) SetController(c *orchestrator.Controller) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.control = c
+}
+
+// Handler serves GET /status (the run status as JSON) and GET /healthz, and
+// POST /abort[?step=name] when a controller is set
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Status())
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("POST /abort", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.RLock()
+		control := m.control
+		m.mu.RUnlock()
+		if control == nil {
+			http.Error(w, "aborting steps is not enabled", http.StatusNotImplemented)
+			return
+		}
+		step := r.URL.Query().Get("step")
+		running := control.RunningStep()
+		if !control.AbortStep(step) {
+			http.Error(w, "no matching step is running", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"aborted": running})
+	})
+	return mux
+}
+
+// Serve starts an HTTP server for the monitor on addr in the background and
+// returns it so the caller can shut it down
+func Serve(addr string, m *Monitor) (*http.Server, error) {
+	srv := &http.Server{Addr: addr, Handler: m.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go srv.Serve(ln)
+	return srv, nil
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+	"rcodegen/pkg/workspace"
+)
+
+// blockingExecutor succeeds every step at a fixed cost, holding the step
+// named block until release is closed
+type blockingExecutor struct {
+	block   string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (e *blockingExecutor) Execute(step *bundle.Step, ctx *orchestrator.Context, ws *workspace.Workspace) (*envelope.Envelope, error) {
+	if step.Name == e.block {
+		close(e.started)
+		<-e.release
+	}
+	return envelope.New().Success().
+		WithResult("cost_usd", 0.25).
+		WithResult("input_tokens", 100).
+		WithResult("output_tokens", 10).
+		Build(), nil
+}
+
+// nopDisplay keeps test output quiet
+type nopDisplay struct{}
+
+func (nopDisplay) Start()                                                 {}
+func (nopDisplay) Stop()                                                  {}
+func (nopDisplay) SetStepRunning(int)                                     {}
+func (nopDisplay) SetStepModel(int, string)                               {}
+func (nopDisplay) SetStepComplete(int, float64, time.Duration, int, bool) {}
+func (nopDisplay) SetStepSkipped(int)                                     {}
+func (nopDisplay) PrintFinalSummary(float64, int, int, int, int)          {}
+
+func getStatus(t *testing.T, url string) Status {
+	t.Helper()
+	resp, err := http.Get(url + "/status")
+	if err != nil {
+		t.Fatalf("GET /status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /status: %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var s Status
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		t.Fatalf("decoding status: %v", err)
+	}
+	return s
+}
+
+func TestMonitor_StatusDuringAndAfterRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	exec := &blockingExecutor{block: "implement", started: make(chan struct{}), release: make(chan struct{})}
+	saved := orchestrator.DispatcherFactory
+	orchestrator.DispatcherFactory = func(map[string]runner.Tool) orchestrator.StepExecutor { return exec }
+	defer func() { orchestrator.DispatcherFactory = saved }()
+
+	monitor := NewMonitor()
+	srv := httptest.NewServer(monitor.Handler())
+	defer srv.Close()
+
+	if s := getStatus(t, srv.URL); s.State != StateIdle {
+		t.Errorf("state before any run = %q, want idle", s.State)
+	}
+
+	o := orchestrator.New(&settings.Settings{})
+	o.SetDisplay(nopDisplay{})
+	o.AddObserver(monitor)
+
+	b := &bundle.Bundle{Name: "build", Steps: []bundle.Step{
+		{Name: "plan", Tool: "claude"},
+		{Name: "implement", Tool: "codex"},
+		{Name: "review", Tool: "gemini"},
+	}}
+	done := make(chan *envelope.Envelope)
+	go func() {
+		env, _ := o.Run(b, map[string]string{})
+		done <- env
+	}()
+
+	select {
+	case <-exec.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run never reached the blocking step")
+	}
+
+	mid := getStatus(t, srv.URL)
+	if mid.State != StateRunning || mid.Bundle != "build" || mid.JobID == "" {
+		t.Errorf("unexpected mid-run status: %+v", mid)
+	}
+	if mid.TotalSteps != 3 || mid.CompletedSteps != 1 || mid.CurrentStep != "implement" {
+		t.Errorf("mid-run progress = %d/%d current %q, want 1/3 implement", mid.CompletedSteps, mid.TotalSteps, mid.CurrentStep)
+	}
+	if mid.CostUSD != 0.25 || mid.InputTokens != 100 {
+		t.Errorf("mid-run cost = %v (%d in), want 0.25 (100 in)", mid.CostUSD, mid.InputTokens)
+	}
+	if len(mid.Steps) != 2 || mid.Steps[0].Status != "success" || mid.Steps[1].Status != StateRunning {
+		t.Errorf("mid-run steps = %+v", mid.Steps)
+	}
+
+	close(exec.release)
+	env := <-done
+	if env.Status != envelope.StatusSuccess {
+		t.Fatalf("run failed: %+v", env)
+	}
+
+	final := getStatus(t, srv.URL)
+	if final.State != "success" || final.CompletedSteps != 3 || final.CurrentStep != "" {
+		t.Errorf("unexpected final status: %+v", final)
+	}
+	if final.CostUSD != 0.75 || final.OutputTokens != 30 {
+		t.Errorf("final cost = %v (%d out), want 0.75 (30 out)", final.CostUSD, final.OutputTokens)
+	}
+}
+
+func postAbort(t *testing.T, url string) *http.Response {
+	t.Helper()
+	resp, err := http.Post(url, "", nil)
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestMonitor_AbortStep(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	exec := &blockingExecutor{block: "implement", started: make(chan struct{}), release: make(chan struct{})}
+	defer close(exec.release)
+	saved := orchestrator.DispatcherFactory
+	orchestrator.DispatcherFactory = func(map[string]runner.Tool) orchestrator.StepExecutor { return exec }
+	defer func() { orchestrator.DispatcherFactory = saved }()
+
+	monitor := NewMonitor()
+	srv := httptest.NewServer(monitor.Handler())
+	defer srv.Close()
+
+	if resp := postAbort(t, srv.URL+"/abort"); resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("POST /abort without a controller: %s, want 501", resp.Status)
+	}
+
+	o := orchestrator.New(&settings.Settings{})
+	o.SetDisplay(nopDisplay{})
+	o.AddObserver(monitor)
+	monitor.SetController(o.Controller())
+
+	if resp := postAbort(t, srv.URL+"/abort"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /abort with nothing running: %s, want 409", resp.Status)
+	}
+
+	b := &bundle.Bundle{Name: "build", Steps: []bundle.Step{
+		{Name: "plan", Tool: "claude"},
+		{Name: "implement", Tool: "codex"},
+		{Name: "review", Tool: "gemini"},
+	}}
+	done := make(chan *envelope.Envelope)
+	go func() {
+		env, _ := o.Run(b, map[string]string{})
+		done <- env
+	}()
+
+	select {
+	case <-exec.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run never reached the blocking step")
+	}
+
+	if resp := postAbort(t, srv.URL+"/abort?step=review"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("POST /abort for a step that is not running: %s, want 409", resp.Status)
+	}
+	if resp := postAbort(t, srv.URL+"/abort?step=implement"); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("POST /abort?step=implement: %s, want 202", resp.Status)
+	}
+
+	var env *envelope.Envelope
+	select {
+	case env = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop after the abort")
+	}
+	if env.Error == nil || env.Error.Code != orchestrator.StepAbortedCode {
+		t.Fatalf("expected %s, got %+v", orchestrator.StepAbortedCode, env)
+	}
+
+	final := getStatus(t, srv.URL)
+	if final.State != "failure" || len(final.Steps) != 2 || final.Steps[1].Status != "failure" {
+		t.Errorf("unexpected status after abort: %+v", final)
+	}
+}
+
+func TestMonitor_FollowsLatestRun(t *testing.T) {
+	m := NewMonitor()
+	m.OnEvent(orchestrator.Event{Type: orchestrator.EventRunStart, JobID: "job-1", Steps: 1})
+	m.OnEvent(orchestrator.Event{Type: orchestrator.EventRunStart, JobID: "job-2", Steps: 1})
+	// The earlier run's events must not leak into the latest run's status
+	m.OnEvent(orchestrator.Event{Type: orchestrator.EventStepComplete, JobID: "job-1", Step: "build", Status: "success", CostUSD: 1})
+	m.OnEvent(orchestrator.Event{Type: orchestrator.EventRunComplete, JobID: "job-1", Status: "success", CostUSD: 1})
+	m.OnEvent(orchestrator.Event{Type: orchestrator.EventStepStart, JobID: "job-2", Step: "build"})
+
+	m.mu.RLock()
+	s := m.status
+	m.mu.RUnlock()
+	if s.JobID != "job-2" || s.State != StateRunning || s.CurrentStep != "build" {
+		t.Errorf("status = %+v, want job-2 running build", s)
+	}
+	if s.CompletedSteps != 0 || s.CostUSD != 0 {
+		t.Errorf("job-1's events changed job-2's status: %+v", s)
+	}
+}
+
+func TestMonitor_Healthz(t *testing.T) {
+	srv := httptest.NewServer(NewMonitor().Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz: %s", resp.Status)
+	}
+}
+
+func TestServe(t *testing.T) {
+	srv, err := Serve("127.0.0.1:0", NewMonitor())
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	srv.Close()
+
+	if _, err := Serve("256.0.0.1:1", NewMonitor()); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
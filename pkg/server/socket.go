@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+)
+
+// Frame types sent over the socket
+const (
+	FrameEvent    = "event"
+	FrameEnvelope = "envelope"
+)
+
+// maxFrameSize bounds the frames ReadFrame accepts
+const maxFrameSize = 64 << 20
+
+// Frame is one message on the socket: a run event, or the final envelope
+type Frame struct {
+	Type     string              `json:"type"`
+	Event    *orchestrator.Event `json:"event,omitempty"`
+	Envelope *envelope.Envelope  `json:"envelope,omitempty"`
+}
+
+// WriteFrame writes v as JSON prefixed by its length as a 4-byte big-endian
+// unsigned integer
+func WriteFrame(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(data)))
+	if _, err := w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadFrame reads one length-prefixed JSON frame written by WriteFrame into v
+func ReadFrame(r io.Reader, v interface{}) error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds the %d byte limit", size, maxFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SocketPublisher sends a run's final envelope, and optionally its events,
+// to a Unix domain socket an editor integration listens on. It is an
+// orchestrator observer; once a write fails, later frames are dropped so a
+// plugin going away never disturbs the run.
+type SocketPublisher struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	events bool
+	err    error
+}
+
+// Compile-time interface satisfaction check
+var _ orchestrator.Observer = (*SocketPublisher)(nil)
+
+// DialSocket connects to the Unix socket at path. With events set, every run
+// event is published as it happens, not just the final envelope.
+func DialSocket(path string, events bool) (*SocketPublisher, error) {
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &SocketPublisher{conn: conn, events: events}, nil
+}
+
+// OnEvent publishes the event when events were requested
+func (p *SocketPublisher) OnEvent(e orchestrator.Event) {
+	if p.events {
+		p.send(Frame{Type: FrameEvent, Event: &e})
+	}
+}
+
+// PublishEnvelope sends the run's final envelope
+func (p *SocketPublisher) PublishEnvelope(env *envelope.Envelope) error {
+	return p.send(Frame{Type: FrameEnvelope, Envelope: env})
+}
+
+// send writes one frame, returning the first write error seen
+func (p *SocketPublisher) send(f Frame) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.err = WriteFrame(p.conn, f)
+	return p.err
+}
+
+// Close closes the connection
+func (p *SocketPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rcodegen/pkg/bundle"
+	"rcodegen/pkg/envelope"
+	"rcodegen/pkg/orchestrator"
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+)
+
+// listenSocket listens on a Unix socket and collects every frame of the
+// first connection, delivered on the returned channel once it closes
+func listenSocket(t *testing.T) (string, <-chan []Frame) {
+	t.Helper()
+	// Socket paths are length-limited, so keep them short
+	dir, err := os.MkdirTemp("", "rcg")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "editor.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	frames := make(chan []Frame, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			frames <- nil
+			return
+		}
+		defer conn.Close()
+		var got []Frame
+		for {
+			var f Frame
+			if err := ReadFrame(conn, &f); err != nil {
+				break
+			}
+			got = append(got, f)
+		}
+		frames <- got
+	}()
+	return path, frames
+}
+
+func runToSocket(t *testing.T, events bool) []Frame {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+
+	exec := &blockingExecutor{}
+	saved := orchestrator.DispatcherFactory
+	orchestrator.DispatcherFactory = func(map[string]runner.Tool) orchestrator.StepExecutor { return exec }
+	defer func() { orchestrator.DispatcherFactory = saved }()
+
+	path, frames := listenSocket(t)
+	pub, err := DialSocket(path, events)
+	if err != nil {
+		t.Fatalf("DialSocket: %v", err)
+	}
+
+	o := orchestrator.New(&settings.Settings{})
+	o.SetDisplay(nopDisplay{})
+	o.AddObserver(pub)
+	b := &bundle.Bundle{Name: "editor", Steps: []bundle.Step{
+		{Name: "plan", Tool: "claude"},
+		{Name: "build", Tool: "codex"},
+	}}
+	env, _ := o.Run(b, map[string]string{})
+	if err := pub.PublishEnvelope(env); err != nil {
+		t.Fatalf("PublishEnvelope: %v", err)
+	}
+	pub.Close()
+
+	got := <-frames
+	if len(got) == 0 {
+		t.Fatal("no frames received")
+	}
+	last := got[len(got)-1]
+	if last.Type != FrameEnvelope || last.Envelope == nil {
+		t.Fatalf("last frame = %+v, want the envelope", last)
+	}
+	if last.Envelope.Status != envelope.StatusSuccess || last.Envelope.Result["job_id"] != env.Result["job_id"] {
+		t.Errorf("received envelope %+v, want %+v", last.Envelope, env)
+	}
+	return got
+}
+
+func TestSocketPublisher_Envelope(t *testing.T) {
+	if got := runToSocket(t, false); len(got) != 1 {
+		t.Errorf("without events only the envelope should be sent, got %d frames", len(got))
+	}
+}
+
+func TestSocketPublisher_Events(t *testing.T) {
+	got := runToSocket(t, true)
+
+	var types []orchestrator.EventType
+	for _, f := range got[:len(got)-1] {
+		if f.Type != FrameEvent || f.Event == nil {
+			t.Fatalf("unexpected frame before the envelope: %+v", f)
+		}
+		types = append(types, f.Event.Type)
+	}
+	want := []orchestrator.EventType{
+		orchestrator.EventRunStart,
+		orchestrator.EventStepStart, orchestrator.EventStepComplete,
+		orchestrator.EventStepStart, orchestrator.EventStepComplete,
+		orchestrator.EventRunComplete,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("event types = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("event %d = %s, want %s", i, types[i], want[i])
+		}
+	}
+}
+
+func TestFrame_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, v := range []string{"first", "second"} {
+		if err := WriteFrame(&buf, map[string]string{"v": v}); err != nil {
+			t.Fatalf("WriteFrame: %v", err)
+		}
+	}
+	if got := buf.Bytes()[:4]; !bytes.Equal(got, []byte{0, 0, 0, 13}) {
+		t.Errorf("length prefix = %v, want 13 big-endian", got)
+	}
+	for _, want := range []string{"first", "second"} {
+		var got map[string]string
+		if err := ReadFrame(&buf, &got); err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if got["v"] != want {
+			t.Errorf("frame = %v, want %s", got, want)
+		}
+	}
+
+	oversized := []byte{0xff, 0xff, 0xff, 0xff}
+	if err := ReadFrame(bytes.NewReader(oversized), new(map[string]string)); err == nil {
+		t.Error("an oversized frame should be rejected")
+	}
+}
@@ -23,19 +23,22 @@ type TaskDef struct {
 
 // CodexDefaults holds default settings for rcodex
 type CodexDefaults struct {
-	Model  string `json:"model"`  // Default model (e.g., "gpt-5.2-codex")
-	Effort string `json:"effort"` // Default effort level (low, medium, high, xhigh)
+	Model            string `json:"model"`                        // Default model (e.g., "gpt-5.2-codex")
+	Effort           string `json:"effort"`                       // Default effort level (low, medium, high, xhigh)
+	SystemPromptFile string `json:"system_prompt_file,omitempty"` // Instructions prepended to every codex task
 }
 
 // ClaudeDefaults holds default settings for rclaude
 type ClaudeDefaults struct {
-	Model  string `json:"model"`  // Default model (sonnet, opus, haiku)
-	Budget string `json:"budget"` // Default max budget in USD
+	Model            string `json:"model"`                        // Default model (sonnet, opus, haiku)
+	Budget           string `json:"budget"`                       // Default max budget in USD
+	SystemPromptFile string `json:"system_prompt_file,omitempty"` // File appended to Claude's system prompt on every run
 }
 
 // GeminiDefaults holds default settings for rgemini
 type GeminiDefaults struct {
-	Model string `json:"model,omitempty"` // Default model (gemini-2.5-pro, etc.)
+	Model            string `json:"model,omitempty"`              // Default model (gemini-2.5-pro, etc.)
+	SystemPromptFile string `json:"system_prompt_file,omitempty"` // Instructions prepended to every gemini task
 }
 
 // Defaults holds default settings for all tools
@@ -47,11 +50,23 @@ type Defaults struct {
 
 // Settings holds all configuration for rcodegen tools
 type Settings struct {
-	CodeDir         string             `json:"code_dir"`                    // Default code directory (supports ~ expansion)
-	OutputDir       string             `json:"output_dir,omitempty"`        // Custom output directory (replaces _rcodegen)
-	DefaultBuildDir string             `json:"default_build_dir,omitempty"` // Default output directory for build bundles
-	Defaults        Defaults           `json:"defaults"`                    // Default settings for each tool
-	Tasks           map[string]TaskDef `json:"tasks"`                       // Task shortcuts
+	CodeDir          string             `json:"code_dir"`                     // Default code directory (supports ~ expansion)
+	OutputDir        string             `json:"output_dir,omitempty"`         // Custom output directory (replaces _rcodegen)
+	DefaultBuildDir  string             `json:"default_build_dir,omitempty"`  // Default output directory for build bundles
+	Defaults         Defaults           `json:"defaults"`                     // Default settings for each tool
+	Tasks            map[string]TaskDef `json:"tasks"`                        // Task shortcuts
+	PersistFormat    string             `json:"persist_format,omitempty"`     // Step result format: "json" (default) or "raw" stdout
+	Currency         string             `json:"currency,omitempty"`           // ISO currency for displayed costs (default "USD")
+	Locale           string             `json:"locale,omitempty"`             // Number formatting locale, e.g. "de-DE" (default "en-US")
+	CurrencyRate     float64            `json:"currency_rate,omitempty"`      // Currency units per USD used to convert costs (default 1)
+	MaxParallelDepth int                `json:"max_parallel_depth,omitempty"` // Deepest allowed nesting of parallel blocks (default 3)
+	DefaultBundle    string             `json:"default_bundle,omitempty"`     // Bundle run by non-interactive `rcodegen` with no bundle named
+	PromptWarnTokens int                `json:"prompt_warn_tokens,omitempty"` // Warn when a resolved task exceeds this many estimated tokens (default 100000, -1 disables)
+	ConfirmAboveUSD  float64            `json:"confirm_above_usd,omitempty"`  // Interactive runs estimated to cost this much ask first (default 1.00, -1 disables)
+	TokenBudget      int                `json:"token_budget,omitempty"`       // Tokens per run: shown against usage in the live header, and no step starts once it is used (0 disables)
+	DisableBuiltins  bool               `json:"disable_builtins,omitempty"`   // Only use bundles in ~/.rcodegen/bundles/, hiding the embedded builtins
+	LiveScrollback   int                `json:"live_scrollback,omitempty"`    // Output lines the live display keeps per step (default 50)
+	OTLPEndpoint     string             `json:"otlp_endpoint,omitempty"`      // OpenTelemetry collector base URL to send run traces to (empty disables)
 }
 
 // TaskConfig is the legacy format used by the rest of the codebase
@@ -137,10 +152,29 @@ func Load() (*Settings, error) {
 	settings.CodeDir = expandTilde(settings.CodeDir)
 	settings.OutputDir = expandTilde(settings.OutputDir)
 	settings.DefaultBuildDir = expandTilde(settings.DefaultBuildDir)
+	settings.Defaults.Claude.SystemPromptFile = expandTilde(settings.Defaults.Claude.SystemPromptFile)
+	settings.Defaults.Codex.SystemPromptFile = expandTilde(settings.Defaults.Codex.SystemPromptFile)
+	settings.Defaults.Gemini.SystemPromptFile = expandTilde(settings.Defaults.Gemini.SystemPromptFile)
 
 	return &settings, nil
 }
 
+// SystemPromptFiles returns the configured system prompt file per tool
+// name ("claude", "codex", "gemini"), omitting tools without one
+func (s *Settings) SystemPromptFiles() map[string]string {
+	files := make(map[string]string)
+	for tool, path := range map[string]string{
+		"claude": s.Defaults.Claude.SystemPromptFile,
+		"codex":  s.Defaults.Codex.SystemPromptFile,
+		"gemini": s.Defaults.Gemini.SystemPromptFile,
+	} {
+		if path != "" {
+			files[tool] = path
+		}
+	}
+	return files
+}
+
 // GetDefaultSettings returns settings with sensible defaults
 // Note: CodeDir is left empty - user should configure this in settings.json
 func GetDefaultSettings() *Settings {
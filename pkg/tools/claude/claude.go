@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"strconv"
 	"sync"
+	"time"
 
 	"rcodegen/pkg/runner"
 	"rcodegen/pkg/settings"
@@ -17,35 +18,66 @@ type Tool struct {
 	settings     *settings.Settings
 	currentModel string // Track current model for status calculations
 
-	// Thread-safe status caching using sync.Once
-	checkOnce    sync.Once
+	// Claude Max status, cached for claudeMaxTTL and guarded by maxMu
+	maxMu        sync.Mutex
+	maxChecked   time.Time              // When the status was last probed
 	isClaudeMax  bool                   // True if user has Claude Max subscription
-	cachedStatus *tracking.ClaudeStatus // Cached status from initial check
+	cachedStatus *tracking.ClaudeStatus // Cached status from the last check
+	probeStatus  func() *tracking.ClaudeStatus
 }
 
+// claudeMaxTTL is how long a Claude Max check is trusted before it is
+// probed again, so a long-running process picks up plan changes
+var claudeMaxTTL = time.Hour
+
 // New creates a new Claude tool
 func New() *Tool {
-	return &Tool{}
+	return &Tool{probeStatus: tracking.GetClaudeStatus}
 }
 
-// checkClaudeMax checks if user has Claude Max subscription and caches the result
+// checkClaudeMax probes for a Claude Max subscription unless the cached
+// result is still fresh. Callers must hold t.maxMu.
 func (t *Tool) checkClaudeMax() {
-	t.checkOnce.Do(func() {
-		// Try to get status - if successful, user has Claude Max
-		status := tracking.GetClaudeStatus()
-		if status.Error == "" && (status.SessionLeft != nil || status.WeeklyAllLeft != nil) {
-			t.isClaudeMax = true
-			t.cachedStatus = status
-		}
-	})
+	if !t.maxChecked.IsZero() && time.Since(t.maxChecked) < claudeMaxTTL {
+		return
+	}
+	t.probeClaudeMax()
+}
+
+// probeClaudeMax checks if user has Claude Max subscription and caches the
+// result. Callers must hold t.maxMu.
+func (t *Tool) probeClaudeMax() {
+	probe := t.probeStatus
+	if probe == nil {
+		probe = tracking.GetClaudeStatus
+	}
+	// Try to get status - if successful, user has Claude Max
+	status := probe()
+	t.isClaudeMax = status != nil && status.Error == "" && (status.SessionLeft != nil || status.WeeklyAllLeft != nil)
+	t.cachedStatus = nil
+	if t.isClaudeMax {
+		t.cachedStatus = status
+	}
+	t.maxChecked = time.Now()
 }
 
 // IsClaudeMax returns true if user has Claude Max subscription
 func (t *Tool) IsClaudeMax() bool {
+	t.maxMu.Lock()
+	defer t.maxMu.Unlock()
 	t.checkClaudeMax()
 	return t.isClaudeMax
 }
 
+// RefreshClaudeMax probes for a Claude Max subscription again, whatever the
+// age of the cached result, and returns the new result
+func (t *Tool) RefreshClaudeMax() bool {
+	t.maxMu.Lock()
+	defer t.maxMu.Unlock()
+	t.probeClaudeMax()
+	return t.isClaudeMax
+}
+
 // SetSettings sets the settings (called by runner after loading)
 func (t *Tool) SetSettings(s *settings.Settings) {
 	t.settings = s
@@ -125,6 +157,11 @@ func (t *Tool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd
 		args = append(args, "--output-format", "stream-json", "--verbose")
 	}
 
+	// Added to Claude's own system prompt, keeping its tool instructions
+	if cfg.SystemPromptFile != "" {
+		args = append(args, "--append-system-prompt-file", cfg.SystemPromptFile)
+	}
+
 	cmd := exec.Command("claude", args...)
 
 	// Set working directory (Claude has no -C flag)
@@ -148,13 +185,15 @@ func (t *Tool) SupportsStatusTracking() bool {
 // CaptureStatusBefore captures Claude Max credit status before tasks
 func (t *Tool) CaptureStatusBefore() interface{} {
 	// Use cached status if we already checked for Claude Max
-	if t.cachedStatus != nil {
-		status := t.cachedStatus
-		t.cachedStatus = nil // Clear cache so we fetch fresh after
+	t.maxMu.Lock()
+	status := t.cachedStatus
+	t.cachedStatus = nil // Clear cache so we fetch fresh after
+	t.maxMu.Unlock()
+	if status != nil {
 		return status
 	}
 
-	status := tracking.GetClaudeStatus()
+	status = tracking.GetClaudeStatus()
 	if status.Error != "" {
 		// Show helpful message for iTerm2-related errors
 		if status.IsITerm2Error() {
@@ -285,6 +324,9 @@ func (t *Tool) ApplyToolDefaults(cfg *runner.Config) {
 		if t.settings.Defaults.Claude.Budget != "" {
 			cfg.MaxBudget = t.settings.Defaults.Claude.Budget
 		}
+		if cfg.SystemPromptFile == "" {
+			cfg.SystemPromptFile = t.settings.Defaults.Claude.SystemPromptFile
+		}
 	}
 
 	// NOTE: Claude Max check is deferred to PrepareForExecution
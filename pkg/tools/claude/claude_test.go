@@ -1,8 +1,15 @@
 package claude
 
 import (
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+	"rcodegen/pkg/tracking"
 )
 
 func TestCheckClaudeMax_ThreadSafe(t *testing.T) {
@@ -22,9 +29,112 @@ func TestCheckClaudeMax_ThreadSafe(t *testing.T) {
 	// If we get here without -race detecting issues, test passes
 }
 
+// probeCounter stands in for the Claude status probe, reporting Claude Max
+// while max is set and counting the probes
+type probeCounter struct {
+	max    atomic.Bool
+	probes atomic.Int32
+}
+
+func (p *probeCounter) probe() *tracking.ClaudeStatus {
+	p.probes.Add(1)
+	if !p.max.Load() {
+		return &tracking.ClaudeStatus{Error: "not_iterm2"}
+	}
+	left := 80
+	return &tracking.ClaudeStatus{SessionLeft: &left}
+}
+
+func TestRefreshClaudeMax_UpdatesCachedValue(t *testing.T) {
+	p := &probeCounter{}
+	tool := New()
+	tool.probeStatus = p.probe
+
+	if tool.IsClaudeMax() {
+		t.Fatal("IsClaudeMax = true before the plan changed")
+	}
+	p.max.Store(true)
+	if tool.IsClaudeMax() {
+		t.Error("IsClaudeMax should use the cached value within the TTL")
+	}
+	if !tool.RefreshClaudeMax() || !tool.IsClaudeMax() {
+		t.Error("RefreshClaudeMax should pick up the plan change")
+	}
+	if n := p.probes.Load(); n != 2 {
+		t.Errorf("probed %d times, want 2", n)
+	}
+	if tool.CaptureStatusBefore() == nil {
+		t.Error("CaptureStatusBefore should reuse the refreshed status")
+	}
+}
+
+func TestIsClaudeMax_ProbesAgainAfterTTL(t *testing.T) {
+	defer func(ttl time.Duration) { claudeMaxTTL = ttl }(claudeMaxTTL)
+	claudeMaxTTL = time.Millisecond
+
+	p := &probeCounter{}
+	tool := New()
+	tool.probeStatus = p.probe
+	tool.IsClaudeMax()
+
+	p.max.Store(true)
+	time.Sleep(5 * time.Millisecond)
+	if !tool.IsClaudeMax() {
+		t.Error("IsClaudeMax should probe again once the cached value expires")
+	}
+}
+
+func TestRefreshClaudeMax_ThreadSafe(t *testing.T) {
+	p := &probeCounter{}
+	tool := New()
+	tool.probeStatus = p.probe
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			p.max.Store(i%2 == 0)
+			tool.RefreshClaudeMax()
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = tool.IsClaudeMax()
+			_ = tool.CaptureStatusBefore()
+		}()
+	}
+	wg.Wait()
+
+	p.max.Store(true)
+	if !tool.RefreshClaudeMax() {
+		t.Error("the last refresh should set the cached value")
+	}
+}
+
 func TestNew_ReturnsNonNil(t *testing.T) {
 	tool := New()
 	if tool == nil {
 		t.Error("New() returned nil")
 	}
 }
+
+func TestBuildCommand_SystemPromptFile(t *testing.T) {
+	tool := New()
+	tool.SetSettings(&settings.Settings{Defaults: settings.Defaults{
+		Claude: settings.ClaudeDefaults{SystemPromptFile: "/etc/conventions.md"},
+	}})
+
+	cfg := &runner.Config{}
+	tool.ApplyToolDefaults(cfg)
+	cmd := tool.BuildCommand(cfg, "", "task")
+	i := slices.Index(cmd.Args, "--append-system-prompt-file")
+	if i < 0 || i+1 >= len(cmd.Args) || cmd.Args[i+1] != "/etc/conventions.md" {
+		t.Errorf("expected --append-system-prompt-file /etc/conventions.md in %v", cmd.Args)
+	}
+
+	// Without a system prompt file, no flag is passed
+	cmd = New().BuildCommand(&runner.Config{}, "", "task")
+	if slices.Contains(cmd.Args, "--append-system-prompt-file") {
+		t.Errorf("unexpected system prompt flag in %v", cmd.Args)
+	}
+}
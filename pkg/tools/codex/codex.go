@@ -67,6 +67,10 @@ func (t *Tool) DefaultModelSetting() string {
 
 // BuildCommand constructs the exec.Cmd for running a task
 func (t *Tool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	// Codex's instructions file replaces its built-in prompt, so the system
+	// prompt file goes ahead of the task instead
+	task = runner.PrependSystemPrompt(cfg.SystemPromptFile, task)
+
 	// Use resume with PTY wrapper if we have a session ID
 	if cfg.SessionID != "" {
 		// Use the Python PTY wrapper for resume (handles terminal emulation)
@@ -93,16 +97,13 @@ func (t *Tool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd
 		"--model", cfg.Model,
 		"-c", fmt.Sprintf("model_reasoning_effort=\"%s\"", cfg.Effort),
 	}
-
 	if workDir != "" {
 		args = append(args, "-C", workDir)
 	}
 
-	if cfg.OutputJSON {
-		args = append(args, "--json")
-	}
-
-	args = append(args, task)
+	// Stream JSON events, so replies, tool calls and token usage can be
+	// parsed (see runner.StreamParser); with -j they pass through as-is
+	args = append(args, "--json", task)
 
 	return exec.Command("codex", args...)
 }
@@ -249,6 +250,9 @@ func (t *Tool) ApplyToolDefaults(cfg *runner.Config) {
 		if t.settings.Defaults.Codex.Effort != "" {
 			cfg.Effort = t.settings.Defaults.Codex.Effort
 		}
+		if cfg.SystemPromptFile == "" {
+			cfg.SystemPromptFile = t.settings.Defaults.Codex.SystemPromptFile
+		}
 	}
 }
 
@@ -322,9 +326,9 @@ func (t *Tool) StatsJSONFields(cfg *runner.Config) map[string]interface{} {
 	}
 }
 
-// UsesStreamOutput returns false - Codex uses regular terminal output
+// UsesStreamOutput returns true - Codex exec runs with --json
 func (t *Tool) UsesStreamOutput() bool {
-	return false
+	return true
 }
 
 // RunLogFields returns Codex-specific fields for the .runlog file
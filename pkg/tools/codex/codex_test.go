@@ -0,0 +1,59 @@
+package codex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+)
+
+func TestBuildCommand_SystemPromptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conventions.md")
+	if err := os.WriteFile(path, []byte("Use tabs.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tool := New()
+	tool.SetSettings(&settings.Settings{Defaults: settings.Defaults{
+		Codex: settings.CodexDefaults{SystemPromptFile: path},
+	}})
+
+	cfg := &runner.Config{}
+	tool.ApplyToolDefaults(cfg)
+	for _, sessionID := range []string{"", "session-1"} {
+		cfg.SessionID = sessionID
+		cmd := tool.BuildCommand(cfg, "/repo", "task")
+		// The file is added ahead of the task, keeping codex's own prompt
+		var found bool
+		for _, arg := range cmd.Args {
+			if arg == "Use tabs.\n\ntask" {
+				found = true
+			}
+			if strings.Contains(arg, "experimental_instructions_file") {
+				t.Errorf("session %q: the instructions file replaces codex's prompt: %v", sessionID, cmd.Args)
+			}
+		}
+		if !found {
+			t.Errorf("session %q: expected the instructions ahead of the task in %v", sessionID, cmd.Args)
+		}
+	}
+
+	cmd := New().BuildCommand(&runner.Config{}, "/repo", "task")
+	if cmd.Args[len(cmd.Args)-1] != "task" {
+		t.Errorf("expected the task unchanged without a system prompt file, got %v", cmd.Args)
+	}
+}
+
+func TestBuildCommand_StreamsJSON(t *testing.T) {
+	tool := New()
+	if !tool.UsesStreamOutput() {
+		t.Error("codex output should go through the stream parser")
+	}
+	cmd := tool.BuildCommand(&runner.Config{Model: "gpt-5.2-codex"}, "/repo", "task")
+	n := len(cmd.Args)
+	if n < 2 || cmd.Args[n-2] != "--json" || cmd.Args[n-1] != "task" {
+		t.Errorf("expected --json ahead of the task in %v", cmd.Args)
+	}
+}
@@ -0,0 +1,109 @@
+// Package fixture provides a runner.Tool wrapper that records tool
+// invocations to a fixture directory and replays them later without calling
+// the real tool, for deterministic tests and demos.
+package fixture
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"rcodegen/pkg/runner"
+)
+
+// Mode selects whether the wrapper records or replays
+type Mode string
+
+const (
+	ModeRecord Mode = "record" // Run the real tool and save its output
+	ModeReplay Mode = "replay" // Return the saved output without running the tool
+)
+
+// Compile-time interface satisfaction check
+var _ runner.Tool = (*Tool)(nil)
+
+// Tool wraps a runner.Tool. Each invocation is keyed by a hash of the prompt
+// (with the tool name and model) and stored in Dir as <key>.stdout,
+// <key>.stderr and <key>.exit, plus <key>.prompt for reference.
+type Tool struct {
+	runner.Tool
+	Dir  string
+	Mode Mode
+}
+
+// New wraps tool to record to or replay from dir
+func New(tool runner.Tool, dir string, mode Mode) *Tool {
+	return &Tool{Tool: tool, Dir: dir, Mode: mode}
+}
+
+// Wrap wraps every tool of a registry with the same fixture directory and mode
+func Wrap(tools map[string]runner.Tool, dir string, mode Mode) map[string]runner.Tool {
+	wrapped := make(map[string]runner.Tool, len(tools))
+	for name, tool := range tools {
+		wrapped[name] = New(tool, dir, mode)
+	}
+	return wrapped
+}
+
+// Key returns the fixture key for a prompt sent to this tool
+func (t *Tool) Key(cfg *runner.Config, task string) string {
+	model := ""
+	if cfg != nil {
+		model = cfg.Model
+	}
+	sum := sha256.Sum256([]byte(t.Name() + "\x00" + model + "\x00" + task))
+	return t.Name() + "-" + hex.EncodeToString(sum[:8])
+}
+
+// recordScript runs the real command (its arguments), streaming stdout
+// through while saving stdout, stderr and the exit code under $FIXTURE
+const recordScript = `{ "$@" 2>"$FIXTURE.stderr"; echo $? >"$FIXTURE.exit"; } | tee "$FIXTURE.stdout"
+cat "$FIXTURE.stderr" >&2
+exit "$(cat "$FIXTURE.exit")"`
+
+// replayScript reproduces a recorded invocation
+const replayScript = `cat "$FIXTURE.stdout"
+cat "$FIXTURE.stderr" >&2
+exit "$(cat "$FIXTURE.exit")"`
+
+// BuildCommand returns a command that records the real tool's output or
+// replays a recorded one. Replaying a prompt that was never recorded fails.
+func (t *Tool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	base := filepath.Join(t.Dir, t.Key(cfg, task))
+
+	if t.Mode == ModeRecord {
+		real := t.Tool.BuildCommand(cfg, workDir, task)
+		if err := os.MkdirAll(t.Dir, 0755); err == nil {
+			os.WriteFile(base+".prompt", []byte(task), 0644)
+		}
+
+		// Run the exact binary the tool resolved, with its arguments
+		args := append([]string{"-c", recordScript, "sh", real.Path}, real.Args[1:]...)
+		cmd := exec.Command("sh", args...)
+		cmd.Dir = real.Dir
+		cmd.Stdin = real.Stdin
+		cmd.Env = append(envOrCurrent(real.Env), "FIXTURE="+base)
+		return cmd
+	}
+
+	if _, err := os.Stat(base + ".exit"); err != nil {
+		cmd := exec.Command("sh", "-c", `echo "no fixture recorded for this prompt: $FIXTURE" >&2; exit 1`)
+		cmd.Env = append(os.Environ(), "FIXTURE="+base)
+		return cmd
+	}
+	cmd := exec.Command("sh", "-c", replayScript)
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "FIXTURE="+base)
+	return cmd
+}
+
+// envOrCurrent returns env, or the current environment when env is nil
+// (which exec.Cmd treats as inheriting the parent's environment)
+func envOrCurrent(env []string) []string {
+	if env == nil {
+		return os.Environ()
+	}
+	return env
+}
@@ -0,0 +1,116 @@
+package fixture
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/tools/claude"
+)
+
+// fakeTool stands in for a real AI CLI: it echoes the prompt and counts how
+// many times it actually ran
+type fakeTool struct {
+	runner.Tool
+	counter string
+}
+
+func (f fakeTool) Name() string { return "fake" }
+
+func (f fakeTool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", `echo run >>"$1"; echo "answer to: $2"; echo "progress" >&2; exit 3`, "sh", f.counter, task)
+	cmd.Dir = workDir
+	return cmd
+}
+
+func run(t *testing.T, tool runner.Tool, task string) (string, string, int) {
+	t.Helper()
+	cmd := tool.BuildCommand(&runner.Config{Model: "test-model"}, t.TempDir(), task)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("running command: %v", err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+func runCount(t *testing.T, counter string) int {
+	data, _ := os.ReadFile(counter)
+	return strings.Count(string(data), "\n")
+}
+
+func TestTool_RecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(t.TempDir(), "runs")
+	real := fakeTool{Tool: claude.New(), counter: counter}
+
+	stdout, stderr, code := run(t, New(real, dir, ModeRecord), "fix the bug")
+	if stdout != "answer to: fix the bug\n" || stderr != "progress\n" || code != 3 {
+		t.Fatalf("record passthrough = %q/%q/%d", stdout, stderr, code)
+	}
+	if runCount(t, counter) != 1 {
+		t.Fatalf("the real tool should run once while recording")
+	}
+
+	key := New(real, dir, ModeRecord).Key(&runner.Config{Model: "test-model"}, "fix the bug")
+	if prompt, _ := os.ReadFile(filepath.Join(dir, key+".prompt")); string(prompt) != "fix the bug" {
+		t.Errorf("recorded prompt = %q", prompt)
+	}
+
+	stdout, stderr, code = run(t, New(real, dir, ModeReplay), "fix the bug")
+	if stdout != "answer to: fix the bug\n" || stderr != "progress\n" || code != 3 {
+		t.Errorf("replay = %q/%q/%d, want the recorded output", stdout, stderr, code)
+	}
+	if runCount(t, counter) != 1 {
+		t.Errorf("replay must not run the real tool")
+	}
+}
+
+func TestTool_ReplayUnknownPromptFails(t *testing.T) {
+	counter := filepath.Join(t.TempDir(), "runs")
+	tool := New(fakeTool{Tool: claude.New(), counter: counter}, t.TempDir(), ModeReplay)
+
+	_, stderr, code := run(t, tool, "never recorded")
+	if code == 0 || !strings.Contains(stderr, "no fixture recorded") {
+		t.Errorf("expected a failure for an unrecorded prompt, got %d %q", code, stderr)
+	}
+	if runCount(t, counter) != 0 {
+		t.Errorf("replay must not run the real tool")
+	}
+}
+
+func TestTool_KeyDependsOnPromptToolAndModel(t *testing.T) {
+	tool := New(fakeTool{Tool: claude.New()}, "", ModeReplay)
+	a := tool.Key(&runner.Config{Model: "m"}, "task")
+	if a != tool.Key(&runner.Config{Model: "m"}, "task") {
+		t.Error("key should be stable")
+	}
+	if a == tool.Key(&runner.Config{Model: "m"}, "other task") {
+		t.Error("key should depend on the prompt")
+	}
+	if a == tool.Key(&runner.Config{Model: "other"}, "task") {
+		t.Error("key should depend on the model")
+	}
+	if !strings.HasPrefix(a, "fake-") {
+		t.Errorf("key %q should start with the tool name", a)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tools := Wrap(map[string]runner.Tool{"claude": claude.New()}, "/fixtures", ModeReplay)
+	ft, ok := tools["claude"].(*Tool)
+	if !ok || ft.Dir != "/fixtures" || ft.Mode != ModeReplay || ft.Name() != "rclaude" {
+		t.Errorf("unexpected wrapped tool: %+v", tools["claude"])
+	}
+}
@@ -65,6 +65,10 @@ func (t *Tool) DefaultModelSetting() string {
 
 // BuildCommand constructs the exec.Cmd for running a task
 func (t *Tool) BuildCommand(cfg *runner.Config, workDir, task string) *exec.Cmd {
+	// GEMINI_SYSTEM_MD replaces Gemini's built-in prompt, so the system
+	// prompt file goes ahead of the task instead
+	task = runner.PrependSystemPrompt(cfg.SystemPromptFile, task)
+
 	var args []string
 
 	// Resume existing session if available
@@ -141,6 +145,9 @@ func (t *Tool) ApplyToolDefaults(cfg *runner.Config) {
 	if cfg.Model == "" {
 		cfg.Model = t.DefaultModel()
 	}
+	if t.settings != nil && cfg.SystemPromptFile == "" {
+		cfg.SystemPromptFile = t.settings.Defaults.Gemini.SystemPromptFile
+	}
 }
 
 // PrepareForExecution does expensive setup after task validation
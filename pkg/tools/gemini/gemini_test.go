@@ -0,0 +1,38 @@
+package gemini
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"rcodegen/pkg/runner"
+	"rcodegen/pkg/settings"
+)
+
+func TestBuildCommand_SystemPromptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conventions.md")
+	if err := os.WriteFile(path, []byte("Use tabs.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tool := New()
+	tool.SetSettings(&settings.Settings{Defaults: settings.Defaults{
+		Gemini: settings.GeminiDefaults{SystemPromptFile: path},
+	}})
+
+	cfg := &runner.Config{}
+	tool.ApplyToolDefaults(cfg)
+	cmd := tool.BuildCommand(cfg, "", "task")
+	// The file is added ahead of the task, keeping gemini's own prompt
+	if !slices.Contains(cmd.Args, "Use tabs.\n\ntask") {
+		t.Errorf("expected the instructions ahead of the task in %v", cmd.Args)
+	}
+	if cmd.Env != nil {
+		t.Errorf("unexpected command env %v; GEMINI_SYSTEM_MD would replace the built-in prompt", cmd.Env)
+	}
+
+	cmd = New().BuildCommand(&runner.Config{}, "", "task")
+	if !slices.Contains(cmd.Args, "task") {
+		t.Errorf("expected the task unchanged without a system prompt file, got %v", cmd.Args)
+	}
+}
@@ -0,0 +1,221 @@
+package workspace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// JobSummary is the outcome of a job as recorded in its event log
+type JobSummary struct {
+	JobID    string
+	Bundle   string
+	Status   string // Empty when the run never completed
+	CostUSD  float64
+	Duration time.Duration
+	Steps    []StepSummary // In execution order
+
+	// Wall-clock start and end of the run (zero when not recorded, e.g. the
+	// end of a run that never completed)
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// StepSummary is the outcome of one top-level step of a job
+type StepSummary struct {
+	Name     string
+	Status   string // success, partial, failure or skipped
+	CostUSD  float64
+	Duration time.Duration
+
+	StartedAt time.Time // Zero for skipped steps
+	EndedAt   time.Time
+}
+
+// RunDiff compares two jobs of the same bundle; deltas are B minus A
+type RunDiff struct {
+	Bundle        string
+	JobA, JobB    string
+	StatusA       string
+	StatusB       string
+	CostA, CostB  float64
+	CostDelta     float64
+	DurationDelta time.Duration
+	Steps         []StepDiff // Steps of A in order, then steps only in B
+}
+
+// StepDiff compares one step across two jobs. A status is empty when the
+// step did not run in that job.
+type StepDiff struct {
+	Name          string
+	StatusA       string
+	StatusB       string
+	CostDelta     float64
+	DurationDelta time.Duration
+}
+
+// StatusChanged reports whether the step ended differently in the two jobs
+func (d StepDiff) StatusChanged() bool {
+	return d.StatusA != d.StatusB
+}
+
+// jobEvent is the subset of an event log entry needed to summarize a job
+type jobEvent struct {
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	JobID      string    `json:"job_id"`
+	Bundle     string    `json:"bundle"`
+	Step       string    `json:"step"`
+	Status     string    `json:"status"`
+	CostUSD    float64   `json:"cost_usd"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// JobDir resolves a job ID under the default workspace; paths are returned
+// unchanged
+func JobDir(job string) string {
+	if strings.ContainsRune(job, filepath.Separator) {
+		return job
+	}
+	return filepath.Join(DefaultBaseDir(), "jobs", job)
+}
+
+// LoadJobSummary summarizes a job (an ID or a job directory) from its
+// event log
+func LoadJobSummary(job string) (*JobSummary, error) {
+	dir := JobDir(job)
+	f, err := os.Open(filepath.Join(dir, EventLogFile))
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", job, err)
+	}
+	defer f.Close()
+
+	s := &JobSummary{JobID: filepath.Base(dir)}
+	index := make(map[string]int)
+	stepStarts := make(map[string]time.Time)
+	var stepCost float64
+	completed := false
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e jobEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("job %s: %w: %v", job, ErrCorruptJob, err)
+		}
+		if e.JobID != "" {
+			s.JobID = e.JobID
+		}
+		if e.Bundle != "" {
+			s.Bundle = e.Bundle
+		}
+
+		switch e.Event {
+		case "run_start":
+			s.StartedAt = e.Time
+		case "step_start":
+			stepStarts[e.Step] = e.Time
+		case "step_complete", "step_skipped":
+			step := StepSummary{
+				Name:      e.Step,
+				Status:    e.Status,
+				CostUSD:   e.CostUSD,
+				Duration:  time.Duration(e.DurationMs) * time.Millisecond,
+				StartedAt: stepStarts[e.Step],
+				EndedAt:   e.Time,
+			}
+			if e.Event == "step_skipped" {
+				step.Status = "skipped"
+				step.StartedAt, step.EndedAt = time.Time{}, time.Time{}
+			}
+			stepCost += e.CostUSD
+			if i, ok := index[e.Step]; ok {
+				s.Steps[i] = step
+			} else {
+				index[e.Step] = len(s.Steps)
+				s.Steps = append(s.Steps, step)
+			}
+		case "run_complete":
+			completed = true
+			s.Status = e.Status
+			s.CostUSD = e.CostUSD
+			s.Duration = time.Duration(e.DurationMs) * time.Millisecond
+			s.EndedAt = e.Time
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("job %s: %w", job, err)
+	}
+
+	// An interrupted run has no totals; fall back to the sum of its steps
+	if !completed {
+		s.CostUSD = stepCost
+		for _, step := range s.Steps {
+			s.Duration += step.Duration
+		}
+	}
+	return s, nil
+}
+
+// CompareRuns computes the cost, duration and per-step status changes from
+// job A to job B, which must be runs of the same bundle
+func CompareRuns(jobA, jobB string) (RunDiff, error) {
+	a, err := LoadJobSummary(jobA)
+	if err != nil {
+		return RunDiff{}, err
+	}
+	b, err := LoadJobSummary(jobB)
+	if err != nil {
+		return RunDiff{}, err
+	}
+	if a.Bundle != b.Bundle {
+		return RunDiff{}, fmt.Errorf("cannot compare runs of different bundles: %s and %s", a.Bundle, b.Bundle)
+	}
+
+	diff := RunDiff{
+		Bundle:        a.Bundle,
+		JobA:          a.JobID,
+		JobB:          b.JobID,
+		StatusA:       a.Status,
+		StatusB:       b.Status,
+		CostA:         a.CostUSD,
+		CostB:         b.CostUSD,
+		CostDelta:     b.CostUSD - a.CostUSD,
+		DurationDelta: b.Duration - a.Duration,
+	}
+
+	stepsB := make(map[string]StepSummary, len(b.Steps))
+	for _, step := range b.Steps {
+		stepsB[step.Name] = step
+	}
+	seen := make(map[string]bool, len(a.Steps))
+	for _, sa := range a.Steps {
+		seen[sa.Name] = true
+		sb := stepsB[sa.Name]
+		diff.Steps = append(diff.Steps, StepDiff{
+			Name:          sa.Name,
+			StatusA:       sa.Status,
+			StatusB:       sb.Status,
+			CostDelta:     sb.CostUSD - sa.CostUSD,
+			DurationDelta: sb.Duration - sa.Duration,
+		})
+	}
+	for _, sb := range b.Steps {
+		if !seen[sb.Name] {
+			diff.Steps = append(diff.Steps, StepDiff{
+				Name:          sb.Name,
+				StatusB:       sb.Status,
+				CostDelta:     sb.CostUSD,
+				DurationDelta: sb.Duration,
+			})
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,146 @@
+package workspace
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeJob creates a job directory with the given event log lines
+func writeJob(t *testing.T, id string, events ...string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "jobs", id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := strings.Join(events, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, EventLogFile), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestCompareRuns_Deltas(t *testing.T) {
+	jobA := writeJob(t, "job-a",
+		`{"event":"run_start","job_id":"job-a","bundle":"review","index":0,"steps":3}`,
+		`{"event":"step_start","job_id":"job-a","bundle":"review","step":"analyze","index":0}`,
+		`{"event":"step_complete","job_id":"job-a","bundle":"review","step":"analyze","index":0,"status":"success","cost_usd":1.5,"duration_ms":60000}`,
+		`{"event":"step_complete","job_id":"job-a","bundle":"review","step":"fix","index":1,"status":"failure","cost_usd":0.5,"duration_ms":30000}`,
+		`{"event":"run_complete","job_id":"job-a","bundle":"review","index":0,"status":"failure","cost_usd":2.0,"duration_ms":90000}`,
+	)
+	jobB := writeJob(t, "job-b",
+		`{"event":"run_start","job_id":"job-b","bundle":"review","index":0,"steps":3}`,
+		`{"event":"step_complete","job_id":"job-b","bundle":"review","step":"analyze","index":0,"status":"success","cost_usd":1.0,"duration_ms":45000}`,
+		`{"event":"step_complete","job_id":"job-b","bundle":"review","step":"fix","index":1,"status":"success","cost_usd":0.75,"duration_ms":40000}`,
+		`{"event":"step_skipped","job_id":"job-b","bundle":"review","step":"escalate","index":2}`,
+		`{"event":"run_complete","job_id":"job-b","bundle":"review","index":0,"status":"success","cost_usd":1.75,"duration_ms":85000}`,
+	)
+
+	diff, err := CompareRuns(jobA, jobB)
+	if err != nil {
+		t.Fatalf("CompareRuns: %v", err)
+	}
+
+	if diff.Bundle != "review" || diff.JobA != "job-a" || diff.JobB != "job-b" {
+		t.Errorf("unexpected identity: %+v", diff)
+	}
+	if diff.StatusA != "failure" || diff.StatusB != "success" {
+		t.Errorf("statuses = %s -> %s", diff.StatusA, diff.StatusB)
+	}
+	if !approx(diff.CostDelta, -0.25) {
+		t.Errorf("CostDelta = %v, want -0.25", diff.CostDelta)
+	}
+	if diff.DurationDelta != -5*time.Second {
+		t.Errorf("DurationDelta = %v, want -5s", diff.DurationDelta)
+	}
+
+	if len(diff.Steps) != 3 {
+		t.Fatalf("got %d step diffs, want 3: %+v", len(diff.Steps), diff.Steps)
+	}
+	analyze, fix, escalate := diff.Steps[0], diff.Steps[1], diff.Steps[2]
+	if analyze.Name != "analyze" || analyze.StatusChanged() || !approx(analyze.CostDelta, -0.5) || analyze.DurationDelta != -15*time.Second {
+		t.Errorf("unexpected analyze diff: %+v", analyze)
+	}
+	if fix.Name != "fix" || !fix.StatusChanged() || fix.StatusA != "failure" || fix.StatusB != "success" {
+		t.Errorf("unexpected fix status change: %+v", fix)
+	}
+	if !approx(fix.CostDelta, 0.25) || fix.DurationDelta != 10*time.Second {
+		t.Errorf("unexpected fix deltas: %+v", fix)
+	}
+	if escalate.Name != "escalate" || escalate.StatusA != "" || escalate.StatusB != "skipped" {
+		t.Errorf("unexpected escalate diff: %+v", escalate)
+	}
+}
+
+func TestCompareRuns_DifferentBundles(t *testing.T) {
+	jobA := writeJob(t, "job-a", `{"event":"run_start","bundle":"review","index":0}`)
+	jobB := writeJob(t, "job-b", `{"event":"run_start","bundle":"audit","index":0}`)
+
+	if _, err := CompareRuns(jobA, jobB); err == nil || !strings.Contains(err.Error(), "different bundles") {
+		t.Errorf("expected a different-bundles error, got %v", err)
+	}
+}
+
+func TestLoadJobSummary_IncompleteRun(t *testing.T) {
+	job := writeJob(t, "job-c",
+		`{"event":"run_start","bundle":"review","index":0}`,
+		`{"event":"step_complete","bundle":"review","step":"one","index":0,"status":"success","cost_usd":0.4,"duration_ms":1000}`,
+		`{"event":"step_complete","bundle":"review","step":"two","index":1,"status":"success","cost_usd":0.1,"duration_ms":2000}`,
+	)
+
+	s, err := LoadJobSummary(job)
+	if err != nil {
+		t.Fatalf("LoadJobSummary: %v", err)
+	}
+	if s.JobID != "job-c" || s.Status != "" {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if !approx(s.CostUSD, 0.5) || s.Duration != 3*time.Second {
+		t.Errorf("incomplete run totals = %v/%v, want 0.5/3s", s.CostUSD, s.Duration)
+	}
+}
+
+func TestLoadJobSummary_MissingLog(t *testing.T) {
+	if _, err := LoadJobSummary(filepath.Join(t.TempDir(), "nope")); err == nil {
+		t.Error("expected an error for a job without an event log")
+	}
+}
+
+func TestLoadJobSummary_Timestamps(t *testing.T) {
+	job := writeJob(t, "job-t",
+		`{"event":"run_start","time":"2026-10-16T09:00:00Z","bundle":"review","index":0}`,
+		`{"event":"step_start","time":"2026-10-16T09:00:00.5Z","bundle":"review","step":"one","index":0}`,
+		`{"event":"step_complete","time":"2026-10-16T09:00:02Z","bundle":"review","step":"one","index":0,"status":"success","duration_ms":1500}`,
+		`{"event":"step_skipped","time":"2026-10-16T09:00:02Z","bundle":"review","step":"two","index":1}`,
+		`{"event":"run_complete","time":"2026-10-16T09:00:03Z","bundle":"review","index":0,"status":"success","duration_ms":3000}`,
+	)
+
+	s, err := LoadJobSummary(job)
+	if err != nil {
+		t.Fatalf("LoadJobSummary: %v", err)
+	}
+	at := func(v string) time.Time {
+		ts, _ := time.Parse(time.RFC3339, v)
+		return ts
+	}
+	if !s.StartedAt.Equal(at("2026-10-16T09:00:00Z")) || !s.EndedAt.Equal(at("2026-10-16T09:00:03Z")) {
+		t.Errorf("run times = %v - %v", s.StartedAt, s.EndedAt)
+	}
+	if s.EndedAt.Sub(s.StartedAt) != s.Duration {
+		t.Errorf("run span %v should match its duration %v", s.EndedAt.Sub(s.StartedAt), s.Duration)
+	}
+	one := s.Steps[0]
+	if !one.StartedAt.Equal(at("2026-10-16T09:00:00.5Z")) || one.EndedAt.Sub(one.StartedAt) != one.Duration {
+		t.Errorf("step one times = %v - %v, duration %v", one.StartedAt, one.EndedAt, one.Duration)
+	}
+	if two := s.Steps[1]; !two.StartedAt.IsZero() || !two.EndedAt.IsZero() {
+		t.Errorf("skipped step should have no times, got %v - %v", two.StartedAt, two.EndedAt)
+	}
+}
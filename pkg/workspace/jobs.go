@@ -0,0 +1,148 @@
+package workspace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrCorruptJob is wrapped by errors for a job whose event log cannot be
+// parsed, typically because a crash truncated its last line
+var ErrCorruptJob = errors.New("corrupt job event log")
+
+// CorruptLogSuffix is appended to the name of the event log RepairJob
+// replaces, keeping the damaged original for inspection
+const CorruptLogSuffix = ".corrupt"
+
+// ListJobs summarizes every job under baseDir's jobs directory, oldest
+// first. Jobs whose event log is missing or corrupt are skipped with a
+// warning written to warn (if not nil) instead of failing the listing.
+func ListJobs(baseDir string, warn io.Writer) ([]*JobSummary, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, "jobs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*JobSummary
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		s, err := LoadJobSummary(filepath.Join(baseDir, "jobs", entry.Name()))
+		if err != nil {
+			if warn != nil {
+				hint := ""
+				if errors.Is(err, ErrCorruptJob) {
+					hint = " (RepairJob can rebuild it)"
+				}
+				fmt.Fprintf(warn, "warning: skipping %v%s\n", err, hint)
+			}
+			continue
+		}
+		jobs = append(jobs, s)
+	}
+	// Job IDs start with their timestamp, so this is chronological
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].JobID < jobs[j].JobID })
+	return jobs, nil
+}
+
+// RepairJob rebuilds the event log of a job (an ID or a job directory)
+// damaged by a crash. Entries that still parse are kept; a run_start is
+// added if it was lost, and every step with a stored output but no surviving
+// outcome gets a step_complete with status "unknown". The damaged log is
+// kept next to the new one with CorruptLogSuffix. The repaired job has no
+// run_complete, so it summarizes as an interrupted run.
+func RepairJob(job string) (*JobSummary, error) {
+	dir := JobDir(job)
+	logPath := filepath.Join(dir, EventLogFile)
+	data, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("job %s: %w", job, err)
+	}
+
+	jobID := filepath.Base(dir)
+	var kept [][]byte
+	var bundleName string
+	hasStart := false
+	outcomes := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		var e jobEvent
+		if len(line) == 0 || json.Unmarshal(line, &e) != nil {
+			continue
+		}
+		kept = append(kept, append([]byte(nil), line...))
+		if e.Bundle != "" {
+			bundleName = e.Bundle
+		}
+		switch e.Event {
+		case "run_start":
+			hasStart = true
+		case "step_complete", "step_skipped":
+			outcomes[e.Step] = true
+		}
+	}
+
+	encode := func(v interface{}) []byte {
+		b, _ := json.Marshal(v)
+		return b
+	}
+	var rebuilt [][]byte
+	if !hasStart {
+		rebuilt = append(rebuilt, encode(map[string]interface{}{
+			"event": "run_start", "time": time.Now(), "job_id": jobID, "bundle": bundleName, "index": 0,
+		}))
+	}
+	rebuilt = append(rebuilt, kept...)
+	for i, step := range storedOutputs(dir) {
+		if !outcomes[step] {
+			rebuilt = append(rebuilt, encode(map[string]interface{}{
+				"event": "step_complete", "time": time.Now(), "job_id": jobID, "bundle": bundleName,
+				"step": step, "index": i, "status": "unknown",
+			}))
+		}
+	}
+
+	if len(data) > 0 {
+		if err := os.WriteFile(logPath+CorruptLogSuffix, data, 0644); err != nil {
+			return nil, fmt.Errorf("job %s: %w", job, err)
+		}
+	}
+	tmp := logPath + ".tmp"
+	if err := os.WriteFile(tmp, append(bytes.Join(rebuilt, []byte("\n")), '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("job %s: %w", job, err)
+	}
+	if err := os.Rename(tmp, logPath); err != nil {
+		return nil, fmt.Errorf("job %s: %w", job, err)
+	}
+	return LoadJobSummary(dir)
+}
+
+// storedOutputs returns the names of the steps with an output file in the
+// job directory, sorted
+func storedOutputs(dir string) []string {
+	entries, _ := os.ReadDir(filepath.Join(dir, "outputs"))
+	var steps []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (filepath.Ext(name) != ".json" && filepath.Ext(name) != ".txt") {
+			continue
+		}
+		steps = append(steps, strings.TrimSuffix(name, filepath.Ext(name)))
+	}
+	sort.Strings(steps)
+	return steps
+}
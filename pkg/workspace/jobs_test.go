@@ -0,0 +1,120 @@
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// truncatedLog is an event log whose last entry was cut off by a crash
+var truncatedLog = []string{
+	`{"event":"run_start","job_id":"20260101-120000-bbbb","bundle":"review","index":0,"steps":3}`,
+	`{"event":"step_complete","job_id":"20260101-120000-bbbb","bundle":"review","step":"analyze","index":0,"status":"success","cost_usd":1.5,"duration_ms":60000}`,
+	`{"event":"step_complete","job_id":"20260101-120000-bbbb","bundle":"rev`,
+}
+
+func writeJobIn(t *testing.T, base, id string, events ...string) string {
+	t.Helper()
+	dir := filepath.Join(base, "jobs", id)
+	if err := os.MkdirAll(filepath.Join(dir, "outputs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := strings.Join(events, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, EventLogFile), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestLoadJobSummary_CorruptLog(t *testing.T) {
+	dir := writeJob(t, "20260101-120000-bbbb", truncatedLog...)
+	if _, err := LoadJobSummary(dir); !errors.Is(err, ErrCorruptJob) {
+		t.Fatalf("LoadJobSummary error = %v, want ErrCorruptJob", err)
+	}
+}
+
+func TestListJobs_SkipsCorruptJobs(t *testing.T) {
+	base := t.TempDir()
+	writeJobIn(t, base, "20260101-130000-cccc",
+		`{"event":"run_start","job_id":"20260101-130000-cccc","bundle":"review","index":0,"steps":1}`,
+		`{"event":"run_complete","job_id":"20260101-130000-cccc","bundle":"review","index":0,"status":"success","cost_usd":1.0}`,
+	)
+	writeJobIn(t, base, "20260101-120000-bbbb", truncatedLog...)
+	writeJobIn(t, base, "20260101-110000-aaaa",
+		`{"event":"run_start","job_id":"20260101-110000-aaaa","bundle":"build","index":0,"steps":1}`,
+	)
+
+	var warn bytes.Buffer
+	jobs, err := ListJobs(base, &warn)
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].JobID != "20260101-110000-aaaa" || jobs[1].JobID != "20260101-130000-cccc" {
+		t.Fatalf("jobs = %+v, want the two readable jobs oldest first", jobs)
+	}
+	if !strings.Contains(warn.String(), "20260101-120000-bbbb") || !strings.Contains(warn.String(), "RepairJob") {
+		t.Errorf("expected a warning about the corrupt job, got %q", warn.String())
+	}
+
+	if jobs, err := ListJobs(filepath.Join(base, "missing"), nil); err != nil || len(jobs) != 0 {
+		t.Errorf("a missing workspace should list no jobs, got %v %v", jobs, err)
+	}
+}
+
+func TestRepairJob(t *testing.T) {
+	dir := writeJobIn(t, t.TempDir(), "20260101-120000-bbbb", truncatedLog...)
+	for _, name := range []string{"analyze.json", "fix.json", "report.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, "outputs", name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := RepairJob(dir)
+	if err != nil {
+		t.Fatalf("RepairJob: %v", err)
+	}
+	if s.JobID != "20260101-120000-bbbb" || s.Bundle != "review" || s.Status != "" {
+		t.Errorf("unexpected repaired summary: %+v", s)
+	}
+	want := map[string]string{"analyze": "success", "fix": "unknown", "report": "unknown"}
+	if len(s.Steps) != len(want) {
+		t.Fatalf("steps = %+v, want %v", s.Steps, want)
+	}
+	for _, step := range s.Steps {
+		if want[step.Name] != step.Status {
+			t.Errorf("step %s status = %q, want %q", step.Name, step.Status, want[step.Name])
+		}
+	}
+	if s.CostUSD != 1.5 {
+		t.Errorf("cost = %v, want 1.5 from the surviving entries", s.CostUSD)
+	}
+
+	corrupt, err := os.ReadFile(filepath.Join(dir, EventLogFile+CorruptLogSuffix))
+	if err != nil || !strings.Contains(string(corrupt), `"bundle":"rev`) {
+		t.Errorf("the damaged log should be kept, got %q %v", corrupt, err)
+	}
+	if _, err := LoadJobSummary(dir); err != nil {
+		t.Errorf("repaired job should load: %v", err)
+	}
+}
+
+func TestRepairJob_MissingLog(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "jobs", "20260101-140000-dddd")
+	if err := os.MkdirAll(filepath.Join(dir, "outputs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "outputs", "plan.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := RepairJob(dir)
+	if err != nil {
+		t.Fatalf("RepairJob: %v", err)
+	}
+	if s.JobID != "20260101-140000-dddd" || len(s.Steps) != 1 || s.Steps[0].Name != "plan" {
+		t.Errorf("unexpected summary rebuilt from outputs: %+v", s)
+	}
+}
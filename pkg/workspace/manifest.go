@@ -0,0 +1,62 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ManifestFile is the record of a finished run in its job directory
+const ManifestFile = "manifest.json"
+
+// Manifest records what a run did: the bundle and inputs it ran with, how
+// it ended, and the envelope of every step in the order they ran
+type Manifest struct {
+	JobID  string            `json:"job_id"`
+	Bundle string            `json:"bundle"`
+	Inputs map[string]string `json:"inputs,omitempty"`
+	Status string            `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Steps  []ManifestStep    `json:"steps"`
+}
+
+// ManifestStep is the part of a step's envelope kept in the manifest,
+// enough for a resumed run to reuse the step's result
+type ManifestStep struct {
+	Name       string                 `json:"name"`
+	Status     string                 `json:"status"`
+	Tool       string                 `json:"tool,omitempty"`
+	CostUSD    float64                `json:"cost_usd,omitempty"`
+	DurationMs int64                  `json:"duration_ms,omitempty"`
+	OutputRef  string                 `json:"output_ref,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Result     map[string]interface{} `json:"result,omitempty"`
+}
+
+// WriteManifest writes m to the job directory's ManifestFile, replacing any
+// earlier one
+func (w *Workspace) WriteManifest(m *Manifest) (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(w.JobDir, ManifestFile)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// LoadManifest reads the manifest of a job (an ID or a job directory)
+func LoadManifest(job string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(JobDir(job), ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("job %s: %w", job, err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("job %s: parsing %s: %w", job, ManifestFile, err)
+	}
+	return &m, nil
+}
@@ -0,0 +1,47 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// OutputStore persists step outputs. Paths are the output refs recorded in
+// step envelopes; an implementation backed by S3 or GCS can treat them as
+// object keys so a team can share a run's outputs.
+type OutputStore interface {
+	// Write stores data at path, replacing any previous content
+	Write(path string, data []byte) error
+	// Read returns the data stored at path. A missing path is reported
+	// with an error wrapping fs.ErrNotExist.
+	Read(path string) ([]byte, error)
+}
+
+// LocalStore is the default OutputStore, keeping outputs on local disk
+type LocalStore struct{}
+
+// Write writes data to the file at path, creating its directory if needed
+func (LocalStore) Write(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Read reads the file at path
+func (LocalStore) Read(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// OutputStore returns the store the workspace writes outputs to
+func (w *Workspace) OutputStore() OutputStore {
+	if w.Store != nil {
+		return w.Store
+	}
+	return LocalStore{}
+}
+
+// ReadOutput reads an output written by the workspace, such as a step's
+// output_ref, from its store
+func (w *Workspace) ReadOutput(path string) ([]byte, error) {
+	return w.OutputStore().Read(path)
+}
@@ -3,6 +3,7 @@
 package workspace
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -12,10 +13,21 @@ import (
 	"time"
 )
 
+// Step result persistence formats
+const (
+	PersistJSON = "json" // {"output": ..., "stdout": ..., "stderr": ...} object in outputs/<step>.json
+	PersistRaw  = "raw"  // Primary output as-is in outputs/<step>.txt, stderr in errors/<step>.txt
+)
+
+// EventLogFile is the newline-delimited JSON event log in every job directory
+const EventLogFile = "events.jsonl"
+
 type Workspace struct {
-	BaseDir string
-	JobID   string
-	JobDir  string
+	BaseDir       string
+	JobID         string
+	JobDir        string
+	PersistFormat string      // PersistJSON (default) or PersistRaw
+	Store         OutputStore // Where step outputs are written (nil = LocalStore)
 }
 
 // GenerateJobID creates YYYYMMDD-HHMMSS-{4 hex bytes}
@@ -29,6 +41,15 @@ func GenerateJobID() string {
 	return fmt.Sprintf("%s-%s", now.Format("20060102-150405"), hex.EncodeToString(b))
 }
 
+// DefaultBaseDir returns the workspace root, ~/.rcodegen/workspace
+func DefaultBaseDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.Getenv("HOME")
+	}
+	return filepath.Join(home, ".rcodegen", "workspace")
+}
+
 func New(baseDir string) (*Workspace, error) {
 	jobID := GenerateJobID()
 	jobDir := filepath.Join(baseDir, "jobs", jobID)
@@ -53,16 +74,49 @@ func (w *Workspace) OutputPath(stepName string) string {
 
 func (w *Workspace) WriteOutput(stepName string, data interface{}) (string, error) {
 	path := w.OutputPath(stepName)
-	f, err := os.Create(path)
-	if err != nil {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
 		return "", err
 	}
-	defer f.Close()
+	if err := w.OutputStore().Write(path, buf.Bytes()); err != nil {
+		return "", err
+	}
+	return path, nil
+}
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(data); err != nil {
+// WriteNamedOutput writes one of a step's named output files under the
+// step's own outputs directory, returning its path
+func (w *Workspace) WriteNamedOutput(stepName, file string, data []byte) (string, error) {
+	path := filepath.Join(w.JobDir, "outputs", stepName, file)
+	if err := w.OutputStore().Write(path, data); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// WriteStepResult persists a tool step's primary output (the captured
+// stream chosen by the step) and its raw stdout and stderr in the workspace's
+// PersistFormat, returning the path to use as the step's output_ref.
+func (w *Workspace) WriteStepResult(stepName, output, stdout, stderr string) (string, error) {
+	if w.PersistFormat != PersistRaw {
+		return w.WriteOutput(stepName, map[string]interface{}{
+			"output": output,
+			"stdout": stdout,
+			"stderr": stderr,
+		})
+	}
+
+	path := filepath.Join(w.JobDir, "outputs", stepName+".txt")
+	if err := w.OutputStore().Write(path, []byte(output)); err != nil {
 		return "", err
 	}
+	if stderr != "" {
+		errPath := filepath.Join(w.JobDir, "errors", stepName+".txt")
+		if err := w.OutputStore().Write(errPath, []byte(stderr)); err != nil {
+			return "", err
+		}
+	}
 	return path, nil
 }
@@ -1,6 +1,9 @@
 package workspace
 
 import (
+	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -96,3 +99,177 @@ func TestWorkspace_WriteOutput(t *testing.T) {
 		t.Errorf("output file missing expected content: %s", content)
 	}
 }
+
+func TestWorkspace_WriteStepResult_JSON(t *testing.T) {
+	ws, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	path, err := ws.WriteStepResult("report", "# Report\n", "# Report\n", "warn")
+	if err != nil {
+		t.Fatalf("WriteStepResult() error: %v", err)
+	}
+	if path != ws.OutputPath("report") {
+		t.Errorf("path = %q, want %q", path, ws.OutputPath("report"))
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read output file: %v", err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, content)
+	}
+	if got["output"] != "# Report\n" || got["stdout"] != "# Report\n" || got["stderr"] != "warn" {
+		t.Errorf("unexpected JSON content: %v", got)
+	}
+}
+
+func TestWorkspace_WriteStepResult_Raw(t *testing.T) {
+	ws, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	ws.PersistFormat = PersistRaw
+
+	path, err := ws.WriteStepResult("report", "# Report\n", "# Report\n", "warn")
+	if err != nil {
+		t.Fatalf("WriteStepResult() error: %v", err)
+	}
+	if filepath.Ext(path) != ".txt" {
+		t.Errorf("raw output should be a .txt file, got %s", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read output file: %v", err)
+	}
+	if string(content) != "# Report\n" {
+		t.Errorf("raw output = %q, want stdout as-is", content)
+	}
+
+	errContent, err := os.ReadFile(filepath.Join(ws.JobDir, "errors", "report.txt"))
+	if err != nil {
+		t.Fatalf("could not read stderr file: %v", err)
+	}
+	if string(errContent) != "warn" {
+		t.Errorf("raw stderr = %q, want %q", errContent, "warn")
+	}
+}
+
+func TestWorkspace_WriteStepResult_RawEmptyStderr(t *testing.T) {
+	ws, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	ws.PersistFormat = PersistRaw
+
+	if _, err := ws.WriteStepResult("quiet", "ok", "ok", ""); err != nil {
+		t.Fatalf("WriteStepResult() error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ws.JobDir, "errors", "quiet.txt")); !os.IsNotExist(err) {
+		t.Error("empty stderr should not create an errors file")
+	}
+}
+
+// memStore is an in-memory OutputStore standing in for a remote store
+type memStore map[string][]byte
+
+func (m memStore) Write(path string, data []byte) error {
+	m[path] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m memStore) Read(path string) ([]byte, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: path, Err: fs.ErrNotExist}
+	}
+	return data, nil
+}
+
+func TestWorkspace_OutputStore(t *testing.T) {
+	ws, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	store := memStore{}
+	ws.Store = store
+
+	path, err := ws.WriteOutput("review", map[string]string{"verdict": "ok"})
+	if err != nil {
+		t.Fatalf("WriteOutput() error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("output should go to the store, not local disk")
+	}
+	data, err := ws.ReadOutput(path)
+	if err != nil {
+		t.Fatalf("ReadOutput() error: %v", err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("stored output is not JSON: %v", err)
+	}
+	if got["verdict"] != "ok" {
+		t.Errorf("read back %v, want verdict ok", got)
+	}
+
+	ws.PersistFormat = PersistRaw
+	path, err = ws.WriteStepResult("report", "# Report\n", "# Report\n", "warn")
+	if err != nil {
+		t.Fatalf("WriteStepResult() error: %v", err)
+	}
+	if data, err := ws.ReadOutput(path); err != nil || string(data) != "# Report\n" {
+		t.Errorf("ReadOutput(%s) = %q, %v; want the raw stdout", path, data, err)
+	}
+	if data := store[filepath.Join(ws.JobDir, "errors", "report.txt")]; string(data) != "warn" {
+		t.Errorf("stored stderr = %q, want %q", data, "warn")
+	}
+}
+
+func TestLocalStore_ReadMissing(t *testing.T) {
+	_, err := LocalStore{}.Read(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Read() error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	ws, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	m := &Manifest{
+		JobID:  ws.JobID,
+		Bundle: "review",
+		Inputs: map[string]string{"codebase": "demo"},
+		Status: "failure",
+		Error:  "step build failed",
+		Steps: []ManifestStep{
+			{Name: "build", Status: "failure", Tool: "claude", CostUSD: 0.5, DurationMs: 900, Error: "exit status 1"},
+		},
+	}
+	path, err := ws.WriteManifest(m)
+	if err != nil {
+		t.Fatalf("WriteManifest: %v", err)
+	}
+	if path != filepath.Join(ws.JobDir, ManifestFile) {
+		t.Errorf("path = %s", path)
+	}
+
+	got, err := LoadManifest(ws.JobDir)
+	if err != nil {
+		t.Fatalf("LoadManifest: %v", err)
+	}
+	if got.Bundle != "review" || got.Inputs["codebase"] != "demo" || got.Error != m.Error || len(got.Steps) != 1 || got.Steps[0].Error != "exit status 1" || got.Steps[0].CostUSD != 0.5 {
+		t.Errorf("round trip = %+v, want %+v", got, m)
+	}
+
+	if _, err := LoadManifest(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a job without a manifest")
+	}
+}